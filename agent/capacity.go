@@ -5,11 +5,14 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/registration"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/klog/v2"
@@ -40,6 +43,27 @@ func GetCapacity() map[corev1.ResourceName]resource.Quantity {
 	return capacity
 }
 
+// StartCapacityResync periodically re-detects the host capacity and patches the
+// ByoHost when it changes, so hardware changes are picked up without a restart.
+// A non-positive interval disables the resync.
+func StartCapacityResync(interval time.Duration, hostName, namespace string) {
+	if interval <= 0 {
+		klog.Info("Capacity resync disabled")
+		return
+	}
+	klog.Infof("Starting capacity resync every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := registration.LocalHostRegistrar.SyncCapacity(context.TODO(), hostName, namespace, GetCapacity()); err != nil {
+				klog.Errorf("Failed to resync host capacity: %v", err)
+			}
+		}
+	}()
+}
+
 // getMemoryBytes reads MemTotal from /proc/meminfo and returns bytes
 func getMemoryBytes() (int64, error) {
 	file, err := os.Open("/proc/meminfo")
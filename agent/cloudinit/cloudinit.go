@@ -24,6 +24,7 @@ type ScriptExecutor struct {
 	Hostname              string
 	Labels                map[string]string
 	Taints                []corev1.Taint
+	NodeIP                string
 }
 
 type bootstrapConfig struct {
@@ -118,6 +119,14 @@ func (se ScriptExecutor) Execute(ctx context.Context, bootstrapScript string) er
 						}
 					}
 
+					// Inject node-ip of the default interface, multi-NIC hosts would otherwise
+					// register with whatever IP kubelet picks
+					if se.NodeIP != "" {
+						if _, exists := extraArgs["node-ip"]; !exists {
+							extraArgs["node-ip"] = se.NodeIP
+						}
+					}
+
 					nodeReg["kubeletExtraArgs"] = extraArgs
 					config["nodeRegistration"] = nodeReg
 
@@ -158,5 +158,41 @@ runCmd:
 
 			Expect(err.Error()).To(ContainSubstring("command execution failed"))
 		})
+
+		It("should inject the node IP into the kubelet args of the kubeadm config", func() {
+			fakeTemplateParser.ParseTemplateStub = func(content string) (string, error) { return content, nil }
+			scriptExecutor.Hostname = "test-host"
+			scriptExecutor.NodeIP = "10.0.0.5"
+			bootstrapScript := fmt.Sprintf(`write_files:
+- path: %s/kubeadm-join-config.yaml
+  content: |
+    apiVersion: kubeadm.k8s.io/v1beta3
+    kind: JoinConfiguration
+    nodeRegistration:
+      name: test-host`, workDir)
+
+			Expect(scriptExecutor.Execute(context.Background(), bootstrapScript)).To(Succeed())
+
+			Expect(fakeFileWriter.WriteToFileCallCount()).To(Equal(1))
+			Expect(fakeFileWriter.WriteToFileArgsForCall(0).Content).To(ContainSubstring("node-ip: 10.0.0.5"))
+		})
+
+		It("should keep a node IP already set in the kubeadm config", func() {
+			fakeTemplateParser.ParseTemplateStub = func(content string) (string, error) { return content, nil }
+			scriptExecutor.Hostname = "test-host"
+			scriptExecutor.NodeIP = "10.0.0.5"
+			bootstrapScript := fmt.Sprintf(`write_files:
+- path: %s/kubeadm-join-config.yaml
+  content: |
+    nodeRegistration:
+      kubeletExtraArgs:
+        node-ip: 192.168.0.5`, workDir)
+
+			Expect(scriptExecutor.Execute(context.Background(), bootstrapScript)).To(Succeed())
+
+			content := fakeFileWriter.WriteToFileArgsForCall(0).Content
+			Expect(content).To(ContainSubstring("node-ip: 192.168.0.5"))
+			Expect(content).NotTo(ContainSubstring("10.0.0.5"))
+		})
 	})
 })
@@ -5,21 +5,17 @@ package cloudinit
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"regexp"
 	"strings"
+	"unicode"
 )
 
-const (
-	// MaxCommandLength is the maximum allowed length for a command
-	MaxCommandLength = 4096
-)
-
-var (
-	// dangerousPattern matches potentially dangerous shell characters
-	dangerousPattern = regexp.MustCompile(`[;&|$\` + "`" + `]`)
-)
+// ErrCommandRefused is returned when a command does not match any of the allowed command patterns
+var ErrCommandRefused = errors.New("command refused")
 
 //counterfeiter:generate . ICmdRunner
 type ICmdRunner interface {
@@ -28,23 +24,23 @@ type ICmdRunner interface {
 
 // CmdRunner default implementer of ICmdRunner
 type CmdRunner struct {
+	// AllowedCommands restricts the commands run to those matching one of the patterns, e.g. to only
+	// let the install scripts of the controller run. Every statement of a command, i.e. every line or
+	// part separated by ;, &, |, && or ||, must match a pattern as a whole, and commands substituting
+	// other commands are refused. Any command is run when empty, the scripts and bootstrap commands come
+	// from the management cluster and are trusted like the agent itself.
+	AllowedCommands []*regexp.Regexp
 }
 
-// RunCmd executes the command string with security enhancements
+// RunCmd executes the command string with bash. A command not matching the AllowedCommands is not run
+// and an ErrCommandRefused error is returned.
 func (r CmdRunner) RunCmd(ctx context.Context, cmd string) error {
-	// Validate command is not empty
 	if strings.TrimSpace(cmd) == "" {
 		return nil
 	}
 
-	// Validate command length
-	if len(cmd) > MaxCommandLength {
-		return nil
-	}
-
-	// Check for potentially dangerous patterns
-	if dangerousPattern.MatchString(cmd) {
-		return nil
+	if err := r.allowed(cmd); err != nil {
+		return err
 	}
 
 	// Use exec.CommandContext with the provided context for proper cancellation
@@ -57,3 +53,110 @@ func (r CmdRunner) RunCmd(ctx context.Context, cmd string) error {
 	}
 	return nil
 }
+
+// allowed returns an ErrCommandRefused error unless every statement of the command matches one of the
+// AllowedCommands as a whole, or none is configured
+func (r CmdRunner) allowed(cmd string) error {
+	if len(r.AllowedCommands) == 0 {
+		return nil
+	}
+	statements, err := splitStatements(cmd)
+	if err != nil {
+		return fmt.Errorf("%w: %q %v", ErrCommandRefused, firstLine(cmd), err)
+	}
+	patterns := make([]*regexp.Regexp, 0, len(r.AllowedCommands))
+	for _, pattern := range r.AllowedCommands {
+		patterns = append(patterns, regexp.MustCompile(`^(?:`+pattern.String()+`)$`))
+	}
+	for _, statement := range statements {
+		if !matchesAny(patterns, statement) {
+			return fmt.Errorf("%w: %q matches none of the allowed command patterns", ErrCommandRefused, statement)
+		}
+	}
+	return nil
+}
+
+func matchesAny(patterns []*regexp.Regexp, statement string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(statement) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitStatements splits the command into the statements bash runs, at the line breaks and the ;, &, |, &&
+// and || outside of quotes, dropping comments and empty statements. Commands whose statements cannot be told
+// apart, substituting other commands with $(...), `...`, <(...) or >(...) or with unterminated quotes, are
+// returned an error.
+func splitStatements(cmd string) ([]string, error) {
+	var (
+		statements       []string
+		current          strings.Builder
+		single, double   bool
+		comment, escaped bool
+	)
+	flush := func() {
+		if statement := strings.TrimSpace(current.String()); statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+	runes := []rune(strings.ReplaceAll(cmd, "\\\n", ""))
+	for i, c := range runes {
+		var prev, next rune
+		if i > 0 {
+			prev = runes[i-1]
+		}
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		switch {
+		case comment:
+			if c == '\n' {
+				comment = false
+				flush()
+			}
+			continue
+		case escaped:
+			escaped = false
+		case single:
+			single = c != '\''
+		case c == '\\':
+			escaped = true
+		case c == '`' || c == '$' && next == '(':
+			return nil, errors.New("substitutes commands")
+		case double:
+			double = c != '"'
+		case (c == '<' || c == '>') && next == '(':
+			return nil, errors.New("substitutes commands")
+		case c == '\'':
+			single = true
+		case c == '"':
+			double = true
+		case c == '#' && (prev == 0 || unicode.IsSpace(prev)):
+			comment = true
+			continue
+		case c == '&' && (prev == '>' || prev == '<' || next == '>'):
+			// A redirection, e.g. 2>&1 or &>/dev/null
+		case c == '\n' || c == ';' || c == '&' || c == '|':
+			flush()
+			continue
+		}
+		current.WriteRune(c)
+	}
+	if single || double {
+		return nil, errors.New("has unterminated quotes")
+	}
+	flush()
+	return statements, nil
+}
+
+// firstLine returns the first line of the command to name it in errors, without dumping whole scripts
+func firstLine(cmd string) string {
+	line, _, multiline := strings.Cut(strings.TrimSpace(cmd), "\n")
+	if multiline {
+		return line + " ..."
+	}
+	return line
+}
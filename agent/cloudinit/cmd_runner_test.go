@@ -0,0 +1,121 @@
+// Copyright 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/cloudinit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CmdRunner", func() {
+
+	var (
+		workDir string
+		output  string
+		err     error
+	)
+
+	BeforeEach(func() {
+		workDir, err = os.MkdirTemp("", "cmd_runner_ut")
+		Expect(err).NotTo(HaveOccurred())
+		output = path.Join(workDir, "output")
+	})
+
+	AfterEach(func() {
+		err := os.RemoveAll(workDir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should run a multi-line script with shell operators", func() {
+		script := `set -e
+GREETING=hello
+echo "$GREETING world" | tr a-z A-Z > ` + output + ` && echo done >> ` + output + `; true
+`
+		Expect(cloudinit.CmdRunner{}.RunCmd(context.TODO(), script)).To(Succeed())
+
+		content, err := os.ReadFile(output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("HELLO WORLD\ndone\n"))
+	})
+
+	It("Should return the error of a failing command", func() {
+		Expect(cloudinit.CmdRunner{}.RunCmd(context.TODO(), "exit 3")).NotTo(Succeed())
+	})
+
+	It("Should run a command matching an allowed command pattern", func() {
+		runner := cloudinit.CmdRunner{AllowedCommands: []*regexp.Regexp{regexp.MustCompile(`touch \S+`)}}
+		Expect(runner.RunCmd(context.TODO(), "touch "+output)).To(Succeed())
+		Expect(output).To(BeAnExistingFile())
+	})
+
+	It("Should run a script whose statements all match an allowed command pattern", func() {
+		runner := cloudinit.CmdRunner{AllowedCommands: []*regexp.Regexp{
+			regexp.MustCompile(`touch \S+`),
+			regexp.MustCompile(`echo [a-z]+ >> \S+ 2>&1`),
+		}}
+		script := "# create the file\ntouch " + output + " && echo done >> " + output + " 2>&1\n"
+		Expect(runner.RunCmd(context.TODO(), script)).To(Succeed())
+
+		content, err := os.ReadFile(output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("done\n"))
+	})
+
+	It("Should refuse a command matching no allowed command pattern with an error", func() {
+		runner := cloudinit.CmdRunner{AllowedCommands: []*regexp.Regexp{regexp.MustCompile(`systemctl .*`)}}
+		err := runner.RunCmd(context.TODO(), "touch "+output+"\necho refused")
+
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, cloudinit.ErrCommandRefused)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring(`"touch ` + output + `"`))
+		Expect(output).NotTo(BeAnExistingFile())
+	})
+
+	It("Should refuse a command chaining a statement matching no allowed command pattern", func() {
+		runner := cloudinit.CmdRunner{AllowedCommands: []*regexp.Regexp{regexp.MustCompile(`^systemctl `), regexp.MustCompile(`systemctl \S+`)}}
+		for _, cmd := range []string{
+			"systemctl x\ntouch " + output,
+			"systemctl x; touch " + output,
+			"systemctl x && touch " + output,
+			"systemctl x | touch " + output,
+			"systemctl x & touch " + output,
+			"systemctl x \\\n; touch " + output,
+		} {
+			err := runner.RunCmd(context.TODO(), cmd)
+			Expect(errors.Is(err, cloudinit.ErrCommandRefused)).To(BeTrue(), cmd)
+			Expect(err.Error()).To(ContainSubstring(`"touch `+output+`"`), cmd)
+		}
+		Expect(output).NotTo(BeAnExistingFile())
+	})
+
+	It("Should refuse a command substituting other commands", func() {
+		runner := cloudinit.CmdRunner{AllowedCommands: []*regexp.Regexp{regexp.MustCompile(`systemctl .*`)}}
+		for _, cmd := range []string{
+			"systemctl $(touch " + output + ")",
+			"systemctl `touch " + output + "`",
+			`systemctl "$(touch ` + output + `)"`,
+			"systemctl <(touch " + output + ")",
+			"systemctl 'x",
+		} {
+			Expect(errors.Is(runner.RunCmd(context.TODO(), cmd), cloudinit.ErrCommandRefused)).To(BeTrue(), cmd)
+		}
+		Expect(output).NotTo(BeAnExistingFile())
+	})
+
+	It("Should not split statements at separators inside quotes", func() {
+		runner := cloudinit.CmdRunner{AllowedCommands: []*regexp.Regexp{regexp.MustCompile(`echo '[^']*' > \S+`)}}
+		Expect(runner.RunCmd(context.TODO(), "echo 'a; b | c' > "+output)).To(Succeed())
+
+		content, err := os.ReadFile(output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("a; b | c\n"))
+	})
+})
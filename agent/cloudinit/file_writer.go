@@ -8,6 +8,7 @@ import (
 	"io/fs"
 	"os"
 	"os/user"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -29,10 +30,31 @@ type IFileWriter interface {
 
 // FileWriter default implementation of IFileWriter
 type FileWriter struct {
+	// RootDir, when set, is prefixed to every path the writer creates or writes,
+	// e.g. the root of a filesystem image being built. Paths are written as is when empty.
+	RootDir string
+}
+
+// Rebase returns the path prefixed with the root directory of the writer
+func (w FileWriter) Rebase(path string) string {
+	if w.RootDir == "" {
+		return path
+	}
+	return filepath.Join(w.RootDir, path)
+}
+
+// HostPath returns where the writer puts the file of a host path, so the files it writes are read and
+// removed at the same place. Writers without a Rebase method, e.g. fakes, use the path as is.
+func HostPath(w IFileWriter, path string) string {
+	if rebaser, ok := w.(interface{ Rebase(string) string }); ok {
+		return rebaser.Rebase(path)
+	}
+	return path
 }
 
 // MkdirIfNotExists creates the directory if it does not exist already
 func (w FileWriter) MkdirIfNotExists(dirName string) error {
+	dirName = w.Rebase(dirName)
 	_, err := os.Stat(dirName)
 
 	if os.IsNotExist(err) {
@@ -46,26 +68,58 @@ func (w FileWriter) MkdirIfNotExists(dirName string) error {
 }
 
 // WriteToFile writes contents to file with appropriate permissions
-// as provided in the write_files directive of cloud-config file
+// as provided in the write_files directive of cloud-config file.
+// A file is replaced atomically: the contents are written to a temporary file
+// next to it, which is renamed over the target once complete. An interrupted
+// write therefore never leaves a truncated file, e.g. a kubeconfig, behind.
 func (w FileWriter) WriteToFile(file *Files) error {
+	filePath := w.Rebase(file.Path)
 	initPermission := fs.FileMode(filePermission)
-	if stats, err := os.Stat(file.Path); os.IsExist(err) {
+	if stats, err := os.Stat(filePath); err == nil {
 		initPermission = stats.Mode()
 	}
 
-	flag := os.O_WRONLY | os.O_CREATE
 	if file.Append {
-		flag |= os.O_APPEND
-	} else {
-		flag |= os.O_TRUNC
+		f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, initPermission)
+		if err != nil {
+			return err
+		}
+		if err := writeFileContent(f, file); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
 	}
 
-	f, err := os.OpenFile(file.Path, flag, initPermission)
+	f, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp-")
 	if err != nil {
 		return err
 	}
+	tmpPath := f.Name()
+	// The target keeps its contents unless the rename below succeeds
+	defer func() { _ = os.Remove(tmpPath) }()
+
+	if err := f.Chmod(initPermission); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := writeFileContent(f, file); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
 
-	_, err = f.WriteString(file.Content)
+// writeFileContent writes the contents of the file and applies its permissions and owner
+func writeFileContent(f *os.File, file *Files) error {
+	_, err := f.WriteString(file.Content)
 	if err != nil {
 		return err
 	}
@@ -105,9 +159,19 @@ func (w FileWriter) WriteToFile(file *Files) error {
 			return errors.Wrap(err, fmt.Sprintf("Error convert uid %s", userInfo.Uid))
 		}
 
-		gid, err := strconv.ParseUint(userInfo.Gid, base, bitSize)
+		// Use the primary group of the user unless a group is given explicitly
+		groupID := userInfo.Gid
+		if len(owner[1]) > 0 {
+			groupInfo, err := user.LookupGroup(owner[1])
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("Error Lookup group %s", owner[1]))
+			}
+			groupID = groupInfo.Gid
+		}
+
+		gid, err := strconv.ParseUint(groupID, base, bitSize)
 		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("Error convert gid %s", userInfo.Gid))
+			return errors.Wrap(err, fmt.Sprintf("Error convert gid %s", groupID))
 		}
 
 		err = f.Chown(int(uid), int(gid))
@@ -116,5 +180,5 @@ func (w FileWriter) WriteToFile(file *Files) error {
 		}
 	}
 
-	return f.Close()
+	return nil
 }
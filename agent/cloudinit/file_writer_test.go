@@ -6,10 +6,13 @@ package cloudinit_test
 import (
 	"io/fs"
 	"os"
+	"os/user"
 	"path"
 	"strconv"
+	"syscall"
 
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/cloudinit"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/cloudinit/cloudinitfakes"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -130,4 +133,151 @@ var _ = Describe("FileWriter", func() {
 		err = cloudinit.FileWriter{}.WriteToFile(&file)
 		Expect(err).To(MatchError("Error Lookup user some: user: unknown user some"))
 	})
+
+	It("should apply the configured user and group as owner", func() {
+		currentUser, err := user.Current()
+		Expect(err).NotTo(HaveOccurred())
+		currentGroup, err := user.LookupGroupId(currentUser.Gid)
+		Expect(err).NotTo(HaveOccurred())
+
+		file := cloudinit.Files{
+			Path:        path.Join(workDir, "file1.txt"),
+			Owner:       currentUser.Username + ":" + currentGroup.Name,
+			Permissions: "0600",
+			Content:     "some-content",
+		}
+		err = cloudinit.FileWriter{}.WriteToFile(&file)
+		Expect(err).NotTo(HaveOccurred())
+
+		stats, err := os.Stat(file.Path)
+		Expect(err).NotTo(HaveOccurred())
+		stat, ok := stats.Sys().(*syscall.Stat_t)
+		Expect(ok).To(BeTrue())
+		Expect(strconv.FormatUint(uint64(stat.Uid), 10)).To(Equal(currentUser.Uid))
+		Expect(strconv.FormatUint(uint64(stat.Gid), 10)).To(Equal(currentGroup.Gid))
+	})
+
+	It("should return error with unknown group", func() {
+		currentUser, err := user.Current()
+		Expect(err).NotTo(HaveOccurred())
+
+		file := cloudinit.Files{
+			Path:    path.Join(workDir, "file1.txt"),
+			Owner:   currentUser.Username + ":some-random-group",
+			Content: "some-content",
+		}
+		err = cloudinit.FileWriter{}.WriteToFile(&file)
+		Expect(err).To(MatchError(ContainSubstring("Error Lookup group some-random-group")))
+	})
+
+	Context("When replacing an existing file", func() {
+		var filePath string
+
+		BeforeEach(func() {
+			filePath = path.Join(workDir, "kubeconfig")
+			Expect(os.WriteFile(filePath, []byte("original-content"), 0600)).To(Succeed())
+		})
+
+		expectOnlyOriginalFile := func() {
+			buffer, err := os.ReadFile(filePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buffer)).To(Equal("original-content"))
+
+			entries, err := os.ReadDir(workDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		}
+
+		It("should replace the contents and keep the file mode", func() {
+			err := cloudinit.FileWriter{}.WriteToFile(&cloudinit.Files{Path: filePath, Content: "new-content"})
+			Expect(err).NotTo(HaveOccurred())
+
+			buffer, err := os.ReadFile(filePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buffer)).To(Equal("new-content"))
+
+			stats, err := os.Stat(filePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Mode()).To(Equal(fs.FileMode(0600)))
+
+			entries, err := os.ReadDir(workDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+
+		It("should leave the original file intact when applying the permissions fails", func() {
+			err := cloudinit.FileWriter{}.WriteToFile(&cloudinit.Files{Path: filePath, Content: "new-content", Permissions: "invalid"})
+			Expect(err).To(MatchError(ContainSubstring("Error parse the file permission invalid")))
+			expectOnlyOriginalFile()
+		})
+
+		It("should leave the original file intact when applying the owner fails", func() {
+			err := cloudinit.FileWriter{}.WriteToFile(&cloudinit.Files{Path: filePath, Content: "new-content", Owner: "some:random"})
+			Expect(err).To(HaveOccurred())
+			expectOnlyOriginalFile()
+		})
+	})
+
+	Context("When a root directory is set", func() {
+		var writer cloudinit.FileWriter
+
+		BeforeEach(func() {
+			writer = cloudinit.FileWriter{RootDir: workDir}
+		})
+
+		It("should create the directory under the root directory", func() {
+			err := writer.MkdirIfNotExists("/etc/kubernetes/pki")
+			Expect(err).NotTo(HaveOccurred())
+
+			stats, err := os.Stat(path.Join(workDir, "etc", "kubernetes", "pki"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.IsDir()).To(BeTrue())
+		})
+
+		It("should write the file under the root directory", func() {
+			err := writer.MkdirIfNotExists("/etc/kubernetes")
+			Expect(err).NotTo(HaveOccurred())
+
+			err = writer.WriteToFile(&cloudinit.Files{Path: "/etc/kubernetes/kubelet.conf", Content: "some-content", Permissions: "0600"})
+			Expect(err).NotTo(HaveOccurred())
+
+			rebasedPath := path.Join(workDir, "etc", "kubernetes", "kubelet.conf")
+			buffer, err := os.ReadFile(rebasedPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buffer)).To(Equal("some-content"))
+
+			stats, err := os.Stat(rebasedPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Mode()).To(Equal(fs.FileMode(0600)))
+
+			entries, err := os.ReadDir(path.Join(workDir, "etc", "kubernetes"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+
+		It("should append to the file under the root directory", func() {
+			Expect(os.WriteFile(path.Join(workDir, "file.txt"), []byte("some-content-1"), 0644)).To(Succeed())
+
+			err := writer.WriteToFile(&cloudinit.Files{Path: "/file.txt", Content: "some-content-2", Append: true})
+			Expect(err).NotTo(HaveOccurred())
+
+			buffer, err := os.ReadFile(path.Join(workDir, "file.txt"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buffer)).To(Equal("some-content-1some-content-2"))
+		})
+
+		It("should fail when the rebased parent directory does not exist", func() {
+			err := writer.WriteToFile(&cloudinit.Files{Path: "/missing/file.txt", Content: "some-content"})
+			Expect(err).To(HaveOccurred())
+
+			_, err = os.Stat("/missing/file.txt")
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("should resolve the host paths under the root directory", func() {
+			Expect(cloudinit.HostPath(writer, "/etc/kubernetes/kubelet.conf")).To(Equal(path.Join(workDir, "etc", "kubernetes", "kubelet.conf")))
+			Expect(cloudinit.HostPath(cloudinit.FileWriter{}, "/etc/kubernetes/kubelet.conf")).To(Equal("/etc/kubernetes/kubelet.conf"))
+			Expect(cloudinit.HostPath(&cloudinitfakes.FakeIFileWriter{}, "/etc/kubernetes/kubelet.conf")).To(Equal("/etc/kubernetes/kubelet.conf"))
+		})
+	})
 })
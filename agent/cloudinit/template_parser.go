@@ -16,11 +16,13 @@ type ITemplateParser interface {
 // TemplateParser cloudinit templates parsing using ITemplateParser
 type TemplateParser struct {
 	Template interface{}
+	// Options are text/template options applied before parsing, e.g. missingkey=error
+	Options []string
 }
 
 // ParseTemplate parses and returns the parsed template content
 func (tp TemplateParser) ParseTemplate(templateContent string) (string, error) {
-	tmpl, err := template.New("byoh").Parse(templateContent)
+	tmpl, err := template.New("byoh").Option(tp.Options...).Parse(templateContent)
 	if err != nil {
 		return templateContent, err
 	}
@@ -4,33 +4,41 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
 	"time"
 
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/cloudinit"
 	"k8s.io/klog/v2"
 )
 
-// StartDriftDetector starts the periodic drift detection loop
-func StartDriftDetector(interval time.Duration) {
+// DefaultDriftServices are the services the drift detector keeps active and enabled by default
+var DefaultDriftServices = []string{"containerd", "kubelet"}
+
+// StartDriftDetector starts the periodic drift detection loop.
+// containerRuntimeEndpoint is the CRI endpoint checked for health, the crictl default is used when empty.
+// services are kept active and enabled for boot, so a rebooted host does not lose them.
+func StartDriftDetector(interval time.Duration, containerRuntimeEndpoint string, services []string) {
 	klog.Info("Starting Drift Detector")
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
 		for range ticker.C {
-			checkAndRemediate()
+			checkAndRemediate(containerRuntimeEndpoint, services)
 		}
 	}()
 }
 
-func checkAndRemediate() {
+func checkAndRemediate(containerRuntimeEndpoint string, services []string) {
 	checkSwap()
 	checkKernelModules()
 	checkIPForwarding()
-	checkServices()
+	checkServices(context.Background(), cloudinit.CmdRunner{}, services)
+	checkContainerRuntime(containerRuntimeEndpoint)
 	checkSysctl()
 }
 
@@ -121,13 +129,22 @@ func checkIPForwarding() {
 	}
 }
 
-func checkServices() {
-	services := []string{"containerd", "kubelet"}
+// checkServices enables the services disabled for boot and starts the inactive ones
+func checkServices(ctx context.Context, runner cloudinit.ICmdRunner, services []string) {
 	for _, svc := range services {
+		// Check if enabled, a service only started would not come back after a reboot
+		if err := runner.RunCmd(ctx, "systemctl is-enabled --quiet "+svc); err != nil {
+			klog.Warningf("Drift: Service %s is not enabled. Remediating...", svc)
+			if err := runner.RunCmd(ctx, "systemctl enable "+svc); err != nil {
+				klog.Errorf("Drift: Failed to enable service %s: %v", svc, err)
+			} else {
+				klog.Infof("Drift: Service %s enabled successfully", svc)
+			}
+		}
 		// Check if active
-		if err := exec.Command("systemctl", "is-active", "--quiet", svc).Run(); err != nil {
+		if err := runner.RunCmd(ctx, "systemctl is-active --quiet "+svc); err != nil {
 			klog.Warningf("Drift: Service %s is not active. Remediating...", svc)
-			if err := exec.Command("systemctl", "start", svc).Run(); err != nil {
+			if err := runner.RunCmd(ctx, "systemctl start "+svc); err != nil {
 				klog.Errorf("Drift: Failed to start service %s: %v", svc, err)
 			} else {
 				klog.Infof("Drift: Service %s started successfully", svc)
@@ -135,3 +152,17 @@ func checkServices() {
 		}
 	}
 }
+
+func checkContainerRuntime(endpoint string) {
+	args := []string{"info"}
+	if endpoint != "" {
+		args = append([]string{"--runtime-endpoint", endpoint}, args...)
+	}
+	// crictl is installed together with the k8s components, nothing to check before that
+	if _, err := exec.LookPath("crictl"); err != nil {
+		return
+	}
+	if out, err := exec.Command("crictl", args...).CombinedOutput(); err != nil {
+		klog.Warningf("Drift: Container runtime at %q is not healthy: %v: %s", endpoint, err, strings.TrimSpace(string(out)))
+	}
+}
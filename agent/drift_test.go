@@ -0,0 +1,83 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// nolint: nolintlint,testpackage
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/cloudinit/cloudinitfakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Drift detector", func() {
+	Context("When checking the services", func() {
+		var (
+			cmdRunner *cloudinitfakes.FakeICmdRunner
+			failing   map[string]bool
+		)
+
+		BeforeEach(func() {
+			failing = map[string]bool{}
+			cmdRunner = &cloudinitfakes.FakeICmdRunner{}
+			cmdRunner.RunCmdStub = func(_ context.Context, cmd string) error {
+				if failing[cmd] {
+					return errors.New("exit status 1")
+				}
+				return nil
+			}
+		})
+
+		runCmds := func() []string {
+			var cmds []string
+			for i := 0; i < cmdRunner.RunCmdCallCount(); i++ {
+				_, cmd := cmdRunner.RunCmdArgsForCall(i)
+				cmds = append(cmds, cmd)
+			}
+			return cmds
+		}
+
+		It("should leave enabled and active services alone", func() {
+			checkServices(context.TODO(), cmdRunner, []string{"kubelet"})
+
+			Expect(runCmds()).To(Equal([]string{
+				"systemctl is-enabled --quiet kubelet",
+				"systemctl is-active --quiet kubelet",
+			}))
+		})
+
+		It("should enable a service disabled for boot", func() {
+			failing["systemctl is-enabled --quiet kubelet"] = true
+
+			checkServices(context.TODO(), cmdRunner, []string{"containerd", "kubelet"})
+
+			Expect(runCmds()).To(ContainElement("systemctl enable kubelet"))
+			Expect(runCmds()).NotTo(ContainElement("systemctl enable containerd"))
+			Expect(runCmds()).NotTo(ContainElement(HavePrefix("systemctl start")))
+		})
+
+		It("should start an inactive service even when enabling it fails", func() {
+			failing["systemctl is-enabled --quiet kubelet"] = true
+			failing["systemctl enable kubelet"] = true
+			failing["systemctl is-active --quiet kubelet"] = true
+
+			checkServices(context.TODO(), cmdRunner, []string{"kubelet"})
+
+			Expect(runCmds()).To(Equal([]string{
+				"systemctl is-enabled --quiet kubelet",
+				"systemctl enable kubelet",
+				"systemctl is-active --quiet kubelet",
+				"systemctl start kubelet",
+			}))
+		})
+
+		It("should check only the configured services", func() {
+			checkServices(context.TODO(), cmdRunner, []string{"crio"})
+
+			Expect(runCmds()).To(HaveEach(HaveSuffix(" crio")))
+		})
+	})
+})
@@ -0,0 +1,46 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/registration"
+	"k8s.io/klog/v2"
+)
+
+// StartFactsPublisher publishes the facts of the host as a ConfigMap in the namespace for inventory
+// tools, then periodically re-detects them and updates the ConfigMap when they change.
+// An empty namespace disables the publishing, a non-positive interval only publishes once.
+func StartFactsPublisher(interval time.Duration, hostName, namespace string) {
+	if namespace == "" {
+		klog.Info("Host facts publishing disabled")
+		return
+	}
+	klog.Infof("Publishing host facts in namespace %s", namespace)
+	publishFacts(hostName, namespace)
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			publishFacts(hostName, namespace)
+		}
+	}()
+}
+
+func publishFacts(hostName, namespace string) {
+	facts, err := registration.LocalHostRegistrar.HostFacts(GetCapacity())
+	if err != nil {
+		klog.Errorf("Failed to collect host facts: %v", err)
+		return
+	}
+	if _, err := registration.LocalHostRegistrar.SyncFacts(context.TODO(), hostName, namespace, facts); err != nil {
+		klog.Errorf("Failed to publish host facts: %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/registration"
+	"k8s.io/klog/v2"
+)
+
+// StartHeartbeat periodically bumps the heartbeat time of the ByoHost, so the controller does not
+// take a running agent whose host does not change for gone. A non-positive interval disables it.
+func StartHeartbeat(interval time.Duration, hostName, namespace string) {
+	if interval <= 0 {
+		klog.Info("Heartbeat disabled")
+		return
+	}
+	klog.Infof("Starting heartbeat every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := registration.LocalHostRegistrar.Heartbeat(context.TODO(), hostName, namespace); err != nil {
+				klog.Errorf("Failed to send heartbeat: %v", err)
+			}
+		}
+	}()
+}
@@ -12,6 +12,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -21,11 +22,13 @@ import (
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/registration"
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/version"
 	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common/kubeletconfig"
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/feature"
 	pflag "github.com/spf13/pflag"
 
 	certv1 "k8s.io/api/certificates/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/rest"
@@ -85,6 +88,56 @@ func (l *labelFlags) Set(value string) error {
 	}
 }
 
+// allowedCommandFlags is a flag that holds the regular expressions of the commands the agent may run.
+// The flag can be repeated, a single invocation holds one pattern:
+//
+//	-allowed-command "systemctl .*" -allowed-command "kubeadm join .*"
+type allowedCommandFlags []*regexp.Regexp
+
+// String implements flag.Value interface
+func (a *allowedCommandFlags) String() string {
+	patterns := make([]string, 0, len(*a))
+	for _, pattern := range *a {
+		patterns = append(patterns, pattern.String())
+	}
+	return strings.Join(patterns, ",")
+}
+
+// Set implements flag.Value interface
+func (a *allowedCommandFlags) Set(value string) error {
+	pattern, err := regexp.Compile(value)
+	if err != nil {
+		return fmt.Errorf("invalid command pattern %s: %w", value, err)
+	}
+	*a = append(*a, pattern)
+	return nil
+}
+
+// serviceDirectiveFlags is a flag that holds systemd directives in the form Key=Value.
+// The flag can be repeated, a single invocation holds one directive as values may contain commas:
+//
+//	-systemd-service-directive "NoNewPrivileges=yes" -systemd-service-directive "LimitNOFILE=1048576"
+type serviceDirectiveFlags []string
+
+// String implements flag.Value interface
+func (d *serviceDirectiveFlags) String() string {
+	return strings.Join(*d, ",")
+}
+
+// Set implements flag.Value interface
+func (d *serviceDirectiveFlags) Set(value string) error {
+	key, _, found := strings.Cut(value, "=")
+	key = strings.TrimSpace(key)
+	if !found || key == "" {
+		return fmt.Errorf("invalid argument value. expect Key=Value, got %s", value)
+	}
+	if key == "ExecStart" {
+		return fmt.Errorf("ExecStart of the kubelet and kube-proxy units can not be overridden")
+	}
+	*d = append(*d, value)
+	return nil
+}
+
 func setupflags() {
 	klog.InitFlags(nil)
 	// clear any discard loggers set by dependecies
@@ -95,9 +148,47 @@ func setupflags() {
 	flag.Var(&labels, "label", "labels to attach to the ByoHost CR in the form labelname=labelVal for e.g. '--label site=apac --label cores=2'")
 	flag.StringVar(&metricsbindaddress, "metricsbindaddress", ":8080", "metricsbindaddress is the TCP address that the controller should bind to for serving prometheus metrics.It can be set to \"0\" to disable the metrics serving")
 	flag.StringVar(&downloadpath, "downloadpath", "/var/lib/byoh/bundles", "File System path to keep the downloads")
+	flag.StringVar(&bundleCachePath, "bundle-cache-path", "", "Optional, possibly read-only and shared, directory of bundles laid out as <path>/<bundle address>. Offline installs copy a cached bundle instead of pulling it")
 	flag.BoolVar(&skipInstallation, "skip-installation", false, "If you want to skip installation of the kubernetes component binaries")
 	flag.BoolVar(&printVersion, "version", false, "Print the version of the agent")
 	flag.StringVar(&bootstrapKubeConfig, "bootstrap-kubeconfig", "", "Provide bootstrap kubeconfig for bootstrap token workflow")
+	flag.StringVar(&fileOwner, "file-owner", "", "Owner in the form user:group applied to the CA certificates and kubeconfigs written in TLS Bootstrap mode")
+	flag.StringVar(&driftServices, "drift-services", strings.Join(DefaultDriftServices, ","), "Comma separated systemd services the drift detector keeps active and enabled for boot")
+	flag.StringVar(&postBootstrapRemoveTaints, "post-bootstrap-remove-taints", "", "Comma separated taints, as key or key:Effect, removed from the node once it is bootstrapped")
+	flag.StringVar(&containerRuntimeEndpoint, "container-runtime-endpoint", "", "CRI endpoint used by kubelet, kubeadm reset and the runtime health check, e.g. unix:///run/containerd/containerd.sock. Their defaults are used when empty")
+	flag.StringVar(&clusterDNS, "cluster-dns", kubeletconfig.NodeLocalDNSAddress, "IP of the cluster DNS in the default kubelet configuration, the NodeLocal DNSCache address by default")
+	flag.StringVar(&clusterDomain, "cluster-domain", kubeletconfig.DefaultClusterDomain, "DNS domain of the cluster in the default kubelet configuration")
+	flag.StringVar(&kubeletHealthzBindAddress, "kubelet-healthz-bind-address", kubeletconfig.DefaultHealthzBindAddress, "Address the kubelet healthz endpoint binds to in the default kubelet configuration")
+	flag.StringVar(&kubeletEvictionHard, "kubelet-eviction-hard", "", "Comma separated hard eviction thresholds, e.g. memory.available=200Mi,nodefs.available=5%, overriding the ones of the default kubelet configuration")
+	flag.IntVar(&kubeletLogVerbosity, "kubelet-log-verbosity", 0, "Verbosity of the kubelet logs in TLS Bootstrap mode, overridden by the kubeletLogVerbosity of the ByoHost")
+	flag.StringVar(&kubeletTLSMinVersion, "kubelet-tls-min-version", "", "Minimum TLS version of the kubelet server in TLS Bootstrap mode, e.g. VersionTLS12, overridden by the kubeletTLSMinVersion of the ByoHost")
+	flag.StringVar(&kubeletTLSCipherSuites, "kubelet-tls-cipher-suites", "", "Comma separated cipher suites of the kubelet server in TLS Bootstrap mode, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, overridden by the kubeletTLSCipherSuites of the ByoHost")
+	flag.IntVar(&kubeletHealthzPort, "kubelet-healthz-port", kubeletconfig.DefaultHealthzPort, "Port of the kubelet healthz endpoint in the default kubelet configuration")
+	flag.StringVar(&kubeletCertDir, "kubelet-cert-dir", reconciler.DefaultKubeletCertDir, "Directory kubelet keeps its certificates in, in TLS Bootstrap mode")
+	flag.StringVar(&kubeletStaticPodPath, "kubelet-static-pod-path", kubeletconfig.DefaultStaticPodPath, "Directory kubelet reads static pod manifests from, in TLS Bootstrap mode. Set as both --pod-manifest-path of kubelet and staticPodPath of its configuration")
+	flag.IntVar(&kubeletStartRetries, "kubelet-start-retries", 3, "How many more times starting kubelet is attempted in TLS Bootstrap mode when it fails, e.g. on a transient failure of a dependency. The bootstrap fails on the first failure when 0")
+	flag.DurationVar(&kubeletStartRetryDelay, "kubelet-start-retry-delay", 10*time.Second, "Delay after which the ByoHost is requeued to attempt starting kubelet again in TLS Bootstrap mode")
+	flag.BoolVar(&disableKubeletCertRotation, "disable-kubelet-cert-rotation", false, "Disable the rotation of the kubelet client certificate in TLS Bootstrap mode")
+	flag.BoolVar(&disableKubeletServerCertRotation, "disable-kubelet-server-cert-rotation", false, "Disable the rotation of the kubelet serving certificate in TLS Bootstrap mode")
+	flag.BoolVar(&recordInstallScript, "record-install-script", false, "Record the sha256 of the rendered install script as an annotation on the ByoHost after a successful install, for audit")
+	flag.IntVar(&installScriptAuditBytes, "install-script-audit-bytes", 0, fmt.Sprintf("With --record-install-script, also record up to this many bytes, at most %d, of the rendered install script as an annotation on the ByoHost. Disabled when 0", reconciler.MaxInstallScriptAuditBytes))
+	flag.DurationVar(&capacityResyncPeriod, "capacity-resync-period", 10*time.Minute, "Interval at which the host capacity is re-detected and updated on the ByoHost. Set to 0 to disable")
+	flag.DurationVar(&resyncPeriod, "resync-period", 0, "Interval at which the ByoHost is reconciled again without any ByoHost event, so drift of the host-local state is corrected. Disabled when 0")
+	flag.StringVar(&managedLabelPrefix, "managed-label-prefix", "", "Prefix of the capacity, GPU, SELinux and AppArmor labels the agent derives from the host and manages on the ByoHost, e.g. byoh.example.com. The default prefixes are used when empty")
+	flag.StringVar(&rootDir, "root-dir", "", "Directory prefixed to the paths of the bootstrap files, certificates and kubeconfigs the agent writes, e.g. the root of an image being built. Files are written to the host when empty")
+	flag.StringVar(&bootstrapReportPath, "bootstrap-report-path", reconciler.DefaultBootstrapReportPath, "Path of the machine-readable report of the bootstrap of the host, e.g. for support bundles. Disabled when empty")
+	flag.StringVar(&bootstrapLogPath, "bootstrap-log-path", "/var/log/byoh-agent.log", "Log of the agent whose last lines are surfaced in the ByoHost condition and event of a failed install or bootstrap. Disabled when empty")
+	flag.BoolVar(&dryRunUninstall, "dry-run-uninstall", false, "Log the uninstall script and the node reset of a host cleanup instead of running them")
+	flag.StringVar(&minFreeDisk, "min-free-disk", "", "Free space, e.g. 10Gi, required on the filesystems of / and /var before the install script runs. Not checked when empty")
+	flag.BoolVar(&verifyClusterCA, "verify-cluster-ca", false, "Verify once the node is bootstrapped that the CA of the cluster in the kubelet kubeconfig is the CA of the bootstrap secret, and reset the node when it is not")
+	flag.StringVar(&drainKubeconfig, "drain-kubeconfig", "", "Kubeconfig of the workload cluster the node of a host annotated for a graceful drain is drained with before its reset. It must be allowed to get and patch nodes, list pods and create pods/eviction. The node is not drained when empty")
+	flag.DurationVar(&zombieCleanupGracePeriod, "zombie-cleanup-grace-period", 30*time.Second, "How long the MachineRef must stay unset on a bootstrapped host before the agent cleans it up. Set to 0 to clean up immediately")
+	flag.Var(&allowedCommands, "allowed-command", "Regular expression of the commands the agent may run, e.g. '--allowed-command \"systemctl .*\" --allowed-command \"kubeadm join .*\"'. Every statement of a command, i.e. every line or part separated by ;, &, |, && or ||, must match a pattern as a whole. Commands with a statement matching none, or substituting commands, are refused with an error. Any command is run when not set")
+	flag.Var(&serviceDirectives, "systemd-service-directive", "systemd directive in the form Key=Value added to the [Service] section of the kubelet and kube-proxy units in TLS Bootstrap mode, e.g. '--systemd-service-directive NoNewPrivileges=yes --systemd-service-directive LimitNOFILE=1048576'")
+	flag.StringVar(&factsNamespace, "facts-namespace", "", "Namespace of the management cluster where the facts of the host (OS, kernel, CPU, memory, GPU and NICs) are published as the ConfigMap <host name>-facts for inventory tools. Disabled when empty")
+	flag.DurationVar(&factsResyncPeriod, "facts-resync-period", 10*time.Minute, "Interval at which the host facts are re-detected and their ConfigMap updated when they changed. Set to 0 to publish them only at startup")
+	flag.DurationVar(&heartbeatPeriod, "heartbeat-period", 20*time.Second, "Interval at which the agent bumps the heartbeat time of the ByoHost, so the controller does not force the cleanup of a host whose agent is running. Keep it below the --force-cleanup-confirmation-window of the controller manager. Set to 0 to disable")
+	flag.DurationVar(&osResyncPeriod, "os-resync-period", 0, "Interval at which the host operating system, kernel and container runtime are re-detected and the HostDetails of the ByoHost updated, e.g. after an in-place OS upgrade. Disabled when 0")
 
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 	hiddenFlags := []string{"log-flush-frequency", "alsologtostderr", "log-backtrace-at", "log-dir", "logtostderr", "stderrthreshold", "vmodule", "azure-container-registry-config",
@@ -128,10 +219,54 @@ var (
 	labels              = make(labelFlags)
 	metricsbindaddress  string
 	downloadpath        string
+	bundleCachePath     string
 	skipInstallation    bool
 	printVersion        bool
 	bootstrapKubeConfig string
+	bootstrapLogPath    string
+	bootstrapReportPath string
+	rootDir             string
+	managedLabelPrefix  string
 	certExpiryDuration  int64
+
+	capacityResyncPeriod     time.Duration
+	heartbeatPeriod          time.Duration
+	osResyncPeriod           time.Duration
+	factsResyncPeriod        time.Duration
+	factsNamespace           string
+	zombieCleanupGracePeriod time.Duration
+	resyncPeriod             time.Duration
+	fileOwner                string
+
+	postBootstrapRemoveTaints string
+	driftServices             string
+	containerRuntimeEndpoint  string
+
+	clusterDNS                string
+	clusterDomain             string
+	kubeletHealthzBindAddress string
+	kubeletHealthzPort        int
+	kubeletEvictionHard       string
+	kubeletLogVerbosity       int
+	kubeletTLSMinVersion      string
+	kubeletTLSCipherSuites    string
+
+	kubeletCertDir                   string
+	kubeletStaticPodPath             string
+	kubeletStartRetries              int
+	kubeletStartRetryDelay           time.Duration
+	disableKubeletCertRotation       bool
+	disableKubeletServerCertRotation bool
+
+	serviceDirectives serviceDirectiveFlags
+	allowedCommands   allowedCommandFlags
+
+	recordInstallScript     bool
+	installScriptAuditBytes int
+	dryRunUninstall         bool
+	minFreeDisk             string
+	verifyClusterCA         bool
+	drainKubeconfig         string
 )
 
 // TODO - fix logging
@@ -145,8 +280,7 @@ func main() {
 	}
 
 	// Set Agent Info Metric
-	info := version.Get()
-	AgentInfoMetric.WithLabelValues(info.Major+"."+info.Minor, "linux", "amd64").Set(1)
+	SetAgentInfo()
 
 	// Start Heartbeat Updater
 	go func() {
@@ -157,7 +291,13 @@ func main() {
 	}()
 
 	// Start Drift Detector (Phase 16)
-	StartDriftDetector(5 * time.Minute)
+	var services []string
+	for _, svc := range strings.Split(driftServices, ",") {
+		if svc = strings.TrimSpace(svc); svc != "" {
+			services = append(services, svc)
+		}
+	}
+	StartDriftDetector(5*time.Minute, containerRuntimeEndpoint, services)
 
 	scheme = runtime.NewScheme()
 	_ = infrastructurev1beta1.AddToScheme(scheme)
@@ -185,32 +325,27 @@ func main() {
 	// Handle restart flow or if the ~/.byoh/config already exists
 	config := getConfig(logger)
 	k8sClient := getClient(logger, config)
-	registration.LocalHostRegistrar = &registration.HostRegistrar{K8sClient: k8sClient}
+	labelKeys, err := registration.NewHostLabelKeys(managedLabelPrefix)
+	if err != nil {
+		logger.Error(err, "invalid label prefix")
+		return
+	}
+	registration.LocalHostRegistrar = &registration.HostRegistrar{K8sClient: k8sClient, LabelKeys: labelKeys}
 
 	// Detect GPU and add labels
 	gpuInfo := GetGPUInfo()
+	for k, v := range labelKeys.GPULabels(gpuInfo.Present, gpuInfo.Model, gpuInfo.Count) {
+		labels[k] = v
+	}
 	if gpuInfo.Present {
-		labels["nvidia.com/gpu.present"] = "true"
-		if gpuInfo.Model != "" {
-			labels["nvidia.com/gpu.model"] = gpuInfo.Model
-		}
-		if gpuInfo.Count > 0 {
-			labels["nvidia.com/gpu.count"] = fmt.Sprintf("%d", gpuInfo.Count)
-		}
 		logger.Info("Detected NVIDIA GPU", "model", gpuInfo.Model, "count", gpuInfo.Count)
 	}
 
 	capacity := GetCapacity()
 
 	// Add capacity labels to allow filtering by machine capacity
-	if cpu, ok := capacity[corev1.ResourceCPU]; ok {
-		labels["capacity.infrastructure.cluster.x-k8s.io/cpu"] = fmt.Sprintf("%d", cpu.Value())
-	}
-	if mem, ok := capacity[corev1.ResourceMemory]; ok {
-		labels["capacity.infrastructure.cluster.x-k8s.io/memory"] = mem.String()
-	}
-	if gpu, ok := capacity["nvidia.com/gpu"]; ok {
-		labels["capacity.infrastructure.cluster.x-k8s.io/gpu"] = fmt.Sprintf("%d", gpu.Value())
+	for k, v := range labelKeys.CapacityLabels(capacity) {
+		labels[k] = v
 	}
 
 	err = registration.LocalHostRegistrar.Register(hostName, namespace, labels, capacity)
@@ -219,6 +354,15 @@ func main() {
 		return
 	}
 
+	// Keep the registered capacity in sync with hardware changes
+	StartCapacityResync(capacityResyncPeriod, hostName, namespace)
+
+	// Show the controller the agent is running
+	StartHeartbeat(heartbeatPeriod, hostName, namespace)
+
+	// Publish the host facts for inventory tools
+	StartFactsPublisher(factsResyncPeriod, hostName, factsNamespace)
+
 	// Start certificate rotation goroutine.
 	// This is behind a feature flag for now. Set 'CERTIFICATE_ROTATION=true' to enable it.
 	if os.Getenv("CERTIFICATE_ROTATION") == "true" {
@@ -254,14 +398,87 @@ func main() {
 	if skipInstallation {
 		logger.Info("skip-installation flag set, skipping installer initialisation")
 	}
+	// Keep the reported OS in sync with in-place upgrades, events need the manager recorder
+	registration.LocalHostRegistrar.Recorder = mgr.GetEventRecorderFor("hostagent-controller")
+	StartOSResync(osResyncPeriod, hostName, namespace)
+
 	hostReconciler := &reconciler.HostReconciler{
-		Client:              k8sClient,
-		CmdRunner:           cloudinit.CmdRunner{},
-		FileWriter:          cloudinit.FileWriter{},
-		TemplateParser:      setupTemplateParser(),
-		Recorder:            mgr.GetEventRecorderFor("hostagent-controller"),
-		SkipK8sInstallation: skipInstallation,
-		DownloadPath:        downloadpath,
+		HostName:                         hostName,
+		Client:                           k8sClient,
+		CmdRunner:                        cloudinit.CmdRunner{AllowedCommands: allowedCommands},
+		FileWriter:                       cloudinit.FileWriter{RootDir: rootDir},
+		TemplateParser:                   setupTemplateParser(),
+		Recorder:                         mgr.GetEventRecorderFor("hostagent-controller"),
+		SkipK8sInstallation:              skipInstallation,
+		DownloadPath:                     downloadpath,
+		BundleCachePath:                  bundleCachePath,
+		FileOwner:                        fileOwner,
+		ContainerRuntimeEndpoint:         containerRuntimeEndpoint,
+		ClusterDNS:                       clusterDNS,
+		ClusterDomain:                    clusterDomain,
+		KubeletHealthzBindAddress:        kubeletHealthzBindAddress,
+		KubeletHealthzPort:               int32(kubeletHealthzPort),
+		KubeletLogVerbosity:              int32(kubeletLogVerbosity),
+		KubeletTLSMinVersion:             kubeletTLSMinVersion,
+		KubeletCertDir:                   kubeletCertDir,
+		KubeletStaticPodPath:             kubeletStaticPodPath,
+		KubeletStartRetries:              kubeletStartRetries,
+		KubeletStartRetryDelay:           kubeletStartRetryDelay,
+		DisableKubeletCertRotation:       disableKubeletCertRotation,
+		DisableKubeletServerCertRotation: disableKubeletServerCertRotation,
+		ServiceDirectives:                serviceDirectives,
+		RecordInstallScript:              recordInstallScript,
+		InstallScriptAuditBytes:          installScriptAuditBytes,
+		ResyncPeriod:                     resyncPeriod,
+		ZombieCleanupGracePeriod:         zombieCleanupGracePeriod,
+		BootstrapLogPath:                 bootstrapLogPath,
+		BootstrapReportPath:              bootstrapReportPath,
+		DryRunUninstall:                  dryRunUninstall,
+		VerifyClusterCA:                  verifyClusterCA,
+		DrainKubeconfig:                  drainKubeconfig,
+	}
+	if installScriptAuditBytes > reconciler.MaxInstallScriptAuditBytes {
+		logger.Error(fmt.Errorf("--install-script-audit-bytes %d exceeds the maximum of %d", installScriptAuditBytes, reconciler.MaxInstallScriptAuditBytes), "invalid install script audit size")
+		return
+	}
+	if minFreeDisk != "" {
+		quantity, err := resource.ParseQuantity(minFreeDisk)
+		if err != nil {
+			logger.Error(err, "invalid minimum free disk space")
+			return
+		}
+		hostReconciler.MinFreeDiskBytes = quantity.Value()
+	}
+	// Both directories are removed recursively when the host is reset, their defaults are used when empty
+	for name, dir := range map[string]string{"kubelet cert dir": kubeletCertDir, "kubelet static pod path": kubeletStaticPodPath} {
+		if dir == "" {
+			continue
+		}
+		if err = reconciler.ValidateRemovableDir(dir); err != nil {
+			logger.Error(err, "invalid "+name)
+			return
+		}
+	}
+	if hostReconciler.KubeletEvictionHard, err = kubeletconfig.ParseEvictionHard(kubeletEvictionHard); err != nil {
+		logger.Error(err, "invalid kubelet eviction thresholds")
+		return
+	}
+	if err = kubeletconfig.ValidateTLSMinVersion(kubeletTLSMinVersion); err != nil {
+		logger.Error(err, "invalid kubelet TLS min version")
+		return
+	}
+	if hostReconciler.KubeletTLSCipherSuites, err = kubeletconfig.ParseTLSCipherSuites(kubeletTLSCipherSuites); err != nil {
+		logger.Error(err, "invalid kubelet TLS cipher suites")
+		return
+	}
+	if err = kubeletconfig.ValidateTLSSettings(kubeletTLSMinVersion, hostReconciler.KubeletTLSCipherSuites); err != nil {
+		logger.Error(err, "invalid kubelet TLS settings")
+		return
+	}
+	for _, taint := range strings.Split(postBootstrapRemoveTaints, ",") {
+		if taint = strings.TrimSpace(taint); taint != "" {
+			hostReconciler.PostBootstrapTaintsToRemove = append(hostReconciler.PostBootstrapTaintsToRemove, taint)
+		}
 	}
 	if err = hostReconciler.SetupWithManager(context.TODO(), mgr); err != nil {
 		logger.Error(err, "unable to create controller")
@@ -409,7 +626,7 @@ users:
 
 	// Write to the standard kube-proxy.kubeconfig location
 	kubeProxyPath := "/etc/kubernetes/kube-proxy.kubeconfig"
-	if err := os.WriteFile(kubeProxyPath, []byte(kubeProxyKubeconfig), 0600); err != nil {
+	if err := (cloudinit.FileWriter{RootDir: rootDir}).WriteToFile(&cloudinit.Files{Path: kubeProxyPath, Content: kubeProxyKubeconfig, Permissions: "0600"}); err != nil {
 		return fmt.Errorf("failed to write kube-proxy.kubeconfig: %w", err)
 	}
 
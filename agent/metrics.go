@@ -5,8 +5,10 @@ package main
 
 import (
 	"net/http"
+	"runtime"
 	"time"
 
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/version"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"k8s.io/klog/v2"
@@ -46,6 +48,12 @@ func StartMetricsServer(addr string) {
 	}
 }
 
+// SetAgentInfo sets the info metric of the running agent from its build info
+func SetAgentInfo() {
+	AgentInfoMetric.Reset()
+	AgentInfoMetric.WithLabelValues(version.Version(), runtime.GOOS, runtime.GOARCH).Set(1)
+}
+
 // UpdateHeartbeat updates the heartbeat metric to current time
 func UpdateHeartbeat() {
 	HeartbeatMetric.Set(float64(time.Now().Unix()))
@@ -0,0 +1,44 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// nolint: nolintlint,testpackage
+package main
+
+import (
+	"runtime"
+
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/version"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Agent metrics", func() {
+	Context("When the agent info is set", func() {
+		var gitVersion string
+
+		BeforeEach(func() {
+			gitVersion = version.GitVersion
+		})
+
+		AfterEach(func() {
+			version.GitVersion = gitVersion
+		})
+
+		It("should expose the build version, os and arch of the agent", func() {
+			version.GitVersion = "v1.2.3"
+			SetAgentInfo()
+
+			Expect(testutil.CollectAndCount(AgentInfoMetric)).To(Equal(1))
+			Expect(testutil.ToFloat64(AgentInfoMetric.WithLabelValues("v1.2.3", runtime.GOOS, runtime.GOARCH))).To(Equal(float64(1)))
+		})
+
+		It("should report an unknown version when the build did not set one", func() {
+			version.GitVersion = ""
+			SetAgentInfo()
+
+			Expect(testutil.CollectAndCount(AgentInfoMetric)).To(Equal(1))
+			Expect(testutil.ToFloat64(AgentInfoMetric.WithLabelValues("unknown", runtime.GOOS, runtime.GOARCH))).To(Equal(float64(1)))
+		})
+	})
+})
@@ -0,0 +1,33 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/registration"
+	"k8s.io/klog/v2"
+)
+
+// StartOSResync periodically re-detects the host operating system, kernel and container runtime
+// and updates the HostDetails of the ByoHost when they change, e.g. after an in-place OS upgrade.
+// A non-positive interval disables the resync.
+func StartOSResync(interval time.Duration, hostName, namespace string) {
+	if interval <= 0 {
+		klog.Info("OS resync disabled")
+		return
+	}
+	klog.Infof("Starting OS resync every %s", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := registration.LocalHostRegistrar.SyncOSImage(context.TODO(), hostName, namespace); err != nil {
+				klog.Errorf("Failed to resync host operating system: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/cloudinit"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/version"
+	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// DefaultBootstrapReportPath is where the agent writes the bootstrap report of the host by default
+const DefaultBootstrapReportPath = "/var/lib/cluster-api/bootstrap-report.json"
+
+// BootstrapReport is the machine-readable summary of a successful bootstrap of the host, written
+// for support bundles
+type BootstrapReport struct {
+	Host                    string   `json:"host"`
+	JoinMode                string   `json:"joinMode"`
+	DownloadMode            string   `json:"downloadMode,omitempty"`
+	KubernetesVersion       string   `json:"kubernetesVersion,omitempty"`
+	AgentVersion            string   `json:"agentVersion,omitempty"`
+	KernelVersion           string   `json:"kernelVersion,omitempty"`
+	ContainerRuntimeVersion string   `json:"containerRuntimeVersion,omitempty"`
+	FilesWritten            []string `json:"filesWritten"`
+	// StartedAt and CompletedAt bound the whole bootstrap, the install of the k8s components included.
+	// A bootstrap resumed after an agent restart is reported from the restart.
+	StartedAt                    time.Time `json:"startedAt"`
+	CompletedAt                  time.Time `json:"completedAt"`
+	DurationSeconds              float64   `json:"durationSeconds"`
+	InstallDurationSeconds       float64   `json:"installDurationSeconds,omitempty"`
+	NodeBootstrapDurationSeconds float64   `json:"nodeBootstrapDurationSeconds"`
+}
+
+// fileRecorder records the paths of the files written through the wrapped writer, for the bootstrap report
+type fileRecorder struct {
+	cloudinit.IFileWriter
+	paths *[]string
+}
+
+// WriteToFile writes the file with the wrapped writer and records its path once written
+func (w fileRecorder) WriteToFile(file *cloudinit.Files) error {
+	if err := w.IFileWriter.WriteToFile(file); err != nil {
+		return err
+	}
+	*w.paths = append(*w.paths, file.Path)
+	return nil
+}
+
+// Rebase rebases the path like the wrapped writer
+func (w fileRecorder) Rebase(path string) string {
+	return cloudinit.HostPath(w.IFileWriter, path)
+}
+
+// newBootstrapReport returns the report of the bootstrap of the host completed at the given time
+func (r *HostReconciler) newBootstrapReport(byoHost *infrastructurev1beta1.ByoHost, nodeBootstrapDuration time.Duration, completedAt time.Time) *BootstrapReport {
+	joinMode := byoHost.Spec.JoinMode
+	if joinMode == "" {
+		joinMode = infrastructurev1beta1.JoinModeKubeadm
+	}
+	kubernetesVersion := byoHost.Spec.KubernetesVersion
+	if kubernetesVersion == "" {
+		kubernetesVersion = byoHost.Annotations[infrastructurev1beta1.K8sVersionAnnotation]
+	}
+	startedAt := r.bootstrapStartedAt
+	if startedAt.IsZero() {
+		startedAt = completedAt
+	}
+	return &BootstrapReport{
+		Host:                         byoHost.Name,
+		JoinMode:                     string(joinMode),
+		DownloadMode:                 string(byoHost.Spec.DownloadMode),
+		KubernetesVersion:            kubernetesVersion,
+		AgentVersion:                 version.Get().GitVersion,
+		KernelVersion:                byoHost.Status.HostDetails.KernelVersion,
+		ContainerRuntimeVersion:      byoHost.Status.HostDetails.ContainerRuntimeVersion,
+		FilesWritten:                 uniqueSorted(r.bootstrapFiles),
+		StartedAt:                    startedAt.UTC(),
+		CompletedAt:                  completedAt.UTC(),
+		DurationSeconds:              completedAt.Sub(startedAt).Seconds(),
+		InstallDurationSeconds:       r.installDuration.Seconds(),
+		NodeBootstrapDurationSeconds: nodeBootstrapDuration.Seconds(),
+	}
+}
+
+// writeBootstrapReport writes the report of the completed bootstrap of the host to BootstrapReportPath
+func (r *HostReconciler) writeBootstrapReport(ctx context.Context, report *BootstrapReport) error {
+	logger := ctrl.LoggerFrom(ctx)
+
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the bootstrap report: %w", err)
+	}
+	if err := r.FileWriter.MkdirIfNotExists(filepath.Dir(r.BootstrapReportPath)); err != nil {
+		return fmt.Errorf("failed to create the directory of the bootstrap report: %w", err)
+	}
+	if err := r.FileWriter.WriteToFile(&cloudinit.Files{
+		Path:        r.BootstrapReportPath,
+		Content:     string(content) + "\n",
+		Permissions: "0644",
+	}); err != nil {
+		return fmt.Errorf("failed to write the bootstrap report: %w", err)
+	}
+	logger.Info("Wrote bootstrap report", "path", r.BootstrapReportPath)
+	return nil
+}
+
+// uniqueSorted returns the sorted paths without duplicates, e.g. files rewritten by a retried bootstrap
+func uniqueSorted(paths []string) []string {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if !seen[path] {
+			seen[path] = true
+			unique = append(unique, path)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
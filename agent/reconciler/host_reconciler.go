@@ -5,19 +5,33 @@ package reconciler
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/cloudinit"
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/registration"
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common/kubeletconfig"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/record"
@@ -28,6 +42,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	"github.com/kube-vip/kube-vip/pkg/vip"
 	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
@@ -42,14 +57,189 @@ type HostReconciler struct {
 	Recorder            record.EventRecorder
 	SkipK8sInstallation bool
 	DownloadPath        string
+	// HostName is the name of the ByoHost the agent registered. Events of other ByoHosts are ignored,
+	// so the agent never acts on a host it does not run on. All ByoHosts are reconciled when empty.
+	HostName string
+	// BundleCachePath is an optional, possibly read-only and shared, directory holding bundles laid out
+	// as <BundleCachePath>/<bundle address>. Offline installs copy a cached bundle instead of pulling it.
+	BundleCachePath string
+	// FileOwner is an optional "user:group" applied to the CA certificates and
+	// kubeconfigs written in TLS Bootstrap mode. Default ownership is kept when empty.
+	FileOwner string
+	// PostBootstrapTaintsToRemove lists taints, as key or key:Effect, removed from the
+	// local Node once it is bootstrapped, e.g. an initialization taint gating scheduling
+	PostBootstrapTaintsToRemove []string
+	// ContainerRuntimeEndpoint is the CRI endpoint passed to kubelet and kubeadm reset,
+	// e.g. unix:///run/containerd/containerd.sock. Their defaults are used when empty.
+	ContainerRuntimeEndpoint string
+	// ClusterDNS is the IP of the cluster DNS in the generated default KubeletConfiguration.
+	// The kubeadm default is used when empty.
+	ClusterDNS string
+	// ClusterDomain is the DNS domain of the cluster in the generated default KubeletConfiguration.
+	// The default is used when empty.
+	ClusterDomain string
+	// KubeletHealthzBindAddress and KubeletHealthzPort configure the kubelet healthz endpoint
+	// in the generated default KubeletConfiguration. Defaults are used when empty.
+	KubeletHealthzBindAddress string
+	KubeletHealthzPort        int32
+	// KubeletEvictionHard are hard eviction thresholds by signal overriding the defaults of the
+	// generated default KubeletConfiguration
+	KubeletEvictionHard map[string]string
+	// KubeletLogVerbosity is the verbosity of the kubelet logs in TLS Bootstrap mode, overridden by the
+	// KubeletLogVerbosity of the ByoHost. The verbosity of a configuration provided by the cluster is
+	// only changed when either is set.
+	KubeletLogVerbosity int32
+	// KubeletTLSMinVersion and KubeletTLSCipherSuites restrict the TLS of the kubelet server in TLS Bootstrap
+	// mode, overridden by the KubeletTLSMinVersion and KubeletTLSCipherSuites of the ByoHost. The kubelet
+	// defaults, or those of a configuration provided by the cluster, are kept when empty.
+	KubeletTLSMinVersion   string
+	KubeletTLSCipherSuites []string
+	// KubeletStartRetries is how many more times starting kubelet is attempted in TLS Bootstrap mode when it
+	// fails, e.g. on a transient failure of a dependency, by requeueing the ByoHost KubeletStartRetryDelay
+	// later. The bootstrap fails on the first failure when zero.
+	KubeletStartRetries    int
+	KubeletStartRetryDelay time.Duration
+	// KubeletCertDir is the directory kubelet keeps its certificates in, in TLS Bootstrap mode.
+	// DefaultKubeletCertDir is used when empty.
+	KubeletCertDir string
+	// KubeletStaticPodPath is the directory kubelet reads static pod manifests from, in TLS Bootstrap mode, for
+	// layouts other than the kubeadm one. It is both passed as --pod-manifest-path and set as staticPodPath of
+	// the kubelet configuration, a configuration provided by the cluster included, so the two never disagree.
+	// kubeletconfig.DefaultStaticPodPath is used when empty.
+	KubeletStaticPodPath string
+	// DisableKubeletCertRotation and DisableKubeletServerCertRotation turn off the rotation of the
+	// kubelet client and serving certificates, which are both rotated by default
+	DisableKubeletCertRotation       bool
+	DisableKubeletServerCertRotation bool
+	// ServiceDirectives are extra Key=Value directives, e.g. NoNewPrivileges=yes or LimitNOFILE=1048576,
+	// added to the [Service] section of the kubelet and kube-proxy units written in TLS Bootstrap mode
+	ServiceDirectives []string
+	// RecordInstallScript records the sha256 of the rendered install script on the ByoHost after
+	// a successful install. InstallScriptAuditBytes additionally records up to that many bytes
+	// of the script itself, at most MaxInstallScriptAuditBytes, nothing when zero.
+	RecordInstallScript     bool
+	InstallScriptAuditBytes int
+	// ResyncPeriod is the interval at which a ByoHost is reconciled again without any ByoHost event,
+	// so drift of the host-local state is corrected. Periodic resyncs are disabled when zero.
+	ResyncPeriod time.Duration
+	// BootstrapLogPath is the log of the agent, whose last lines are surfaced in the failure
+	// condition and event of a failed install or bootstrap. Nothing is surfaced when empty.
+	BootstrapLogPath string
+	// ZombieCleanupGracePeriod is how long MachineRef must stay nil on a bootstrapped host
+	// before the agent cleans itself up, so a MachineRef briefly cleared by a controller race
+	// does not tear down a healthy node. The host is cleaned up immediately when zero.
+	ZombieCleanupGracePeriod time.Duration
+	// DryRunUninstall makes the host cleanup log the parsed uninstall script and the commands, files
+	// and directories of the node reset instead of running them. The ByoHost is still released.
+	DryRunUninstall bool
+	// MinFreeDiskBytes is the free space required on each of the filesystems of / and /var before the
+	// install script runs, so a host low on disk fails fast instead of midway. Not checked when zero.
+	MinFreeDiskBytes int64
+	// VerifyClusterCA checks once the node is bootstrapped that the CA of the cluster in the kubelet kubeconfig
+	// is the CA of the bootstrap secret, so a misconfigured host does not stay joined to another cluster
+	VerifyClusterCA bool
+	// BootstrapReportPath is where a machine-readable report of the bootstrap of the host, e.g. its mode,
+	// versions, written files and timings, is written once the node is bootstrapped. Not written when empty.
+	BootstrapReportPath string
+	// DrainKubeconfig is the kubeconfig of the workload cluster the Node of a host asking for a graceful drain
+	// is drained with, allowed to get and patch nodes, list pods and create pods/eviction. The kubelet
+	// credentials of the host are not allowed to evict pods. The Node is not drained when empty.
+	DrainKubeconfig string
+
+	// zombieDetectedAt is when the current nil MachineRef was first observed on a bootstrapped host
+	zombieDetectedAt time.Time
+	// bootstrapStartedAt is when the agent started the current bootstrap of the host, for BootstrapDuration.
+	// A bootstrap resumed after an agent restart is measured from the restart.
+	bootstrapStartedAt time.Time
+	// installDuration and bootstrapFiles are the install duration and the files written of the current
+	// bootstrap of the host, for the bootstrap report
+	installDuration time.Duration
+	bootstrapFiles  []string
+	// bootstrapSecretVersion is the resourceVersion of the TLS bootstrap secret the bootstrap files of the
+	// current bootstrap of the host were written from
+	bootstrapSecretVersion string
+	// kubeletStartFailures counts the failed attempts to start kubelet of the current bootstrap of the host
+	kubeletStartFailures int
+	// drainStartedAt is when the agent started the current drain of the Node of the host
+	drainStartedAt time.Time
+	// drainClient is the client of the workload cluster of the DrainKubeconfig, built on the first drain and
+	// reused by the requeues of the drain and the drains that follow
+	drainClient client.Client
 }
 
+var (
+	// errInsufficientDiskSpace is returned by the pre-flight checks when the host is low on disk
+	errInsufficientDiskSpace = errors.New("insufficient disk space")
+	// diskCheckPaths are the paths whose filesystems must have MinFreeDiskBytes free before installing
+	diskCheckPaths = []string{"/", "/var"}
+	// statfs gets the filesystem statistics of a path, replaced in tests
+	statfs = syscall.Statfs
+	// serviceFailureReason gets the failure reason systemd reports for a unit, replaced in tests
+	serviceFailureReason = systemdFailureReason
+	// errKubeletStartFailed is returned by the TLS bootstrap when starting kubelet failed
+	errKubeletStartFailed = errors.New("failed to enable/start kubelet")
+	// errClusterCAMismatch is returned by the cluster CA verification when the node joined another cluster
+	errClusterCAMismatch = errors.New("cluster CA mismatch")
+	// kubeletKubeconfigFile is the kubeconfig kubelet reaches the cluster it joined with, replaced in tests
+	kubeletKubeconfigFile = "/etc/kubernetes/kubelet.conf"
+	// kubeProxyKubeconfigFile is the kubeconfig kube-proxy reaches the cluster with, replaced in tests
+	kubeProxyKubeconfigFile = "/etc/kubernetes/kube-proxy.kubeconfig"
+	// detectSoftwareVersions re-detects the kernel and container runtime versions of the host, replaced in tests
+	detectSoftwareVersions = registration.RefreshSoftwareVersions
+	// drainRetryInterval is the interval the host is requeued at to evict the pods left on its draining Node
+	drainRetryInterval = 5 * time.Second
+	// newDrainClient builds the client of the workload cluster the Node of a host is drained with, replaced in tests
+	newDrainClient = newKubeconfigClient
+	// errNodeNotDrained is returned by the drain when the Node of the host cannot be drained at all, e.g. when
+	// it is not found in the workload cluster
+	errNodeNotDrained = errors.New("node not drained")
+	// caCertHashRegexp matches the CA public key hashes pinned by a kubeadm join, e.g. in caCertHashes
+	caCertHashRegexp = regexp.MustCompile(`sha256:[A-Fa-f0-9]{64}`)
+)
+
 const (
+	// DefaultKubeletCertDir is the default certificate directory of kubelet in TLS Bootstrap mode
+	DefaultKubeletCertDir = "/var/lib/kubelet/pki"
+	// DefaultGracefulDrainTimeout bounds the drain of the Node of a host asking for a graceful drain without a timeout
+	DefaultGracefulDrainTimeout = 5 * time.Minute
+	// MaxInstallScriptAuditBytes caps the install script recorded on the ByoHost, well below the 256KiB limit
+	// of all the annotations of an object
+	MaxInstallScriptAuditBytes = 32 * 1024
+
 	bootstrapSentinelFile = "/run/cluster-api/bootstrap-success.complete"
 	// machineIDFile stores the UID of the Machine currently bound to this host
 	machineIDFile = "/run/cluster-api/machine-id"
+	// kubeletConfigFile is the KubeletConfiguration the agent writes in TLS Bootstrap mode
+	kubeletConfigFile = "/var/lib/kubelet/config.yaml"
 	// KubeadmResetCommand is the command to run to force reset/remove nodes' local file system of the files created by kubeadm
 	KubeadmResetCommand = "kubeadm reset --force"
+	// MaxBootstrapFailures is the number of consecutive bootstrap failures after which the host is quarantined
+	MaxBootstrapFailures = 3
+	// bootstrapPhaseInstalled, bootstrapPhaseFilesWritten and bootstrapPhaseKubeletStarted are the phases of
+	// the bootstrap of a host recorded in the BootstrapPhaseAnnotation once completed
+	bootstrapPhaseInstalled      = "install"
+	bootstrapPhaseFilesWritten   = "files-written"
+	bootstrapPhaseKubeletStarted = "kubelet-started"
+	// bootstrapLogTailLines and bootstrapLogTailBytes bound the tail of the bootstrap log surfaced on a failure
+	bootstrapLogTailLines = 20
+	bootstrapLogTailBytes = 2048
+	// providerIDPatchAttempts bounds the local attempts to patch the Node ProviderID in kubeadm mode,
+	// the controller patches it as a backup afterwards
+	providerIDPatchAttempts = 5
+	// providerIDPatchRetryInterval is the wait between the local attempts to patch the Node ProviderID
+	providerIDPatchRetryInterval = 3 * time.Second
+	// providerIDVerifyDelay is the wait before checking the patched Node ProviderID survived a kubelet re-registration
+	providerIDVerifyDelay = 10 * time.Second
+	// kubeadmFlagsEnvFile holds the kubelet flags written by kubeadm join, sourced by the kubelet unit
+	kubeadmFlagsEnvFile = "/var/lib/kubelet/kubeadm-flags.env"
+	// defaultConntrackMaxPerCore is the kube-proxy default for conntrack.maxPerCore
+	defaultConntrackMaxPerCore = 32768
+	// defaultConntrackMin is the kube-proxy default for conntrack.min
+	defaultConntrackMin = 131072
+	// conntrackEntryBytes approximates the kernel memory used by a single conntrack entry
+	conntrackEntryBytes = 320
+	// conntrackMemoryFraction limits the conntrack table to 1/conntrackMemoryFraction of the host memory
+	conntrackMemoryFraction = 32
 	// NOTE: Agent does NOT use finalizer because it's an external process that can crash.
 	// If Agent crashes during cleanup, ByoHostController will detect the stale cleanup annotation
 	// and clear MachineRef without waiting for Agent. This prevents ByoHost from being stuck
@@ -82,18 +272,19 @@ func (r *HostReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctr
 	hostAnnotations := byoHost.GetAnnotations()
 	_, ok := hostAnnotations[infrastructurev1beta1.HostCleanupAnnotation]
 	if ok {
-		err = r.hostCleanUp(ctx, byoHost)
-		if err != nil {
-			return ctrl.Result{}, err
-		}
-		return ctrl.Result{}, nil
+		return r.hostCleanUp(ctx, byoHost)
 	}
 
 	// Handle deleted machines
 	if !byoHost.ObjectMeta.DeletionTimestamp.IsZero() {
 		return r.reconcileDelete(ctx, byoHost)
 	}
-	return r.reconcileNormal(ctx, byoHost)
+	result, reconcileErr := r.reconcileNormal(ctx, byoHost)
+	if reconcileErr == nil && result.IsZero() && r.ResyncPeriod > 0 {
+		// Changes of host-local files raise no ByoHost event, re-assert the local state periodically
+		result.RequeueAfter = r.ResyncPeriod
+	}
+	return result, reconcileErr
 }
 
 func (r *HostReconciler) reconcileNormal(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) (ctrl.Result, error) {
@@ -106,10 +297,20 @@ func (r *HostReconciler) reconcileNormal(ctx context.Context, byoHost *infrastru
 		// but we are still bootstrapped locally. We must self-clean to ensure consistency.
 		if conditions.IsTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded) ||
 			conditions.IsTrue(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded) {
+			// Confirm the MachineRef stays nil before doing anything destructive
+			if r.zombieDetectedAt.IsZero() {
+				r.zombieDetectedAt = time.Now()
+			}
+			if remaining := r.ZombieCleanupGracePeriod - time.Since(r.zombieDetectedAt); remaining > 0 {
+				logger.Info("MachineRef is nil but host appears to be bootstrapped. Rechecking before self-cleanup.", "after", remaining)
+				return ctrl.Result{RequeueAfter: remaining}, nil
+			}
 			logger.Info("MachineRef is nil but host appears to be bootstrapped. Detected Zombie state (Force Cleanup occurred). Triggering self-cleanup.")
-			if err := r.hostCleanUp(ctx, byoHost); err != nil {
-				return ctrl.Result{}, err
+			if result, err := r.hostCleanUp(ctx, byoHost); err != nil || !result.IsZero() {
+				// The zombie state stays confirmed while the Node is drained
+				return result, err
 			}
+			r.zombieDetectedAt = time.Time{}
 			// Cleanup successful, reset conditions and wait for new MachineRef assignment
 			conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.K8sNodeAbsentReason, clusterv1.ConditionSeverityInfo, "")
 			conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded, infrastructurev1beta1.K8sNodeAbsentReason, clusterv1.ConditionSeverityInfo, "")
@@ -120,6 +321,7 @@ func (r *HostReconciler) reconcileNormal(ctx context.Context, byoHost *infrastru
 		logger.Info("Machine ref not yet set, waiting for assignment")
 		return ctrl.Result{}, nil
 	}
+	r.zombieDetectedAt = time.Time{}
 
 	if byoHost.Spec.BootstrapSecret == nil {
 		logger.Info("BootstrapDataSecret not ready")
@@ -132,14 +334,14 @@ func (r *HostReconciler) reconcileNormal(ctx context.Context, byoHost *infrastru
 	// and the Agent missed the cleanup event (e.g. while offline), we must detect this
 	// and force a cleanup before proceeding.
 	if byoHost.Status.MachineRef != nil {
-		currentMachineIDBytes, err := os.ReadFile(machineIDFile)
+		currentMachineIDBytes, err := os.ReadFile(r.hostPath(machineIDFile))
 		if err == nil {
 			currentMachineID := strings.TrimSpace(string(currentMachineIDBytes))
 			if currentMachineID != string(byoHost.Status.MachineRef.UID) {
 				logger.Info("Detected Machine UID mismatch. Host is bound to a new Machine but carries old state.",
 					"oldID", currentMachineID, "newID", byoHost.Status.MachineRef.UID)
-				if err := r.hostCleanUp(ctx, byoHost); err != nil {
-					return ctrl.Result{}, err
+				if result, err := r.hostCleanUp(ctx, byoHost); err != nil || !result.IsZero() {
+					return result, err
 				}
 				// Cleanup triggered, reset conditions and wait for new MachineRef assignment
 				conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.K8sNodeAbsentReason, clusterv1.ConditionSeverityInfo, "")
@@ -150,6 +352,9 @@ func (r *HostReconciler) reconcileNormal(ctx context.Context, byoHost *infrastru
 	}
 
 	if !conditions.IsTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded) {
+		if r.bootstrapStartedAt.IsZero() {
+			r.bootstrapStartedAt = time.Now()
+		}
 		bootstrapScript, err := r.getBootstrapScript(ctx, byoHost.Spec.BootstrapSecret.Name, byoHost.Spec.BootstrapSecret.Namespace)
 		if err != nil {
 			logger.Error(err, "error getting bootstrap script")
@@ -175,12 +380,17 @@ func (r *HostReconciler) reconcileNormal(ctx context.Context, byoHost *infrastru
 					return ctrl.Result{}, nil
 				}
 			} else {
+				installStartedAt := time.Now()
 				err = r.executeInstallerController(ctx, byoHost)
 				if err != nil {
 					return ctrl.Result{}, err
 				}
+				r.installDuration = time.Since(installStartedAt)
 				r.Recorder.Event(byoHost, corev1.EventTypeNormal, "InstallScriptExecutionSucceeded", "install script executed")
 				conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded)
+				setBootstrapPhase(byoHost, bootstrapPhaseInstalled)
+				// The container runtime was not installed yet when the host registered
+				detectSoftwareVersions(&byoHost.Status.HostDetails)
 			}
 		} else {
 			logger.Info("install script already executed")
@@ -194,49 +404,286 @@ func (r *HostReconciler) reconcileNormal(ctx context.Context, byoHost *infrastru
 			return ctrl.Result{}, err
 		}
 
+		nodeBootstrapStartedAt := time.Now()
 		err = r.bootstrapK8sNode(ctx, bootstrapScript, byoHost)
 		if err != nil {
+			if errors.Is(err, errKubeletStartFailed) && r.kubeletStartFailures < r.KubeletStartRetries {
+				// The written files and installed components are kept, the retry starts kubelet again
+				r.kubeletStartFailures++
+				logger.Error(err, "failed to start kubelet, retrying", "attempt", r.kubeletStartFailures, "delay", r.KubeletStartRetryDelay)
+				conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.CloudInitExecutionFailedReason, clusterv1.ConditionSeverityWarning, "%s", err.Error())
+				return ctrl.Result{Requeue: true, RequeueAfter: r.KubeletStartRetryDelay}, nil
+			}
+			r.kubeletStartFailures = 0
 			logger.Error(err, "error in bootstrapping k8s node")
-			r.Recorder.Event(byoHost, corev1.EventTypeWarning, "BootstrapK8sNodeFailed", "k8s Node Bootstrap failed")
-			_ = r.resetNode(ctx, byoHost)
-			conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.CloudInitExecutionFailedReason, clusterv1.ConditionSeverityError, "")
+			logTail := r.bootstrapLogTail(ctx)
+			r.Recorder.Event(byoHost, corev1.EventTypeWarning, "BootstrapK8sNodeFailed", withLogTail("k8s Node Bootstrap failed", logTail))
+			if byoHost.Annotations[infrastructurev1beta1.BootstrapPhaseAnnotation] == bootstrapPhaseFilesWritten {
+				// Only starting the services failed, e.g. a transient kubelet start failure. The written files
+				// and installed components are kept, so the retry resumes from starting kubelet.
+				logger.Info("keeping the bootstrap files, the retry resumes from starting kubelet")
+			} else {
+				_ = r.resetNode(ctx, byoHost)
+				if conditions.IsTrue(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded) {
+					setBootstrapPhase(byoHost, bootstrapPhaseInstalled)
+				} else {
+					delete(byoHost.Annotations, infrastructurev1beta1.BootstrapPhaseAnnotation)
+				}
+			}
+			conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.CloudInitExecutionFailedReason, clusterv1.ConditionSeverityError, "%s", logTail)
+			r.recordBootstrapFailure(ctx, byoHost)
 			return ctrl.Result{}, err
 		}
 		logger.Info("k8s node successfully bootstrapped")
 		r.Recorder.Event(byoHost, corev1.EventTypeNormal, "BootstrapK8sNodeSucceeded", "k8s Node Bootstraped")
 		conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+		if r.BootstrapReportPath != "" {
+			// The report only helps support, so failing to write it does not fail the bootstrap
+			if err := r.writeBootstrapReport(ctx, r.newBootstrapReport(byoHost, time.Since(nodeBootstrapStartedAt), time.Now())); err != nil {
+				logger.Error(err, "failed to write the bootstrap report")
+			}
+		}
+		r.observeBootstrapDuration(byoHost)
+		r.installDuration = 0
+		r.bootstrapFiles = nil
+		r.bootstrapSecretVersion = ""
+		r.kubeletStartFailures = 0
+		delete(byoHost.Annotations, infrastructurev1beta1.BootstrapFailuresAnnotation)
+		delete(byoHost.Annotations, infrastructurev1beta1.BootstrapPhaseAnnotation)
 
 		// For Kubeadm mode, we need to manually patch the ProviderID on the Node object
 		// because kubeadm join doesn't accept --provider-id flag in the way we need.
 		// Doing it here (Agent-side) is faster than waiting for the Controller to do it.
 		if byoHost.Spec.JoinMode != infrastructurev1beta1.JoinModeTLSBootstrap {
 			if err := r.patchLocalNodeProviderID(ctx, byoHost.Name); err != nil {
-				// Don't fail reconciliation, just log error. Controller will retry eventually.
+				// Don't fail reconciliation once the local retries are exhausted, the Controller patches it as a backup.
 				logger.Error(err, "failed to patch local node providerID")
 			} else {
 				logger.Info("Successfully patched local node providerID")
+				if err := r.verifyLocalNodeProviderID(ctx, byoHost.Name); err != nil {
+					logger.Error(err, "failed to verify local node providerID")
+				}
 			}
 		}
 
 		// Persist Machine ID to ensure consistency across restarts/rebinds
 		if byoHost.Status.MachineRef != nil {
-			if err := os.WriteFile(machineIDFile, []byte(byoHost.Status.MachineRef.UID), 0644); err != nil {
+			if err := r.FileWriter.WriteToFile(&cloudinit.Files{Path: machineIDFile, Content: string(byoHost.Status.MachineRef.UID), Permissions: "0644"}); err != nil {
 				logger.Error(err, "failed to persist machine ID")
 			}
 		}
 
 		// For TLS Bootstrap mode, check if kube-proxy needs to be started
 		// This handles the case where ManageKubeProxy is set to true after bootstrap
-		if byoHost.Spec.JoinMode == infrastructurev1beta1.JoinModeTLSBootstrap && byoHost.Spec.ManageKubeProxy {
+		if byoHost.Spec.JoinMode == infrastructurev1beta1.JoinModeTLSBootstrap && manageKubeProxy(byoHost) {
 			if err := r.startKubeProxyIfNeeded(ctx, byoHost); err != nil {
 				logger.Error(err, "failed to start kube-proxy")
 			}
 		}
 	}
 
+	if err := r.refreshControlPlaneEndpoint(ctx, byoHost); err != nil {
+		logger.Error(err, "failed to point the node at the new control plane endpoint, retrying")
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	if err := r.refreshKubeletLogVerbosity(ctx, byoHost); err != nil {
+		logger.Error(err, "failed to apply the kubelet log verbosity, retrying")
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	if r.VerifyClusterCA {
+		if _, ok := byoHost.Annotations[infrastructurev1beta1.ClusterCAVerifiedAnnotation]; !ok {
+			if err := r.verifyClusterCA(ctx, byoHost); err != nil {
+				if !errors.Is(err, errClusterCAMismatch) {
+					// In TLS Bootstrap mode kubelet writes its kubeconfig only once its certificate is issued, so retry until it is
+					logger.Error(err, "failed to verify the cluster CA of the node, retrying")
+					return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+				}
+				logger.Error(err, "node joined a cluster with an unexpected CA, resetting the node")
+				r.Recorder.Event(byoHost, corev1.EventTypeWarning, "ClusterCAMismatch", err.Error())
+				_ = r.resetNode(ctx, byoHost)
+				conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.ClusterCAMismatchReason, clusterv1.ConditionSeverityError, "%s", err.Error())
+				r.recordBootstrapFailure(ctx, byoHost)
+				return ctrl.Result{}, err
+			}
+			if byoHost.Annotations == nil {
+				byoHost.Annotations = map[string]string{}
+			}
+			byoHost.Annotations[infrastructurev1beta1.ClusterCAVerifiedAnnotation] = "true"
+		}
+	}
+
+	if len(r.PostBootstrapTaintsToRemove) > 0 {
+		if _, ok := byoHost.Annotations[infrastructurev1beta1.PostBootstrapTaintsRemovedAnnotation]; !ok {
+			// The Node may not be registered yet right after bootstrap, so retry until it is
+			if err := r.removeLocalNodeTaints(ctx, byoHost.Name); err != nil {
+				logger.Error(err, "failed to remove post-bootstrap taints from local node, retrying")
+				return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+			}
+			if byoHost.Annotations == nil {
+				byoHost.Annotations = map[string]string{}
+			}
+			byoHost.Annotations[infrastructurev1beta1.PostBootstrapTaintsRemovedAnnotation] = "true"
+			r.Recorder.Eventf(byoHost, corev1.EventTypeNormal, "PostBootstrapTaintsRemoved", "removed taints %s from node", strings.Join(r.PostBootstrapTaintsToRemove, ","))
+		}
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// refreshControlPlaneEndpoint points the kubeconfigs of kubelet and kube-proxy at the control plane endpoint of the
+// ByoHost when it changed since the agent last applied it, e.g. after the VIP of the cluster moved, and restarts them
+// to reconnect. Only servers still pointing at the previous endpoint are changed, e.g. a DNS name is kept.
+func (r *HostReconciler) refreshControlPlaneEndpoint(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
+	logger := ctrl.LoggerFrom(ctx)
+	endpoint := byoHost.Annotations[infrastructurev1beta1.EndPointIPAnnotation]
+	applied, ok := byoHost.Annotations[infrastructurev1beta1.AppliedEndPointIPAnnotation]
+	if endpoint == "" || endpoint == applied {
+		return nil
+	}
+
+	// The kubeconfigs of a host bootstrapped before the endpoint was tracked point at the current endpoint
+	if ok {
+		kubeconfigs := []struct {
+			path    string
+			service string
+		}{
+			{path: kubeletKubeconfigFile, service: "kubelet"},
+			{path: kubeProxyKubeconfigFile, service: "kube-proxy"},
+		}
+		for _, kubeconfig := range kubeconfigs {
+			changed, err := replaceKubeconfigServer(r.hostPath(kubeconfig.path), "https://"+applied, "https://"+endpoint)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+			logger.Info("Pointed kubeconfig at the new control plane endpoint", "path", kubeconfig.path, "endpoint", endpoint)
+			// kube-proxy runs as a unit of the agent only when the agent manages it
+			if kubeconfig.service == "kube-proxy" && !manageKubeProxy(byoHost) {
+				continue
+			}
+			if err := r.CmdRunner.RunCmd(ctx, "systemctl restart "+kubeconfig.service); err != nil {
+				return fmt.Errorf("failed to restart %s: %w", kubeconfig.service, err)
+			}
+		}
+		r.Recorder.Eventf(byoHost, corev1.EventTypeNormal, "ControlPlaneEndpointRefreshed", "Pointed the node at the control plane endpoint %s", endpoint)
+	}
+
+	byoHost.Annotations[infrastructurev1beta1.AppliedEndPointIPAnnotation] = endpoint
+	return nil
+}
+
+// refreshKubeletLogVerbosity rewrites the kubelet configuration of a node bootstrapped in TLS Bootstrap mode when
+// the configured log verbosity differs from the one kubelet runs with, e.g. after the KubeletLogVerbosity of the
+// ByoHost was raised to debug the node, and restarts kubelet to apply it. Nothing changes without a verbosity.
+func (r *HostReconciler) refreshKubeletLogVerbosity(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
+	if byoHost.Spec.JoinMode != infrastructurev1beta1.JoinModeTLSBootstrap || !conditions.IsTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded) {
+		return nil
+	}
+	verbosity, set := r.kubeletLogVerbosity(byoHost)
+	if !set {
+		return nil
+	}
+	content, err := os.ReadFile(r.hostPath(kubeletConfigFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read the kubelet config: %w", err)
+	}
+	config, err := kubeletconfig.WithLogVerbosity(string(content), verbosity)
+	if err != nil {
+		return err
+	}
+	if config == string(content) {
+		return nil
+	}
+	if err := r.FileWriter.WriteToFile(&cloudinit.Files{Path: kubeletConfigFile, Content: config, Permissions: "0644"}); err != nil {
+		return fmt.Errorf("failed to write the kubelet config: %w", err)
+	}
+	if err := r.CmdRunner.RunCmd(ctx, "systemctl restart kubelet"); err != nil {
+		return fmt.Errorf("failed to restart kubelet: %w", err)
+	}
+	r.Recorder.Eventf(byoHost, corev1.EventTypeNormal, "KubeletLogVerbosityChanged", "Restarted kubelet with log verbosity %d", verbosity)
+	return nil
+}
+
+// replaceKubeconfigServer replaces the server of the clusters of the kubeconfig pointing at the old server with the new
+// one, and returns whether the kubeconfig points at the new server, i.e. whether its user has to reconnect. A server
+// already replaced by a previous attempt counts, so a failed restart is retried. A missing kubeconfig is left alone.
+func replaceKubeconfigServer(path, oldServer, newServer string) (bool, error) {
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	replaced, pointed := false, false
+	for _, cluster := range config.Clusters {
+		switch cluster.Server {
+		case oldServer:
+			cluster.Server = newServer
+			replaced, pointed = true, true
+		case newServer:
+			pointed = true
+		}
+	}
+	if !replaced {
+		return pointed, nil
+	}
+	if err := clientcmd.WriteToFile(*config, path); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// observeBootstrapDuration records the duration of the completed bootstrap of the host in BootstrapDuration
+func (r *HostReconciler) observeBootstrapDuration(byoHost *infrastructurev1beta1.ByoHost) {
+	joinMode := byoHost.Spec.JoinMode
+	if joinMode == "" {
+		joinMode = infrastructurev1beta1.JoinModeKubeadm
+	}
+	BootstrapDuration.WithLabelValues(string(joinMode), string(byoHost.Spec.DownloadMode)).Observe(time.Since(r.bootstrapStartedAt).Seconds())
+	r.bootstrapStartedAt = time.Time{}
+}
+
+// setBootstrapPhase records the last completed phase of the bootstrap of the host
+func setBootstrapPhase(byoHost *infrastructurev1beta1.ByoHost, phase string) {
+	if byoHost.Annotations == nil {
+		byoHost.Annotations = map[string]string{}
+	}
+	byoHost.Annotations[infrastructurev1beta1.BootstrapPhaseAnnotation] = phase
+}
+
+// recordBootstrapFailure increments the consecutive bootstrap failure counter of the host.
+// Once MaxBootstrapFailures is reached the host is labelled as quarantined, so the
+// ByoMachine controller stops claiming it until an operator removes the label.
+func (r *HostReconciler) recordBootstrapFailure(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) {
+	logger := ctrl.LoggerFrom(ctx)
+
+	// An unparsable counter is treated as zero and overwritten
+	failures, _ := strconv.Atoi(byoHost.Annotations[infrastructurev1beta1.BootstrapFailuresAnnotation])
+	failures++
+	if byoHost.Annotations == nil {
+		byoHost.Annotations = map[string]string{}
+	}
+	byoHost.Annotations[infrastructurev1beta1.BootstrapFailuresAnnotation] = strconv.Itoa(failures)
+
+	if failures < MaxBootstrapFailures || byoHost.IsQuarantined() {
+		return
+	}
+	logger.Info("quarantining host after repeated bootstrap failures", "failures", failures)
+	if byoHost.Labels == nil {
+		byoHost.Labels = map[string]string{}
+	}
+	byoHost.Labels[infrastructurev1beta1.QuarantinedLabel] = "true"
+	r.Recorder.Eventf(byoHost, corev1.EventTypeWarning, "HostQuarantined", "host quarantined after %d consecutive bootstrap failures", failures)
+}
+
 func (r *HostReconciler) executeInstallerController(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
 	logger := ctrl.LoggerFrom(ctx)
 	secret := &corev1.Secret{}
@@ -249,11 +696,22 @@ func (r *HostReconciler) executeInstallerController(ctx context.Context, byoHost
 	installScript := string(secret.Data["install"])
 	uninstallScript := string(secret.Data["uninstall"])
 
-	byoHost.Spec.UninstallationScript = &uninstallScript
 	installScript, err = r.parseScript(ctx, installScript, byoHost.Name)
 	if err != nil {
+		r.Recorder.Eventf(byoHost, corev1.EventTypeWarning, "InstallScriptInvalid", "install script %s is invalid: %v", byoHost.Spec.InstallationSecret.Name, err)
+		return err
+	}
+	// The uninstall script is parsed during the host cleanup, reject it before anything is installed
+	if _, err = r.parseScript(ctx, uninstallScript, byoHost.Name); err != nil {
+		r.Recorder.Eventf(byoHost, corev1.EventTypeWarning, "InstallScriptInvalid", "uninstall script %s is invalid: %v", byoHost.Spec.InstallationSecret.Name, err)
+		return err
+	}
+	installEnv, err := installEnvExports(byoHost.Spec.InstallEnv)
+	if err != nil {
+		r.Recorder.Eventf(byoHost, corev1.EventTypeWarning, "InstallScriptInvalid", "install env is invalid: %v", err)
 		return err
 	}
+	byoHost.Spec.UninstallationScript = &uninstallScript
 	logger.Info("executing install script")
 
 	// Pre-flight checks
@@ -261,14 +719,17 @@ func (r *HostReconciler) executeInstallerController(ctx context.Context, byoHost
 	if err := r.preflightChecks(ctx); err != nil {
 		logger.Error(err, "pre-flight checks failed")
 		r.Recorder.Event(byoHost, corev1.EventTypeWarning, "PreflightCheckFailed", fmt.Sprintf("Pre-flight check failed: %v", err))
+		if errors.Is(err, errInsufficientDiskSpace) {
+			conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded, infrastructurev1beta1.InsufficientDiskSpaceReason, clusterv1.ConditionSeverityWarning, "%v", err)
+		}
 		return err
 	}
 
 	// Retry logic for install script execution
-	// This helps with transient network issues during binary downloads
+	// Each download is already retried inside the script, this covers transient failures of the other steps
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
-		err = r.CmdRunner.RunCmd(ctx, installScript)
+		err = r.CmdRunner.RunCmd(ctx, installEnv+installScript)
 		if err == nil {
 			break
 		}
@@ -281,19 +742,131 @@ func (r *HostReconciler) executeInstallerController(ctx context.Context, byoHost
 
 	if err != nil {
 		logger.Error(err, "error executing installation script after retries")
-		r.Recorder.Event(byoHost, corev1.EventTypeWarning, "InstallScriptExecutionFailed", "install script execution failed")
-		conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded, infrastructurev1beta1.K8sComponentsInstallationFailedReason, clusterv1.ConditionSeverityInfo, "")
+		logTail := r.bootstrapLogTail(ctx)
+		r.Recorder.Event(byoHost, corev1.EventTypeWarning, "InstallScriptExecutionFailed", withLogTail("install script execution failed", logTail))
+		conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded, infrastructurev1beta1.K8sComponentsInstallationFailedReason, clusterv1.ConditionSeverityInfo, "%s", logTail)
 		return err
 	}
+	r.recordInstallScript(byoHost, installScript)
 	return nil
 }
 
+// bootstrapLogTail returns the last lines of the BootstrapLogPath, bounded to bootstrapLogTailLines
+// and bootstrapLogTailBytes, so a failure can be diagnosed without access to the host.
+// It is empty when no log is configured or the log cannot be read.
+func (r *HostReconciler) bootstrapLogTail(ctx context.Context) string {
+	if r.BootstrapLogPath == "" {
+		return ""
+	}
+	tail, err := readLogTail(r.BootstrapLogPath, bootstrapLogTailLines, bootstrapLogTailBytes)
+	if err != nil {
+		// The agent may not log to a file, e.g. when run by systemd with the output in the journal
+		if os.IsNotExist(err) {
+			return ""
+		}
+		ctrl.LoggerFrom(ctx).Error(err, "failed to read the bootstrap log", "path", r.BootstrapLogPath)
+		return ""
+	}
+	return tail
+}
+
+// readLogTail returns at most the last maxLines lines of the file at path, dropping the oldest
+// of them until they fit in maxBytes. Only the last maxBytes of the file are read.
+func readLogTail(path string, maxLines, maxBytes int) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	offset := info.Size() - int64(maxBytes)
+	if offset < 0 {
+		offset = 0
+	}
+	data := make([]byte, info.Size()-offset)
+	if _, err = f.ReadAt(data, offset); err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	// The first line is partial when the file was read from an offset
+	if offset > 0 && len(lines) > 1 {
+		lines = lines[1:]
+	}
+	if len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// withLogTail appends the tail of the bootstrap log, if any, to the message of a failure event
+func withLogTail(message, logTail string) string {
+	if logTail == "" {
+		return message
+	}
+	return message + ", last lines of the log:\n" + logTail
+}
+
+// installEnvNameRegexp matches the names of the variables that can be exported by the shell
+var installEnvNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// installEnvExports renders the install env of a ByoHost as export statements to prepend to the
+// install script, sorted by name. The values are single quoted, so they are not expanded.
+func installEnvExports(env map[string]string) (string, error) {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		if !installEnvNameRegexp.MatchString(name) {
+			return "", fmt.Errorf("%q is not a valid environment variable name", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var exports strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&exports, "export %s='%s'\n", name, strings.ReplaceAll(env[name], "'", `'\''`))
+	}
+	return exports.String(), nil
+}
+
+// recordInstallScript stores the sha256 and, when configured, the truncated content of the
+// rendered install script on the ByoHost, so operators can audit what ran on the host
+func (r *HostReconciler) recordInstallScript(byoHost *infrastructurev1beta1.ByoHost, installScript string) {
+	if !r.RecordInstallScript {
+		return
+	}
+	if byoHost.Annotations == nil {
+		byoHost.Annotations = map[string]string{}
+	}
+	sum := sha256.Sum256([]byte(installScript))
+	byoHost.Annotations[infrastructurev1beta1.InstallScriptHashAnnotation] = hex.EncodeToString(sum[:])
+
+	if r.InstallScriptAuditBytes <= 0 {
+		delete(byoHost.Annotations, infrastructurev1beta1.InstallScriptAnnotation)
+		return
+	}
+	limit := r.InstallScriptAuditBytes
+	if limit > MaxInstallScriptAuditBytes {
+		limit = MaxInstallScriptAuditBytes
+	}
+	content := installScript
+	if len(content) > limit {
+		content = strings.ToValidUTF8(content[:limit], "")
+	}
+	byoHost.Annotations[infrastructurev1beta1.InstallScriptAnnotation] = content
+}
+
 func (r *HostReconciler) reconcileDelete(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) (ctrl.Result, error) {
 	logger := ctrl.LoggerFrom(ctx)
 	logger.Info("reconcile delete - performing host cleanup")
 
 	// Perform cleanup
-	if err := r.hostCleanUp(ctx, byoHost); err != nil {
+	result, err := r.hostCleanUp(ctx, byoHost)
+	if err != nil {
 		logger.Error(err, "failed to cleanup host during delete")
 		// Check if cleanup failed due to permanent error
 		// If it's a permanent error (e.g., Agent was force-killed), proceed anyway
@@ -303,6 +876,9 @@ func (r *HostReconciler) reconcileDelete(ctx context.Context, byoHost *infrastru
 		} else {
 			return ctrl.Result{RequeueAfter: 30 * time.Second}, err
 		}
+	} else if !result.IsZero() {
+		// The Node is being drained
+		return result, nil
 	}
 
 	logger.Info("Cleanup completed")
@@ -343,11 +919,15 @@ func (r *HostReconciler) parseScript(ctx context.Context, script string, hostnam
 	data, err := cloudinit.TemplateParser{
 		Template: map[string]string{
 			"BundleDownloadPath": r.DownloadPath,
+			"BundleCachePath":    r.BundleCachePath,
 			"Hostname":           hostname,
 		},
+		// An unknown token would otherwise be rendered as "<no value>" and only fail in the shell.
+		// Literals written as {{"{{"}} are still allowed.
+		Options: []string{"missingkey=error"},
 	}.ParseTemplate(script)
 	if err != nil {
-		return "", fmt.Errorf("unable to apply install parsed template to the data object")
+		return "", fmt.Errorf("script contains a template token that can not be resolved, only BundleDownloadPath, BundleCachePath and Hostname are supported: %w", err)
 	}
 	return data, nil
 }
@@ -443,9 +1023,18 @@ func (r *HostReconciler) SetupWithManager(ctx context.Context, mgr manager.Manag
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrastructurev1beta1.ByoHost{}).
 		WithEventFilter(predicates.ResourceNotPaused(ctrl.LoggerFrom(ctx))).
+		WithEventFilter(ownByoHost(r.HostName)).
 		Complete(r)
 }
 
+// ownByoHost filters the events down to those of the ByoHost of the given name, or lets all events
+// through when the name is empty
+func ownByoHost(hostName string) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(object client.Object) bool {
+		return hostName == "" || object.GetName() == hostName
+	})
+}
+
 // cleanup /run/kubeadm, /etc/cni/net.d dirs to remove any stale config on the host
 func (r *HostReconciler) cleank8sdirectories(ctx context.Context) error {
 	logger := ctrl.LoggerFrom(ctx)
@@ -474,15 +1063,32 @@ func (r *HostReconciler) cleank8sdirectories(ctx context.Context) error {
 	return nil
 }
 
-func (r *HostReconciler) hostCleanUp(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
+func (r *HostReconciler) hostCleanUp(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) (ctrl.Result, error) {
 	logger := ctrl.LoggerFrom(ctx)
+
+	// Drain the Node before anything of the host is torn down, the cleanup is requeued while it is drained
+	if timeout, ok := gracefulDrainTimeout(ctx, byoHost); ok && !r.DryRunUninstall {
+		if result := r.drainNode(ctx, byoHost, timeout); !result.IsZero() {
+			return result, nil
+		}
+	}
+
 	logger.Info("cleaning up host")
+	r.bootstrapStartedAt = time.Time{}
+	r.installDuration = 0
+	r.bootstrapFiles = nil
+	r.bootstrapSecretVersion = ""
+	r.kubeletStartFailures = 0
 
 	// Always try to reset and delete the Node when cleanup is triggered
 	// This ensures Node is deleted even if K8sComponentsInstallationSucceeded condition is False
-	logger.Info("resetting node with retry")
-	if err := r.resetNodeWithRetry(ctx, byoHost); err != nil {
-		logger.Error(err, "failed to reset node after multiple attempts, continuing cleanup")
+	if r.DryRunUninstall {
+		r.dryRunResetNode(ctx, byoHost)
+	} else {
+		logger.Info("resetting node with retry")
+		if err := r.resetNodeWithRetry(ctx, byoHost); err != nil {
+			logger.Error(err, "failed to reset node after multiple attempts, continuing cleanup")
+		}
 	}
 
 	k8sComponentsInstallationSucceeded := conditions.Get(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded)
@@ -500,7 +1106,10 @@ func (r *HostReconciler) hostCleanUp(ctx context.Context, byoHost *infrastructur
 				uninstallScript, err = r.parseScript(ctx, uninstallScript, byoHost.Name)
 				if err != nil {
 					logger.Error(err, "error parsing Uninstallation script")
-					return err
+					return ctrl.Result{}, err
+				}
+				if r.DryRunUninstall {
+					logger.Info("Dry run, not executing the Uninstall script", "script", uninstallScript)
 				}
 				// err = r.CmdRunner.RunCmd(ctx, uninstallScript)
 				// if err != nil {
@@ -519,12 +1128,12 @@ func (r *HostReconciler) hostCleanUp(ctx context.Context, byoHost *infrastructur
 
 	err := r.removeSentinelFile(ctx, byoHost)
 	if err != nil {
-		return err
+		return ctrl.Result{}, err
 	}
 
 	err = r.deleteEndpointIP(ctx, byoHost)
 	if err != nil {
-		return err
+		return ctrl.Result{}, err
 	}
 
 	byoHost.Spec.InstallationSecret = nil
@@ -533,11 +1142,11 @@ func (r *HostReconciler) hostCleanUp(ctx context.Context, byoHost *infrastructur
 	conditions.MarkFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded, infrastructurev1beta1.K8sNodeAbsentReason, clusterv1.ConditionSeverityInfo, "")
 
 	// Remove Machine ID file
-	if err := os.Remove(machineIDFile); err != nil && !os.IsNotExist(err) {
+	if err := os.Remove(r.hostPath(machineIDFile)); err != nil && !os.IsNotExist(err) {
 		logger.Error(err, "failed to remove machine ID file")
 	}
 
-	return nil
+	return ctrl.Result{}, nil
 }
 
 func (r *HostReconciler) resetNode(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
@@ -548,7 +1157,7 @@ func (r *HostReconciler) resetNode(ctx context.Context, byoHost *infrastructurev
 	path, err := exec.LookPath("kubeadm")
 	if err == nil && path != "" {
 		logger.Info("Found kubeadm, running kubeadm reset")
-		err := r.CmdRunner.RunCmd(ctx, KubeadmResetCommand)
+		err := r.CmdRunner.RunCmd(ctx, r.kubeadmResetCommand())
 		if err != nil {
 			logger.Error(err, "kubeadm reset failed, falling back to manual cleanup")
 		}
@@ -560,26 +1169,13 @@ func (r *HostReconciler) resetNode(ctx context.Context, byoHost *infrastructurev
 	// This handles both binary installations and failed kubeadm resets
 
 	// 1. Stop services
-	_ = r.CmdRunner.RunCmd(ctx, "systemctl stop kubelet")
-	_ = r.CmdRunner.RunCmd(ctx, "systemctl stop containerd")
-	if byoHost.Spec.ManageKubeProxy {
-		_ = r.CmdRunner.RunCmd(ctx, "systemctl stop kube-proxy")
+	for _, cmd := range stopServicesCommands(byoHost) {
+		_ = r.CmdRunner.RunCmd(ctx, cmd)
 	}
 
 	// 2. Clean up files
-	filesToRemove := []string{
-		"/etc/kubernetes/bootstrap-kubeconfig",
-		"/etc/kubernetes/kubelet.conf",
-		"/etc/kubernetes/pki/ca.crt",
-		"/var/lib/kubelet/config.yaml",
-		"/etc/kubernetes/kube-proxy.kubeconfig",
-		"/var/lib/kube-proxy/kube-proxy-config.yaml",
-		"/etc/systemd/system/kubelet.service",
-		"/etc/systemd/system/kube-proxy.service",
-	}
-
-	for _, f := range filesToRemove {
-		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+	for _, f := range resetNodeFiles {
+		if err := os.Remove(r.hostPath(f)); err != nil && !os.IsNotExist(err) {
 			logger.V(4).Info("Failed to remove file", "file", f, "error", err)
 		}
 	}
@@ -588,19 +1184,12 @@ func (r *HostReconciler) resetNode(ctx context.Context, byoHost *infrastructurev
 	_ = r.CmdRunner.RunCmd(ctx, "systemctl daemon-reload")
 
 	// 3. Remove directories
-	dirsToRemove := []string{
-		"/var/lib/kubelet",
-		"/var/lib/kube-proxy",
-		"/var/lib/etcd",
-		"/etc/kubernetes",
-		"/run/kubernetes",
-		//"/var/lib/cni",
-		//"/etc/cni",
-		//"/opt/cni",
-	}
-
-	for _, d := range dirsToRemove {
-		if err := os.RemoveAll(d); err != nil {
+	for _, d := range r.resetNodeDirs() {
+		if err := ValidateRemovableDir(d); err != nil {
+			logger.Error(err, "Not removing directory", "dir", d)
+			continue
+		}
+		if err := os.RemoveAll(r.hostPath(d)); err != nil {
 			logger.V(4).Info("Failed to remove directory", "dir", d, "error", err)
 		}
 	}
@@ -623,6 +1212,210 @@ func (r *HostReconciler) resetNode(ctx context.Context, byoHost *infrastructurev
 	return nil
 }
 
+// gracefulDrainTimeout returns the timeout of the drain of the Node of the host before its reset, and whether the
+// host asks for a graceful drain. An invalid timeout falls back to the DefaultGracefulDrainTimeout.
+func gracefulDrainTimeout(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) (time.Duration, bool) {
+	value, ok := byoHost.Annotations[infrastructurev1beta1.GracefulDrainAnnotation]
+	if !ok {
+		return 0, false
+	}
+	if value == "" {
+		return DefaultGracefulDrainTimeout, true
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		ctrl.LoggerFrom(ctx).Info("Invalid graceful drain timeout, using the default", "value", value, "default", DefaultGracefulDrainTimeout)
+		return DefaultGracefulDrainTimeout, true
+	}
+	return timeout, true
+}
+
+// drainNode drains the Node of the host before its reset, so its pods are stopped gracefully and their volumes
+// detached. The host is requeued every drainRetryInterval while pods are left on the Node, until the timeout
+// elapsed. The reset is not held up by a failed drain, the pods left are killed by the reset as before.
+func (r *HostReconciler) drainNode(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost, timeout time.Duration) ctrl.Result {
+	logger := ctrl.LoggerFrom(ctx)
+	if r.drainStartedAt.IsZero() {
+		logger.Info("Draining k8s Node", "node", byoHost.Name, "timeout", timeout)
+		r.drainStartedAt = time.Now()
+	}
+
+	remaining, err := r.evictNodePods(ctx, byoHost.Name)
+	if err == nil && remaining == 0 {
+		r.drainStartedAt = time.Time{}
+		r.Recorder.Event(byoHost, corev1.EventTypeNormal, "DrainK8sNodeSucceeded", "k8s Node drained")
+		return ctrl.Result{}
+	}
+	if time.Since(r.drainStartedAt) < timeout && !errors.Is(err, errNodeNotDrained) {
+		if err != nil {
+			logger.Error(err, "failed to drain the node, retrying", "node", byoHost.Name)
+		} else {
+			logger.Info("Waiting for the pods of the node to be evicted", "node", byoHost.Name, "pods", remaining)
+		}
+		return ctrl.Result{RequeueAfter: drainRetryInterval}
+	}
+	if err == nil {
+		err = fmt.Errorf("timed out after %s draining node %s, %d pods left", timeout, byoHost.Name, remaining)
+	}
+	r.drainStartedAt = time.Time{}
+	logger.Error(err, "failed to drain the node, resetting it anyway", "node", byoHost.Name)
+	r.Recorder.Eventf(byoHost, corev1.EventTypeWarning, "DrainK8sNodeFailed", "Node drain failed: %v", err)
+	return ctrl.Result{}
+}
+
+// evictNodePods drains the Node of the host through the workload cluster client of the DrainKubeconfig
+func (r *HostReconciler) evictNodePods(ctx context.Context, nodeName string) (int, error) {
+	if r.DrainKubeconfig == "" {
+		return 0, fmt.Errorf("%w: no drain kubeconfig of the workload cluster configured", errNodeNotDrained)
+	}
+	if r.drainClient == nil {
+		c, err := newDrainClient(r.DrainKubeconfig)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create the client of the workload cluster: %w", err)
+		}
+		r.drainClient = c
+	}
+	return evictNodePods(ctx, r.drainClient, nodeName)
+}
+
+// evictNodePods cordons the Node and evicts its pods, and returns how many pods are left on the Node. Evictions
+// refused by a PodDisruptionBudget are retried by the next call. DaemonSet and static pods are left, the reset
+// stops them. A Node not found is reported with errNodeNotDrained.
+func evictNodePods(ctx context.Context, c client.Client, nodeName string) (int, error) {
+	logger := ctrl.LoggerFrom(ctx)
+
+	node := &corev1.Node{}
+	if err := c.Get(ctx, types.NamespacedName{Name: nodeName}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return 0, fmt.Errorf("%w: node %s not found in the workload cluster", errNodeNotDrained, nodeName)
+		}
+		return 0, fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+	if !node.Spec.Unschedulable {
+		patchBase := client.MergeFrom(node.DeepCopy())
+		node.Spec.Unschedulable = true
+		if err := c.Patch(ctx, node, patchBase); err != nil {
+			return 0, fmt.Errorf("failed to cordon node %s: %w", nodeName, err)
+		}
+	}
+
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods, client.MatchingFields{"spec.nodeName": nodeName}); err != nil {
+		return 0, fmt.Errorf("failed to list the pods of node %s: %w", nodeName, err)
+	}
+	remaining := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !evictable(pod) {
+			continue
+		}
+		remaining++
+		if !pod.DeletionTimestamp.IsZero() {
+			continue
+		}
+		eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}}
+		if err := c.SubResource("eviction").Create(ctx, pod, eviction); err != nil && !apierrors.IsNotFound(err) {
+			// Too many requests when a PodDisruptionBudget does not allow the disruption yet
+			logger.V(4).Info("Eviction refused, retrying", "pod", client.ObjectKeyFromObject(pod), "error", err)
+		}
+	}
+	return remaining, nil
+}
+
+// newKubeconfigClient builds a client for the cluster of the kubeconfig
+func newKubeconfigClient(kubeconfigPath string) (client.Client, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build config from %s: %w", kubeconfigPath, err)
+	}
+	return client.New(config, client.Options{})
+}
+
+// evictable returns whether the pod is evicted by the drain, pods of DaemonSets and static pods are not and
+// completed pods need not be
+func evictable(pod *corev1.Pod) bool {
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return false
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+		return false
+	}
+	return pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed
+}
+
+// resetNodeFiles are the files of the k8s components removed by the node reset
+var resetNodeFiles = []string{
+	"/etc/kubernetes/bootstrap-kubeconfig",
+	"/etc/kubernetes/kubelet.conf",
+	"/etc/kubernetes/pki/ca.crt",
+	"/var/lib/kubelet/config.yaml",
+	"/etc/kubernetes/kube-proxy.kubeconfig",
+	"/var/lib/kube-proxy/kube-proxy-config.yaml",
+	"/etc/systemd/system/kubelet.service",
+	"/etc/systemd/system/kube-proxy.service",
+}
+
+// resetNodeDirs returns the directories of the k8s components removed by the node reset
+func (r *HostReconciler) resetNodeDirs() []string {
+	dirs := []string{
+		"/var/lib/kubelet",
+		"/var/lib/kube-proxy",
+		"/var/lib/etcd",
+		"/etc/kubernetes",
+		"/run/kubernetes",
+		//"/var/lib/cni",
+		//"/etc/cni",
+		//"/opt/cni",
+	}
+	if r.kubeletCertDir() != DefaultKubeletCertDir {
+		dirs = append(dirs, r.kubeletCertDir())
+	}
+	if r.kubeletStaticPodPath() != kubeletconfig.DefaultStaticPodPath {
+		dirs = append(dirs, r.kubeletStaticPodPath())
+	}
+	return dirs
+}
+
+// protectedDirs are the system directories the node reset never removes, even when configured as the kubelet
+// certificate or static pod directory
+var protectedDirs = map[string]bool{
+	"/bin": true, "/boot": true, "/dev": true, "/etc": true, "/home": true, "/lib": true, "/lib64": true,
+	"/opt": true, "/proc": true, "/root": true, "/run": true, "/sbin": true, "/srv": true, "/sys": true,
+	"/tmp": true, "/usr": true, "/usr/bin": true, "/usr/lib": true, "/usr/local": true, "/usr/local/bin": true,
+	"/usr/sbin": true, "/var": true, "/var/lib": true, "/var/log": true, "/var/run": true, "/etc/systemd": true,
+	"/etc/systemd/system": true, "/var/lib/containerd": true, "/var/lib/docker": true,
+}
+
+// ValidateRemovableDir checks that a directory may be removed recursively by the node reset: it must be an
+// absolute path below a top-level directory and not one of the protected system directories
+func ValidateRemovableDir(dir string) error {
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("refusing to remove %q, the path must be absolute", dir)
+	}
+	cleaned := filepath.Clean(dir)
+	if strings.Count(cleaned, "/") < 2 || protectedDirs[cleaned] {
+		return fmt.Errorf("refusing to remove %q, it is a system directory", dir)
+	}
+	return nil
+}
+
+// stopServicesCommands returns the commands stopping the services of the node on reset
+func stopServicesCommands(byoHost *infrastructurev1beta1.ByoHost) []string {
+	cmds := []string{"systemctl stop kubelet", "systemctl stop containerd"}
+	if byoHost.Spec.ManageKubeProxy {
+		cmds = append(cmds, "systemctl stop kube-proxy")
+	}
+	return cmds
+}
+
+// dryRunResetNode logs what resetNode would run and remove, without touching the host or the Node
+func (r *HostReconciler) dryRunResetNode(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) {
+	logger := ctrl.LoggerFrom(ctx)
+	cmds := append([]string{r.kubeadmResetCommand()}, stopServicesCommands(byoHost)...)
+	cmds = append(cmds, "systemctl daemon-reload")
+	logger.Info("Dry run, not resetting k8s Node", "commands", cmds, "files", resetNodeFiles, "dirs", r.resetNodeDirs(), "node", byoHost.Name)
+}
+
 // resetNodeWithRetry attempts to reset the node with retry logic
 func (r *HostReconciler) resetNodeWithRetry(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
 	logger := ctrl.LoggerFrom(ctx)
@@ -662,6 +1455,13 @@ func (r *HostReconciler) bootstrapK8sNode(ctx context.Context, bootstrapScript s
 	logger := ctrl.LoggerFrom(ctx)
 	logger.Info("Bootstraping k8s Node")
 
+	if r.BootstrapReportPath != "" {
+		// Record the files written by the bootstrap, in either join mode, for the bootstrap report
+		fileWriter := r.FileWriter
+		r.FileWriter = fileRecorder{IFileWriter: fileWriter, paths: &r.bootstrapFiles}
+		defer func() { r.FileWriter = fileWriter }()
+	}
+
 	// Check if TLS Bootstrap mode is enabled
 	if byoHost.Spec.JoinMode == infrastructurev1beta1.JoinModeTLSBootstrap {
 		return r.bootstrapK8sNodeTLS(ctx, byoHost)
@@ -674,6 +1474,7 @@ func (r *HostReconciler) bootstrapK8sNode(ctx context.Context, bootstrapScript s
 		Hostname:              byoHost.Name,
 		Labels:                byoHost.Spec.Labels,
 		Taints:                byoHost.Spec.Taints,
+		NodeIP:                defaultInterfaceIP(byoHost.Status.Network),
 	}.Execute(ctx, bootstrapScript)
 }
 
@@ -683,22 +1484,41 @@ func (r *HostReconciler) bootstrapK8sNode(ctx context.Context, bootstrapScript s
 // 2. Writes the necessary configuration files to the host
 // 3. Starts kubelet with TLS bootstrap configuration
 // 4. Optionally starts kube-proxy if ManageKubeProxy is true
+// Each completed phase is recorded on the ByoHost. When the files were written by a previous attempt
+// of the agent that failed to start the services, only the services are started, unless the TLS
+// bootstrap secret changed since, e.g. a rotated bootstrap token, or the agent restarted since.
 func (r *HostReconciler) bootstrapK8sNodeTLS(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
 	logger := ctrl.LoggerFrom(ctx)
 	logger.Info("Bootstrapping k8s Node using TLS Bootstrap mode")
 
-	// Read the TLS bootstrap secret
-	if byoHost.Spec.BootstrapSecret == nil {
-		return fmt.Errorf("bootstrap secret is required for TLS Bootstrap mode")
+	secret, err := r.getTLSBootstrapSecret(ctx, byoHost)
+	if err != nil {
+		return err
+	}
+	if byoHost.Annotations[infrastructurev1beta1.BootstrapPhaseAnnotation] == bootstrapPhaseFilesWritten &&
+		secret.ResourceVersion == r.bootstrapSecretVersion {
+		logger.Info("Bootstrap files already written, resuming from starting kubelet")
+	} else {
+		if err := r.writeTLSBootstrapFiles(ctx, byoHost, secret); err != nil {
+			return err
+		}
+		r.bootstrapSecretVersion = secret.ResourceVersion
+		setBootstrapPhase(byoHost, bootstrapPhaseFilesWritten)
 	}
 
-	secret := &corev1.Secret{}
-	if err := r.Client.Get(ctx, types.NamespacedName{
-		Name:      byoHost.Spec.BootstrapSecret.Name,
-		Namespace: byoHost.Spec.BootstrapSecret.Namespace,
-	}, secret); err != nil {
-		return fmt.Errorf("failed to get TLS bootstrap secret: %w", err)
+	if err := r.startTLSBootstrapServices(ctx, byoHost); err != nil {
+		return err
 	}
+	setBootstrapPhase(byoHost, bootstrapPhaseKubeletStarted)
+
+	logger.Info("Successfully bootstrapped k8s node using TLS Bootstrap mode")
+	return nil
+}
+
+// writeTLSBootstrapFiles writes the CA certificate, kubeconfigs, configurations and kubelet unit of the
+// TLS Bootstrap mode from the TLS bootstrap secret
+func (r *HostReconciler) writeTLSBootstrapFiles(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost, secret *corev1.Secret) error {
+	logger := ctrl.LoggerFrom(ctx)
 
 	// Write CA certificate
 	var caCertData string
@@ -732,6 +1552,7 @@ func (r *HostReconciler) bootstrapK8sNodeTLS(ctx context.Context, byoHost *infra
 				Path:        caPath,
 				Content:     caCertData,
 				Permissions: "0644",
+				Owner:       r.FileOwner,
 			}); err != nil {
 				logger.V(4).Info("failed to write CA certificate", "path", caPath, "error", err)
 				continue
@@ -751,6 +1572,7 @@ func (r *HostReconciler) bootstrapK8sNodeTLS(ctx context.Context, byoHost *infra
 			Path:        bootstrapKubeconfigPath,
 			Content:     string(bootstrapKubeconfig),
 			Permissions: "0600",
+			Owner:       r.FileOwner,
 		}); err != nil {
 			return fmt.Errorf("failed to write bootstrap kubeconfig: %w", err)
 		}
@@ -758,20 +1580,48 @@ func (r *HostReconciler) bootstrapK8sNodeTLS(ctx context.Context, byoHost *infra
 	}
 
 	// Write kubelet configuration if provided, otherwise generate a default
-	kubeletConfigPath := "/var/lib/kubelet/config.yaml"
+	kubeletConfigPath := kubeletConfigFile
 	if err := r.FileWriter.MkdirIfNotExists("/var/lib/kubelet"); err != nil {
 		return fmt.Errorf("failed to create /var/lib/kubelet directory: %w", err)
 	}
 
+	if err := r.validateKubeletTLSSettings(byoHost); err != nil {
+		return err
+	}
+
 	var kubeletConfigContent string
 	if kubeletConfig, ok := secret.Data["kubelet-config.yaml"]; ok {
 		kubeletConfigContent = string(kubeletConfig)
 		logger.Info("Using kubelet config from TLS bootstrap secret")
+		if verbosity, set := r.kubeletLogVerbosity(byoHost); set {
+			config, err := kubeletconfig.WithLogVerbosity(kubeletConfigContent, verbosity)
+			if err != nil {
+				return err
+			}
+			kubeletConfigContent = config
+			logger.Info("Set kubelet log verbosity", "verbosity", verbosity)
+		}
+		if minVersion, cipherSuites := r.kubeletTLSSettings(byoHost); minVersion != "" || len(cipherSuites) > 0 {
+			config, err := kubeletconfig.WithTLSSettings(kubeletConfigContent, minVersion, cipherSuites)
+			if err != nil {
+				return err
+			}
+			kubeletConfigContent = config
+			logger.Info("Set kubelet TLS settings", "minVersion", minVersion, "cipherSuites", cipherSuites)
+		}
+		config, err := kubeletconfig.WithStaticPodPath(kubeletConfigContent, r.kubeletStaticPodPath())
+		if err != nil {
+			return err
+		}
+		kubeletConfigContent = config
 	} else {
 		// Generate default kubelet configuration as fallback
-		kubeletConfigContent = generateDefaultKubeletConfig()
+		kubeletConfigContent = r.defaultKubeletConfig(byoHost)
 		logger.Info("No kubelet config in secret, using default configuration")
 	}
+	if err := validateConfigYAML(ctx, "kubelet", kubeletConfigContent); err != nil {
+		return err
+	}
 
 	if err := r.FileWriter.WriteToFile(&cloudinit.Files{
 		Path:        kubeletConfigPath,
@@ -784,6 +1634,113 @@ func (r *HostReconciler) bootstrapK8sNodeTLS(ctx context.Context, byoHost *infra
 
 	// Write kube-proxy configuration (always write for TLS Bootstrap mode, even if ManageKubeProxy is false)
 	// This allows the external kube-proxy to use the configuration
+	if byoHost.Spec.DisableKubeProxy {
+		logger.Info("kube-proxy is disabled, skipping kube-proxy config and kubeconfig")
+	} else if err := r.writeKubeProxyFiles(ctx, byoHost, secret); err != nil {
+		return err
+	}
+
+	// Start kubelet with TLS bootstrap configuration
+	kubeletArgs := r.kubeletArgs(ctx, byoHost)
+
+	// Create critical directories for kubelet
+	// These must exist before kubelet starts to avoid errors
+	criticalDirs := []string{
+		r.kubeletStaticPodPath(), // For static pod manifests
+		r.kubeletCertDir(),       // For kubelet certificates
+	}
+	if !byoHost.Spec.DisableKubeProxy {
+		criticalDirs = append(criticalDirs, "/var/lib/kube-proxy") // For kube-proxy state
+	}
+	for _, dir := range criticalDirs {
+		if err := r.FileWriter.MkdirIfNotExists(dir); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+		logger.V(4).Info("Created directory", "path", dir)
+	}
+
+	// Create and start kubelet systemd service
+	kubeletServiceContent := r.serviceUnit(ctx, fmt.Sprintf(kubeletServiceUnit, strings.Join(kubeletArgs, " ")))
+
+	if err := r.FileWriter.WriteToFile(&cloudinit.Files{
+		Path:        "/etc/systemd/system/kubelet.service",
+		Content:     kubeletServiceContent,
+		Permissions: "0644",
+	}); err != nil {
+		return fmt.Errorf("failed to write kubelet service: %w", err)
+	}
+	logger.Info("Wrote kubelet service file")
+	return nil
+}
+
+// startTLSBootstrapServices starts kubelet, and kube-proxy when managed by the agent, from the files
+// written by writeTLSBootstrapFiles
+func (r *HostReconciler) startTLSBootstrapServices(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
+	logger := ctrl.LoggerFrom(ctx)
+
+	if err := r.CmdRunner.RunCmd(ctx, "systemctl daemon-reload"); err != nil {
+		return fmt.Errorf("failed to reload systemd: %w", err)
+	}
+
+	if err := r.startKubelet(ctx); err != nil {
+		return fmt.Errorf("%w: %v", errKubeletStartFailed, err)
+	}
+	logger.Info("Started kubelet service")
+
+	// Start kube-proxy if ManageKubeProxy is true
+	if manageKubeProxy(byoHost) {
+		kubeProxyServiceContent := r.serviceUnit(ctx, kubeProxyServiceUnit)
+		if err := r.FileWriter.WriteToFile(&cloudinit.Files{
+			Path:        "/etc/systemd/system/kube-proxy.service",
+			Content:     kubeProxyServiceContent,
+			Permissions: "0644",
+		}); err != nil {
+			return fmt.Errorf("failed to write kube-proxy service: %w", err)
+		}
+		logger.Info("Wrote kube-proxy service file")
+
+		if err := r.CmdRunner.RunCmd(ctx, "systemctl daemon-reload"); err != nil {
+			return fmt.Errorf("failed to reload systemd for kube-proxy: %w", err)
+		}
+		if err := r.CmdRunner.RunCmd(ctx, "systemctl enable --now kube-proxy"); err != nil {
+			return fmt.Errorf("failed to enable/start kube-proxy: %w", err)
+		}
+		logger.Info("Started kube-proxy service")
+	}
+	return nil
+}
+
+// startKubelet enables and starts kubelet. The failure reason reported by systemd is added to the error.
+// Retrying after failed attempts is left to the reconcile, so it does not block the agent.
+func (r *HostReconciler) startKubelet(ctx context.Context) error {
+	if r.kubeletStartFailures > 0 {
+		// A unit failing repeatedly hits the start rate limit of systemd, which refuses to start it again
+		_ = r.CmdRunner.RunCmd(ctx, "systemctl reset-failed kubelet")
+	}
+	err := r.CmdRunner.RunCmd(ctx, "systemctl enable --now kubelet")
+	if err == nil {
+		return nil
+	}
+	if reason := serviceFailureReason(ctx, "kubelet"); reason != "" {
+		err = fmt.Errorf("%w (%s)", err, reason)
+	}
+	return err
+}
+
+// systemdFailureReason returns the result and exit status systemd reports for the unit, e.g.
+// "Result=exit-code ExecMainStatus=1", empty when they cannot be read
+func systemdFailureReason(ctx context.Context, unit string) string {
+	out, err := exec.CommandContext(ctx, "systemctl", "show", unit, "--property=Result,ExecMainStatus").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(string(out)), " ")
+}
+
+// writeKubeProxyFiles writes the kube-proxy configuration and the kube-proxy kubeconfig in TLS Bootstrap mode
+func (r *HostReconciler) writeKubeProxyFiles(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost, secret *corev1.Secret) error {
+	logger := ctrl.LoggerFrom(ctx)
+
 	kubeProxyConfigPath := "/var/lib/kube-proxy/kube-proxy-config.yaml"
 	if err := r.FileWriter.MkdirIfNotExists("/var/lib/kube-proxy"); err != nil {
 		return fmt.Errorf("failed to create /var/lib/kube-proxy directory: %w", err)
@@ -795,9 +1752,21 @@ func (r *HostReconciler) bootstrapK8sNodeTLS(ctx context.Context, byoHost *infra
 		logger.Info("Using kube-proxy config from TLS bootstrap secret")
 	} else {
 		// Generate default kube-proxy configuration as fallback
-		kubeProxyConfigContent = generateDefaultKubeProxyConfig()
+		kubeProxyConfigContent = generateDefaultKubeProxyConfig(ctx, byoHost)
 		logger.Info("No kube-proxy config in secret, using default configuration")
 	}
+	if manageKubeProxy(byoHost) {
+		// The config of the cluster is shared by all the nodes, pin it to the node of this host
+		withOverride, err := withKubeProxyHostnameOverride(kubeProxyConfigContent, byoHost.Name)
+		if err != nil {
+			logger.Error(err, "failed to set the hostnameOverride of the kube-proxy config, keeping it as is")
+		} else {
+			kubeProxyConfigContent = withOverride
+		}
+	}
+	if err := validateConfigYAML(ctx, "kube-proxy", kubeProxyConfigContent); err != nil {
+		return err
+	}
 
 	if err := r.FileWriter.WriteToFile(&cloudinit.Files{
 		Path:        kubeProxyConfigPath,
@@ -860,20 +1829,26 @@ users:
 		Path:        kubeProxyKubeconfigPath,
 		Content:     kubeProxyKubeconfigContent,
 		Permissions: "0600",
+		Owner:       r.FileOwner,
 	}); err != nil {
 		return fmt.Errorf("failed to write kube-proxy kubeconfig: %w", err)
 	}
 	logger.Info("Wrote kube-proxy kubeconfig using certificate from ~/.byoh/config", "path", kubeProxyKubeconfigPath)
+	return nil
+}
+
+// kubeletArgs returns the arguments kubelet is started with in TLS Bootstrap mode
+func (r *HostReconciler) kubeletArgs(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) []string {
+	logger := ctrl.LoggerFrom(ctx)
 
-	// Start kubelet with TLS bootstrap configuration
 	kubeletArgs := []string{
 		"--bootstrap-kubeconfig=/etc/kubernetes/bootstrap-kubeconfig",
 		"--kubeconfig=/etc/kubernetes/kubelet.conf",
-		"--cert-dir=/var/lib/kubelet/pki",
+		fmt.Sprintf("--cert-dir=%s", r.kubeletCertDir()),
 		"--config=/var/lib/kubelet/config.yaml",
-		"--rotate-certificates=true",
-		"--rotate-server-certificates=true",
-		"--pod-manifest-path=/etc/kubernetes/manifests",
+		fmt.Sprintf("--rotate-certificates=%t", !r.DisableKubeletCertRotation),
+		fmt.Sprintf("--rotate-server-certificates=%t", !r.DisableKubeletServerCertRotation),
+		fmt.Sprintf("--pod-manifest-path=%s", r.kubeletStaticPodPath()),
 		// Inject provider-id for Cluster Autoscaler compatibility
 		// This matches the behavior in Kubeadm mode (cloudinit interceptor)
 		fmt.Sprintf("--provider-id=%s", common.GenerateProviderID(byoHost.Name)),
@@ -903,108 +1878,82 @@ users:
 		logger.Info("Adding node taints", "taints", byoHost.Spec.Taints)
 	}
 
-	// Create critical directories for kubelet
-	// These must exist before kubelet starts to avoid errors
-	criticalDirs := []string{
-		"/etc/kubernetes/manifests", // For static pod manifests
-		"/var/lib/kubelet/pki",      // For kubelet certificates
-		"/var/lib/kube-proxy",       // For kube-proxy state
-	}
-	for _, dir := range criticalDirs {
-		if err := r.FileWriter.MkdirIfNotExists(dir); err != nil {
-			return fmt.Errorf("failed to create directory %s: %w", dir, err)
-		}
-		logger.V(4).Info("Created directory", "path", dir)
-	}
-
-	// Create and start kubelet systemd service
-	kubeletServiceContent := fmt.Sprintf(`[Unit]
-Description=kubelet: The Kubernetes Node Agent
-Documentation=https://kubernetes.io/docs/home/
-Wants=network-online.target
-After=network-online.target
-After=containerd.service
-Wants=containerd.service
-
-[Service]
-ExecStart=/usr/local/bin/kubelet %s
-Restart=always
-StartLimitInterval=0
-RestartSec=10
-# Mount cgroup to support cgroupfs driver (common in binary installs)
-ExecStartPre=-/bin/mount -o remount,rw '/sys/fs/cgroup'
-# Ensure working directory exists
-WorkingDirectory=/var/lib/kubelet
-# Resource accounting
-CPUAccounting=true
-MemoryAccounting=true
-
-[Install]
-WantedBy=multi-user.target
-`, strings.Join(kubeletArgs, " "))
-
-	if err := r.FileWriter.WriteToFile(&cloudinit.Files{
-		Path:        "/etc/systemd/system/kubelet.service",
-		Content:     kubeletServiceContent,
-		Permissions: "0644",
-	}); err != nil {
-		return fmt.Errorf("failed to write kubelet service: %w", err)
+	if r.ContainerRuntimeEndpoint != "" {
+		kubeletArgs = append(kubeletArgs, fmt.Sprintf("--container-runtime-endpoint=%s", r.ContainerRuntimeEndpoint))
 	}
-	logger.Info("Wrote kubelet service file")
 
-	if err := r.CmdRunner.RunCmd(ctx, "systemctl daemon-reload"); err != nil {
-		return fmt.Errorf("failed to reload systemd: %w", err)
+	// Register with the IP of the default interface, multi-NIC hosts would otherwise
+	// register with whatever IP kubelet picks
+	if nodeIP := defaultInterfaceIP(byoHost.Status.Network); nodeIP != "" {
+		kubeletArgs = append(kubeletArgs, fmt.Sprintf("--node-ip=%s", nodeIP))
+		logger.Info("Adding node IP of the default interface", "nodeIP", nodeIP)
 	}
+	return kubeletArgs
+}
 
-	if err := r.CmdRunner.RunCmd(ctx, "systemctl enable --now kubelet"); err != nil {
-		return fmt.Errorf("failed to enable/start kubelet: %w", err)
+// defaultInterfaceIP returns the first global unicast IP of the interface the default gateway sits
+// on, preferring IPv4, or an empty string when the host did not report one
+func defaultInterfaceIP(network []infrastructurev1beta1.NetworkStatus) string {
+	for _, iface := range network {
+		if !iface.IsDefault {
+			continue
+		}
+		var ipv6 string
+		for _, addr := range iface.IPAddrs {
+			ip, _, err := net.ParseCIDR(addr)
+			if err != nil {
+				ip = net.ParseIP(addr)
+			}
+			if ip == nil || !ip.IsGlobalUnicast() {
+				continue
+			}
+			if ip.To4() != nil {
+				return ip.String()
+			}
+			if ipv6 == "" {
+				ipv6 = ip.String()
+			}
+		}
+		return ipv6
 	}
-	logger.Info("Started kubelet service")
-
-	// Start kube-proxy if ManageKubeProxy is true
-	if byoHost.Spec.ManageKubeProxy {
-		kubeProxyServiceContent := `[Unit]
-Description=kube-proxy: The Kubernetes Network Proxy
-Documentation=https://kubernetes.io/docs/home/
-Wants=network-online.target
-After=network-online.target
+	return ""
+}
 
-[Service]
-ExecStart=/usr/local/bin/kube-proxy --config=/var/lib/kube-proxy/kube-proxy-config.yaml
-Restart=always
-StartLimitInterval=0
-RestartSec=10
+// hostPath returns where the FileWriter puts the file of a host path, see cloudinit.HostPath. The files
+// the agent reads or removes go through it, so they are the ones it wrote, e.g. under --root-dir.
+func (r *HostReconciler) hostPath(path string) string {
+	return cloudinit.HostPath(r.FileWriter, path)
+}
 
-[Install]
-WantedBy=multi-user.target
-`
-		if err := r.FileWriter.WriteToFile(&cloudinit.Files{
-			Path:        "/etc/systemd/system/kube-proxy.service",
-			Content:     kubeProxyServiceContent,
-			Permissions: "0644",
-		}); err != nil {
-			return fmt.Errorf("failed to write kube-proxy service: %w", err)
-		}
-		logger.Info("Wrote kube-proxy service file")
+// kubeletCertDir returns the configured kubelet certificate directory or the default one
+func (r *HostReconciler) kubeletCertDir() string {
+	if r.KubeletCertDir == "" {
+		return DefaultKubeletCertDir
+	}
+	return r.KubeletCertDir
+}
 
-		if err := r.CmdRunner.RunCmd(ctx, "systemctl daemon-reload"); err != nil {
-			return fmt.Errorf("failed to reload systemd for kube-proxy: %w", err)
-		}
-		if err := r.CmdRunner.RunCmd(ctx, "systemctl enable --now kube-proxy"); err != nil {
-			return fmt.Errorf("failed to enable/start kube-proxy: %w", err)
-		}
-		logger.Info("Started kube-proxy service")
+// kubeletStaticPodPath returns the configured static pod directory of kubelet, kubeletconfig.DefaultStaticPodPath if unset
+func (r *HostReconciler) kubeletStaticPodPath() string {
+	if r.KubeletStaticPodPath == "" {
+		return kubeletconfig.DefaultStaticPodPath
 	}
+	return r.KubeletStaticPodPath
+}
 
-	logger.Info("Successfully bootstrapped k8s node using TLS Bootstrap mode")
-	return nil
+// kubeadmResetCommand returns the kubeadm reset command, pointed at the configured CRI endpoint if any
+func (r *HostReconciler) kubeadmResetCommand() string {
+	if r.ContainerRuntimeEndpoint == "" {
+		return KubeadmResetCommand
+	}
+	return fmt.Sprintf("%s --cri-socket=%s", KubeadmResetCommand, r.ContainerRuntimeEndpoint)
 }
 
 func (r *HostReconciler) removeSentinelFile(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
 	logger := ctrl.LoggerFrom(ctx)
 	logger.Info("Removing the bootstrap sentinel file")
-	if _, err := os.Stat(bootstrapSentinelFile); !os.IsNotExist(err) {
-		err := os.Remove(bootstrapSentinelFile)
+	if _, err := os.Stat(r.hostPath(bootstrapSentinelFile)); !os.IsNotExist(err) {
+		err := os.Remove(r.hostPath(bootstrapSentinelFile))
 		if err != nil {
 			return errors.Wrapf(err, "failed to delete sentinel file %s", bootstrapSentinelFile)
 		}
@@ -1042,17 +1991,24 @@ func (r *HostReconciler) removeAnnotations(ctx context.Context, byoHost *infrast
 	// Remove Byomachine-name label
 	delete(byoHost.Labels, infrastructurev1beta1.AttachedByoMachineLabel)
 
+	// Remove the node labels and taints the cluster defaults added
+	byoHost.RemoveClusterNodeDefaults()
+
 	// Remove the EndPointIP annotation
 	delete(byoHost.Annotations, infrastructurev1beta1.EndPointIPAnnotation)
+	delete(byoHost.Annotations, infrastructurev1beta1.AppliedEndPointIPAnnotation)
 
 	// Remove the cleanup annotation
 	delete(byoHost.Annotations, infrastructurev1beta1.HostCleanupAnnotation)
 
 	// Remove the cleanup started at annotation
-	delete(byoHost.Annotations, "byoh.infrastructure.cluster.x-k8s.io/cleanup-started-at")
+	delete(byoHost.Annotations, infrastructurev1beta1.CleanupStartedAtAnnotation)
 
 	// Remove the force cleanup annotation
-	delete(byoHost.Annotations, "byoh.infrastructure.cluster.x-k8s.io/force-cleanup")
+	delete(byoHost.Annotations, infrastructurev1beta1.ForceCleanupAnnotation)
+
+	// Remove the force cleanup confirmation annotation
+	delete(byoHost.Annotations, infrastructurev1beta1.ForceCleanupConfirmationAnnotation)
 
 	// Remove the cluster version annotation
 	delete(byoHost.Annotations, infrastructurev1beta1.K8sVersionAnnotation)
@@ -1060,30 +2016,149 @@ func (r *HostReconciler) removeAnnotations(ctx context.Context, byoHost *infrast
 	// Remove the bundle registry annotation
 	delete(byoHost.Annotations, infrastructurev1beta1.BundleLookupBaseRegistryAnnotation)
 
+	// Remove the post-bootstrap taints annotation so the taints are removed again on the next bootstrap
+	delete(byoHost.Annotations, infrastructurev1beta1.PostBootstrapTaintsRemovedAnnotation)
+
+	// Remove the cluster CA verification, the CA is verified again after the next bootstrap
+	delete(byoHost.Annotations, infrastructurev1beta1.ClusterCAVerifiedAnnotation)
+
+	// Remove the bootstrap phase, the next bootstrap starts from scratch
+	delete(byoHost.Annotations, infrastructurev1beta1.BootstrapPhaseAnnotation)
+
+	// Remove the audit of the install script, it is recorded again by the next install
+	delete(byoHost.Annotations, infrastructurev1beta1.InstallScriptHashAnnotation)
+	delete(byoHost.Annotations, infrastructurev1beta1.InstallScriptAnnotation)
+
 	logger.Info("Annotations removed")
 }
 
 // patchLocalNodeProviderID patches the ProviderID of the local Node object
-// using the local kubelet configuration.
+// using the local kubelet configuration. Transient failures, e.g. the Node not
+// registered yet right after the join, are retried locally a bounded number of times.
 func (r *HostReconciler) patchLocalNodeProviderID(ctx context.Context, hostname string) error {
+	return patchNodeProviderIDWithRetry(ctx, newLocalNodeClient, hostname, providerIDPatchAttempts, providerIDPatchRetryInterval)
+}
+
+// patchNodeProviderIDWithRetry patches the ProviderID of the Node up to attempts times,
+// waiting interval between the attempts, and returns the last error
+func patchNodeProviderIDWithRetry(ctx context.Context, newClient func() (client.Client, error), nodeName string, attempts int, interval time.Duration) error {
 	logger := ctrl.LoggerFrom(ctx)
-	logger.Info("Attempting to patch local node ProviderID")
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		logger.Info("Attempting to patch local node ProviderID", "attempt", attempt)
+		c, err := newClient()
+		if err == nil {
+			err = patchNodeProviderID(ctx, c, nodeName)
+		}
+		if err == nil {
+			return nil
+		}
+		lastErr = err
 
-	kubeconfigPath := "/etc/kubernetes/kubelet.conf"
-	if _, err := os.Stat(kubeconfigPath); os.IsNotExist(err) {
-		return fmt.Errorf("kubelet.conf not found at %s", kubeconfigPath)
+		if attempt < attempts {
+			logger.Info("failed to patch local node ProviderID, retrying", "attempt", attempt, "error", err.Error())
+			timer := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
 	}
+	return lastErr
+}
 
-	// Build client from local kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-	if err != nil {
-		return fmt.Errorf("failed to build config from kubelet.conf: %w", err)
+// verifyLocalNodeProviderID checks the ProviderID patched on the local Node survived a kubelet
+// re-registration. kubelet started without --provider-id can clear it, in which case the flag is
+// injected into the kubeadm kubelet flags, kubelet is restarted and the ProviderID patched again.
+func (r *HostReconciler) verifyLocalNodeProviderID(ctx context.Context, hostname string) error {
+	return verifyNodeProviderID(ctx, newLocalNodeClient, hostname, providerIDVerifyDelay, func(ctx context.Context) error {
+		return r.injectKubeletProviderIDFlag(ctx, kubeadmFlagsEnvFile, hostname)
+	})
+}
+
+// verifyNodeProviderID waits delay and checks the Node still has the BYOH ProviderID. When it was
+// cleared, pinProviderID makes kubelet keep it and the ProviderID is patched again.
+func verifyNodeProviderID(ctx context.Context, newClient func() (client.Client, error), nodeName string, delay time.Duration, pinProviderID func(context.Context) error) error {
+	logger := ctrl.LoggerFrom(ctx)
+
+	timer := time.NewTimer(delay)
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+		return ctx.Err()
+	case <-timer.C:
 	}
 
-	localClient, err := client.New(config, client.Options{})
+	c, err := newClient()
 	if err != nil {
-		return fmt.Errorf("failed to create local client: %w", err)
+		return err
+	}
+	node := &corev1.Node{}
+	if err := c.Get(ctx, types.NamespacedName{Name: nodeName}, node); err != nil {
+		return fmt.Errorf("failed to get local node %s: %w", nodeName, err)
+	}
+	if node.Spec.ProviderID == common.GenerateProviderID(nodeName) {
+		logger.Info("Node ProviderID persisted")
+		return nil
+	}
+
+	logger.Info("Node ProviderID was cleared by kubelet, pinning it in the kubelet flags", "providerID", node.Spec.ProviderID)
+	if err := pinProviderID(ctx); err != nil {
+		return fmt.Errorf("failed to pin the kubelet provider-id: %w", err)
+	}
+	return patchNodeProviderIDWithRetry(ctx, newClient, nodeName, providerIDPatchAttempts, providerIDPatchRetryInterval)
+}
+
+// injectKubeletProviderIDFlag adds --provider-id to the kubelet flags of flagsFile and restarts
+// kubelet. It is a no-op when the flags already set a provider-id.
+func (r *HostReconciler) injectKubeletProviderIDFlag(ctx context.Context, flagsFile, hostname string) error {
+	content, err := os.ReadFile(r.hostPath(flagsFile))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read kubelet flags %s: %w", flagsFile, err)
+	}
+
+	updated, changed := withProviderIDFlag(string(content), common.GenerateProviderID(hostname))
+	if !changed {
+		return nil
+	}
+	// kubelet reads the flags on every restart, so they are never left truncated
+	if err := r.FileWriter.WriteToFile(&cloudinit.Files{Path: flagsFile, Content: updated, Permissions: "0644"}); err != nil {
+		return fmt.Errorf("failed to write kubelet flags %s: %w", flagsFile, err)
 	}
+	ctrl.LoggerFrom(ctx).Info("Injected --provider-id into the kubelet flags, restarting kubelet", "file", flagsFile)
+	return r.CmdRunner.RunCmd(ctx, "systemctl restart kubelet")
+}
+
+// withProviderIDFlag adds --provider-id to the KUBELET_KUBEADM_ARGS of a kubeadm-flags.env content,
+// adding the variable when missing. changed is false when a provider-id is already set.
+func withProviderIDFlag(content, providerID string) (updated string, changed bool) {
+	if strings.Contains(content, "--provider-id") {
+		return content, false
+	}
+
+	const argsVar = "KUBELET_KUBEADM_ARGS="
+	flag := "--provider-id=" + providerID
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, argsVar) {
+			continue
+		}
+		args := strings.Trim(strings.TrimPrefix(line, argsVar), `"`)
+		lines[i] = argsVar + `"` + strings.TrimSpace(args+" "+flag) + `"`
+		return strings.Join(lines, "\n") + "\n", true
+	}
+
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return content + argsVar + `"` + flag + `"` + "\n", true
+}
+
+// patchNodeProviderID sets the BYOH ProviderID on the Node, it is a no-op when already set
+func patchNodeProviderID(ctx context.Context, localClient client.Client, hostname string) error {
+	logger := ctrl.LoggerFrom(ctx)
 
 	// Get Node
 	node := &corev1.Node{}
@@ -1113,6 +2188,79 @@ func (r *HostReconciler) patchLocalNodeProviderID(ctx context.Context, hostname
 	return nil
 }
 
+// newLocalNodeClient builds a client for the workload cluster from the local kubelet configuration
+func newLocalNodeClient() (client.Client, error) {
+	kubeconfigPath := "/etc/kubernetes/kubelet.conf"
+	if _, err := os.Stat(kubeconfigPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("kubelet.conf not found at %s", kubeconfigPath)
+	}
+
+	// Build client from local kubeconfig
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build config from kubelet.conf: %w", err)
+	}
+
+	localClient, err := client.New(config, client.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create local client: %w", err)
+	}
+	return localClient, nil
+}
+
+// removeLocalNodeTaints removes the configured post-bootstrap taints from the local Node
+func (r *HostReconciler) removeLocalNodeTaints(ctx context.Context, hostname string) error {
+	localClient, err := newLocalNodeClient()
+	if err != nil {
+		return err
+	}
+	return removeNodeTaints(ctx, localClient, hostname, r.PostBootstrapTaintsToRemove)
+}
+
+// removeNodeTaints removes the taints matching toRemove (key or key:Effect) from the Node,
+// preserving every other taint. It is a no-op when none of the taints are present.
+func removeNodeTaints(ctx context.Context, c client.Client, nodeName string, toRemove []string) error {
+	logger := ctrl.LoggerFrom(ctx)
+
+	node := &corev1.Node{}
+	if err := c.Get(ctx, types.NamespacedName{Name: nodeName}, node); err != nil {
+		return fmt.Errorf("failed to get local node %s: %w", nodeName, err)
+	}
+
+	taints := make([]corev1.Taint, 0, len(node.Spec.Taints))
+	for _, taint := range node.Spec.Taints {
+		if !taintMatchesAny(taint, toRemove) {
+			taints = append(taints, taint)
+		}
+	}
+	if len(taints) == len(node.Spec.Taints) {
+		logger.Info("No post-bootstrap taints to remove from node", "node", nodeName)
+		return nil
+	}
+
+	helper, err := patch.NewHelper(node, c)
+	if err != nil {
+		return fmt.Errorf("failed to create patch helper: %w", err)
+	}
+	node.Spec.Taints = taints
+	if err := helper.Patch(ctx, node); err != nil {
+		return fmt.Errorf("failed to remove taints from node %s: %w", nodeName, err)
+	}
+	logger.Info("Removed post-bootstrap taints from node", "node", nodeName, "taints", toRemove)
+	return nil
+}
+
+// taintMatchesAny reports whether the taint matches one of the given key or key:Effect specs
+func taintMatchesAny(taint corev1.Taint, specs []string) bool {
+	for _, spec := range specs {
+		key, effect, hasEffect := strings.Cut(strings.TrimSpace(spec), ":")
+		if taint.Key == key && (!hasEffect || taint.Effect == corev1.TaintEffect(effect)) {
+			return true
+		}
+	}
+	return false
+}
+
 // preflightChecks performs basic checks before installation
 func (r *HostReconciler) preflightChecks(ctx context.Context) error {
 	logger := ctrl.LoggerFrom(ctx)
@@ -1145,65 +2293,111 @@ func (r *HostReconciler) preflightChecks(ctx context.Context) error {
 
 	// Let's add a simple check for critical files to ensure we are not overwriting a working cluster
 	// unintentionally (though `hostCleanUp` should have run).
-	if _, err := os.Stat("/etc/kubernetes/manifests/kube-apiserver.yaml"); err == nil {
+	if _, err := os.Stat(r.hostPath(filepath.Join(r.kubeletStaticPodPath(), "kube-apiserver.yaml"))); err == nil {
 		logger.Info("Warning: Found existing kube-apiserver manifest. Node might already be part of a cluster.")
 		// We don't fail, just warn, because maybe it's a re-install.
 	}
 
+	return r.checkFreeDisk(ctx)
+}
+
+// checkFreeDisk fails with errInsufficientDiskSpace when the free space of one of the diskCheckPaths
+// is below MinFreeDiskBytes. The paths are checked where the FileWriter puts the files of the install, e.g.
+// under --root-dir. Nothing is checked when no minimum is configured.
+func (r *HostReconciler) checkFreeDisk(ctx context.Context) error {
+	if r.MinFreeDiskBytes <= 0 {
+		return nil
+	}
+	logger := ctrl.LoggerFrom(ctx)
+	for _, path := range diskCheckPaths {
+		var stat syscall.Statfs_t
+		if err := statfs(r.hostPath(path), &stat); err != nil {
+			return errors.Wrapf(err, "failed to get the free space on %s", path)
+		}
+		// Bavail excludes the blocks reserved for root, which the install may not rely on
+		free := int64(stat.Bavail) * int64(stat.Bsize) //nolint:unconvert // Bsize is not int64 on all architectures
+		logger.Info("free disk space", "path", path, "bytes", free)
+		if free < r.MinFreeDiskBytes {
+			return errors.Wrapf(errInsufficientDiskSpace, "%s free on %s, at least %s required",
+				resource.NewQuantity(free, resource.BinarySI), path, resource.NewQuantity(r.MinFreeDiskBytes, resource.BinarySI))
+		}
+	}
 	return nil
 }
 
-// generateDefaultKubeletConfig generates a default KubeletConfiguration
-// For TLS Bootstrap mode when no kubelet-config is provided in the secret,
-// generate a minimal working config that works for most clusters
-func generateDefaultKubeletConfig() string {
-	return fmt.Sprintf(`apiVersion: kubelet.config.k8s.io/v1beta1
-kind: KubeletConfiguration
-authentication:
-  anonymous:
-    enabled: false
-  webhook:
-    cacheTTL: 2m0s
-    enabled: true
-  x509:
-    clientCAFile: /etc/kubernetes/pki/ca.crt
-authorization:
-  mode: Webhook
-  webhook:
-    cacheAuthorizedTTL: 5m0s
-    cacheUnauthorizedTTL: 30s
-cgroupDriver: systemd
-clusterDNS:
-- 169.254.20.10
-clusterDomain: cluster.local
-containerLogMaxFiles: 5
-containerLogMaxSize: 10Mi
-evictionHard:
-  imagefs.available: 15%%
-  memory.available: 100Mi
-  nodefs.available: 10%%
-  nodefs.inodesFree: 5%%
-evictionPressureTransitionPeriod: 5m0s
-fileCheckFrequency: 40s
-healthzBindAddress: 127.0.0.1
-healthzPort: 10248
-imageGCHighThresholdPercent: 85
-imageGCLowThresholdPercent: 80
-logging:
-  verbosity: 0
-nodeStatusUpdateFrequency: 10s
-rotateCertificates: true
-runtimeRequestTimeout: 2m0s
-staticPodPath: /etc/kubernetes/manifests
-streamingConnectionIdleTimeout: 4h0m0s
-syncFrequency: 1m0s
-volumeStatsAggPeriod: 1m0s
-`)
+// defaultKubeletConfig generates the default KubeletConfiguration with the configured cluster DNS and domain,
+// kubelet healthz endpoint, log verbosity and TLS settings.
+func (r *HostReconciler) defaultKubeletConfig(byoHost *infrastructurev1beta1.ByoHost) string {
+	verbosity, _ := r.kubeletLogVerbosity(byoHost)
+	minVersion, cipherSuites := r.kubeletTLSSettings(byoHost)
+	return kubeletconfig.GenerateDefaultKubeletConfig(kubeletconfig.Options{
+		ClusterDNS:         r.ClusterDNS,
+		ClusterDomain:      r.ClusterDomain,
+		HealthzBindAddress: r.KubeletHealthzBindAddress,
+		HealthzPort:        r.KubeletHealthzPort,
+		EvictionHard:       r.KubeletEvictionHard,
+		LogVerbosity:       verbosity,
+		StaticPodPath:      r.kubeletStaticPodPath(),
+		TLSMinVersion:      minVersion,
+		TLSCipherSuites:    cipherSuites,
+	})
+}
+
+// kubeletLogVerbosity returns the kubelet log verbosity of the ByoHost, or else of the agent, and
+// whether either is set
+func (r *HostReconciler) kubeletLogVerbosity(byoHost *infrastructurev1beta1.ByoHost) (int32, bool) {
+	if byoHost.Spec.KubeletLogVerbosity != nil {
+		return *byoHost.Spec.KubeletLogVerbosity, true
+	}
+	return r.KubeletLogVerbosity, r.KubeletLogVerbosity > 0
+}
+
+// kubeletTLSSettings returns the minimum TLS version and the cipher suites of the kubelet server, each of the
+// ByoHost or else of the agent
+func (r *HostReconciler) kubeletTLSSettings(byoHost *infrastructurev1beta1.ByoHost) (string, []string) {
+	minVersion, cipherSuites := r.KubeletTLSMinVersion, r.KubeletTLSCipherSuites
+	if byoHost.Spec.KubeletTLSMinVersion != "" {
+		minVersion = byoHost.Spec.KubeletTLSMinVersion
+	}
+	if len(byoHost.Spec.KubeletTLSCipherSuites) > 0 {
+		cipherSuites = byoHost.Spec.KubeletTLSCipherSuites
+	}
+	return minVersion, cipherSuites
+}
+
+// validateKubeletTLSSettings rejects kubelet TLS settings kubelet would fail to start with, e.g. cipher suites
+// of the agent along with the minimum TLS version VersionTLS13 of the ByoHost
+func (r *HostReconciler) validateKubeletTLSSettings(byoHost *infrastructurev1beta1.ByoHost) error {
+	minVersion, cipherSuites := r.kubeletTLSSettings(byoHost)
+	if err := kubeletconfig.ValidateTLSSettings(minVersion, cipherSuites); err != nil {
+		return fmt.Errorf("invalid kubelet TLS settings: %w", err)
+	}
+	return nil
 }
 
 // generateDefaultKubeProxyConfig generates a default KubeProxyConfiguration
-// For binary-deployed clusters without ConfigMaps, generate a minimal working config
-func generateDefaultKubeProxyConfig() string {
+// For binary-deployed clusters without ConfigMaps, generate a minimal working config.
+// The conntrack limits are scaled down to the capacity reported for the host.
+func generateDefaultKubeProxyConfig(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) string {
+	logger := ctrl.LoggerFrom(ctx)
+
+	var cpus, memBytes int64
+	if cpu, ok := byoHost.Spec.Capacity[corev1.ResourceCPU]; ok {
+		cpus = cpu.Value()
+	}
+	if memory, ok := byoHost.Spec.Capacity[corev1.ResourceMemory]; ok {
+		memBytes = memory.Value()
+	}
+	maxPerCore, minEntries, scaled := conntrackSettings(cpus, memBytes)
+	if scaled {
+		logger.Info("Warning: host cannot satisfy the default kube-proxy conntrack limits, scaling them down",
+			"cpus", cpus, "memoryBytes", memBytes, "maxPerCore", maxPerCore, "min", minEntries)
+	}
+	hostnameOverride := ""
+	if manageKubeProxy(byoHost) {
+		hostnameOverride = byoHost.Name
+	}
+
 	return fmt.Sprintf(`apiVersion: kubeproxy.config.k8s.io/v1alpha1
 kind: KubeProxyConfiguration
 bindAddress: 0.0.0.0
@@ -1216,13 +2410,13 @@ clientConnection:
 clusterCIDR: ""
 configSyncPeriod: 15m0s
 conntrack:
-  maxPerCore: 32768
-  min: 131072
+  maxPerCore: %d
+  min: %d
   tcpCloseWaitTimeout: 1h0m0s
   tcpEstablishedTimeout: 24h0m0s
 enableProfiling: false
 healthzBindAddress: 0.0.0.0:10256
-hostnameOverride: ""
+hostnameOverride: %q
 iptables:
   masqueradeAll: false
   masqueradeBit: 14
@@ -1243,7 +2437,77 @@ nodePortAddresses: null
 oomScoreAdj: -999
 portRange: ""
 clusterDomain: "cluster.local"
- `)
+`, maxPerCore, minEntries, hostnameOverride)
+}
+
+// withKubeProxyHostnameOverride sets the hostnameOverride of the kube-proxy configuration to the node name
+// when it is not set, so kube-proxy does not identify the node by a hostname differing from the ByoHost
+// name, e.g. on multi-NIC hosts. An override set on purpose is kept.
+func withKubeProxyHostnameOverride(config, nodeName string) (string, error) {
+	return kubeletconfig.SetConfigFields("kube-proxy", config, func(fields map[string]interface{}) bool {
+		if override, _ := fields["hostnameOverride"].(string); override != "" {
+			return false
+		}
+		fields["hostnameOverride"] = nodeName
+		return true
+	})
+}
+
+// validateConfigYAML returns an error unless the kubelet or kube-proxy configuration parses as a YAML
+// mapping, so a broken configuration is not written to disk for the component to fail on at start.
+// Lines with trailing whitespace are valid YAML but logged as a warning, they hint at a broken template.
+func validateConfigYAML(ctx context.Context, name, config string) error {
+	fields, err := kubeletconfig.ParseConfigFields(name, config)
+	if err != nil {
+		return fmt.Errorf("invalid %s configuration: %w", name, err)
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("invalid %s configuration: it is empty", name)
+	}
+
+	var lines []int
+	for i, line := range strings.Split(config, "\n") {
+		if strings.TrimRight(line, " \t") != line {
+			lines = append(lines, i+1)
+		}
+	}
+	if len(lines) > 0 {
+		ctrl.LoggerFrom(ctx).Info("Warning: configuration has lines with trailing whitespace", "config", name, "lines", lines)
+	}
+	return nil
+}
+
+// conntrackSettings returns the kube-proxy conntrack maxPerCore and min values for a host
+// with the given CPU count and memory. The kube-proxy defaults are kept unless the conntrack
+// table they allow would need more than 1/conntrackMemoryFraction of the host memory, in
+// which case both values are scaled down to fit and scaled is true. Unknown capacity keeps
+// the defaults.
+func conntrackSettings(cpus, memBytes int64) (maxPerCore, minEntries int64, scaled bool) {
+	maxPerCore, minEntries = defaultConntrackMaxPerCore, defaultConntrackMin
+	if cpus <= 0 || memBytes <= 0 {
+		return maxPerCore, minEntries, false
+	}
+
+	budget := memBytes / conntrackMemoryFraction / conntrackEntryBytes
+	wanted := cpus * maxPerCore
+	if wanted < minEntries {
+		wanted = minEntries
+	}
+	if wanted <= budget {
+		return maxPerCore, minEntries, false
+	}
+
+	maxPerCore = budget / cpus
+	if minEntries > budget {
+		minEntries = budget
+	}
+	return maxPerCore, minEntries, true
+}
+
+// manageKubeProxy returns whether the agent runs kube-proxy on the host. DisableKubeProxy takes precedence
+// over ManageKubeProxy, for eBPF dataplanes like Cilium that replace kube-proxy.
+func manageKubeProxy(byoHost *infrastructurev1beta1.ByoHost) bool {
+	return byoHost.Spec.ManageKubeProxy && !byoHost.Spec.DisableKubeProxy
 }
 
 // startKubeProxyIfNeeded starts kube-proxy if ManageKubeProxy is true and kube-proxy is not already running.
@@ -1252,8 +2516,8 @@ func (r *HostReconciler) startKubeProxyIfNeeded(ctx context.Context, byoHost *in
 	logger := ctrl.LoggerFrom(ctx)
 
 	// Check if ManageKubeProxy is enabled
-	if !byoHost.Spec.ManageKubeProxy {
-		logger.V(4).Info("ManageKubeProxy is false, skipping kube-proxy start")
+	if !manageKubeProxy(byoHost) {
+		logger.V(4).Info("ManageKubeProxy is false or kube-proxy is disabled, skipping kube-proxy start")
 		return nil
 	}
 
@@ -1267,14 +2531,18 @@ func (r *HostReconciler) startKubeProxyIfNeeded(ctx context.Context, byoHost *in
 
 	// Generate default kube-proxy config if it doesn't exist
 	kubeProxyConfigPath := "/var/lib/kube-proxy/kube-proxy-config.yaml"
-	if _, err := os.Stat(kubeProxyConfigPath); os.IsNotExist(err) {
+	if _, err := os.Stat(r.hostPath(kubeProxyConfigPath)); os.IsNotExist(err) {
 		logger.Info("kube-proxy config not found, generating default config")
 		if err := r.FileWriter.MkdirIfNotExists("/etc/kubernetes"); err != nil {
 			return fmt.Errorf("failed to create /etc/kubernetes directory: %w", err)
 		}
+		kubeProxyConfigContent := generateDefaultKubeProxyConfig(ctx, byoHost)
+		if err := validateConfigYAML(ctx, "kube-proxy", kubeProxyConfigContent); err != nil {
+			return err
+		}
 		if err := r.FileWriter.WriteToFile(&cloudinit.Files{
 			Path:        kubeProxyConfigPath,
-			Content:     generateDefaultKubeProxyConfig(),
+			Content:     kubeProxyConfigContent,
 			Permissions: "0644",
 		}); err != nil {
 			return fmt.Errorf("failed to write kube-proxy config: %w", err)
@@ -1283,21 +2551,7 @@ func (r *HostReconciler) startKubeProxyIfNeeded(ctx context.Context, byoHost *in
 	}
 
 	// Write kube-proxy service file
-	kubeProxyServiceContent := `[Unit]
-Description=kube-proxy: The Kubernetes Network Proxy
-Documentation=https://kubernetes.io/docs/home/
-Wants=network-online.target
-After=network-online.target
-
-[Service]
-ExecStart=/usr/local/bin/kube-proxy --config=/var/lib/kube-proxy/kube-proxy-config.yaml
-Restart=always
-StartLimitInterval=0
-RestartSec=10
-
-[Install]
-WantedBy=multi-user.target
-`
+	kubeProxyServiceContent := r.serviceUnit(ctx, kubeProxyServiceUnit)
 	if err := r.FileWriter.WriteToFile(&cloudinit.Files{
 		Path:        "/etc/systemd/system/kube-proxy.service",
 		Content:     kubeProxyServiceContent,
@@ -1320,6 +2574,74 @@ WantedBy=multi-user.target
 	return nil
 }
 
+// kubeletServiceUnit is the systemd unit of kubelet in TLS Bootstrap mode, formatted with the kubelet arguments
+const kubeletServiceUnit = `[Unit]
+Description=kubelet: The Kubernetes Node Agent
+Documentation=https://kubernetes.io/docs/home/
+Wants=network-online.target
+After=network-online.target
+After=containerd.service
+Wants=containerd.service
+
+[Service]
+ExecStart=/usr/local/bin/kubelet %s
+Restart=always
+StartLimitInterval=0
+RestartSec=10
+# Mount cgroup to support cgroupfs driver (common in binary installs)
+ExecStartPre=-/bin/mount -o remount,rw '/sys/fs/cgroup'
+# Ensure working directory exists
+WorkingDirectory=/var/lib/kubelet
+# Resource accounting
+CPUAccounting=true
+MemoryAccounting=true
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// kubeProxyServiceUnit is the systemd unit of kube-proxy when managed by the agent
+const kubeProxyServiceUnit = `[Unit]
+Description=kube-proxy: The Kubernetes Network Proxy
+Documentation=https://kubernetes.io/docs/home/
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+ExecStart=/usr/local/bin/kube-proxy --config=/var/lib/kube-proxy/kube-proxy-config.yaml
+Restart=always
+StartLimitInterval=0
+RestartSec=10
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// serviceUnit adds the configured ServiceDirectives to the end of the [Service] section of the unit.
+// Directives that would replace the mandatory ExecStart of the unit are skipped.
+func (r *HostReconciler) serviceUnit(ctx context.Context, unit string) string {
+	var directives []string
+	for _, directive := range r.ServiceDirectives {
+		key, value, found := strings.Cut(directive, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" || key == "ExecStart" {
+			ctrl.LoggerFrom(ctx).Info("Skipping invalid systemd service directive", "directive", directive)
+			continue
+		}
+		directives = append(directives, key+"="+strings.TrimSpace(value))
+	}
+	if len(directives) == 0 {
+		return unit
+	}
+
+	// The [Service] section of the units is followed by the [Install] section
+	serviceEnd := strings.Index(unit, "\n[Install]")
+	if serviceEnd < 0 {
+		serviceEnd = len(unit)
+	}
+	return unit[:serviceEnd] + "# Configured service directives\n" + strings.Join(directives, "\n") + "\n" + unit[serviceEnd:]
+}
+
 // extractCACertificate extracts the CA certificate data from a kubeconfig string
 func extractCACertificate(kubeconfigContent string) string {
 	// Parse the kubeconfig
@@ -1338,6 +2660,121 @@ func extractCACertificate(kubeconfigContent string) string {
 	return ""
 }
 
+// verifyClusterCA checks the CA of the cluster in the kubelet kubeconfig has the public key of the CA of
+// the bootstrap secret: its CA certificate in TLS Bootstrap mode, the CA public key hashes pinned by the
+// kubeadm join otherwise. A host whose bootstrap secret does not tell the CA is not verified.
+func (r *HostReconciler) verifyClusterCA(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
+	logger := ctrl.LoggerFrom(ctx)
+
+	expected, err := r.expectedClusterCAHashes(ctx, byoHost)
+	if err != nil {
+		return err
+	}
+	if len(expected) == 0 {
+		logger.Info("No cluster CA in the bootstrap secret, skipping the cluster CA verification")
+		return nil
+	}
+	if err := verifyKubeconfigClusterCA(r.hostPath(kubeletKubeconfigFile), expected); err != nil {
+		return err
+	}
+	logger.Info("Verified the cluster CA of the node", "caCertHashes", expected)
+	return nil
+}
+
+// expectedClusterCAHashes returns the public key hashes of the CA of the cluster the bootstrap secret joins
+func (r *HostReconciler) expectedClusterCAHashes(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) ([]string, error) {
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, types.NamespacedName{
+		Name:      byoHost.Spec.BootstrapSecret.Name,
+		Namespace: byoHost.Spec.BootstrapSecret.Namespace,
+	}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get bootstrap secret: %w", err)
+	}
+
+	if byoHost.Spec.JoinMode != infrastructurev1beta1.JoinModeTLSBootstrap {
+		var hashes []string
+		for _, hash := range caCertHashRegexp.FindAllString(string(secret.Data["value"]), -1) {
+			hashes = append(hashes, strings.ToLower(hash))
+		}
+		return hashes, nil
+	}
+
+	caData := secret.Data["ca.crt"]
+	if len(caData) == 0 {
+		caData = []byte(extractCACertificate(string(secret.Data["bootstrap-kubeconfig"])))
+	}
+	if len(caData) == 0 {
+		return nil, nil
+	}
+	return caCertHashes(caData)
+}
+
+// verifyKubeconfigClusterCA checks the CA of the cluster of the current context of the kubeconfig has one
+// of the expected public key hashes
+func verifyKubeconfigClusterCA(kubeconfigPath string, expected []string) error {
+	caData, err := kubeconfigClusterCA(kubeconfigPath)
+	if err != nil {
+		return err
+	}
+	actual, err := caCertHashes(caData)
+	if err != nil {
+		return fmt.Errorf("invalid cluster CA in %s: %w", kubeconfigPath, err)
+	}
+	for _, hash := range actual {
+		for _, expectedHash := range expected {
+			if hash == expectedHash {
+				return nil
+			}
+		}
+	}
+	return errors.Wrapf(errClusterCAMismatch, "the cluster CA %s in %s is not the expected cluster CA %s",
+		strings.Join(actual, ","), kubeconfigPath, strings.Join(expected, ","))
+}
+
+// kubeconfigClusterCA returns the CA certificate of the cluster of the current context of the kubeconfig
+func kubeconfigClusterCA(kubeconfigPath string) ([]byte, error) {
+	config, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", kubeconfigPath, err)
+	}
+	kubeContext, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return nil, fmt.Errorf("no current context in %s", kubeconfigPath)
+	}
+	cluster, ok := config.Clusters[kubeContext.Cluster]
+	if !ok {
+		return nil, fmt.Errorf("no cluster %s in %s", kubeContext.Cluster, kubeconfigPath)
+	}
+	if len(cluster.CertificateAuthorityData) > 0 {
+		return cluster.CertificateAuthorityData, nil
+	}
+	if cluster.CertificateAuthority != "" {
+		return os.ReadFile(cluster.CertificateAuthority)
+	}
+	return nil, fmt.Errorf("no CA of the cluster %s in %s", kubeContext.Cluster, kubeconfigPath)
+}
+
+// caCertHashes returns the hashes, as pinned by kubeadm join, of the public keys of the PEM encoded
+// CA certificates: sha256:<hex encoded sha256 of the Subject Public Key Info>
+func caCertHashes(caData []byte) ([]string, error) {
+	var hashes []string
+	for block, rest := pem.Decode(caData); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		hashes = append(hashes, "sha256:"+hex.EncodeToString(sum[:]))
+	}
+	if len(hashes) == 0 {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	return hashes, nil
+}
+
 // extractTokenFromBootstrapKubeconfig extracts the bootstrap token from a kubeconfig string
 func extractTokenFromBootstrapKubeconfig(kubeconfigContent string) string {
 	// Parse the kubeconfig
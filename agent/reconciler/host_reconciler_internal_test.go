@@ -0,0 +1,1930 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package reconciler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/cloudinit"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/cloudinit/cloudinitfakes"
+	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common/kubeletconfig"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/yaml"
+)
+
+// failingPatchClient fails the first failures patches, e.g. with an API server hiccup
+type failingPatchClient struct {
+	client.Client
+	failures int
+	patches  int
+}
+
+func (c *failingPatchClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.patches++
+	if c.patches <= c.failures {
+		return errors.New("etcdserver: request timed out")
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+// newTestCA returns a PEM encoded self-signed CA certificate
+func newTestCA(commonName string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// writeTestKubeconfig writes a kubeconfig whose cluster has the given CA certificate data
+func writeTestKubeconfig(path string, caData []byte) {
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    certificate-authority-data: %s
+    server: https://10.0.0.1:6443
+  name: default-cluster
+contexts:
+- context:
+    cluster: default-cluster
+    user: default-auth
+  name: default-context
+current-context: default-context
+users:
+- name: default-auth
+  user: {}
+`, base64.StdEncoding.EncodeToString(caData))
+	Expect(os.WriteFile(path, []byte(kubeconfig), 0600)).To(Succeed())
+}
+
+var _ = Describe("HostReconciler/Unit", func() {
+	Context("When filtering the ByoHost events", func() {
+		var ownHost, otherHost *infrastructurev1beta1.ByoHost
+
+		BeforeEach(func() {
+			ownHost = &infrastructurev1beta1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "host-a", Namespace: "default"}}
+			otherHost = &infrastructurev1beta1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "host-b", Namespace: "default"}}
+		})
+
+		It("should let the events of the own ByoHost through", func() {
+			filter := ownByoHost("host-a")
+			Expect(filter.Create(event.CreateEvent{Object: ownHost})).To(BeTrue())
+			Expect(filter.Update(event.UpdateEvent{ObjectOld: ownHost, ObjectNew: ownHost})).To(BeTrue())
+			Expect(filter.Delete(event.DeleteEvent{Object: ownHost})).To(BeTrue())
+			Expect(filter.Generic(event.GenericEvent{Object: ownHost})).To(BeTrue())
+		})
+
+		It("should filter out the events of other ByoHosts", func() {
+			filter := ownByoHost("host-a")
+			Expect(filter.Create(event.CreateEvent{Object: otherHost})).To(BeFalse())
+			Expect(filter.Update(event.UpdateEvent{ObjectOld: otherHost, ObjectNew: otherHost})).To(BeFalse())
+			Expect(filter.Delete(event.DeleteEvent{Object: otherHost})).To(BeFalse())
+			Expect(filter.Generic(event.GenericEvent{Object: otherHost})).To(BeFalse())
+		})
+
+		It("should let all events through without a host name", func() {
+			filter := ownByoHost("")
+			Expect(filter.Create(event.CreateEvent{Object: ownHost})).To(BeTrue())
+			Expect(filter.Update(event.UpdateEvent{ObjectOld: otherHost, ObjectNew: otherHost})).To(BeTrue())
+		})
+	})
+
+	Context("When removing post-bootstrap taints", func() {
+		var (
+			ctx        context.Context
+			fakeClient client.Client
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+				Spec: corev1.NodeSpec{Taints: []corev1.Taint{
+					{Key: "node.example.com/initializing", Effect: corev1.TaintEffectNoSchedule},
+					{Key: "node.example.com/initializing", Effect: corev1.TaintEffectNoExecute},
+					{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule},
+				}},
+			}
+			fakeClient = fake.NewClientBuilder().WithObjects(node).Build()
+		})
+
+		getTaints := func() []corev1.Taint {
+			node := &corev1.Node{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: "test-node"}, node)).To(Succeed())
+			return node.Spec.Taints
+		}
+
+		It("should remove the configured taint with all effects and preserve others", func() {
+			Expect(removeNodeTaints(ctx, fakeClient, "test-node", []string{"node.example.com/initializing"})).To(Succeed())
+			Expect(getTaints()).To(ConsistOf(corev1.Taint{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule}))
+		})
+
+		It("should only remove the taint with the configured effect", func() {
+			Expect(removeNodeTaints(ctx, fakeClient, "test-node", []string{"node.example.com/initializing:NoSchedule"})).To(Succeed())
+			Expect(getTaints()).To(ConsistOf(
+				corev1.Taint{Key: "node.example.com/initializing", Effect: corev1.TaintEffectNoExecute},
+				corev1.Taint{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule},
+			))
+		})
+
+		It("should leave the node untouched when the taint is not present", func() {
+			Expect(removeNodeTaints(ctx, fakeClient, "test-node", []string{"unknown"})).To(Succeed())
+			Expect(getTaints()).To(HaveLen(3))
+		})
+
+		It("should return an error when the node is not registered yet", func() {
+			Expect(removeNodeTaints(ctx, fakeClient, "missing-node", []string{"unknown"})).NotTo(Succeed())
+		})
+	})
+
+	Context("When a container runtime endpoint is configured", func() {
+		var byoHost *infrastructurev1beta1.ByoHost
+
+		BeforeEach(func() {
+			byoHost = &infrastructurev1beta1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "test-host"}}
+		})
+
+		It("should pass the endpoint to kubelet", func() {
+			r := &HostReconciler{ContainerRuntimeEndpoint: "unix:///var/run/custom/containerd.sock"}
+			Expect(r.kubeletArgs(context.TODO(), byoHost)).To(ContainElement("--container-runtime-endpoint=unix:///var/run/custom/containerd.sock"))
+		})
+
+		It("should pass the endpoint to kubeadm reset", func() {
+			r := &HostReconciler{ContainerRuntimeEndpoint: "unix:///var/run/custom/containerd.sock"}
+			Expect(r.kubeadmResetCommand()).To(Equal("kubeadm reset --force --cri-socket=unix:///var/run/custom/containerd.sock"))
+		})
+
+		It("should keep the kubelet and kubeadm defaults when not configured", func() {
+			r := &HostReconciler{}
+			Expect(r.kubeletArgs(context.TODO(), byoHost)).NotTo(ContainElement(HavePrefix("--container-runtime-endpoint")))
+			Expect(r.kubeadmResetCommand()).To(Equal(KubeadmResetCommand))
+		})
+	})
+	Context("When the kubelet certificates are configured", func() {
+		var byoHost *infrastructurev1beta1.ByoHost
+
+		BeforeEach(func() {
+			byoHost = &infrastructurev1beta1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "test-host"}}
+		})
+
+		It("should pass the configured cert dir and rotation settings to kubelet", func() {
+			r := &HostReconciler{
+				KubeletCertDir:                   "/etc/kubernetes/kubelet-pki",
+				DisableKubeletCertRotation:       true,
+				DisableKubeletServerCertRotation: true,
+			}
+			args := r.kubeletArgs(context.TODO(), byoHost)
+			Expect(args).To(ContainElements(
+				"--cert-dir=/etc/kubernetes/kubelet-pki",
+				"--rotate-certificates=false",
+				"--rotate-server-certificates=false",
+			))
+			Expect(args).NotTo(ContainElement("--cert-dir=" + DefaultKubeletCertDir))
+		})
+
+		It("should only disable the server certificate rotation when requested", func() {
+			r := &HostReconciler{DisableKubeletServerCertRotation: true}
+			Expect(r.kubeletArgs(context.TODO(), byoHost)).To(ContainElements(
+				"--rotate-certificates=true",
+				"--rotate-server-certificates=false",
+			))
+		})
+
+		It("should keep the defaults when not configured", func() {
+			r := &HostReconciler{}
+			Expect(r.kubeletArgs(context.TODO(), byoHost)).To(ContainElements(
+				"--cert-dir=/var/lib/kubelet/pki",
+				"--rotate-certificates=true",
+				"--rotate-server-certificates=true",
+			))
+		})
+	})
+
+	Context("When the kubelet static pod path is configured", func() {
+		var (
+			byoHost    *infrastructurev1beta1.ByoHost
+			fileWriter *cloudinitfakes.FakeIFileWriter
+		)
+
+		BeforeEach(func() {
+			byoHost = &infrastructurev1beta1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-host"},
+				Spec: infrastructurev1beta1.ByoHostSpec{
+					JoinMode:         infrastructurev1beta1.JoinModeTLSBootstrap,
+					DisableKubeProxy: true,
+					BootstrapSecret:  &corev1.ObjectReference{Kind: "Secret", Name: "test-bootstrap-secret", Namespace: "default"},
+				},
+			}
+			fileWriter = &cloudinitfakes.FakeIFileWriter{}
+		})
+
+		writtenFile := func(path string) string {
+			for i := 0; i < fileWriter.WriteToFileCallCount(); i++ {
+				if file := fileWriter.WriteToFileArgsForCall(i); file.Path == path {
+					return file.Content
+				}
+			}
+			Fail("file " + path + " was not written")
+			return ""
+		}
+
+		writeFiles := func(r *HostReconciler, secretData map[string][]byte) {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-bootstrap-secret", Namespace: "default"},
+				Data:       secretData,
+			}
+			r.Client = fake.NewClientBuilder().WithObjects(secret).Build()
+			r.FileWriter = fileWriter
+			Expect(r.writeTLSBootstrapFiles(context.TODO(), byoHost, secret)).To(Succeed())
+		}
+
+		It("should pass the path to kubelet and set it in the default configuration", func() {
+			r := &HostReconciler{KubeletStaticPodPath: "/etc/kubelet.d"}
+			writeFiles(r, map[string][]byte{"bootstrap-kubeconfig": []byte("fake-kubeconfig")})
+
+			Expect(writtenFile("/var/lib/kubelet/config.yaml")).To(ContainSubstring("staticPodPath: /etc/kubelet.d\n"))
+			Expect(writtenFile("/etc/systemd/system/kubelet.service")).To(ContainSubstring("--pod-manifest-path=/etc/kubelet.d"))
+			Expect(writtenFile("/etc/systemd/system/kubelet.service")).NotTo(ContainSubstring(kubeletconfig.DefaultStaticPodPath))
+			Expect(fileWriter.Invocations()["MkdirIfNotExists"]).To(ContainElement([]interface{}{"/etc/kubelet.d"}))
+		})
+
+		It("should set the path in a configuration provided by the cluster", func() {
+			r := &HostReconciler{KubeletStaticPodPath: "/etc/kubelet.d"}
+			writeFiles(r, map[string][]byte{
+				"bootstrap-kubeconfig": []byte("fake-kubeconfig"),
+				"kubelet-config.yaml":  []byte("kind: KubeletConfiguration\nstaticPodPath: /etc/kubernetes/manifests\n"),
+			})
+
+			Expect(writtenFile("/var/lib/kubelet/config.yaml")).To(ContainSubstring("staticPodPath: /etc/kubelet.d\n"))
+			Expect(writtenFile("/etc/systemd/system/kubelet.service")).To(ContainSubstring("--pod-manifest-path=/etc/kubelet.d"))
+		})
+
+		It("should remove the path on reset", func() {
+			Expect((&HostReconciler{KubeletStaticPodPath: "/etc/kubelet.d"}).resetNodeDirs()).To(ContainElement("/etc/kubelet.d"))
+			Expect((&HostReconciler{}).resetNodeDirs()).NotTo(ContainElement(kubeletconfig.DefaultStaticPodPath))
+		})
+
+		It("should only allow directories below the system directories to be removed on reset", func() {
+			for _, dir := range (&HostReconciler{}).resetNodeDirs() {
+				Expect(ValidateRemovableDir(dir)).To(Succeed())
+			}
+			Expect(ValidateRemovableDir("/etc/kubelet.d")).To(Succeed())
+			Expect(ValidateRemovableDir("/data/kubelet/pki")).To(Succeed())
+			for _, dir := range []string{"", "pki", "/", "/var", "/var/lib", "/var/lib/", "/usr/local", "/etc/../var/lib", "/data"} {
+				Expect(ValidateRemovableDir(dir)).NotTo(Succeed(), dir)
+			}
+		})
+
+		It("should keep the kubeadm default when not configured", func() {
+			r := &HostReconciler{}
+			Expect(r.kubeletArgs(context.TODO(), byoHost)).To(ContainElement("--pod-manifest-path=/etc/kubernetes/manifests"))
+			Expect(r.defaultKubeletConfig(byoHost)).To(ContainSubstring("staticPodPath: /etc/kubernetes/manifests\n"))
+		})
+	})
+
+	Context("When systemd service directives are configured", func() {
+		It("should add the directives to the [Service] section of the kubelet unit", func() {
+			r := &HostReconciler{ServiceDirectives: []string{"NoNewPrivileges=yes", "LimitNOFILE=1048576"}}
+			unit := r.serviceUnit(context.TODO(), kubeletServiceUnit)
+
+			service, install, found := strings.Cut(unit, "[Install]")
+			Expect(found).To(BeTrue())
+			Expect(service).To(ContainSubstring("NoNewPrivileges=yes\nLimitNOFILE=1048576\n"))
+			Expect(service).To(ContainSubstring("ExecStart=/usr/local/bin/kubelet"))
+			Expect(install).To(Equal("\nWantedBy=multi-user.target\n"))
+		})
+
+		It("should add the directives to the kube-proxy unit", func() {
+			r := &HostReconciler{ServiceDirectives: []string{"ProtectHome=true"}}
+			unit := r.serviceUnit(context.TODO(), kubeProxyServiceUnit)
+
+			Expect(unit).To(ContainSubstring("ProtectHome=true\n\n[Install]"))
+			Expect(unit).To(ContainSubstring("ExecStart=/usr/local/bin/kube-proxy --config=/var/lib/kube-proxy/kube-proxy-config.yaml"))
+		})
+
+		It("should skip directives overriding ExecStart and invalid directives", func() {
+			r := &HostReconciler{ServiceDirectives: []string{"ExecStart=/bin/true", "NoNewPrivileges", "=yes", "ExecStartPre=-/bin/true"}}
+			unit := r.serviceUnit(context.TODO(), kubeProxyServiceUnit)
+
+			Expect(strings.Count(unit, "ExecStart=")).To(Equal(1))
+			Expect(unit).NotTo(ContainSubstring("NoNewPrivileges"))
+			Expect(unit).To(ContainSubstring("ExecStartPre=-/bin/true"))
+		})
+
+		It("should keep the units unchanged when not configured", func() {
+			r := &HostReconciler{}
+			Expect(r.serviceUnit(context.TODO(), kubeProxyServiceUnit)).To(Equal(kubeProxyServiceUnit))
+		})
+	})
+
+	Context("When generating the default kube-proxy conntrack settings", func() {
+		hostWithCapacity := func(cpu, memory string) *infrastructurev1beta1.ByoHost {
+			return &infrastructurev1beta1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-host"},
+				Spec: infrastructurev1beta1.ByoHostSpec{
+					Capacity: map[corev1.ResourceName]resource.Quantity{
+						corev1.ResourceCPU:    resource.MustParse(cpu),
+						corev1.ResourceMemory: resource.MustParse(memory),
+					},
+				},
+			}
+		}
+
+		It("should keep the kube-proxy defaults on a large host", func() {
+			maxPerCore, minEntries, scaled := conntrackSettings(16, 64*1024*1024*1024)
+			Expect(scaled).To(BeFalse())
+			Expect(maxPerCore).To(Equal(int64(defaultConntrackMaxPerCore)))
+			Expect(minEntries).To(Equal(int64(defaultConntrackMin)))
+
+			config := generateDefaultKubeProxyConfig(context.TODO(), hostWithCapacity("16", "64Gi"))
+			Expect(config).To(ContainSubstring("maxPerCore: 32768\n"))
+			Expect(config).To(ContainSubstring("min: 131072\n"))
+		})
+
+		It("should scale the conntrack limits down on a small host", func() {
+			maxPerCore, minEntries, scaled := conntrackSettings(2, 1024*1024*1024)
+			Expect(scaled).To(BeTrue())
+			Expect(maxPerCore).To(Equal(int64(52428)))
+			Expect(minEntries).To(Equal(int64(104857)))
+			Expect(2 * maxPerCore).To(BeNumerically("<=", minEntries))
+
+			config := generateDefaultKubeProxyConfig(context.TODO(), hostWithCapacity("2", "1Gi"))
+			Expect(config).To(ContainSubstring("maxPerCore: 52428\n"))
+			Expect(config).To(ContainSubstring("min: 104857\n"))
+		})
+
+		It("should only scale maxPerCore when the minimum still fits", func() {
+			maxPerCore, minEntries, scaled := conntrackSettings(64, 8*1024*1024*1024)
+			Expect(scaled).To(BeTrue())
+			Expect(maxPerCore).To(Equal(int64(13107)))
+			Expect(minEntries).To(Equal(int64(defaultConntrackMin)))
+		})
+
+		It("should keep the kube-proxy defaults when the capacity is unknown", func() {
+			config := generateDefaultKubeProxyConfig(context.TODO(), &infrastructurev1beta1.ByoHost{})
+			Expect(config).To(ContainSubstring("maxPerCore: 32768\n"))
+			Expect(config).To(ContainSubstring("min: 131072\n"))
+		})
+	})
+	Context("When setting the kube-proxy hostnameOverride", func() {
+		var byoHost *infrastructurev1beta1.ByoHost
+
+		BeforeEach(func() {
+			byoHost = &infrastructurev1beta1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-host"},
+				Spec:       infrastructurev1beta1.ByoHostSpec{ManageKubeProxy: true},
+			}
+		})
+
+		It("should populate the default configuration with the host name", func() {
+			config := generateDefaultKubeProxyConfig(context.TODO(), byoHost)
+			Expect(config).To(ContainSubstring("hostnameOverride: \"test-host\"\n"))
+		})
+
+		It("should leave the default configuration empty when kube-proxy is not managed", func() {
+			byoHost.Spec.ManageKubeProxy = false
+			config := generateDefaultKubeProxyConfig(context.TODO(), byoHost)
+			Expect(config).To(ContainSubstring("hostnameOverride: \"\"\n"))
+		})
+
+		It("should populate an empty override of the cluster configuration with the host name", func() {
+			config, err := withKubeProxyHostnameOverride("kind: KubeProxyConfiguration\nhostnameOverride: \"\"\nmode: ipvs\n", "test-host")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(ContainSubstring("hostnameOverride: test-host\n"))
+			Expect(config).To(ContainSubstring("mode: ipvs\n"))
+
+			config, err = withKubeProxyHostnameOverride("kind: KubeProxyConfiguration\n", "test-host")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(ContainSubstring("hostnameOverride: test-host\n"))
+		})
+
+		It("should keep an override set on purpose", func() {
+			config := "kind: KubeProxyConfiguration\nhostnameOverride: custom-node\n"
+			Expect(withKubeProxyHostnameOverride(config, "test-host")).To(Equal(config))
+		})
+
+		It("should fail on a malformed configuration", func() {
+			_, err := withKubeProxyHostnameOverride("kind: [", "test-host")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("When validating a configuration before writing it", func() {
+		It("should accept the default kube-proxy configuration", func() {
+			for _, manage := range []bool{true, false} {
+				byoHost := &infrastructurev1beta1.ByoHost{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-host"},
+					Spec:       infrastructurev1beta1.ByoHostSpec{ManageKubeProxy: manage},
+				}
+				config := generateDefaultKubeProxyConfig(context.TODO(), byoHost)
+				Expect(validateConfigYAML(context.TODO(), "kube-proxy", config)).To(Succeed())
+
+				fields := map[string]interface{}{}
+				Expect(yaml.Unmarshal([]byte(config), &fields)).To(Succeed())
+				Expect(fields).To(HaveKeyWithValue("kind", "KubeProxyConfiguration"))
+				for _, line := range strings.Split(config, "\n") {
+					Expect(line).To(Equal(strings.TrimRight(line, " \t")))
+				}
+			}
+		})
+
+		It("should accept the default kubelet configuration", func() {
+			r := &HostReconciler{
+				KubeletEvictionHard:    map[string]string{"memory.available": "500Mi"},
+				KubeletLogVerbosity:    3,
+				KubeletTLSMinVersion:   "VersionTLS12",
+				KubeletTLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			}
+			config := r.defaultKubeletConfig(&infrastructurev1beta1.ByoHost{})
+			Expect(validateConfigYAML(context.TODO(), "kubelet", config)).To(Succeed())
+
+			fields := map[string]interface{}{}
+			Expect(yaml.Unmarshal([]byte(config), &fields)).To(Succeed())
+			Expect(fields).To(HaveKeyWithValue("kind", "KubeletConfiguration"))
+			Expect(fields).To(HaveKeyWithValue("tlsMinVersion", "VersionTLS12"))
+		})
+
+		It("should accept a configuration with trailing whitespace", func() {
+			Expect(validateConfigYAML(context.TODO(), "kube-proxy", "kind: KubeProxyConfiguration\nmode: ipvs \n ")).To(Succeed())
+		})
+
+		It("should reject a malformed configuration", func() {
+			err := validateConfigYAML(context.TODO(), "kube-proxy", "kind: [")
+			Expect(err).To(MatchError(ContainSubstring("invalid kube-proxy configuration")))
+		})
+
+		It("should reject a configuration which is not a mapping", func() {
+			err := validateConfigYAML(context.TODO(), "kube-proxy", "fake-kube-proxy-config")
+			Expect(err).To(MatchError(ContainSubstring("invalid kube-proxy configuration")))
+		})
+
+		It("should reject an empty configuration", func() {
+			err := validateConfigYAML(context.TODO(), "kubelet", "\n")
+			Expect(err).To(MatchError("invalid kubelet configuration: it is empty"))
+		})
+	})
+	Context("When generating the default kubelet configuration", func() {
+		It("should use the configured healthz endpoint", func() {
+			r := &HostReconciler{KubeletHealthzBindAddress: "0.0.0.0", KubeletHealthzPort: 10250}
+			config := r.defaultKubeletConfig(&infrastructurev1beta1.ByoHost{})
+			Expect(config).To(ContainSubstring("healthzBindAddress: 0.0.0.0\n"))
+			Expect(config).To(ContainSubstring("healthzPort: 10250\n"))
+		})
+
+		It("should produce the same configuration as the controller for the same inputs", func() {
+			r := &HostReconciler{KubeletHealthzBindAddress: "0.0.0.0", KubeletHealthzPort: 10250}
+			Expect(r.defaultKubeletConfig(&infrastructurev1beta1.ByoHost{})).To(Equal(kubeletconfig.GenerateDefaultKubeletConfig(kubeletconfig.Options{
+				ClusterDNS:         kubeletconfig.DefaultClusterDNS,
+				HealthzBindAddress: "0.0.0.0",
+				HealthzPort:        10250,
+			})))
+		})
+
+		It("should fall back to the default healthz endpoint", func() {
+			config := (&HostReconciler{}).defaultKubeletConfig(&infrastructurev1beta1.ByoHost{})
+			Expect(config).To(ContainSubstring("healthzBindAddress: 127.0.0.1\n"))
+			Expect(config).To(ContainSubstring("healthzPort: 10248\n"))
+			Expect(config).To(ContainSubstring("- 10.96.0.10\n"))
+			Expect(config).To(ContainSubstring("clusterDomain: cluster.local\n"))
+		})
+
+		It("should use the configured cluster DNS", func() {
+			config := (&HostReconciler{ClusterDNS: kubeletconfig.NodeLocalDNSAddress}).defaultKubeletConfig(&infrastructurev1beta1.ByoHost{})
+			Expect(config).To(ContainSubstring("- 169.254.20.10\n"))
+		})
+
+		It("should use the configured eviction thresholds", func() {
+			config := (&HostReconciler{KubeletEvictionHard: map[string]string{"memory.available": "500Mi"}}).defaultKubeletConfig(&infrastructurev1beta1.ByoHost{})
+			Expect(config).To(ContainSubstring("  memory.available: 500Mi\n"))
+			Expect(config).To(ContainSubstring("  nodefs.available: 10%\n"))
+		})
+
+		It("should use the configured cluster domain", func() {
+			config := (&HostReconciler{ClusterDomain: "corp.example"}).defaultKubeletConfig(&infrastructurev1beta1.ByoHost{})
+			Expect(config).To(ContainSubstring("clusterDomain: corp.example\n"))
+			Expect(config).NotTo(ContainSubstring("cluster.local"))
+		})
+
+		It("should use the kubelet log verbosity of the agent", func() {
+			config := (&HostReconciler{KubeletLogVerbosity: 3}).defaultKubeletConfig(&infrastructurev1beta1.ByoHost{})
+			Expect(config).To(ContainSubstring("logging:\n  verbosity: 3\n"))
+		})
+
+		It("should prefer the kubelet log verbosity of the ByoHost", func() {
+			verbosity := int32(0)
+			byoHost := &infrastructurev1beta1.ByoHost{Spec: infrastructurev1beta1.ByoHostSpec{KubeletLogVerbosity: &verbosity}}
+			r := &HostReconciler{KubeletLogVerbosity: 3}
+			Expect(r.defaultKubeletConfig(byoHost)).To(ContainSubstring("logging:\n  verbosity: 0\n"))
+
+			verbosity = 6
+			Expect(r.defaultKubeletConfig(byoHost)).To(ContainSubstring("logging:\n  verbosity: 6\n"))
+			value, set := r.kubeletLogVerbosity(byoHost)
+			Expect(value).To(BeEquivalentTo(6))
+			Expect(set).To(BeTrue())
+		})
+
+		It("should not change the verbosity of a provided configuration unless set", func() {
+			_, set := (&HostReconciler{}).kubeletLogVerbosity(&infrastructurev1beta1.ByoHost{})
+			Expect(set).To(BeFalse())
+		})
+
+		It("should render the kubelet TLS settings of the agent", func() {
+			r := &HostReconciler{KubeletTLSMinVersion: "VersionTLS12", KubeletTLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}}
+			config := r.defaultKubeletConfig(&infrastructurev1beta1.ByoHost{})
+			Expect(config).To(ContainSubstring("tlsCipherSuites:\n- TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256\n"))
+			Expect(config).To(ContainSubstring("tlsMinVersion: VersionTLS12\n"))
+		})
+
+		It("should prefer the kubelet TLS settings of the ByoHost", func() {
+			byoHost := &infrastructurev1beta1.ByoHost{Spec: infrastructurev1beta1.ByoHostSpec{
+				KubeletTLSMinVersion:   "VersionTLS12",
+				KubeletTLSCipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"},
+			}}
+			r := &HostReconciler{KubeletTLSMinVersion: "VersionTLS11", KubeletTLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}}
+			config := r.defaultKubeletConfig(byoHost)
+			Expect(config).To(ContainSubstring("tlsCipherSuites:\n- TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384\n"))
+			Expect(config).To(ContainSubstring("tlsMinVersion: VersionTLS12\n"))
+			Expect(r.validateKubeletTLSSettings(byoHost)).To(Succeed())
+		})
+
+		It("should reject the cipher suites of the agent along with the minimum TLS version VersionTLS13 of the ByoHost", func() {
+			byoHost := &infrastructurev1beta1.ByoHost{Spec: infrastructurev1beta1.ByoHostSpec{KubeletTLSMinVersion: "VersionTLS13"}}
+			r := &HostReconciler{KubeletTLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}}
+			Expect(r.validateKubeletTLSSettings(byoHost)).To(MatchError(ContainSubstring("cannot be set with the minimum TLS version VersionTLS13")))
+		})
+
+		It("should reject a cipher suite of the ByoHost not supported by kubelet", func() {
+			byoHost := &infrastructurev1beta1.ByoHost{Spec: infrastructurev1beta1.ByoHostSpec{KubeletTLSCipherSuites: []string{"TLS_FOO"}}}
+			err := (&HostReconciler{}).validateKubeletTLSSettings(byoHost)
+			Expect(err).To(MatchError(ContainSubstring(`invalid kubelet TLS settings: unsupported TLS cipher suite "TLS_FOO"`)))
+		})
+	})
+	Context("When MachineRef is cleared on a bootstrapped host", func() {
+		var (
+			r       *HostReconciler
+			byoHost *infrastructurev1beta1.ByoHost
+		)
+
+		BeforeEach(func() {
+			r = &HostReconciler{ZombieCleanupGracePeriod: time.Minute}
+			byoHost = &infrastructurev1beta1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "test-host"}}
+			conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+			conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded)
+		})
+
+		It("should wait for the grace period before cleaning up", func() {
+			result, err := r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			Expect(result.RequeueAfter).To(BeNumerically("<=", time.Minute))
+			Expect(conditions.IsTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)).To(BeTrue())
+		})
+
+		It("should not clean up when the MachineRef is restored within the grace period", func() {
+			_, err := r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.zombieDetectedAt.IsZero()).To(BeFalse())
+
+			byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Name: "test-machine"}
+			_, err = r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.zombieDetectedAt.IsZero()).To(BeTrue())
+
+			// A later nil MachineRef starts a fresh grace period
+			byoHost.Status.MachineRef = nil
+			result, err := r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 59*time.Second))
+			Expect(conditions.IsTrue(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded)).To(BeTrue())
+		})
+	})
+	Context("When a resync period is configured", func() {
+		var (
+			ctx     context.Context
+			r       *HostReconciler
+			hostKey types.NamespacedName
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			scheme := runtime.NewScheme()
+			Expect(infrastructurev1beta1.AddToScheme(scheme)).To(Succeed())
+
+			byoHost := &infrastructurev1beta1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: "default"}}
+			hostKey = types.NamespacedName{Name: byoHost.Name, Namespace: byoHost.Namespace}
+			r = &HostReconciler{
+				Client:       fake.NewClientBuilder().WithScheme(scheme).WithObjects(byoHost).Build(),
+				ResyncPeriod: 5 * time.Minute,
+			}
+		})
+
+		It("should reconcile again after the resync period without any ByoHost event", func() {
+			for i := 0; i < 2; i++ {
+				result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: hostKey})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
+			}
+		})
+
+		It("should keep a shorter requeue of the reconcile", func() {
+			byoHost := &infrastructurev1beta1.ByoHost{}
+			Expect(r.Client.Get(ctx, hostKey, byoHost)).To(Succeed())
+			conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+			Expect(r.Client.Update(ctx, byoHost)).To(Succeed())
+			r.ZombieCleanupGracePeriod = time.Minute
+
+			result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: hostKey})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("<=", time.Minute))
+		})
+
+		It("should not requeue when resyncs are disabled", func() {
+			r.ResyncPeriod = 0
+			result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: hostKey})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.IsZero()).To(BeTrue())
+		})
+	})
+	Context("When parsing install and uninstall scripts", func() {
+		var r *HostReconciler
+
+		BeforeEach(func() {
+			r = &HostReconciler{DownloadPath: "/var/lib/byoh/bundles"}
+		})
+
+		It("should resolve the supported template tokens", func() {
+			script, err := r.parseScript(context.TODO(), `tar -C {{.BundleDownloadPath}} && echo {{.Hostname}} {{"{{"}}`, "test-host")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(script).To(Equal("tar -C /var/lib/byoh/bundles && echo test-host {{"))
+		})
+
+		It("should reject a template token that can not be resolved", func() {
+			_, err := r.parseScript(context.TODO(), "curl {{.BundleURL}}", "test-host")
+			Expect(err).To(MatchError(ContainSubstring("BundleURL")))
+		})
+	})
+	Context("When the install script is recorded for audit", func() {
+		var (
+			r       *HostReconciler
+			byoHost *infrastructurev1beta1.ByoHost
+		)
+
+		BeforeEach(func() {
+			r = &HostReconciler{RecordInstallScript: true}
+			byoHost = &infrastructurev1beta1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: "default"}}
+		})
+
+		It("should record a hash that changes with the script", func() {
+			r.recordInstallScript(byoHost, "echo install")
+			firstHash := byoHost.Annotations[infrastructurev1beta1.InstallScriptHashAnnotation]
+			Expect(firstHash).To(HaveLen(64))
+
+			r.recordInstallScript(byoHost, "echo install")
+			Expect(byoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.InstallScriptHashAnnotation, firstHash))
+
+			r.recordInstallScript(byoHost, "echo install v2")
+			Expect(byoHost.Annotations[infrastructurev1beta1.InstallScriptHashAnnotation]).NotTo(Equal(firstHash))
+			Expect(byoHost.Annotations).NotTo(HaveKey(infrastructurev1beta1.InstallScriptAnnotation))
+		})
+
+		It("should record the script truncated to the configured size", func() {
+			r.InstallScriptAuditBytes = 4
+			r.recordInstallScript(byoHost, "echo install")
+			Expect(byoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.InstallScriptAnnotation, "echo"))
+
+			r.InstallScriptAuditBytes = 1024
+			r.recordInstallScript(byoHost, "echo install")
+			Expect(byoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.InstallScriptAnnotation, "echo install"))
+		})
+
+		It("should cap the recorded script", func() {
+			r.InstallScriptAuditBytes = 1024 * 1024
+			r.recordInstallScript(byoHost, strings.Repeat("x", 2*MaxInstallScriptAuditBytes))
+			Expect(byoHost.Annotations[infrastructurev1beta1.InstallScriptAnnotation]).To(HaveLen(MaxInstallScriptAuditBytes))
+		})
+
+		It("should not record anything when disabled", func() {
+			r.RecordInstallScript = false
+			r.recordInstallScript(byoHost, "echo install")
+			Expect(byoHost.Annotations).To(BeEmpty())
+		})
+	})
+	Context("When the local node ProviderID is patched", func() {
+		var (
+			ctx       context.Context
+			c         *failingPatchClient
+			newClient func() (client.Client, error)
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test-node"}}
+			c = &failingPatchClient{Client: fake.NewClientBuilder().WithObjects(node).Build()}
+			newClient = func() (client.Client, error) { return c, nil }
+		})
+
+		getProviderID := func() string {
+			node := &corev1.Node{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "test-node"}, node)).To(Succeed())
+			return node.Spec.ProviderID
+		}
+
+		It("should retry a transient patch failure locally", func() {
+			c.failures = 2
+			Expect(patchNodeProviderIDWithRetry(ctx, newClient, "test-node", 3, time.Millisecond)).To(Succeed())
+			Expect(c.patches).To(Equal(3))
+			Expect(getProviderID()).To(Equal("byoh://test-node"))
+		})
+
+		It("should retry until the local client can be created", func() {
+			calls := 0
+			flakyNewClient := func() (client.Client, error) {
+				calls++
+				if calls == 1 {
+					return nil, errors.New("kubelet.conf not found")
+				}
+				return c, nil
+			}
+			Expect(patchNodeProviderIDWithRetry(ctx, flakyNewClient, "test-node", 3, time.Millisecond)).To(Succeed())
+			Expect(getProviderID()).To(Equal("byoh://test-node"))
+		})
+
+		It("should return the last error once the attempts are exhausted", func() {
+			c.failures = 5
+			err := patchNodeProviderIDWithRetry(ctx, newClient, "test-node", 3, time.Millisecond)
+			Expect(err).To(MatchError(ContainSubstring("request timed out")))
+			Expect(c.patches).To(Equal(3))
+			Expect(getProviderID()).To(BeEmpty())
+		})
+
+		It("should not patch a node whose ProviderID is already set", func() {
+			Expect(patchNodeProviderIDWithRetry(ctx, newClient, "test-node", 3, time.Millisecond)).To(Succeed())
+			Expect(patchNodeProviderIDWithRetry(ctx, newClient, "test-node", 3, time.Millisecond)).To(Succeed())
+			Expect(c.patches).To(Equal(1))
+		})
+	})
+	Context("When verifying the local node ProviderID persisted", func() {
+		var (
+			ctx       context.Context
+			c         client.Client
+			newClient func() (client.Client, error)
+			pinned    int
+			pin       func(context.Context) error
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			pinned = 0
+			pin = func(context.Context) error {
+				pinned++
+				return nil
+			}
+		})
+
+		withNode := func(providerID string) {
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test-node"}, Spec: corev1.NodeSpec{ProviderID: providerID}}
+			c = fake.NewClientBuilder().WithObjects(node).Build()
+			newClient = func() (client.Client, error) { return c, nil }
+		}
+
+		It("should leave kubelet alone when the ProviderID persisted", func() {
+			withNode("byoh://test-node")
+			Expect(verifyNodeProviderID(ctx, newClient, "test-node", time.Millisecond, pin)).To(Succeed())
+			Expect(pinned).To(Equal(0))
+		})
+
+		It("should pin the ProviderID in the kubelet flags and patch it again when kubelet cleared it", func() {
+			withNode("")
+			Expect(verifyNodeProviderID(ctx, newClient, "test-node", time.Millisecond, pin)).To(Succeed())
+			Expect(pinned).To(Equal(1))
+
+			node := &corev1.Node{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "test-node"}, node)).To(Succeed())
+			Expect(node.Spec.ProviderID).To(Equal("byoh://test-node"))
+		})
+
+		It("should not patch the ProviderID when pinning it failed", func() {
+			withNode("")
+			err := verifyNodeProviderID(ctx, newClient, "test-node", time.Millisecond, func(context.Context) error {
+				return errors.New("read-only file system")
+			})
+			Expect(err).To(MatchError(ContainSubstring("failed to pin the kubelet provider-id")))
+		})
+	})
+	Context("When injecting --provider-id into the kubelet flags", func() {
+		var (
+			r         *HostReconciler
+			cmdRunner *cloudinitfakes.FakeICmdRunner
+			flagsFile string
+		)
+
+		BeforeEach(func() {
+			cmdRunner = &cloudinitfakes.FakeICmdRunner{}
+			r = &HostReconciler{CmdRunner: cmdRunner, FileWriter: cloudinit.FileWriter{}}
+			flagsFile = filepath.Join(GinkgoT().TempDir(), "kubeadm-flags.env")
+		})
+
+		It("should add the flag to the kubeadm flags and restart kubelet", func() {
+			content := "KUBELET_KUBEADM_ARGS=\"--container-runtime-endpoint=unix:///run/containerd/containerd.sock --pod-infra-container-image=registry.k8s.io/pause:3.9\"\n"
+			Expect(os.WriteFile(flagsFile, []byte(content), 0644)).To(Succeed())
+
+			Expect(r.injectKubeletProviderIDFlag(context.TODO(), flagsFile, "test-node")).To(Succeed())
+			flags, err := os.ReadFile(flagsFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(flags)).To(Equal("KUBELET_KUBEADM_ARGS=\"--container-runtime-endpoint=unix:///run/containerd/containerd.sock --pod-infra-container-image=registry.k8s.io/pause:3.9 --provider-id=byoh://test-node\"\n"))
+			Expect(cmdRunner.RunCmdCallCount()).To(Equal(1))
+			_, cmd := cmdRunner.RunCmdArgsForCall(0)
+			Expect(cmd).To(Equal("systemctl restart kubelet"))
+
+			// kubelet already runs with the flag, it is not restarted again
+			Expect(r.injectKubeletProviderIDFlag(context.TODO(), flagsFile, "test-node")).To(Succeed())
+			Expect(cmdRunner.RunCmdCallCount()).To(Equal(1))
+		})
+
+		It("should write the flags when kubeadm did not", func() {
+			Expect(r.injectKubeletProviderIDFlag(context.TODO(), flagsFile, "test-node")).To(Succeed())
+			flags, err := os.ReadFile(flagsFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(flags)).To(Equal("KUBELET_KUBEADM_ARGS=\"--provider-id=byoh://test-node\"\n"))
+			Expect(cmdRunner.RunCmdCallCount()).To(Equal(1))
+		})
+
+		It("should read and write the flags under the root directory", func() {
+			rootDir := GinkgoT().TempDir()
+			r.FileWriter = cloudinit.FileWriter{RootDir: rootDir}
+			Expect(os.MkdirAll(filepath.Join(rootDir, "var", "lib", "kubelet"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(rootDir, kubeadmFlagsEnvFile), []byte("KUBELET_KUBEADM_ARGS=\"--v=2\"\n"), 0644)).To(Succeed())
+
+			Expect(r.injectKubeletProviderIDFlag(context.TODO(), kubeadmFlagsEnvFile, "test-node")).To(Succeed())
+			flags, err := os.ReadFile(filepath.Join(rootDir, kubeadmFlagsEnvFile))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(flags)).To(Equal("KUBELET_KUBEADM_ARGS=\"--v=2 --provider-id=byoh://test-node\"\n"))
+		})
+
+		It("should keep the other variables of the flags file", func() {
+			updated, changed := withProviderIDFlag("KUBELET_EXTRA=1", "byoh://test-node")
+			Expect(changed).To(BeTrue())
+			Expect(updated).To(Equal("KUBELET_EXTRA=1\nKUBELET_KUBEADM_ARGS=\"--provider-id=byoh://test-node\"\n"))
+		})
+	})
+
+	Context("When the ByoHost has an install env", func() {
+		It("should export the variables sorted and quoted", func() {
+			exports, err := installEnvExports(map[string]string{
+				"NO_PROXY":   "10.0.0.0/8,.svc",
+				"HTTP_PROXY": "http://proxy:3128",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exports).To(Equal("export HTTP_PROXY='http://proxy:3128'\nexport NO_PROXY='10.0.0.0/8,.svc'\n"))
+		})
+
+		It("should make the variables present in the command environment", func() {
+			exports, err := installEnvExports(map[string]string{
+				"REGISTRY_MIRROR": "mirror.local:5000",
+				"QUOTED":          `it's $HOME`,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			out, err := exec.Command("/bin/bash", "-c", exports+"env").Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.Split(string(out), "\n")).To(ContainElements("REGISTRY_MIRROR=mirror.local:5000", `QUOTED=it's $HOME`))
+		})
+
+		It("should render nothing without install env", func() {
+			Expect(installEnvExports(nil)).To(BeEmpty())
+		})
+
+		It("should reject an invalid variable name", func() {
+			_, err := installEnvExports(map[string]string{"NO-PROXY": "x"})
+			Expect(err).To(MatchError(ContainSubstring("NO-PROXY")))
+
+			_, err = installEnvExports(map[string]string{"A=B; rm -rf": "x"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When the host has several network interfaces", func() {
+		var network []infrastructurev1beta1.NetworkStatus
+
+		BeforeEach(func() {
+			network = []infrastructurev1beta1.NetworkStatus{
+				{NetworkInterfaceName: "lo", IPAddrs: []string{"127.0.0.1/8", "::1/128"}},
+				{NetworkInterfaceName: "eth1", IPAddrs: []string{"172.16.0.10/16"}},
+				{NetworkInterfaceName: "eth0", IsDefault: true, IPAddrs: []string{"fe80::1/64", "2001:db8::10/64", "10.0.0.5/24"}},
+			}
+		})
+
+		It("should select the IPv4 address of the default interface", func() {
+			Expect(defaultInterfaceIP(network)).To(Equal("10.0.0.5"))
+		})
+
+		It("should fall back to a global IPv6 address of the default interface", func() {
+			network[2].IPAddrs = []string{"fe80::1/64", "2001:db8::10/64"}
+			Expect(defaultInterfaceIP(network)).To(Equal("2001:db8::10"))
+		})
+
+		It("should select nothing without a default interface", func() {
+			network[2].IsDefault = false
+			Expect(defaultInterfaceIP(network)).To(BeEmpty())
+		})
+
+		It("should pass the default interface IP to kubelet", func() {
+			byoHost := &infrastructurev1beta1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "test-host"}}
+			Expect((&HostReconciler{}).kubeletArgs(context.TODO(), byoHost)).NotTo(ContainElement(HavePrefix("--node-ip")))
+
+			byoHost.Status.Network = network
+			Expect((&HostReconciler{}).kubeletArgs(context.TODO(), byoHost)).To(ContainElement("--node-ip=10.0.0.5"))
+		})
+	})
+
+	Context("When reading the tail of the bootstrap log", func() {
+		var logPath string
+
+		BeforeEach(func() {
+			logPath = filepath.Join(GinkgoT().TempDir(), "byoh-agent.log")
+		})
+
+		It("should return the last lines of the log", func() {
+			var log strings.Builder
+			for i := 1; i <= 30; i++ {
+				log.WriteString(fmt.Sprintf("line %d\n", i))
+			}
+			Expect(os.WriteFile(logPath, []byte(log.String()), 0o600)).To(Succeed())
+
+			tail, err := readLogTail(logPath, 3, 1024)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tail).To(Equal("line 28\nline 29\nline 30"))
+		})
+
+		It("should drop a partial line when bounded by bytes", func() {
+			Expect(os.WriteFile(logPath, []byte("first line\nsecond line\nthird line\n"), 0o600)).To(Succeed())
+
+			tail, err := readLogTail(logPath, 20, 16)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tail).To(Equal("third line"))
+		})
+
+		It("should surface nothing without a log", func() {
+			r := &HostReconciler{BootstrapLogPath: filepath.Join(filepath.Dir(logPath), "missing.log")}
+			Expect(r.bootstrapLogTail(context.TODO())).To(BeEmpty())
+			Expect(withLogTail("k8s Node Bootstrap failed", "")).To(Equal("k8s Node Bootstrap failed"))
+		})
+	})
+
+	Context("When the uninstall is a dry run", func() {
+		var (
+			r         *HostReconciler
+			cmdRunner *cloudinitfakes.FakeICmdRunner
+			byoHost   *infrastructurev1beta1.ByoHost
+			node      *corev1.Node
+		)
+
+		BeforeEach(func() {
+			cmdRunner = &cloudinitfakes.FakeICmdRunner{}
+			node = &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test-host"}}
+			r = &HostReconciler{
+				Client:          fake.NewClientBuilder().WithObjects(node).Build(),
+				CmdRunner:       cmdRunner,
+				DownloadPath:    "/var/lib/byoh/bundles",
+				DryRunUninstall: true,
+			}
+			uninstallScript := "rm -rf {{.BundleDownloadPath}}/k8s"
+			byoHost = &infrastructurev1beta1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-host"},
+				Spec: infrastructurev1beta1.ByoHostSpec{
+					InstallationSecret:   &corev1.ObjectReference{Kind: "Secret", Name: "test-installation-secret"},
+					UninstallationScript: &uninstallScript,
+				},
+				Status: infrastructurev1beta1.ByoHostStatus{
+					MachineRef: &corev1.ObjectReference{Kind: "ByoMachine", Name: "test-machine"},
+				},
+			}
+			conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+			conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded)
+		})
+
+		It("should not run any command and still release the host", func() {
+			_, err := r.hostCleanUp(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmdRunner.RunCmdCallCount()).To(BeZero())
+
+			Expect(r.Client.Get(context.TODO(), client.ObjectKeyFromObject(node), &corev1.Node{})).To(Succeed())
+			Expect(byoHost.Status.MachineRef).To(BeNil())
+			Expect(byoHost.Spec.InstallationSecret).To(BeNil())
+			Expect(byoHost.Spec.UninstallationScript).To(BeNil())
+			Expect(conditions.IsFalse(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded)).To(BeTrue())
+			Expect(conditions.IsFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)).To(BeTrue())
+		})
+
+		It("should still validate the uninstall script", func() {
+			invalidScript := "curl {{.BundleURL}}"
+			byoHost.Spec.UninstallationScript = &invalidScript
+
+			_, err := r.hostCleanUp(context.TODO(), byoHost)
+			Expect(err).To(MatchError(ContainSubstring("BundleURL")))
+			Expect(cmdRunner.RunCmdCallCount()).To(BeZero())
+		})
+	})
+
+	Context("When a minimum free disk space is configured", func() {
+		var (
+			r         *HostReconciler
+			cmdRunner *cloudinitfakes.FakeICmdRunner
+			byoHost   *infrastructurev1beta1.ByoHost
+			freeBytes map[string]uint64
+		)
+
+		BeforeEach(func() {
+			freeBytes = map[string]uint64{"/": 20 << 30, "/var": 20 << 30}
+			statfs = func(path string, stat *syscall.Statfs_t) error {
+				free, ok := freeBytes[path]
+				if !ok {
+					return syscall.ENOENT
+				}
+				stat.Bsize = 4096
+				stat.Bavail = free / 4096
+				return nil
+			}
+			DeferCleanup(func() { statfs = syscall.Statfs })
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-installation-secret", Namespace: "default"},
+				Data:       map[string][]byte{"install": []byte("echo install"), "uninstall": []byte("echo uninstall")},
+			}
+			cmdRunner = &cloudinitfakes.FakeICmdRunner{}
+			r = &HostReconciler{
+				Client:           fake.NewClientBuilder().WithObjects(secret).Build(),
+				CmdRunner:        cmdRunner,
+				Recorder:         record.NewFakeRecorder(32),
+				MinFreeDiskBytes: 10 << 30,
+			}
+			byoHost = &infrastructurev1beta1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-host"},
+				Spec: infrastructurev1beta1.ByoHostSpec{
+					InstallationSecret: &corev1.ObjectReference{Kind: "Secret", Name: "test-installation-secret", Namespace: "default"},
+				},
+			}
+		})
+
+		It("should run the install script when enough space is free", func() {
+			Expect(r.executeInstallerController(context.TODO(), byoHost)).To(Succeed())
+			Expect(cmdRunner.RunCmdCallCount()).To(Equal(1))
+		})
+
+		It("should fail fast with a condition when /var is low on disk", func() {
+			freeBytes["/var"] = 2 << 30
+
+			err := r.executeInstallerController(context.TODO(), byoHost)
+			Expect(errors.Is(err, errInsufficientDiskSpace)).To(BeTrue())
+			Expect(cmdRunner.RunCmdCallCount()).To(BeZero())
+
+			condition := conditions.Get(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Reason).To(Equal(infrastructurev1beta1.InsufficientDiskSpaceReason))
+			Expect(condition.Message).To(ContainSubstring("2Gi free on /var, at least 10Gi required"))
+		})
+
+		It("should not check the free space without a minimum", func() {
+			delete(freeBytes, "/var")
+			r.MinFreeDiskBytes = 0
+
+			Expect(r.checkFreeDisk(context.TODO())).To(Succeed())
+		})
+
+		It("should fail when the free space cannot be read", func() {
+			delete(freeBytes, "/var")
+
+			err := r.checkFreeDisk(context.TODO())
+			Expect(err).To(MatchError(ContainSubstring("failed to get the free space on /var")))
+			Expect(errors.Is(err, errInsufficientDiskSpace)).To(BeFalse())
+		})
+
+		It("should check the free space under the root directory of the FileWriter", func() {
+			r.FileWriter = cloudinit.FileWriter{RootDir: "/mnt/image"}
+			freeBytes = map[string]uint64{"/mnt/image": 20 << 30, "/mnt/image/var": 2 << 30}
+
+			err := r.checkFreeDisk(context.TODO())
+			Expect(errors.Is(err, errInsufficientDiskSpace)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring("2Gi free on /var")))
+		})
+	})
+
+	Context("When starting kubelet fails in TLS Bootstrap mode", func() {
+		var (
+			r                     *HostReconciler
+			cmdRunner             *cloudinitfakes.FakeICmdRunner
+			fileWriter            *cloudinitfakes.FakeIFileWriter
+			byoHost               *infrastructurev1beta1.ByoHost
+			kubeletStartFailures  int
+			origServiceFailReason func(context.Context, string) string
+		)
+
+		BeforeEach(func() {
+			origServiceFailReason = serviceFailureReason
+			serviceFailureReason = func(context.Context, string) string {
+				return "Result=exit-code ExecMainStatus=1"
+			}
+			bootstrapSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-bootstrap-secret", Namespace: "default"},
+				Data: map[string][]byte{
+					"ca.crt":               []byte("fake-ca"),
+					"bootstrap-kubeconfig": []byte("fake-kubeconfig"),
+					"kubelet-config.yaml":  []byte("kind: KubeletConfiguration\n"),
+				},
+			}
+			installationSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-installation-secret", Namespace: "default"},
+				Data:       map[string][]byte{"install": []byte("echo install"), "uninstall": []byte("echo uninstall")},
+			}
+
+			// Starting kubelet fails once, e.g. while containerd is still coming up
+			kubeletStartFailures = 1
+			cmdRunner = &cloudinitfakes.FakeICmdRunner{}
+			cmdRunner.RunCmdStub = func(_ context.Context, cmd string) error {
+				if cmd == "systemctl enable --now kubelet" && kubeletStartFailures > 0 {
+					kubeletStartFailures--
+					return errors.New("Job for kubelet.service failed")
+				}
+				return nil
+			}
+			fileWriter = &cloudinitfakes.FakeIFileWriter{}
+			r = &HostReconciler{
+				Client:     fake.NewClientBuilder().WithObjects(bootstrapSecret, installationSecret).Build(),
+				CmdRunner:  cmdRunner,
+				FileWriter: fileWriter,
+				Recorder:   record.NewFakeRecorder(32),
+			}
+			byoHost = &infrastructurev1beta1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-host"},
+				Spec: infrastructurev1beta1.ByoHostSpec{
+					JoinMode:           infrastructurev1beta1.JoinModeTLSBootstrap,
+					DisableKubeProxy:   true,
+					BootstrapSecret:    &corev1.ObjectReference{Kind: "Secret", Name: "test-bootstrap-secret", Namespace: "default"},
+					InstallationSecret: &corev1.ObjectReference{Kind: "Secret", Name: "test-installation-secret", Namespace: "default"},
+				},
+				Status: infrastructurev1beta1.ByoHostStatus{
+					MachineRef: &corev1.ObjectReference{Kind: "ByoMachine", Name: "test-machine"},
+				},
+			}
+		})
+
+		AfterEach(func() {
+			serviceFailureReason = origServiceFailReason
+		})
+
+		runCmds := func() []string {
+			var cmds []string
+			for i := 0; i < cmdRunner.RunCmdCallCount(); i++ {
+				_, cmd := cmdRunner.RunCmdArgsForCall(i)
+				cmds = append(cmds, cmd)
+			}
+			return cmds
+		}
+
+		It("should keep the install and the written files", func() {
+			_, err := r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).To(MatchError(ContainSubstring("failed to enable/start kubelet")))
+			Expect(err).To(MatchError(ContainSubstring("(Result=exit-code ExecMainStatus=1)")))
+
+			Expect(byoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.BootstrapPhaseAnnotation, bootstrapPhaseFilesWritten))
+			Expect(conditions.IsTrue(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded)).To(BeTrue())
+			Expect(conditions.IsFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)).To(BeTrue())
+			Expect(runCmds()).NotTo(ContainElement(HavePrefix("systemctl stop")))
+		})
+
+		It("should retry from starting kubelet rather than reinstalling", func() {
+			_, err := r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).To(HaveOccurred())
+			filesWritten := fileWriter.WriteToFileCallCount()
+
+			_, err = r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fileWriter.WriteToFileCallCount()).To(Equal(filesWritten))
+			Expect(runCmds()).To(Equal([]string{
+				"echo install",
+				"systemctl daemon-reload",
+				"systemctl enable --now kubelet",
+				"systemctl daemon-reload",
+				"systemctl enable --now kubelet",
+			}))
+			Expect(conditions.IsTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)).To(BeTrue())
+			Expect(byoHost.Annotations).NotTo(HaveKey(infrastructurev1beta1.BootstrapPhaseAnnotation))
+		})
+
+		It("should write the files again when the bootstrap secret changed since", func() {
+			_, err := r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).To(HaveOccurred())
+			filesWritten := fileWriter.WriteToFileCallCount()
+
+			secret := &corev1.Secret{}
+			Expect(r.Client.Get(context.TODO(), types.NamespacedName{Name: "test-bootstrap-secret", Namespace: "default"}, secret)).To(Succeed())
+			secret.Data["bootstrap-kubeconfig"] = []byte("rotated-kubeconfig")
+			Expect(r.Client.Update(context.TODO(), secret)).To(Succeed())
+
+			_, err = r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fileWriter.WriteToFileCallCount()).To(BeNumerically(">", filesWritten))
+			var bootstrapKubeconfig string
+			for i := filesWritten; i < fileWriter.WriteToFileCallCount(); i++ {
+				if file := fileWriter.WriteToFileArgsForCall(i); file.Path == "/etc/kubernetes/bootstrap-kubeconfig" {
+					bootstrapKubeconfig = file.Content
+				}
+			}
+			Expect(bootstrapKubeconfig).To(Equal("rotated-kubeconfig"))
+		})
+
+		It("should requeue to start kubelet again when retries are configured", func() {
+			r.KubeletStartRetries = 2
+			r.KubeletStartRetryDelay = time.Minute
+
+			result, err := r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(ctrl.Result{Requeue: true, RequeueAfter: time.Minute}))
+			Expect(conditions.IsFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)).To(BeTrue())
+			Expect(byoHost.Annotations).NotTo(HaveKey(infrastructurev1beta1.BootstrapFailuresAnnotation))
+
+			_, err = r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(runCmds()).To(Equal([]string{
+				"echo install",
+				"systemctl daemon-reload",
+				"systemctl enable --now kubelet",
+				"systemctl daemon-reload",
+				"systemctl reset-failed kubelet",
+				"systemctl enable --now kubelet",
+			}))
+			Expect(conditions.IsTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)).To(BeTrue())
+		})
+
+		It("should fail with the systemd failure reason once the retries are exhausted", func() {
+			kubeletStartFailures = 10
+			r.KubeletStartRetries = 2
+			r.KubeletStartRetryDelay = time.Millisecond
+
+			var err error
+			for i := 0; i < 2; i++ {
+				_, err = r.reconcileNormal(context.TODO(), byoHost)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			_, err = r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).To(MatchError(ContainSubstring("failed to enable/start kubelet")))
+			Expect(err).To(MatchError(ContainSubstring("(Result=exit-code ExecMainStatus=1)")))
+
+			var starts int
+			for _, cmd := range runCmds() {
+				if cmd == "systemctl enable --now kubelet" {
+					starts++
+				}
+			}
+			Expect(starts).To(Equal(3))
+			Expect(conditions.IsFalse(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)).To(BeTrue())
+		})
+
+		It("should write the bootstrap report once the node is bootstrapped", func() {
+			r.BootstrapReportPath = DefaultBootstrapReportPath
+			byoHost.Spec.KubernetesVersion = "v1.28.2"
+			byoHost.Status.HostDetails = infrastructurev1beta1.HostInfo{
+				KernelVersion:           "5.15.0-91-generic",
+				ContainerRuntimeVersion: "containerd://1.7.2",
+			}
+
+			_, err := r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).To(HaveOccurred())
+			_, err = r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+
+			var reports []*cloudinit.Files
+			for i := 0; i < fileWriter.WriteToFileCallCount(); i++ {
+				if file := fileWriter.WriteToFileArgsForCall(i); file.Path == DefaultBootstrapReportPath {
+					reports = append(reports, file)
+				}
+			}
+			Expect(reports).To(HaveLen(1))
+
+			report := &BootstrapReport{}
+			Expect(json.Unmarshal([]byte(reports[0].Content), report)).To(Succeed())
+			Expect(report.Host).To(Equal("test-host"))
+			Expect(report.JoinMode).To(Equal(string(infrastructurev1beta1.JoinModeTLSBootstrap)))
+			Expect(report.KubernetesVersion).To(Equal("v1.28.2"))
+			Expect(report.KernelVersion).To(Equal("5.15.0-91-generic"))
+			Expect(report.ContainerRuntimeVersion).To(Equal("containerd://1.7.2"))
+			// The files written by the failed attempt are reported by the resumed one
+			Expect(report.FilesWritten).To(ContainElements(
+				"/etc/kubernetes/bootstrap-kubeconfig",
+				"/var/lib/kubelet/config.yaml",
+				"/etc/systemd/system/kubelet.service",
+			))
+			Expect(report.FilesWritten).NotTo(ContainElement(DefaultBootstrapReportPath))
+			Expect(report.StartedAt.IsZero()).To(BeFalse())
+			Expect(report.CompletedAt).NotTo(BeTemporally("<", report.StartedAt))
+			Expect(report.DurationSeconds).To(BeNumerically(">=", report.NodeBootstrapDurationSeconds))
+			Expect(report.InstallDurationSeconds).To(BeNumerically(">=", 0))
+			Expect(r.bootstrapFiles).To(BeEmpty())
+		})
+
+		It("should not write the bootstrap report when its path is empty", func() {
+			_, err := r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).To(HaveOccurred())
+			_, err = r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+
+			for i := 0; i < fileWriter.WriteToFileCallCount(); i++ {
+				Expect(fileWriter.WriteToFileArgsForCall(i).Path).NotTo(Equal(DefaultBootstrapReportPath))
+			}
+			Expect(r.bootstrapFiles).To(BeEmpty())
+		})
+
+		It("should observe the bootstrap duration, retries included, once the node is bootstrapped", func() {
+			bootstrapDuration := func() *dto.Histogram {
+				metric := &dto.Metric{}
+				observer := BootstrapDuration.WithLabelValues(string(infrastructurev1beta1.JoinModeTLSBootstrap), "")
+				Expect(observer.(prometheus.Metric).Write(metric)).To(Succeed())
+				return metric.GetHistogram()
+			}
+			observed := bootstrapDuration().GetSampleCount()
+
+			_, err := r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).To(HaveOccurred())
+			Expect(bootstrapDuration().GetSampleCount()).To(Equal(observed))
+
+			_, err = r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bootstrapDuration().GetSampleCount()).To(Equal(observed + 1))
+			Expect(r.bootstrapStartedAt.IsZero()).To(BeTrue())
+
+			// A reconcile of the bootstrapped host observes nothing more
+			_, err = r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bootstrapDuration().GetSampleCount()).To(Equal(observed + 1))
+		})
+	})
+
+	Context("When verifying the cluster CA of the node", func() {
+		var (
+			r              *HostReconciler
+			byoHost        *infrastructurev1beta1.ByoHost
+			clusterCA      []byte
+			kubeconfigDir  string
+			origKubeconfig string
+		)
+
+		BeforeEach(func() {
+			clusterCA = newTestCA("kubernetes")
+			bootstrapSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-bootstrap-secret", Namespace: "default"},
+				Data:       map[string][]byte{"ca.crt": clusterCA},
+			}
+			r = &HostReconciler{
+				Client:          fake.NewClientBuilder().WithObjects(bootstrapSecret).Build(),
+				CmdRunner:       &cloudinitfakes.FakeICmdRunner{},
+				FileWriter:      &cloudinitfakes.FakeIFileWriter{},
+				Recorder:        record.NewFakeRecorder(32),
+				VerifyClusterCA: true,
+			}
+			byoHost = &infrastructurev1beta1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-host"},
+				Spec: infrastructurev1beta1.ByoHostSpec{
+					JoinMode:        infrastructurev1beta1.JoinModeTLSBootstrap,
+					BootstrapSecret: &corev1.ObjectReference{Kind: "Secret", Name: "test-bootstrap-secret", Namespace: "default"},
+				},
+				Status: infrastructurev1beta1.ByoHostStatus{
+					MachineRef: &corev1.ObjectReference{Kind: "ByoMachine", Name: "test-machine"},
+				},
+			}
+			conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+
+			kubeconfigDir = GinkgoT().TempDir()
+			origKubeconfig = kubeletKubeconfigFile
+			kubeletKubeconfigFile = filepath.Join(kubeconfigDir, "kubelet.conf")
+		})
+
+		AfterEach(func() {
+			kubeletKubeconfigFile = origKubeconfig
+		})
+
+		It("should mark the node verified when it joined the cluster of the bootstrap secret", func() {
+			writeTestKubeconfig(kubeletKubeconfigFile, clusterCA)
+
+			_, err := r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(byoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.ClusterCAVerifiedAnnotation, "true"))
+			Expect(conditions.IsTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)).To(BeTrue())
+		})
+
+		It("should reset the node with a condition when it joined another cluster", func() {
+			writeTestKubeconfig(kubeletKubeconfigFile, newTestCA("other-kubernetes"))
+
+			_, err := r.reconcileNormal(context.TODO(), byoHost)
+			Expect(errors.Is(err, errClusterCAMismatch)).To(BeTrue())
+
+			condition := conditions.Get(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(infrastructurev1beta1.ClusterCAMismatchReason))
+			Expect(condition.Message).To(ContainSubstring("is not the expected cluster CA"))
+			Expect(byoHost.Annotations).NotTo(HaveKey(infrastructurev1beta1.ClusterCAVerifiedAnnotation))
+			Expect(byoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.BootstrapFailuresAnnotation, "1"))
+		})
+
+		It("should retry until kubelet wrote its kubeconfig", func() {
+			result, err := r.reconcileNormal(context.TODO(), byoHost)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+			Expect(byoHost.Annotations).NotTo(HaveKey(infrastructurev1beta1.ClusterCAVerifiedAnnotation))
+			Expect(conditions.IsTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)).To(BeTrue())
+		})
+
+		It("should compare the CA hashes pinned by the kubeadm join", func() {
+			hashes, err := caCertHashes(clusterCA)
+			Expect(err).NotTo(HaveOccurred())
+			script := fmt.Sprintf("discovery:\n  bootstrapToken:\n    caCertHashes:\n    - %s\n", hashes[0])
+			bootstrapSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-bootstrap-secret", Namespace: "default"},
+				Data:       map[string][]byte{"value": []byte(script)},
+			}
+			r.Client = fake.NewClientBuilder().WithObjects(bootstrapSecret).Build()
+			byoHost.Spec.JoinMode = infrastructurev1beta1.JoinModeKubeadm
+
+			writeTestKubeconfig(kubeletKubeconfigFile, clusterCA)
+			Expect(r.verifyClusterCA(context.TODO(), byoHost)).To(Succeed())
+
+			writeTestKubeconfig(kubeletKubeconfigFile, newTestCA("other-kubernetes"))
+			Expect(errors.Is(r.verifyClusterCA(context.TODO(), byoHost), errClusterCAMismatch)).To(BeTrue())
+		})
+
+		It("should read the CA certificate file referenced by the kubeconfig", func() {
+			caFile := filepath.Join(kubeconfigDir, "ca.crt")
+			Expect(os.WriteFile(caFile, clusterCA, 0600)).To(Succeed())
+			kubeconfig := "apiVersion: v1\nkind: Config\nclusters:\n- cluster:\n    certificate-authority: ca.crt\n    server: https://10.0.0.1:6443\n  name: default-cluster\n" +
+				"contexts:\n- context:\n    cluster: default-cluster\n  name: default-context\ncurrent-context: default-context\n"
+			Expect(os.WriteFile(kubeletKubeconfigFile, []byte(kubeconfig), 0600)).To(Succeed())
+
+			expected, err := caCertHashes(clusterCA)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verifyKubeconfigClusterCA(kubeletKubeconfigFile, expected)).To(Succeed())
+		})
+
+		It("should skip the verification when the bootstrap secret does not tell the CA", func() {
+			bootstrapSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-bootstrap-secret", Namespace: "default"},
+				Data:       map[string][]byte{"value": []byte("discovery:\n  bootstrapToken:\n    unsafeSkipCAVerification: true\n")},
+			}
+			r.Client = fake.NewClientBuilder().WithObjects(bootstrapSecret).Build()
+			byoHost.Spec.JoinMode = infrastructurev1beta1.JoinModeKubeadm
+
+			Expect(r.verifyClusterCA(context.TODO(), byoHost)).To(Succeed())
+		})
+	})
+
+	Context("When the control plane endpoint of the cluster changes", func() {
+		var (
+			r              *HostReconciler
+			byoHost        *infrastructurev1beta1.ByoHost
+			cmdRunner      *cloudinitfakes.FakeICmdRunner
+			recorder       *record.FakeRecorder
+			origKubelet    string
+			origKubeProxy  string
+			kubeconfigPath string
+		)
+
+		BeforeEach(func() {
+			cmdRunner = &cloudinitfakes.FakeICmdRunner{}
+			recorder = record.NewFakeRecorder(32)
+			r = &HostReconciler{
+				CmdRunner: cmdRunner,
+				Recorder:  recorder,
+			}
+			byoHost = &infrastructurev1beta1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-host",
+					Annotations: map[string]string{
+						infrastructurev1beta1.EndPointIPAnnotation:        "10.0.0.2:6443",
+						infrastructurev1beta1.AppliedEndPointIPAnnotation: "10.0.0.1:6443",
+					},
+				},
+			}
+
+			kubeconfigDir := GinkgoT().TempDir()
+			origKubelet, origKubeProxy = kubeletKubeconfigFile, kubeProxyKubeconfigFile
+			kubeletKubeconfigFile = filepath.Join(kubeconfigDir, "kubelet.conf")
+			kubeProxyKubeconfigFile = filepath.Join(kubeconfigDir, "kube-proxy.kubeconfig")
+			kubeconfigPath = kubeletKubeconfigFile
+			writeTestKubeconfig(kubeletKubeconfigFile, newTestCA("kubernetes"))
+		})
+
+		AfterEach(func() {
+			kubeletKubeconfigFile, kubeProxyKubeconfigFile = origKubelet, origKubeProxy
+		})
+
+		serverOf := func(path string) string {
+			config, err := clientcmd.LoadFromFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			return config.Clusters["default-cluster"].Server
+		}
+
+		It("should point kubelet at the new endpoint and restart it", func() {
+			Expect(r.refreshControlPlaneEndpoint(context.TODO(), byoHost)).To(Succeed())
+
+			Expect(serverOf(kubeconfigPath)).To(Equal("https://10.0.0.2:6443"))
+			Expect(cmdRunner.RunCmdCallCount()).To(Equal(1))
+			_, cmd := cmdRunner.RunCmdArgsForCall(0)
+			Expect(cmd).To(Equal("systemctl restart kubelet"))
+			Expect(byoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.AppliedEndPointIPAnnotation, "10.0.0.2:6443"))
+			Expect(recorder.Events).To(Receive(ContainSubstring("ControlPlaneEndpointRefreshed")))
+		})
+
+		It("should restart kube-proxy only when the agent manages it", func() {
+			writeTestKubeconfig(kubeProxyKubeconfigFile, newTestCA("kubernetes"))
+			Expect(r.refreshControlPlaneEndpoint(context.TODO(), byoHost)).To(Succeed())
+			Expect(serverOf(kubeProxyKubeconfigFile)).To(Equal("https://10.0.0.2:6443"))
+			Expect(cmdRunner.RunCmdCallCount()).To(Equal(1))
+
+			writeTestKubeconfig(kubeletKubeconfigFile, newTestCA("kubernetes"))
+			writeTestKubeconfig(kubeProxyKubeconfigFile, newTestCA("kubernetes"))
+			byoHost.Annotations[infrastructurev1beta1.AppliedEndPointIPAnnotation] = "10.0.0.1:6443"
+			byoHost.Spec.ManageKubeProxy = true
+			Expect(r.refreshControlPlaneEndpoint(context.TODO(), byoHost)).To(Succeed())
+			Expect(cmdRunner.RunCmdCallCount()).To(Equal(3))
+			_, cmd := cmdRunner.RunCmdArgsForCall(2)
+			Expect(cmd).To(Equal("systemctl restart kube-proxy"))
+		})
+
+		It("should only record the endpoint the first time it sees the host", func() {
+			delete(byoHost.Annotations, infrastructurev1beta1.AppliedEndPointIPAnnotation)
+
+			Expect(r.refreshControlPlaneEndpoint(context.TODO(), byoHost)).To(Succeed())
+
+			Expect(serverOf(kubeconfigPath)).To(Equal("https://10.0.0.1:6443"))
+			Expect(cmdRunner.RunCmdCallCount()).To(BeZero())
+			Expect(byoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.AppliedEndPointIPAnnotation, "10.0.0.2:6443"))
+		})
+
+		It("should leave a kubeconfig pointing at another server alone", func() {
+			byoHost.Annotations[infrastructurev1beta1.AppliedEndPointIPAnnotation] = "api.example.com:6443"
+
+			Expect(r.refreshControlPlaneEndpoint(context.TODO(), byoHost)).To(Succeed())
+
+			Expect(serverOf(kubeconfigPath)).To(Equal("https://10.0.0.1:6443"))
+			Expect(cmdRunner.RunCmdCallCount()).To(BeZero())
+		})
+
+		It("should keep the applied endpoint when kubelet fails to restart, to retry", func() {
+			cmdRunner.RunCmdReturns(errors.New("unit not found"))
+
+			Expect(r.refreshControlPlaneEndpoint(context.TODO(), byoHost)).NotTo(Succeed())
+
+			Expect(byoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.AppliedEndPointIPAnnotation, "10.0.0.1:6443"))
+
+			cmdRunner.RunCmdReturns(nil)
+			Expect(r.refreshControlPlaneEndpoint(context.TODO(), byoHost)).To(Succeed())
+			Expect(cmdRunner.RunCmdCallCount()).To(Equal(2))
+			Expect(byoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.AppliedEndPointIPAnnotation, "10.0.0.2:6443"))
+		})
+	})
+
+	Context("When the kubelet log verbosity of a bootstrapped host changes", func() {
+		var (
+			r          *HostReconciler
+			byoHost    *infrastructurev1beta1.ByoHost
+			cmdRunner  *cloudinitfakes.FakeICmdRunner
+			recorder   *record.FakeRecorder
+			rootDir    string
+			configPath string
+		)
+
+		BeforeEach(func() {
+			rootDir = GinkgoT().TempDir()
+			configPath = filepath.Join(rootDir, kubeletConfigFile)
+			Expect(os.MkdirAll(filepath.Dir(configPath), 0o755)).To(Succeed())
+			Expect(os.WriteFile(configPath, []byte("kind: KubeletConfiguration\nlogging:\n  verbosity: 0\n"), 0o644)).To(Succeed())
+
+			cmdRunner = &cloudinitfakes.FakeICmdRunner{}
+			recorder = record.NewFakeRecorder(32)
+			r = &HostReconciler{
+				CmdRunner:  cmdRunner,
+				FileWriter: cloudinit.FileWriter{RootDir: rootDir},
+				Recorder:   recorder,
+			}
+			verbosity := int32(4)
+			byoHost = &infrastructurev1beta1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-host"},
+				Spec: infrastructurev1beta1.ByoHostSpec{
+					JoinMode:            infrastructurev1beta1.JoinModeTLSBootstrap,
+					KubeletLogVerbosity: &verbosity,
+				},
+			}
+			conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+		})
+
+		It("should rewrite the kubelet config and restart kubelet", func() {
+			Expect(r.refreshKubeletLogVerbosity(context.TODO(), byoHost)).To(Succeed())
+
+			Expect(os.ReadFile(configPath)).To(ContainSubstring("verbosity: 4\n"))
+			Expect(cmdRunner.RunCmdCallCount()).To(Equal(1))
+			_, cmd := cmdRunner.RunCmdArgsForCall(0)
+			Expect(cmd).To(Equal("systemctl restart kubelet"))
+			Expect(recorder.Events).To(Receive(ContainSubstring("KubeletLogVerbosityChanged")))
+
+			Expect(r.refreshKubeletLogVerbosity(context.TODO(), byoHost)).To(Succeed())
+			Expect(cmdRunner.RunCmdCallCount()).To(Equal(1))
+		})
+
+		It("should leave kubelet alone without a configured verbosity", func() {
+			byoHost.Spec.KubeletLogVerbosity = nil
+
+			Expect(r.refreshKubeletLogVerbosity(context.TODO(), byoHost)).To(Succeed())
+			Expect(os.ReadFile(configPath)).To(ContainSubstring("verbosity: 0\n"))
+			Expect(cmdRunner.RunCmdCallCount()).To(BeZero())
+		})
+
+		It("should leave a host that is not bootstrapped yet alone", func() {
+			byoHost.Status.Conditions = nil
+
+			Expect(r.refreshKubeletLogVerbosity(context.TODO(), byoHost)).To(Succeed())
+			Expect(cmdRunner.RunCmdCallCount()).To(BeZero())
+		})
+	})
+
+	Context("When the node of a host is drained before its reset", func() {
+		var (
+			ctx context.Context
+			c   *evictionClient
+		)
+
+		pod := func(name, nodeName string, mutate ...func(*corev1.Pod)) *corev1.Pod {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec:       corev1.PodSpec{NodeName: nodeName},
+				Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+			}
+			for _, m := range mutate {
+				m(pod)
+			}
+			return pod
+		}
+
+		podExists := func(name string) bool {
+			err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, &corev1.Pod{})
+			if apierrors.IsNotFound(err) {
+				return false
+			}
+			Expect(err).NotTo(HaveOccurred())
+			return true
+		}
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			isController := true
+			objects := []client.Object{
+				&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test-host"}},
+				pod("web", "test-host"),
+				pod("db", "test-host"),
+				pod("other-node", "other-host"),
+				pod("daemon", "test-host", func(p *corev1.Pod) {
+					p.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "DaemonSet", Name: "daemon", UID: "uid", Controller: &isController}}
+				}),
+				pod("static", "test-host", func(p *corev1.Pod) {
+					p.Annotations = map[string]string{corev1.MirrorPodAnnotationKey: "hash"}
+				}),
+				pod("completed", "test-host", func(p *corev1.Pod) { p.Status.Phase = corev1.PodSucceeded }),
+			}
+			c = &evictionClient{
+				Client: fake.NewClientBuilder().WithObjects(objects...).
+					WithIndex(&corev1.Pod{}, "spec.nodeName", func(o client.Object) []string {
+						return []string{o.(*corev1.Pod).Spec.NodeName}
+					}).Build(),
+				refused: map[string]bool{},
+			}
+		})
+
+		It("should cordon the node and evict its pods", func() {
+			remaining, err := evictNodePods(ctx, c, "test-host")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remaining).To(Equal(2))
+
+			node := &corev1.Node{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: "test-host"}, node)).To(Succeed())
+			Expect(node.Spec.Unschedulable).To(BeTrue())
+			Expect(c.evicted).To(ConsistOf("default/web", "default/db"))
+			Expect(podExists("web")).To(BeFalse())
+			Expect(podExists("db")).To(BeFalse())
+			Expect(podExists("other-node")).To(BeTrue())
+			Expect(podExists("daemon")).To(BeTrue())
+			Expect(podExists("static")).To(BeTrue())
+
+			Expect(evictNodePods(ctx, c, "test-host")).To(BeZero())
+		})
+
+		It("should evict the pods refused by a PodDisruptionBudget again", func() {
+			c.refused["default/db"] = true
+
+			_, err := evictNodePods(ctx, c, "test-host")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(evictNodePods(ctx, c, "test-host")).To(Equal(1))
+			Expect(podExists("web")).To(BeFalse())
+			Expect(podExists("db")).To(BeTrue())
+
+			c.allow("default/db")
+			_, err = evictNodePods(ctx, c, "test-host")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(podExists("db")).To(BeFalse())
+			Expect(c.evicted).To(HaveLen(4))
+		})
+
+		It("should report a node not found as not drained", func() {
+			_, err := evictNodePods(ctx, c, "gone-host")
+			Expect(err).To(MatchError(errNodeNotDrained))
+			Expect(c.evicted).To(BeEmpty())
+		})
+
+		Context("by the reconciler", func() {
+			var (
+				r                  *HostReconciler
+				recorder           *record.FakeRecorder
+				byoHost            *infrastructurev1beta1.ByoHost
+				origNewDrainClient func(string) (client.Client, error)
+				drainClients       int
+			)
+
+			BeforeEach(func() {
+				origNewDrainClient = newDrainClient
+				drainClients = 0
+				newDrainClient = func(kubeconfigPath string) (client.Client, error) {
+					Expect(kubeconfigPath).To(Equal("/etc/byoh/drain.kubeconfig"))
+					drainClients++
+					return c, nil
+				}
+				recorder = record.NewFakeRecorder(10)
+				// The client of the management cluster has no Node, the workload cluster client is used
+				r = &HostReconciler{
+					Client:          fake.NewClientBuilder().Build(),
+					Recorder:        recorder,
+					DrainKubeconfig: "/etc/byoh/drain.kubeconfig",
+				}
+				byoHost = &infrastructurev1beta1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: "default"}}
+			})
+
+			AfterEach(func() {
+				newDrainClient = origNewDrainClient
+			})
+
+			It("should requeue the host until the pods are evicted and report the drain", func() {
+				Expect(r.drainNode(ctx, byoHost, time.Minute)).To(Equal(ctrl.Result{RequeueAfter: drainRetryInterval}))
+				Expect(recorder.Events).NotTo(Receive())
+
+				Expect(r.drainNode(ctx, byoHost, time.Minute)).To(Equal(ctrl.Result{}))
+				Expect(recorder.Events).To(Receive(ContainSubstring("DrainK8sNodeSucceeded")))
+				Expect(c.evicted).To(ConsistOf("default/web", "default/db"))
+				Expect(r.drainStartedAt.IsZero()).To(BeTrue())
+			})
+
+			It("should build the workload cluster client once across the requeues of the drain", func() {
+				c.refused["default/db"] = true
+				for i := 0; i < 3; i++ {
+					Expect(r.drainNode(ctx, byoHost, time.Minute)).To(Equal(ctrl.Result{RequeueAfter: drainRetryInterval}))
+				}
+				Expect(drainClients).To(Equal(1))
+			})
+
+			It("should give up the drain once the timeout elapsed", func() {
+				c.refused["default/db"] = true
+				Expect(r.drainNode(ctx, byoHost, time.Minute)).To(Equal(ctrl.Result{RequeueAfter: drainRetryInterval}))
+
+				r.drainStartedAt = time.Now().Add(-2 * time.Minute)
+				Expect(r.drainNode(ctx, byoHost, time.Minute)).To(Equal(ctrl.Result{}))
+				Expect(recorder.Events).To(Receive(ContainSubstring("timed out after 1m0s draining node test-host, 1 pods left")))
+				Expect(podExists("db")).To(BeTrue())
+			})
+
+			It("should report a node not found in the workload cluster as not drained", func() {
+				byoHost.Name = "gone-host"
+				Expect(r.drainNode(ctx, byoHost, time.Minute)).To(Equal(ctrl.Result{}))
+				Expect(recorder.Events).To(Receive(And(ContainSubstring("DrainK8sNodeFailed"), ContainSubstring("node not drained"))))
+			})
+
+			It("should not drain the node without a drain kubeconfig", func() {
+				r.DrainKubeconfig = ""
+				Expect(r.drainNode(ctx, byoHost, time.Minute)).To(Equal(ctrl.Result{}))
+				Expect(recorder.Events).To(Receive(ContainSubstring("no drain kubeconfig")))
+				Expect(c.evicted).To(BeEmpty())
+			})
+
+			It("should requeue the cleanup of the host while its node is drained", func() {
+				byoHost.Annotations = map[string]string{infrastructurev1beta1.GracefulDrainAnnotation: "1m"}
+				byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Name: "test-machine"}
+
+				result, err := r.hostCleanUp(ctx, byoHost)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(ctrl.Result{RequeueAfter: drainRetryInterval}))
+				Expect(byoHost.Status.MachineRef).NotTo(BeNil())
+			})
+		})
+
+		It("should only drain the hosts asking for it, with their timeout", func() {
+			byoHost := &infrastructurev1beta1.ByoHost{}
+			_, ok := gracefulDrainTimeout(ctx, byoHost)
+			Expect(ok).To(BeFalse())
+
+			for value, expected := range map[string]time.Duration{
+				"":     DefaultGracefulDrainTimeout,
+				"90s":  90 * time.Second,
+				"soon": DefaultGracefulDrainTimeout,
+			} {
+				byoHost.Annotations = map[string]string{infrastructurev1beta1.GracefulDrainAnnotation: value}
+				timeout, ok := gracefulDrainTimeout(ctx, byoHost)
+				Expect(ok).To(BeTrue(), value)
+				Expect(timeout).To(Equal(expected), value)
+			}
+		})
+	})
+})
+
+// evictionClient serves the evictions of pods the fake client does not support, deleting the evicted pods unless
+// their eviction is refused as by a PodDisruptionBudget
+type evictionClient struct {
+	client.Client
+	mu      sync.Mutex
+	evicted []string
+	refused map[string]bool
+}
+
+func (c *evictionClient) SubResource(subResource string) client.SubResourceClient {
+	if subResource == "eviction" {
+		return evictionSubResourceClient{c: c}
+	}
+	return c.Client.SubResource(subResource)
+}
+
+// allow lets the eviction of the pod through
+func (c *evictionClient) allow(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.refused, key)
+}
+
+type evictionSubResourceClient struct {
+	client.SubResourceClient
+	c *evictionClient
+}
+
+func (e evictionSubResourceClient) Create(ctx context.Context, obj client.Object, _ client.Object, _ ...client.SubResourceCreateOption) error {
+	key := obj.GetNamespace() + "/" + obj.GetName()
+	e.c.mu.Lock()
+	e.c.evicted = append(e.c.evicted, key)
+	refused := e.c.refused[key]
+	e.c.mu.Unlock()
+	if refused {
+		return apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 1)
+	}
+	return e.c.Client.Delete(ctx, obj)
+}
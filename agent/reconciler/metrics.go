@@ -0,0 +1,25 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package reconciler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// BootstrapDuration observes the time from the start of the bootstrap of a host, the install included,
+// to its K8sNodeBootstrapSucceeded condition, so slow hosts can be found
+var BootstrapDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "byoh_agent_bootstrap_duration_seconds",
+		Help:    "Time from the start of the bootstrap of the host to its K8sNodeBootstrapSucceeded condition",
+		Buckets: []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	},
+	[]string{"join_mode", "download_mode"},
+)
+
+func init() {
+	// The agent manager serves the controller-runtime registry on its metrics bind address
+	metrics.Registry.MustRegister(BootstrapDuration)
+}
@@ -7,6 +7,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/cloudinit/cloudinitfakes"
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/reconciler"
@@ -150,6 +152,76 @@ var _ = Describe("Byohost Agent Tests", func() {
 				}))
 			})
 
+			It("should apply the configured owner to the CA and bootstrap kubeconfig in TLS Bootstrap mode", func() {
+				tlsSecret := builder.Secret(ns, "test-tls-secret").
+					WithKeyData("ca.crt", "fake-ca").
+					WithKeyData("bootstrap-kubeconfig", "fake-kubeconfig").
+					Build()
+				Expect(k8sClient.Create(ctx, tlsSecret)).NotTo(HaveOccurred())
+
+				byoHost.Spec.JoinMode = infrastructurev1beta1.JoinModeTLSBootstrap
+				byoHost.Spec.BootstrapSecret = &corev1.ObjectReference{
+					Kind:      "Secret",
+					Namespace: tlsSecret.Namespace,
+					Name:      tlsSecret.Name,
+				}
+				Expect(patchHelper.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).NotTo(HaveOccurred())
+
+				hostReconciler.SkipK8sInstallation = true
+				hostReconciler.FileOwner = "kubelet:kubelet"
+				// The reconcile fails later on when loading the agent kubeconfig, the writes before are still recorded
+				_, _ = hostReconciler.Reconcile(ctx, controllerruntime.Request{
+					NamespacedName: byoHostLookupKey,
+				})
+
+				owners := map[string]string{}
+				for i := 0; i < fakeFileWriter.WriteToFileCallCount(); i++ {
+					file := fakeFileWriter.WriteToFileArgsForCall(i)
+					owners[file.Path] = file.Owner
+				}
+				Expect(owners).To(HaveKeyWithValue("/etc/kubernetes/pki/ca.crt", "kubelet:kubelet"))
+				Expect(owners).To(HaveKeyWithValue("/etc/kubernetes/bootstrap-kubeconfig", "kubelet:kubelet"))
+				Expect(owners).To(HaveKeyWithValue("/var/lib/kubelet/config.yaml", ""))
+			})
+
+			It("should not write any kube-proxy artifacts when kube-proxy is disabled", func() {
+				tlsSecret := builder.Secret(ns, "test-tls-secret").
+					WithKeyData("ca.crt", "fake-ca").
+					WithKeyData("bootstrap-kubeconfig", "fake-kubeconfig").
+					WithKeyData("kube-proxy-config.yaml", "fake-kube-proxy-config").
+					Build()
+				Expect(k8sClient.Create(ctx, tlsSecret)).NotTo(HaveOccurred())
+
+				byoHost.Spec.JoinMode = infrastructurev1beta1.JoinModeTLSBootstrap
+				byoHost.Spec.ManageKubeProxy = true
+				byoHost.Spec.DisableKubeProxy = true
+				byoHost.Spec.BootstrapSecret = &corev1.ObjectReference{
+					Kind:      "Secret",
+					Namespace: tlsSecret.Namespace,
+					Name:      tlsSecret.Name,
+				}
+				Expect(patchHelper.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).NotTo(HaveOccurred())
+
+				hostReconciler.SkipK8sInstallation = true
+				_, _ = hostReconciler.Reconcile(ctx, controllerruntime.Request{
+					NamespacedName: byoHostLookupKey,
+				})
+
+				var writtenPaths []string
+				for i := 0; i < fakeFileWriter.WriteToFileCallCount(); i++ {
+					writtenPaths = append(writtenPaths, fakeFileWriter.WriteToFileArgsForCall(i).Path)
+				}
+				Expect(writtenPaths).To(ContainElement("/etc/systemd/system/kubelet.service"))
+				Expect(writtenPaths).NotTo(ContainElement(ContainSubstring("kube-proxy")))
+				for i := 0; i < fakeFileWriter.MkdirIfNotExistsCallCount(); i++ {
+					Expect(fakeFileWriter.MkdirIfNotExistsArgsForCall(i)).NotTo(ContainSubstring("kube-proxy"))
+				}
+				for i := 0; i < fakeCommandRunner.RunCmdCallCount(); i++ {
+					_, cmd := fakeCommandRunner.RunCmdArgsForCall(i)
+					Expect(cmd).NotTo(ContainSubstring("kube-proxy"))
+				}
+			})
+
 			Context("When bootstrap secret is ready", func() {
 				BeforeEach(func() {
 					secretData := `write_files:
@@ -347,6 +419,84 @@ runCmd:
 						}))
 					})
 
+					It("should surface the tail of the bootstrap log in the failure condition", func() {
+						conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded)
+						Expect(patchHelper.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).NotTo(HaveOccurred())
+
+						logPath := filepath.Join(GinkgoT().TempDir(), "byoh-agent.log")
+						Expect(os.WriteFile(logPath, []byte("starting kubelet\n[ERROR FileAvailable--etc-kubernetes-kubelet.conf]: /etc/kubernetes/kubelet.conf already exists\n"), 0o600)).To(Succeed())
+						hostReconciler.BootstrapLogPath = logPath
+						fakeCommandRunner.RunCmdReturns(errors.New("I failed"))
+
+						_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{
+							NamespacedName: byoHostLookupKey,
+						})
+						Expect(reconcilerErr).To(HaveOccurred())
+
+						updatedByoHost := &infrastructurev1beta1.ByoHost{}
+						Expect(k8sClient.Get(ctx, byoHostLookupKey, updatedByoHost)).To(Succeed())
+						k8sNodeBootstrapSucceeded := conditions.Get(updatedByoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)
+						Expect(k8sNodeBootstrapSucceeded.Reason).To(Equal(infrastructurev1beta1.CloudInitExecutionFailedReason))
+						Expect(k8sNodeBootstrapSucceeded.Message).To(Equal("starting kubelet\n[ERROR FileAvailable--etc-kubernetes-kubelet.conf]: /etc/kubernetes/kubelet.conf already exists"))
+
+						events := eventutils.CollectEvents(recorder.Events)
+						Expect(events).Should(ContainElement(ContainSubstring("Warning BootstrapK8sNodeFailed k8s Node Bootstrap failed, last lines of the log:\nstarting kubelet")))
+					})
+
+					It("should export the install env before running the install script", func() {
+						byoHost.Spec.InstallEnv = map[string]string{"HTTP_PROXY": "http://proxy:3128"}
+						Expect(patchHelper.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).NotTo(HaveOccurred())
+
+						_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{
+							NamespacedName: byoHostLookupKey,
+						})
+						Expect(reconcilerErr).ToNot(HaveOccurred())
+
+						_, installCmd := fakeCommandRunner.RunCmdArgsForCall(0)
+						Expect(installCmd).To(Equal("export HTTP_PROXY='http://proxy:3128'\n" + `echo "install"`))
+					})
+
+					It("should quarantine the host after repeated bootstrap failures", func() {
+						conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sComponentsInstallationSucceeded)
+						Expect(patchHelper.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).NotTo(HaveOccurred())
+
+						fakeCommandRunner.RunCmdReturns(errors.New("I failed"))
+
+						updatedByoHost := &infrastructurev1beta1.ByoHost{}
+						for i := 1; i <= reconciler.MaxBootstrapFailures; i++ {
+							_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{
+								NamespacedName: byoHostLookupKey,
+							})
+							Expect(reconcilerErr).To(HaveOccurred())
+
+							Expect(k8sClient.Get(ctx, byoHostLookupKey, updatedByoHost)).To(Succeed())
+							Expect(updatedByoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.BootstrapFailuresAnnotation, fmt.Sprint(i)))
+							if i < reconciler.MaxBootstrapFailures {
+								Expect(updatedByoHost.IsQuarantined()).To(BeFalse())
+							}
+						}
+						Expect(updatedByoHost.Labels).To(HaveKeyWithValue(infrastructurev1beta1.QuarantinedLabel, "true"))
+						Expect(updatedByoHost.IsAvailable()).To(BeFalse())
+
+						events := eventutils.CollectEvents(recorder.Events)
+						Expect(events).Should(ContainElement(fmt.Sprintf("Warning HostQuarantined host quarantined after %d consecutive bootstrap failures", reconciler.MaxBootstrapFailures)))
+					})
+
+					It("should clear the bootstrap failure counter if the bootstrap execution succeeds", func() {
+						byoHost.Annotations[infrastructurev1beta1.BootstrapFailuresAnnotation] = "2"
+						Expect(patchHelper.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).NotTo(HaveOccurred())
+
+						_, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{
+							NamespacedName: byoHostLookupKey,
+						})
+						Expect(reconcilerErr).ToNot(HaveOccurred())
+
+						updatedByoHost := &infrastructurev1beta1.ByoHost{}
+						Expect(k8sClient.Get(ctx, byoHostLookupKey, updatedByoHost)).To(Succeed())
+						Expect(updatedByoHost.Annotations).NotTo(HaveKey(infrastructurev1beta1.BootstrapFailuresAnnotation))
+						Expect(updatedByoHost.IsQuarantined()).To(BeFalse())
+					})
+
 					It("should return error if install script execution failed", func() {
 						fakeCommandRunner.RunCmdReturns(errors.New("failed to execute install script"))
 						invalidInstallationSecret := builder.Secret(ns, "invalid-test-secret").
@@ -373,6 +523,37 @@ runCmd:
 						}))
 					})
 
+					It("should return error if install script has an unresolved template token", func() {
+						invalidInstallationSecret := builder.Secret(ns, "unresolved-token-secret").
+							WithKeyData("install", "curl {{.Unknown}}").
+							WithKeyData("uninstall", uninstallScript).
+							Build()
+						Expect(k8sClient.Create(ctx, invalidInstallationSecret)).NotTo(HaveOccurred())
+						byoHost.Spec.InstallationSecret = &corev1.ObjectReference{
+							Kind:      "Secret",
+							Namespace: invalidInstallationSecret.Namespace,
+							Name:      invalidInstallationSecret.Name,
+						}
+						Expect(patchHelper.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).NotTo(HaveOccurred())
+
+						result, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{
+							NamespacedName: byoHostLookupKey,
+						})
+						Expect(result).To(Equal(controllerruntime.Result{}))
+						Expect(reconcilerErr).To(HaveOccurred())
+						Expect(fakeCommandRunner.RunCmdCallCount()).To(Equal(0))
+
+						updatedByoHost := &infrastructurev1beta1.ByoHost{}
+						Expect(k8sClient.Get(ctx, byoHostLookupKey, updatedByoHost)).To(Succeed())
+						Expect(updatedByoHost.Spec.UninstallationScript).To(BeNil())
+
+						// assert events
+						events := eventutils.CollectEvents(recorder.Events)
+						Expect(events).Should(ConsistOf(
+							HavePrefix("Warning InstallScriptInvalid install script unresolved-token-secret is invalid"),
+						))
+					})
+
 					It("should return error if installation secrent does not exists", func() {
 						fakeCommandRunner.RunCmdReturns(errors.New("failed to execute install script"))
 						byoHost.Spec.InstallationSecret = &corev1.ObjectReference{
@@ -410,6 +591,22 @@ runCmd:
 						Expect(*updatedByoHost.Spec.UninstallationScript).To(Equal(uninstallScript))
 					})
 
+					It("should record the hash of the install script when enabled", func() {
+						hostReconciler.RecordInstallScript = true
+						result, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{
+							NamespacedName: byoHostLookupKey,
+						})
+						Expect(result).To(Equal(controllerruntime.Result{}))
+						Expect(reconcilerErr).NotTo(HaveOccurred())
+
+						updatedByoHost := &infrastructurev1beta1.ByoHost{}
+						Expect(k8sClient.Get(ctx, byoHostLookupKey, updatedByoHost)).To(Succeed())
+						// sha256 of the install script echo "install"
+						Expect(updatedByoHost.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.InstallScriptHashAnnotation,
+							"92042c9dddb0e21ed31409eaa3981e0630d52b39f2ef3c2c280f570c617bd467"))
+						Expect(updatedByoHost.Annotations).NotTo(HaveKey(infrastructurev1beta1.InstallScriptAnnotation))
+					})
+
 					It("should set K8sComponentsInstallationSucceeded to true if Install succeeds", func() {
 						result, reconcilerErr := hostReconciler.Reconcile(ctx, controllerruntime.Request{
 							NamespacedName: byoHostLookupKey,
@@ -0,0 +1,97 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	klog "k8s.io/klog/v2"
+)
+
+// HostFactsConfigMapName returns the name of the ConfigMap of the facts of the host
+func HostFactsConfigMapName(hostName string) string {
+	return infrastructurev1beta1.HostFactsConfigMapName(hostName)
+}
+
+// HostFacts collects the facts of the host published for inventory tools: its operating system,
+// kernel, CPU, memory, GPU and network interfaces
+func (hr *HostRegistrar) HostFacts(capacity map[corev1.ResourceName]resource.Quantity) (map[string]string, error) {
+	hostInfo, err := hr.getHostInfo()
+	if err != nil {
+		return nil, err
+	}
+	return hostFactsData(hostInfo, capacity, hr.GetNetworkStatus())
+}
+
+// hostFactsData flattens the facts of the host into the data of its ConfigMap, the network
+// interfaces being JSON encoded
+func hostFactsData(hostInfo infrastructurev1beta1.HostInfo, capacity map[corev1.ResourceName]resource.Quantity, network []infrastructurev1beta1.NetworkStatus) (map[string]string, error) {
+	nics, err := json.Marshal(network)
+	if err != nil {
+		return nil, err
+	}
+	facts := map[string]string{
+		"os":               hostInfo.OSImage,
+		"architecture":     hostInfo.Architecture,
+		"kernel":           hostInfo.KernelVersion,
+		"containerRuntime": hostInfo.ContainerRuntimeVersion,
+		"nics":             string(nics),
+	}
+	if cpu, ok := capacity[corev1.ResourceCPU]; ok {
+		facts["cpu"] = fmt.Sprintf("%d", cpu.Value())
+	}
+	if mem, ok := capacity[corev1.ResourceMemory]; ok {
+		facts["memory"] = mem.String()
+	}
+	gpus := int64(0)
+	if gpu, ok := capacity["nvidia.com/gpu"]; ok {
+		gpus = gpu.Value()
+	}
+	facts["gpu"] = fmt.Sprintf("%d", gpus)
+	return facts, nil
+}
+
+// SyncFacts creates the ConfigMap of the facts of the host in the namespace, or updates it when the
+// facts changed. It returns true if the ConfigMap was created or updated.
+func (hr *HostRegistrar) SyncFacts(ctx context.Context, hostName, namespace string, facts map[string]string) (bool, error) {
+	configMap := &corev1.ConfigMap{}
+	err := hr.K8sClient.Get(ctx, types.NamespacedName{Name: HostFactsConfigMapName(hostName), Namespace: namespace}, configMap)
+	if apierrors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      HostFactsConfigMapName(hostName),
+				Namespace: namespace,
+				Labels:    map[string]string{infrastructurev1beta1.HostFactsLabel: "true"},
+			},
+			Data: facts,
+		}
+		klog.Infof("Publishing the host facts in ConfigMap %s/%s", namespace, configMap.Name)
+		if err := hr.K8sClient.Create(ctx, configMap); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if reflect.DeepEqual(configMap.Data, facts) {
+		return false, nil
+	}
+
+	klog.Infof("Host facts changed, updating ConfigMap %s/%s", namespace, configMap.Name)
+	configMap.Data = facts
+	if err := hr.K8sClient.Update(ctx, configMap); err != nil {
+		return false, err
+	}
+	return true, nil
+}
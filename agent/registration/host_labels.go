@@ -0,0 +1,95 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package registration
+
+import (
+	"fmt"
+	"strings"
+
+	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// HostLabelKeys are the keys of the labels the agent derives from the host and sets on its ByoHost,
+// so ByoMachines can select hosts by capacity or security modules
+type HostLabelKeys struct {
+	CPU        string
+	Memory     string
+	GPU        string
+	GPUPresent string
+	GPUModel   string
+	GPUCount   string
+	SELinux    string
+	AppArmor   string
+}
+
+// DefaultHostLabelKeys returns the keys of the host labels under the default prefixes, the
+// capacity labels under CapacityLabelPrefix, the GPU labels under the nvidia.com prefix of the
+// NVIDIA GPU feature discovery and the others under LabelPrefix
+func DefaultHostLabelKeys() HostLabelKeys {
+	return HostLabelKeys{
+		CPU:        infrastructurev1beta1.CapacityLabelPrefix + "/cpu",
+		Memory:     infrastructurev1beta1.CapacityLabelPrefix + "/memory",
+		GPU:        infrastructurev1beta1.CapacityLabelPrefix + "/gpu",
+		GPUPresent: "nvidia.com/gpu.present",
+		GPUModel:   "nvidia.com/gpu.model",
+		GPUCount:   "nvidia.com/gpu.count",
+		SELinux:    infrastructurev1beta1.SELinuxLabel,
+		AppArmor:   infrastructurev1beta1.AppArmorLabel,
+	}
+}
+
+// NewHostLabelKeys returns the keys of all the host labels under the given prefix, e.g. to avoid
+// collisions with the labels of other controllers. The default keys are returned when it is empty.
+func NewHostLabelKeys(prefix string) (HostLabelKeys, error) {
+	if prefix == "" {
+		return DefaultHostLabelKeys(), nil
+	}
+	if errs := validation.IsDNS1123Subdomain(prefix); len(errs) > 0 {
+		return HostLabelKeys{}, fmt.Errorf("invalid label prefix %q: %s", prefix, strings.Join(errs, ", "))
+	}
+	return HostLabelKeys{
+		CPU:        prefix + "/cpu",
+		Memory:     prefix + "/memory",
+		GPU:        prefix + "/gpu",
+		GPUPresent: prefix + "/gpu.present",
+		GPUModel:   prefix + "/gpu.model",
+		GPUCount:   prefix + "/gpu.count",
+		SELinux:    prefix + "/selinux",
+		AppArmor:   prefix + "/apparmor",
+	}, nil
+}
+
+// CapacityLabels returns the labels exposing the given capacity of the host
+func (k HostLabelKeys) CapacityLabels(capacity map[corev1.ResourceName]resource.Quantity) map[string]string {
+	labels := map[string]string{}
+	if cpu, ok := capacity[corev1.ResourceCPU]; ok {
+		labels[k.CPU] = fmt.Sprintf("%d", cpu.Value())
+	}
+	if mem, ok := capacity[corev1.ResourceMemory]; ok {
+		labels[k.Memory] = mem.String()
+	}
+	if gpu, ok := capacity["nvidia.com/gpu"]; ok {
+		labels[k.GPU] = fmt.Sprintf("%d", gpu.Value())
+	}
+	return labels
+}
+
+// GPULabels returns the labels exposing the GPUs detected on the host, none when there is no GPU
+func (k HostLabelKeys) GPULabels(present bool, model string, count int) map[string]string {
+	labels := map[string]string{}
+	if !present {
+		return labels
+	}
+	labels[k.GPUPresent] = "true"
+	if model != "" {
+		labels[k.GPUModel] = model
+	}
+	if count > 0 {
+		labels[k.GPUCount] = fmt.Sprintf("%d", count)
+	}
+	return labels
+}
@@ -8,11 +8,14 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"os/exec"
 	"regexp"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/jackpal/gateway"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/version"
 	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
@@ -20,6 +23,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	klog "k8s.io/klog/v2"
 	"sigs.k8s.io/cluster-api/util/patch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -39,6 +43,18 @@ type HostInfo struct {
 type HostRegistrar struct {
 	K8sClient   client.Client
 	ByoHostInfo HostInfo
+	// Recorder is optional, events about the ByoHost are only emitted when it is set
+	Recorder record.EventRecorder
+	// LabelKeys are the keys of the labels derived from the host, DefaultHostLabelKeys when unset
+	LabelKeys HostLabelKeys
+}
+
+// labelKeys returns the configured keys of the host labels or the default ones
+func (hr *HostRegistrar) labelKeys() HostLabelKeys {
+	if hr.LabelKeys == (HostLabelKeys{}) {
+		return DefaultHostLabelKeys()
+	}
+	return hr.LabelKeys
 }
 
 // Register is called on agent startup
@@ -100,7 +116,7 @@ func (hr *HostRegistrar) Register(hostName, namespace string, hostLabels map[str
 	return hr.UpdateHost(ctx, byoHost)
 }
 
-// UpdateHost updates the network interface and host platform details status for the host
+// UpdateHost updates the network interface and host platform details status and the agent version annotation for the host
 func (hr *HostRegistrar) UpdateHost(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
 	klog.Info("Add Network Info")
 	helper, err := patch.NewHelper(byoHost, hr.K8sClient)
@@ -114,37 +130,167 @@ func (hr *HostRegistrar) UpdateHost(ctx context.Context, byoHost *infrastructure
 	if byoHost.Status.HostDetails, err = hr.getHostInfo(); err != nil {
 		return err
 	}
+	setSecurityLabels(byoHost, hr.labelKeys())
+
+	if byoHost.Annotations == nil {
+		byoHost.Annotations = map[string]string{}
+	}
+	byoHost.Annotations[infrastructurev1beta1.AgentVersionAnnotation] = version.Version()
 
 	return helper.Patch(ctx, byoHost)
 }
 
-// checkAndCleanupAfterForce checks if the host was force cleaned and performs necessary cleanup
-// This allows the Agent to recover gracefully after force cleanup operations
-func (hr *HostRegistrar) checkAndCleanupAfterForce(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
-	const forceCleanupAuditAnnotation = "byoh.infrastructure.cluster.x-k8s.io/force-cleanup-audit"
+// SyncCapacity patches the registered capacity of the ByoHost when it differs from
+// the given detected capacity, e.g. after memory hot-plug or a GPU being added.
+// It returns true if the ByoHost was patched.
+func (hr *HostRegistrar) SyncCapacity(ctx context.Context, hostName, namespace string, capacity map[corev1.ResourceName]resource.Quantity) (bool, error) {
+	byoHost := &infrastructurev1beta1.ByoHost{}
+	if err := hr.K8sClient.Get(ctx, types.NamespacedName{Name: hostName, Namespace: namespace}, byoHost); err != nil {
+		return false, err
+	}
+	if capacityEqual(byoHost.Spec.Capacity, capacity) {
+		return false, nil
+	}
 
-	// Check if there was a previous force cleanup
-	if auditStr, exists := byoHost.Annotations[forceCleanupAuditAnnotation]; exists {
-		klog.Infof("Detected previous force cleanup: %s", auditStr)
+	helper, err := patch.NewHelper(byoHost, hr.K8sClient)
+	if err != nil {
+		return false, err
+	}
+	klog.Infof("Host capacity changed from %v to %v, updating ByoHost", byoHost.Spec.Capacity, capacity)
+	byoHost.Spec.Capacity = capacity
+	if err := helper.Patch(ctx, byoHost); err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-		// Clean up any residual Kubernetes resources that might have been left behind
-		if err := hr.performPostForceCleanup(ctx, byoHost); err != nil {
-			return fmt.Errorf("post force cleanup failed: %w", err)
-		}
+// Heartbeat bumps Status.LastHeartbeatTime of the ByoHost, so the controller sees the agent is running
+// even when nothing else of the host changes
+func (hr *HostRegistrar) Heartbeat(ctx context.Context, hostName, namespace string) error {
+	byoHost := &infrastructurev1beta1.ByoHost{}
+	if err := hr.K8sClient.Get(ctx, types.NamespacedName{Name: hostName, Namespace: namespace}, byoHost); err != nil {
+		return err
+	}
+	helper, err := patch.NewHelper(byoHost, hr.K8sClient)
+	if err != nil {
+		return err
+	}
+	now := metav1.Now()
+	byoHost.Status.LastHeartbeatTime = &now
+	return helper.Patch(ctx, byoHost)
+}
 
-		// Remove the audit annotation to indicate we've processed it
-		helper, err := patch.NewHelper(byoHost, hr.K8sClient)
-		if err != nil {
-			return fmt.Errorf("creating patch helper: %w", err)
-		}
-		delete(byoHost.Annotations, forceCleanupAuditAnnotation)
-		if err := helper.Patch(ctx, byoHost); err != nil {
-			return fmt.Errorf("removing audit annotation: %w", err)
+// SyncOSImage re-detects the operating system of the host and updates Status.HostDetails.OSImage
+// when it changed, e.g. after an in-place OS upgrade, so that later installs resolve the bundle
+// of the new OS. The kernel and container runtime versions are re-detected along, e.g. after a
+// kernel update. It returns true if the ByoHost was patched.
+func (hr *HostRegistrar) SyncOSImage(ctx context.Context, hostName, namespace string) (bool, error) {
+	return hr.syncOSImage(ctx, hostName, namespace, os.ReadFile, runCommand)
+}
+
+func (hr *HostRegistrar) syncOSImage(ctx context.Context, hostName, namespace string, readFile func(string) ([]byte, error),
+	run func(string, ...string) ([]byte, error)) (bool, error) {
+	osImage, err := getOperatingSystem(readFile)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get host operating system image")
+	}
+
+	byoHost := &infrastructurev1beta1.ByoHost{}
+	if err := hr.K8sClient.Get(ctx, types.NamespacedName{Name: hostName, Namespace: namespace}, byoHost); err != nil {
+		return false, err
+	}
+	helper, err := patch.NewHelper(byoHost, hr.K8sClient)
+	if err != nil {
+		return false, err
+	}
+	previous := byoHost.Status.HostDetails.OSImage
+	versionsChanged := refreshSoftwareVersions(&byoHost.Status.HostDetails, run)
+	if previous == osImage && !versionsChanged {
+		return false, nil
+	}
+
+	if previous != osImage {
+		klog.Infof("Host operating system changed from %q to %q, updating ByoHost", previous, osImage)
+		byoHost.Status.HostDetails.OSImage = osImage
+	}
+	if err := helper.Patch(ctx, byoHost); err != nil {
+		return false, err
+	}
+	if hr.Recorder != nil && previous != osImage {
+		hr.Recorder.Eventf(byoHost, corev1.EventTypeNormal, "OSImageChanged", "operating system changed from %q to %q", previous, osImage)
+	}
+	return true, nil
+}
+
+// RefreshSoftwareVersions re-detects the kernel and container runtime versions of the host into the host info,
+// e.g. once the container runtime is installed, which happens after the registration. It returns true if either
+// changed.
+func RefreshSoftwareVersions(hostInfo *infrastructurev1beta1.HostInfo) bool {
+	return refreshSoftwareVersions(hostInfo, runCommand)
+}
+
+func refreshSoftwareVersions(hostInfo *infrastructurev1beta1.HostInfo, run func(string, ...string) ([]byte, error)) bool {
+	kernelVersion := getKernelVersion(run)
+	runtimeVersion := getContainerRuntimeVersion(run)
+	// A failed detection keeps the version reported before
+	if kernelVersion == "" {
+		kernelVersion = hostInfo.KernelVersion
+	}
+	if runtimeVersion == "" {
+		runtimeVersion = hostInfo.ContainerRuntimeVersion
+	}
+	if kernelVersion == hostInfo.KernelVersion && runtimeVersion == hostInfo.ContainerRuntimeVersion {
+		return false
+	}
+	klog.Infof("Host software versions changed, kernel %q to %q, container runtime %q to %q",
+		hostInfo.KernelVersion, kernelVersion, hostInfo.ContainerRuntimeVersion, runtimeVersion)
+	hostInfo.KernelVersion = kernelVersion
+	hostInfo.ContainerRuntimeVersion = runtimeVersion
+	return true
+}
+
+// capacityEqual compares two resource maps by quantity value rather than by
+// their string representation, so "1Gi" and "1024Mi" are treated as equal.
+func capacityEqual(a, b map[corev1.ResourceName]resource.Quantity) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, qa := range a {
+		qb, ok := b[name]
+		if !ok || qa.Cmp(qb) != 0 {
+			return false
 		}
+	}
+	return true
+}
+
+// checkAndCleanupAfterForce checks if the host was force cleaned and performs necessary cleanup
+// This allows the Agent to recover gracefully after force cleanup operations
+func (hr *HostRegistrar) checkAndCleanupAfterForce(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
+	// Check if there was a previous force cleanup not yet handled by the agent
+	record := byoHost.Status.LastForceCleanup
+	if record == nil || record.AgentAcknowledged {
+		return nil
+	}
+	klog.Infof("Detected previous force cleanup at %s, reason=%s, timeout=%s, elapsed=%s",
+		record.Timestamp.Format(time.RFC3339), record.Reason, record.Timeout.Duration, record.Elapsed.Duration)
 
-		klog.Info("Successfully completed post-force cleanup")
+	// Clean up any residual Kubernetes resources that might have been left behind
+	if err := hr.performPostForceCleanup(ctx, byoHost); err != nil {
+		return fmt.Errorf("post force cleanup failed: %w", err)
 	}
 
+	// Acknowledge the record to indicate we've processed it, the record itself is kept for observability
+	helper, err := patch.NewHelper(byoHost, hr.K8sClient)
+	if err != nil {
+		return fmt.Errorf("creating patch helper: %w", err)
+	}
+	byoHost.Status.LastForceCleanup.AgentAcknowledged = true
+	if err := helper.Patch(ctx, byoHost); err != nil {
+		return fmt.Errorf("acknowledging force cleanup: %w", err)
+	}
+
+	klog.Info("Successfully completed post-force cleanup")
 	return nil
 }
 
@@ -220,6 +366,8 @@ func (hr *HostRegistrar) GetNetworkStatus() []infrastructurev1beta1.NetworkStatu
 func (hr *HostRegistrar) getHostInfo() (infrastructurev1beta1.HostInfo, error) {
 	hostInfo := infrastructurev1beta1.HostInfo{}
 
+	// The hostname is informational, the ByoHost keeps the name it was registered with
+	hostInfo.Hostname, _ = os.Hostname()
 	hostInfo.Architecture = runtime.GOARCH
 	hostInfo.OSName = runtime.GOOS
 
@@ -228,13 +376,124 @@ func (hr *HostRegistrar) getHostInfo() (infrastructurev1beta1.HostInfo, error) {
 	} else {
 		hostInfo.OSImage = distribution
 	}
+
+	// Kernel and runtime are informational; the runtime may not be installed yet at registration
+	hostInfo.KernelVersion = getKernelVersion(runCommand)
+	hostInfo.ContainerRuntimeVersion = getContainerRuntimeVersion(runCommand)
+	hostInfo.SELinux = getSELinuxMode(os.ReadFile)
+	hostInfo.AppArmor = getAppArmorMode(os.ReadFile)
 	return hostInfo, nil
 }
 
+const (
+	// selinuxEnforceFile holds 1 when SELinux is enforcing and 0 when it is permissive,
+	// it only exists when SELinux is enabled
+	selinuxEnforceFile = "/sys/fs/selinux/enforce"
+	// apparmorEnabledFile holds Y when AppArmor is enabled
+	apparmorEnabledFile = "/sys/module/apparmor/parameters/enabled"
+	// apparmorProfilesFile lists the loaded AppArmor profiles as "<name> (<mode>)"
+	apparmorProfilesFile = "/sys/kernel/security/apparmor/profiles"
+)
+
+// getSELinuxMode returns the SELinux mode of the host read from selinuxfs
+func getSELinuxMode(readFile func(string) ([]byte, error)) infrastructurev1beta1.SecurityModuleMode {
+	content, err := readFile(selinuxEnforceFile)
+	if err != nil {
+		return infrastructurev1beta1.SecurityModuleDisabled
+	}
+	if strings.TrimSpace(string(content)) == "1" {
+		return infrastructurev1beta1.SecurityModuleEnforcing
+	}
+	return infrastructurev1beta1.SecurityModulePermissive
+}
+
+// getAppArmorMode returns the AppArmor mode of the host, Enforcing as soon as a
+// loaded profile is in enforce mode
+func getAppArmorMode(readFile func(string) ([]byte, error)) infrastructurev1beta1.SecurityModuleMode {
+	enabled, err := readFile(apparmorEnabledFile)
+	if err != nil || !strings.HasPrefix(strings.TrimSpace(string(enabled)), "Y") {
+		return infrastructurev1beta1.SecurityModuleDisabled
+	}
+	profiles, err := readFile(apparmorProfilesFile)
+	if err != nil {
+		klog.Warningf("failed to read the AppArmor profiles: %v", err)
+		return infrastructurev1beta1.SecurityModulePermissive
+	}
+	for _, profile := range strings.Split(string(profiles), "\n") {
+		if strings.HasSuffix(strings.TrimSpace(profile), "(enforce)") {
+			return infrastructurev1beta1.SecurityModuleEnforcing
+		}
+	}
+	return infrastructurev1beta1.SecurityModulePermissive
+}
+
+// setSecurityLabels exposes the reported SELinux and AppArmor modes as ByoHost labels
+func setSecurityLabels(byoHost *infrastructurev1beta1.ByoHost, keys HostLabelKeys) {
+	if byoHost.Labels == nil {
+		byoHost.Labels = map[string]string{}
+	}
+	for label, mode := range map[string]infrastructurev1beta1.SecurityModuleMode{
+		keys.SELinux:  byoHost.Status.HostDetails.SELinux,
+		keys.AppArmor: byoHost.Status.HostDetails.AppArmor,
+	} {
+		if mode == "" {
+			delete(byoHost.Labels, label)
+			continue
+		}
+		byoHost.Labels[label] = strings.ToLower(string(mode))
+	}
+}
+
+// runCommand executes the given command and returns its standard output.
+func runCommand(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).Output()
+}
+
+// getKernelVersion returns the kernel release of the host as reported by `uname -r`.
+func getKernelVersion(run func(string, ...string) ([]byte, error)) string {
+	out, err := run("uname", "-r")
+	if err != nil {
+		klog.Warningf("failed to get kernel version: %v", err)
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// containerRuntimes lists the runtimes probed for their version, in order of preference.
+var containerRuntimes = []struct {
+	name    string
+	command string
+	// versionField is the index of the version in the first line of `<command> --version`
+	versionField int
+}{
+	// containerd github.com/containerd/containerd v1.7.2 0cae528dd6cb557f7201036e9f43420650207b58
+	{name: "containerd", command: "containerd", versionField: 2},
+	// crio version 1.28.1
+	{name: "cri-o", command: "crio", versionField: 2},
+}
+
+// getContainerRuntimeVersion returns the installed container runtime in the
+// <runtime>://<version> form, or an empty string if no known runtime is found.
+func getContainerRuntimeVersion(run func(string, ...string) ([]byte, error)) string {
+	for _, rt := range containerRuntimes {
+		out, err := run(rt.command, "--version")
+		if err != nil {
+			continue
+		}
+		firstLine := strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)[0]
+		fields := strings.Fields(firstLine)
+		if len(fields) <= rt.versionField {
+			continue
+		}
+		return fmt.Sprintf("%s://%s", rt.name, strings.TrimPrefix(fields[rt.versionField], "v"))
+	}
+	return ""
+}
+
 // getOperatingSystem gets the name of the current operating system image.
+// PRETTY_NAME is preferred; minimal images that only ship ID and VERSION_ID
+// get a name composed from those so that bundle resolution can still match.
 func getOperatingSystem(f func(string) ([]byte, error)) (string, error) {
-	rex := regexp.MustCompile("(PRETTY_NAME)=(.*)")
-
 	bytes, err := f("/etc/os-release")
 	if err != nil && os.IsNotExist(err) {
 		// /usr/lib/os-release in stateless systems like Clear Linux
@@ -243,10 +502,41 @@ func getOperatingSystem(f func(string) ([]byte, error)) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("error opening file : %v", err)
 	}
-	line := rex.FindAllStringSubmatch(string(bytes), -1)
-	if len(line) > 0 {
-		osName := strings.Trim(line[0][2], "\"")
+	fields := parseOSRelease(string(bytes))
+	if osName, ok := fields["PRETTY_NAME"]; ok && osName != "" {
 		return strings.ReplaceAll(osName, " LTS", ""), nil
 	}
+	if id, version := fields["ID"], fields["VERSION_ID"]; id != "" && version != "" {
+		// ID is lowercase by spec (e.g. "ubuntu"), registry filters use the PRETTY_NAME form
+		if name, ok := osReleaseNames[id]; ok {
+			return name + " " + version, nil
+		}
+		return strings.ToUpper(id[:1]) + id[1:] + " " + version, nil
+	}
 	return "Unknown", nil
 }
+
+// osReleaseNames are the names the PRETTY_NAME of the known operating systems starts with, by os-release ID
+var osReleaseNames = map[string]string{
+	"ubuntu": "Ubuntu",
+	"rhel":   "Red Hat Enterprise Linux",
+	"rocky":  "Rocky Linux",
+	"centos": "CentOS Stream",
+}
+
+// parseOSRelease parses the KEY=value lines of an os-release file,
+// stripping optional quotes around the values.
+func parseOSRelease(content string) map[string]string {
+	rex := regexp.MustCompile(`^([A-Z0-9_]+)=(.*)$`)
+	fields := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		match := rex.FindStringSubmatch(strings.TrimSpace(line))
+		if len(match) != 3 {
+			continue
+		}
+		if _, exists := fields[match[1]]; !exists {
+			fields[match[1]] = strings.Trim(match[2], "\"'")
+		}
+	}
+	return fields
+}
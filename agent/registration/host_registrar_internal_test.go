@@ -4,11 +4,23 @@
 package registration
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
+	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/installer"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func getMockFile(targetOs string) ([]byte, error) {
@@ -69,5 +81,443 @@ var _ = Describe("Host Registrar Tests", func() {
 			Expect(err).ShouldNot(HaveOccurred())
 			Expect(detectedOS).To(Equal("Unknown"))
 		})
+
+		It("Should compose the operating system from ID and VERSION_ID", func() {
+			detectedOS, err := getOperatingSystem(func(string) ([]byte, error) {
+				return []byte("ID=ubuntu\nVERSION_ID=\"22.04\"\n"), nil
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(detectedOS).To(Equal("Ubuntu 22.04"))
+		})
+
+		It("Should compose the operating system from quoted ID and VERSION_ID", func() {
+			detectedOS, err := getOperatingSystem(func(string) ([]byte, error) {
+				return []byte("NAME=\"Rocky Linux\"\nID=\"rocky\"\nVERSION_ID='9.3'\n"), nil
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(detectedOS).To(Equal("Rocky Linux 9.3"))
+		})
+
+		It("Should compose an operating system the installer resolves a bundle for", func() {
+			for osRelease, expected := range map[string]string{
+				"ID=ubuntu\nVERSION_ID=\"22.04\"\n":  "Ubuntu 22.04",
+				"ID=\"rhel\"\nVERSION_ID=\"9.2\"\n":  "Red Hat Enterprise Linux 9.2",
+				"ID=\"rocky\"\nVERSION_ID=\"9.2\"\n": "Rocky Linux 9.2",
+				"ID=\"centos\"\nVERSION_ID=\"9\"\n":  "CentOS Stream 9",
+			} {
+				content := osRelease
+				detectedOS, err := getOperatingSystem(func(string) ([]byte, error) { return []byte(content), nil })
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(detectedOS).To(Equal(expected))
+
+				_, _, err = installer.ResolveBundle(detectedOS, "amd64", "v1.30.1")
+				Expect(err).ShouldNot(HaveOccurred(), detectedOS)
+			}
+		})
+
+		It("Should return Unknown when VERSION_ID is missing", func() {
+			detectedOS, err := getOperatingSystem(func(string) ([]byte, error) {
+				return []byte("ID=alpine\n"), nil
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(detectedOS).To(Equal("Unknown"))
+		})
+	})
+
+	Context("When the kernel version is detected", func() {
+		It("Should return the trimmed output of uname -r", func() {
+			kernel := getKernelVersion(func(name string, args ...string) ([]byte, error) {
+				Expect(name).To(Equal("uname"))
+				Expect(args).To(Equal([]string{"-r"}))
+				return []byte("5.15.0-91-generic\n"), nil
+			})
+			Expect(kernel).To(Equal("5.15.0-91-generic"))
+		})
+
+		It("Should return empty when uname fails", func() {
+			kernel := getKernelVersion(func(string, ...string) ([]byte, error) {
+				return nil, errors.New("uname not found")
+			})
+			Expect(kernel).To(BeEmpty())
+		})
+	})
+
+	Context("When the container runtime version is detected", func() {
+		It("Should return the containerd version", func() {
+			runtime := getContainerRuntimeVersion(func(name string, args ...string) ([]byte, error) {
+				if name == "containerd" {
+					return []byte("containerd github.com/containerd/containerd v1.7.2 0cae528dd6cb557f7201036e9f43420650207b58\n"), nil
+				}
+				return nil, errors.New("not found")
+			})
+			Expect(runtime).To(Equal("containerd://1.7.2"))
+		})
+
+		It("Should fall back to cri-o when containerd is not installed", func() {
+			runtime := getContainerRuntimeVersion(func(name string, args ...string) ([]byte, error) {
+				if name == "crio" {
+					return []byte("crio version 1.28.1\nGitCommit: abc\n"), nil
+				}
+				return nil, errors.New("not found")
+			})
+			Expect(runtime).To(Equal("cri-o://1.28.1"))
+		})
+
+		It("Should return empty when no runtime is installed", func() {
+			runtime := getContainerRuntimeVersion(func(string, ...string) ([]byte, error) {
+				return nil, errors.New("not found")
+			})
+			Expect(runtime).To(BeEmpty())
+		})
+	})
+
+	Context("When the security posture is detected", func() {
+		// sysfs simulates the given files, the others do not exist
+		sysfs := func(files map[string]string) func(string) ([]byte, error) {
+			return func(name string) ([]byte, error) {
+				if content, ok := files[name]; ok {
+					return []byte(content), nil
+				}
+				return nil, os.ErrNotExist
+			}
+		}
+
+		DescribeTable("Should map the SELinux enforce file to the SELinux mode",
+			func(files map[string]string, mode infrastructurev1beta1.SecurityModuleMode) {
+				Expect(getSELinuxMode(sysfs(files))).To(Equal(mode))
+			},
+			Entry("enforcing", map[string]string{selinuxEnforceFile: "1\n"}, infrastructurev1beta1.SecurityModuleEnforcing),
+			Entry("permissive", map[string]string{selinuxEnforceFile: "0\n"}, infrastructurev1beta1.SecurityModulePermissive),
+			Entry("disabled", map[string]string{}, infrastructurev1beta1.SecurityModuleDisabled),
+		)
+
+		DescribeTable("Should map the AppArmor status to the AppArmor mode",
+			func(files map[string]string, mode infrastructurev1beta1.SecurityModuleMode) {
+				Expect(getAppArmorMode(sysfs(files))).To(Equal(mode))
+			},
+			Entry("with a profile in enforce mode", map[string]string{
+				apparmorEnabledFile:  "Y\n",
+				apparmorProfilesFile: "/usr/sbin/cups-browsed (complain)\n/usr/bin/man (enforce)\n",
+			}, infrastructurev1beta1.SecurityModuleEnforcing),
+			Entry("with profiles in complain mode only", map[string]string{
+				apparmorEnabledFile:  "Y\n",
+				apparmorProfilesFile: "/usr/sbin/cups-browsed (complain)\n",
+			}, infrastructurev1beta1.SecurityModulePermissive),
+			Entry("without loaded profiles", map[string]string{
+				apparmorEnabledFile:  "Y\n",
+				apparmorProfilesFile: "",
+			}, infrastructurev1beta1.SecurityModulePermissive),
+			Entry("when the profiles cannot be read", map[string]string{
+				apparmorEnabledFile: "Y\n",
+			}, infrastructurev1beta1.SecurityModulePermissive),
+			Entry("disabled on the kernel command line", map[string]string{
+				apparmorEnabledFile:  "N\n",
+				apparmorProfilesFile: "/usr/bin/man (enforce)\n",
+			}, infrastructurev1beta1.SecurityModuleDisabled),
+			Entry("not built into the kernel", map[string]string{}, infrastructurev1beta1.SecurityModuleDisabled),
+		)
+
+		It("Should expose the modes as lower-cased labels", func() {
+			byoHost := &infrastructurev1beta1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{infrastructurev1beta1.AppArmorLabel: "enforcing", "site": "apac"}},
+				Status: infrastructurev1beta1.ByoHostStatus{HostDetails: infrastructurev1beta1.HostInfo{
+					SELinux: infrastructurev1beta1.SecurityModuleEnforcing,
+				}},
+			}
+			setSecurityLabels(byoHost, DefaultHostLabelKeys())
+			Expect(byoHost.Labels).To(Equal(map[string]string{
+				infrastructurev1beta1.SELinuxLabel: "enforcing",
+				"site":                             "apac",
+			}))
+		})
+	})
+
+	Context("When the host was force cleaned by the controller", func() {
+		var (
+			ctx     context.Context
+			hr      *HostRegistrar
+			byoHost *infrastructurev1beta1.ByoHost
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			scheme := runtime.NewScheme()
+			Expect(infrastructurev1beta1.AddToScheme(scheme)).To(Succeed())
+			byoHost = &infrastructurev1beta1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "host", Namespace: "default"},
+				Status: infrastructurev1beta1.ByoHostStatus{
+					LastForceCleanup: &infrastructurev1beta1.ForceCleanupRecord{
+						Timestamp: metav1.NewTime(time.Now().Add(-time.Minute).Truncate(time.Second)),
+						Reason:    infrastructurev1beta1.ForceCleanupAgentUnavailableReason,
+						Timeout:   metav1.Duration{Duration: 5 * time.Minute},
+						Elapsed:   metav1.Duration{Duration: 6 * time.Minute},
+					},
+				},
+			}
+			hr = &HostRegistrar{K8sClient: fake.NewClientBuilder().WithScheme(scheme).WithObjects(byoHost).Build()}
+			Expect(hr.K8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), byoHost)).To(Succeed())
+		})
+
+		It("Should acknowledge the force cleanup and retain the record", func() {
+			Expect(hr.checkAndCleanupAfterForce(ctx, byoHost)).To(Succeed())
+
+			updated := &infrastructurev1beta1.ByoHost{}
+			Expect(hr.K8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), updated)).To(Succeed())
+			Expect(updated.Status.LastForceCleanup).NotTo(BeNil())
+			Expect(updated.Status.LastForceCleanup.AgentAcknowledged).To(BeTrue())
+			Expect(updated.Status.LastForceCleanup.Reason).To(Equal(infrastructurev1beta1.ForceCleanupAgentUnavailableReason))
+			Expect(updated.Status.LastForceCleanup.Elapsed.Duration).To(Equal(6 * time.Minute))
+		})
+
+		It("Should not process an acknowledged force cleanup again", func() {
+			byoHost.Status.LastForceCleanup.AgentAcknowledged = true
+			resourceVersion := byoHost.ResourceVersion
+			Expect(hr.checkAndCleanupAfterForce(ctx, byoHost)).To(Succeed())
+
+			updated := &infrastructurev1beta1.ByoHost{}
+			Expect(hr.K8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), updated)).To(Succeed())
+			Expect(updated.ResourceVersion).To(Equal(resourceVersion))
+		})
+	})
+	Context("When the host operating system is upgraded in place", func() {
+		var (
+			ctx      context.Context
+			hr       *HostRegistrar
+			recorder *record.FakeRecorder
+			osImage  string
+		)
+
+		readOSRelease := func(string) ([]byte, error) {
+			return []byte(fmt.Sprintf("PRETTY_NAME=%q\n", osImage)), nil
+		}
+		// noCommand fails every command, the versions are not detected
+		noCommand := func(string, ...string) ([]byte, error) {
+			return nil, errors.New("command not found")
+		}
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			scheme := runtime.NewScheme()
+			Expect(infrastructurev1beta1.AddToScheme(scheme)).To(Succeed())
+			byoHost := &infrastructurev1beta1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "host", Namespace: "default"},
+				Status: infrastructurev1beta1.ByoHostStatus{
+					HostDetails: infrastructurev1beta1.HostInfo{OSName: "linux", OSImage: "Ubuntu 22.04.4"},
+				},
+			}
+			recorder = record.NewFakeRecorder(1)
+			hr = &HostRegistrar{
+				K8sClient: fake.NewClientBuilder().WithScheme(scheme).WithObjects(byoHost).Build(),
+				Recorder:  recorder,
+			}
+		})
+
+		getHostDetails := func() infrastructurev1beta1.HostInfo {
+			byoHost := &infrastructurev1beta1.ByoHost{}
+			Expect(hr.K8sClient.Get(ctx, client.ObjectKey{Name: "host", Namespace: "default"}, byoHost)).To(Succeed())
+			return byoHost.Status.HostDetails
+		}
+
+		It("Should update the OSImage and emit an event", func() {
+			osImage = "Ubuntu 24.04.1 LTS"
+			updated, err := hr.syncOSImage(ctx, "host", "default", readOSRelease, noCommand)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated).To(BeTrue())
+			Expect(getHostDetails()).To(Equal(infrastructurev1beta1.HostInfo{OSName: "linux", OSImage: "Ubuntu 24.04.1"}))
+			Expect(recorder.Events).To(Receive(Equal(`Normal OSImageChanged operating system changed from "Ubuntu 22.04.4" to "Ubuntu 24.04.1"`)))
+		})
+
+		It("Should not patch the host when the OS did not change", func() {
+			osImage = "Ubuntu 22.04.4 LTS"
+			updated, err := hr.syncOSImage(ctx, "host", "default", readOSRelease, noCommand)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated).To(BeFalse())
+			Expect(getHostDetails().OSImage).To(Equal("Ubuntu 22.04.4"))
+			Expect(recorder.Events).NotTo(Receive())
+		})
+
+		It("Should update the kernel and container runtime versions when the OS did not change", func() {
+			osImage = "Ubuntu 22.04.4 LTS"
+			updated, err := hr.syncOSImage(ctx, "host", "default", readOSRelease, func(name string, _ ...string) ([]byte, error) {
+				switch name {
+				case "uname":
+					return []byte("6.8.0-45-generic\n"), nil
+				case "containerd":
+					return []byte("containerd github.com/containerd/containerd v1.7.2 0cae528\n"), nil
+				}
+				return nil, errors.New("command not found")
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated).To(BeTrue())
+			Expect(getHostDetails().KernelVersion).To(Equal("6.8.0-45-generic"))
+			Expect(getHostDetails().ContainerRuntimeVersion).To(Equal("containerd://1.7.2"))
+			Expect(recorder.Events).NotTo(Receive())
+		})
+
+		It("Should keep the reported versions when they cannot be detected", func() {
+			hostInfo := infrastructurev1beta1.HostInfo{KernelVersion: "6.8.0-45-generic", ContainerRuntimeVersion: "containerd://1.7.2"}
+			Expect(refreshSoftwareVersions(&hostInfo, noCommand)).To(BeFalse())
+			Expect(hostInfo.KernelVersion).To(Equal("6.8.0-45-generic"))
+			Expect(hostInfo.ContainerRuntimeVersion).To(Equal("containerd://1.7.2"))
+		})
+
+		It("Should return an error when the os-release file cannot be read", func() {
+			_, err := hr.syncOSImage(ctx, "host", "default", func(string) ([]byte, error) {
+				return nil, errors.New("permission denied")
+			}, noCommand)
+			Expect(err).To(HaveOccurred())
+			Expect(getHostDetails().OSImage).To(Equal("Ubuntu 22.04.4"))
+		})
+	})
+
+	Context("When the host facts are published", func() {
+		var (
+			ctx      context.Context
+			hr       *HostRegistrar
+			hostInfo infrastructurev1beta1.HostInfo
+			capacity map[corev1.ResourceName]resource.Quantity
+			network  []infrastructurev1beta1.NetworkStatus
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			scheme := runtime.NewScheme()
+			Expect(corev1.AddToScheme(scheme)).To(Succeed())
+			hr = &HostRegistrar{K8sClient: fake.NewClientBuilder().WithScheme(scheme).Build()}
+			hostInfo = infrastructurev1beta1.HostInfo{
+				OSName:                  "linux",
+				OSImage:                 "Ubuntu 22.04.4 LTS",
+				Architecture:            "amd64",
+				KernelVersion:           "5.15.0-105-generic",
+				ContainerRuntimeVersion: "containerd://1.7.2",
+			}
+			capacity = map[corev1.ResourceName]resource.Quantity{
+				corev1.ResourceCPU:    resource.MustParse("8"),
+				corev1.ResourceMemory: resource.MustParse("32Gi"),
+			}
+			network = []infrastructurev1beta1.NetworkStatus{
+				{Connected: true, IsDefault: true, NetworkInterfaceName: "eth0", MACAddr: "00:11:22:33:44:55", IPAddrs: []string{"10.0.0.5/24"}},
+			}
+		})
+
+		getFacts := func() *corev1.ConfigMap {
+			configMap := &corev1.ConfigMap{}
+			Expect(hr.K8sClient.Get(ctx, client.ObjectKey{Name: "host-facts", Namespace: "inventory"}, configMap)).To(Succeed())
+			return configMap
+		}
+
+		It("Should flatten the facts of the host", func() {
+			facts, err := hostFactsData(hostInfo, capacity, network)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(Equal(map[string]string{
+				"os":               "Ubuntu 22.04.4 LTS",
+				"architecture":     "amd64",
+				"kernel":           "5.15.0-105-generic",
+				"containerRuntime": "containerd://1.7.2",
+				"cpu":              "8",
+				"memory":           "32Gi",
+				"gpu":              "0",
+				"nics":             `[{"connected":true,"ipAddrs":["10.0.0.5/24"],"macAddr":"00:11:22:33:44:55","networkInterfaceName":"eth0","isDefault":true}]`,
+			}))
+		})
+
+		It("Should create the ConfigMap of the facts", func() {
+			facts, err := hostFactsData(hostInfo, capacity, network)
+			Expect(err).NotTo(HaveOccurred())
+
+			updated, err := hr.SyncFacts(ctx, "host", "inventory", facts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated).To(BeTrue())
+
+			configMap := getFacts()
+			Expect(configMap.Labels).To(HaveKeyWithValue(infrastructurev1beta1.HostFactsLabel, "true"))
+			Expect(configMap.Data).To(Equal(facts))
+		})
+
+		It("Should update the ConfigMap only when the facts changed", func() {
+			facts, err := hostFactsData(hostInfo, capacity, network)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = hr.SyncFacts(ctx, "host", "inventory", facts)
+			Expect(err).NotTo(HaveOccurred())
+
+			updated, err := hr.SyncFacts(ctx, "host", "inventory", facts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated).To(BeFalse())
+
+			// A GPU was added and the kernel upgraded
+			capacity["nvidia.com/gpu"] = resource.MustParse("2")
+			hostInfo.KernelVersion = "6.8.0-40-generic"
+			facts, err = hostFactsData(hostInfo, capacity, network)
+			Expect(err).NotTo(HaveOccurred())
+
+			updated, err = hr.SyncFacts(ctx, "host", "inventory", facts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated).To(BeTrue())
+			Expect(getFacts().Data).To(HaveKeyWithValue("gpu", "2"))
+			Expect(getFacts().Data).To(HaveKeyWithValue("kernel", "6.8.0-40-generic"))
+		})
+	})
+
+	Context("When a label prefix is configured", func() {
+		capacity := map[corev1.ResourceName]resource.Quantity{
+			corev1.ResourceCPU:    resource.MustParse("8"),
+			corev1.ResourceMemory: resource.MustParse("32Gi"),
+			"nvidia.com/gpu":      resource.MustParse("2"),
+		}
+
+		It("Should use the default prefixes when it is empty", func() {
+			keys, err := NewHostLabelKeys("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(Equal(DefaultHostLabelKeys()))
+			Expect(keys.CapacityLabels(capacity)).To(Equal(map[string]string{
+				"capacity.infrastructure.cluster.x-k8s.io/cpu":    "8",
+				"capacity.infrastructure.cluster.x-k8s.io/memory": "32Gi",
+				"capacity.infrastructure.cluster.x-k8s.io/gpu":    "2",
+			}))
+			Expect(keys.GPULabels(true, "Tesla-T4", 2)).To(Equal(map[string]string{
+				"nvidia.com/gpu.present": "true",
+				"nvidia.com/gpu.model":   "Tesla-T4",
+				"nvidia.com/gpu.count":   "2",
+			}))
+			Expect(keys.GPULabels(false, "", 0)).To(BeEmpty())
+			Expect(keys.SELinux).To(Equal(infrastructurev1beta1.SELinuxLabel))
+			Expect(keys.AppArmor).To(Equal(infrastructurev1beta1.AppArmorLabel))
+		})
+
+		It("Should use the prefix for all the host labels", func() {
+			keys, err := NewHostLabelKeys("byoh.example.com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys.CapacityLabels(capacity)).To(Equal(map[string]string{
+				"byoh.example.com/cpu":    "8",
+				"byoh.example.com/memory": "32Gi",
+				"byoh.example.com/gpu":    "2",
+			}))
+			Expect(keys.GPULabels(true, "Tesla-T4", 2)).To(Equal(map[string]string{
+				"byoh.example.com/gpu.present": "true",
+				"byoh.example.com/gpu.model":   "Tesla-T4",
+				"byoh.example.com/gpu.count":   "2",
+			}))
+
+			byoHost := &infrastructurev1beta1.ByoHost{
+				Status: infrastructurev1beta1.ByoHostStatus{HostDetails: infrastructurev1beta1.HostInfo{
+					SELinux:  infrastructurev1beta1.SecurityModulePermissive,
+					AppArmor: infrastructurev1beta1.SecurityModuleEnforcing,
+				}},
+			}
+			setSecurityLabels(byoHost, keys)
+			Expect(byoHost.Labels).To(Equal(map[string]string{
+				"byoh.example.com/selinux":  "permissive",
+				"byoh.example.com/apparmor": "enforcing",
+			}))
+		})
+
+		It("Should reject a prefix that is not a DNS subdomain", func() {
+			_, err := NewHostLabelKeys("Example_Prefix/")
+			Expect(err).To(MatchError(ContainSubstring("invalid label prefix")))
+		})
+
+		It("Should default the keys of the registrar", func() {
+			Expect((&HostRegistrar{}).labelKeys()).To(Equal(DefaultHostLabelKeys()))
+		})
 	})
 })
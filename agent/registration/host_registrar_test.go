@@ -5,12 +5,18 @@ package registration_test
 
 import (
 	"context"
+	"os"
+	"time"
 
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/registration"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/agent/version"
 	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/test/builder"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var _ = Describe("Host Registrar Tests", func() {
@@ -35,5 +41,87 @@ var _ = Describe("Host Registrar Tests", func() {
 		It("Should update the host details on the byohost successfully", func() {
 			Expect(hr.UpdateHost(ctx, byoHost)).ToNot(HaveOccurred())
 		})
+
+		It("Should record the hostname of the host", func() {
+			Expect(hr.UpdateHost(ctx, byoHost)).ToNot(HaveOccurred())
+
+			hostname, err := os.Hostname()
+			Expect(err).NotTo(HaveOccurred())
+			updated := &infrastructurev1beta1.ByoHost{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), updated)).To(Succeed())
+			Expect(updated.Status.HostDetails.Hostname).To(Equal(hostname))
+		})
+
+		It("Should record the agent version on the byohost", func() {
+			gitVersion := version.GitVersion
+			version.GitVersion = "v1.2.3"
+			defer func() { version.GitVersion = gitVersion }()
+
+			Expect(hr.UpdateHost(ctx, byoHost)).ToNot(HaveOccurred())
+
+			updated := &infrastructurev1beta1.ByoHost{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), updated)).To(Succeed())
+			Expect(updated.Annotations).To(HaveKeyWithValue(infrastructurev1beta1.AgentVersionAnnotation, "v1.2.3"))
+		})
+	})
+
+	Context("When the agent sends a heartbeat", func() {
+		It("Should bump the heartbeat time of the byohost", func() {
+			Expect(hr.Heartbeat(ctx, byoHost.Name, defaultNamespace)).To(Succeed())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), byoHost)).To(Succeed())
+			Expect(byoHost.Status.LastHeartbeatTime).NotTo(BeNil())
+			first := byoHost.Status.LastHeartbeatTime.Time
+
+			time.Sleep(time.Second)
+			Expect(hr.Heartbeat(ctx, byoHost.Name, defaultNamespace)).To(Succeed())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), byoHost)).To(Succeed())
+			Expect(byoHost.Status.LastHeartbeatTime.Time).To(BeTemporally(">", first))
+		})
+	})
+
+	Context("When the host capacity is resynced", func() {
+		var capacity map[corev1.ResourceName]resource.Quantity
+
+		BeforeEach(func() {
+			capacity = map[corev1.ResourceName]resource.Quantity{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("8Gi"),
+			}
+			patched, err := hr.SyncCapacity(ctx, byoHost.Name, defaultNamespace, capacity)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(patched).To(BeTrue())
+		})
+
+		It("Should not patch the byohost when the detected capacity is unchanged", func() {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), byoHost)).To(Succeed())
+			resourceVersion := byoHost.ResourceVersion
+
+			unchanged := map[corev1.ResourceName]resource.Quantity{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("8192Mi"),
+			}
+			patched, err := hr.SyncCapacity(ctx, byoHost.Name, defaultNamespace, unchanged)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(patched).To(BeFalse())
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), byoHost)).To(Succeed())
+			Expect(byoHost.ResourceVersion).To(Equal(resourceVersion))
+		})
+
+		It("Should patch the byohost when the detected capacity changes", func() {
+			changed := map[corev1.ResourceName]resource.Quantity{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("16Gi"),
+				"nvidia.com/gpu":      resource.MustParse("1"),
+			}
+			patched, err := hr.SyncCapacity(ctx, byoHost.Name, defaultNamespace, changed)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(patched).To(BeTrue())
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(byoHost), byoHost)).To(Succeed())
+			memory := byoHost.Spec.Capacity[corev1.ResourceMemory]
+			Expect(memory.Cmp(resource.MustParse("16Gi"))).To(Equal(0))
+			Expect(byoHost.Spec.Capacity).To(HaveKey(corev1.ResourceName("nvidia.com/gpu")))
+		})
 	})
 })
@@ -44,3 +44,11 @@ func Get() Info {
 		Platform:     fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
 	}
 }
+
+// Version returns the semantic version of the running agent, unknown when the build scripts did not set it
+func Version() string {
+	if GitVersion == "" {
+		return "unknown"
+	}
+	return GitVersion
+}
@@ -4,6 +4,7 @@
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
@@ -25,6 +26,42 @@ type ByoClusterSpec struct {
 	// if not set, the default will be set to https://docker.io/mensyli/cluster-api-byoh-controller
 	// +optional
 	BundleLookupBaseRegistry string `json:"bundleLookupBaseRegistry,omitempty"`
+
+	// CNIPluginsVersion pins the version of the CNI plugins the installers download in online mode,
+	// e.g. v1.5.1, to match the requirements of the CNI of the cluster. Defaults to v1.4.0.
+	// +kubebuilder:validation:Pattern=`^v\d+\.\d+\.\d+$`
+	// +optional
+	CNIPluginsVersion string `json:"cniPluginsVersion,omitempty"`
+
+	// ImgpkgVersion pins the version of imgpkg the installers download on hosts without imgpkg,
+	// e.g. v0.39.0. Defaults to v0.36.4.
+	// +kubebuilder:validation:Pattern=`^v\d+\.\d+\.\d+$`
+	// +optional
+	ImgpkgVersion string `json:"imgpkgVersion,omitempty"`
+
+	// ImgpkgBaseURL points the imgpkg download at a mirror for air-gapped hosts, the binary is
+	// fetched from <ImgpkgBaseURL>/<ImgpkgVersion>/imgpkg-linux-<arch>.
+	// Defaults to github.com/vmware-tanzu/carvel-imgpkg/releases/download.
+	// +kubebuilder:validation:Pattern=`^(https?://)?[A-Za-z0-9.-]+(:[0-9]+)?(/[A-Za-z0-9._~%-]+)*$`
+	// +optional
+	ImgpkgBaseURL string `json:"imgpkgBaseURL,omitempty"`
+
+	// MaxConcurrentBootstraps caps the number of hosts of the cluster bootstrapping at the same time,
+	// so a small control plane or mirror is not overwhelmed. ByoMachines wait for a host to attach
+	// while as many hosts are attached but not yet bootstrapped. Unlimited when 0.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxConcurrentBootstraps int32 `json:"maxConcurrentBootstraps,omitempty"`
+
+	// DefaultNodeLabels are applied to every node of the cluster when its ByoHost is attached.
+	// Labels set on the ByoHost take precedence over these defaults.
+	// +optional
+	DefaultNodeLabels map[string]string `json:"defaultNodeLabels,omitempty"`
+
+	// DefaultNodeTaints are applied to every node of the cluster when its ByoHost is attached.
+	// A taint on the ByoHost with the same key and effect takes precedence over the default.
+	// +optional
+	DefaultNodeTaints []corev1.Taint `json:"defaultNodeTaints,omitempty"`
 }
 
 // ByoClusterStatus defines the observed state of ByoCluster
@@ -38,6 +75,32 @@ type ByoClusterStatus struct {
 
 	// FailureDomains is a list of failure domain objects synced from the infrastructure provider.
 	FailureDomains clusterv1.FailureDomains `json:"failureDomains,omitempty"`
+
+	// HostPool summarizes the health of the ByoHosts the cluster can use: the hosts bound to
+	// it and the unbound hosts of the capacity pool.
+	// +optional
+	HostPool *HostPoolSummary `json:"hostPool,omitempty"`
+}
+
+// HostPoolSummary counts the ByoHosts of a cluster by state. A host is counted in every
+// state that applies to it, so the counts do not add up to Total.
+type HostPoolSummary struct {
+	// Total is the number of hosts bound to the cluster or unbound.
+	Total int32 `json:"total"`
+
+	// Available is the number of unbound hosts that can be claimed by a ByoMachine.
+	Available int32 `json:"available"`
+
+	// Bound is the number of hosts bound to a ByoMachine of the cluster.
+	Bound int32 `json:"bound"`
+
+	// Unschedulable is the number of hosts that can not be claimed because they are
+	// quarantined or being cleaned up.
+	Unschedulable int32 `json:"unschedulable"`
+
+	// AgentsUnreachable is the number of hosts whose agent did not acknowledge the last
+	// cleanup the controller forced because the agent was unavailable.
+	AgentsUnreachable int32 `json:"agentsUnreachable"`
 }
 
 // APIEndpoint represents a reachable Kubernetes API endpoint.
@@ -52,6 +115,10 @@ type APIEndpoint struct {
 //+kubebuilder:object:root=true
 //+kubebuilder:resource:path=byoclusters,scope=Namespaced,shortName=byoc
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Hosts",type="integer",JSONPath=`.status.hostPool.total`,description="Hosts bound to the cluster or unbound"
+//+kubebuilder:printcolumn:name="Available",type="integer",JSONPath=`.status.hostPool.available`,description="Unbound hosts that can be claimed"
+//+kubebuilder:printcolumn:name="Bound",type="integer",JSONPath=`.status.hostPool.bound`,description="Hosts bound to the cluster"
+//+kubebuilder:printcolumn:name="Unreachable",type="integer",JSONPath=`.status.hostPool.agentsUnreachable`,description="Hosts whose agent is unreachable"
 
 // ByoCluster is the Schema for the byoclusters API
 type ByoCluster struct {
@@ -4,6 +4,8 @@
 package v1beta1
 
 import (
+	"encoding/json"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -11,16 +13,80 @@ import (
 )
 
 const (
+	// LabelPrefix is the prefix of the labels and annotations BYOH manages on its resources
+	LabelPrefix = "byoh.infrastructure.cluster.x-k8s.io"
+	// CapacityLabelPrefix is the default prefix of the labels the agent sets on a ByoHost to expose
+	// its capacity, e.g. capacity.infrastructure.cluster.x-k8s.io/cpu
+	CapacityLabelPrefix = "capacity.infrastructure.cluster.x-k8s.io"
+
 	// HostCleanupAnnotation annotation used to mark a host for cleanup
-	HostCleanupAnnotation = "byoh.infrastructure.cluster.x-k8s.io/unregistering"
+	HostCleanupAnnotation = LabelPrefix + "/unregistering"
 	// EndPointIPAnnotation annotation used to store the IP address of the endpoint
-	EndPointIPAnnotation = "byoh.infrastructure.cluster.x-k8s.io/endpointip"
+	EndPointIPAnnotation = LabelPrefix + "/endpointip"
+	// AppliedEndPointIPAnnotation annotation used to store the endpoint the agent last pointed the kubeconfigs
+	// of the node at, so a change of the EndPointIPAnnotation after the bootstrap is picked up
+	AppliedEndPointIPAnnotation = LabelPrefix + "/applied-endpointip"
 	// K8sVersionAnnotation annotation used to store the k8s version
-	K8sVersionAnnotation = "byoh.infrastructure.cluster.x-k8s.io/k8sversion"
+	K8sVersionAnnotation = LabelPrefix + "/k8sversion"
 	// AttachedByoMachineLabel label used to mark a node name attached to a byo host
-	AttachedByoMachineLabel = "byoh.infrastructure.cluster.x-k8s.io/byomachine-name"
+	AttachedByoMachineLabel = LabelPrefix + "/byomachine-name"
 	// BundleLookupBaseRegistryAnnotation annotation used to store the base registry for the bundle lookup
-	BundleLookupBaseRegistryAnnotation = "byoh.infrastructure.cluster.x-k8s.io/bundle-registry"
+	BundleLookupBaseRegistryAnnotation = LabelPrefix + "/bundle-registry"
+	// BootstrapFailuresAnnotation annotation used to count the consecutive bootstrap failures of a host
+	BootstrapFailuresAnnotation = LabelPrefix + "/bootstrap-failures"
+	// BootstrapPhaseAnnotation annotation used to store the last completed phase of the bootstrap of a host,
+	// so a bootstrap failing to start kubelet is retried from there instead of from scratch
+	BootstrapPhaseAnnotation = LabelPrefix + "/bootstrap-phase"
+	// QuarantinedLabel label used to exclude a host that repeatedly failed bootstrap from selection.
+	// Operators remove it (together with the BootstrapFailuresAnnotation) once the host is fixed.
+	QuarantinedLabel = LabelPrefix + "/quarantined"
+	// PostBootstrapTaintsRemovedAnnotation annotation used to mark that the agent removed the configured
+	// post-bootstrap taints from the Node, so taints re-added later are left alone
+	PostBootstrapTaintsRemovedAnnotation = LabelPrefix + "/post-bootstrap-taints-removed"
+	// ClusterCAVerifiedAnnotation annotation used to mark that the agent verified the node joined the
+	// cluster with the CA of the bootstrap secret of the host
+	ClusterCAVerifiedAnnotation = LabelPrefix + "/cluster-ca-verified"
+	// SELinuxLabel label used to expose the lower-cased SELinux mode of the host, e.g. enforcing,
+	// so ByoMachines can select compliant hosts
+	SELinuxLabel = LabelPrefix + "/selinux"
+	// AppArmorLabel label used to expose the lower-cased AppArmor mode of the host, e.g. enforcing,
+	// so ByoMachines can select compliant hosts
+	AppArmorLabel = LabelPrefix + "/apparmor"
+	// HostFactsLabel label used to mark the ConfigMaps of host facts the agents publish for inventory tools
+	HostFactsLabel = LabelPrefix + "/host-facts"
+	// InstallScriptHashAnnotation annotation used to store the sha256 of the rendered install script
+	// the agent ran successfully, for audit
+	InstallScriptHashAnnotation = LabelPrefix + "/install-script-sha256"
+	// InstallScriptAnnotation annotation used to store the rendered install script, truncated to the
+	// size configured on the agent, for audit
+	InstallScriptAnnotation = LabelPrefix + "/install-script"
+	// CleanupStartedAtAnnotation annotation used to store when the controller first saw the cleanup
+	// of a host, to force the cleanup once the agent did not complete it in time
+	CleanupStartedAtAnnotation = LabelPrefix + "/cleanup-started-at"
+	// AgentVersionAnnotation annotation used to store the version of the agent running on the host, set at
+	// every start of the agent, so version skew across the hosts can be detected from the management cluster
+	AgentVersionAnnotation = LabelPrefix + "/agent-version"
+	// ForceCleanupConfirmationAnnotation annotation used to store when the cleanup timeout of a host was
+	// exceeded, the Node is only force deleted if the agent shows no activity within the confirmation window
+	ForceCleanupConfirmationAnnotation = LabelPrefix + "/force-cleanup-confirmation"
+	// GracefulDrainAnnotation annotation used to drain the Node of a host before the agent resets it on cleanup,
+	// evicting its pods while respecting their PodDisruptionBudgets. The value bounds the drain, e.g. 5m, the
+	// default timeout of the agent is used when empty. The reset proceeds once the timeout elapsed.
+	GracefulDrainAnnotation = LabelPrefix + "/graceful-drain"
+	// MaintenanceWindowAnnotation annotation used to restrict the force cleanup of a host to a maintenance
+	// window of the form "[DAYS ]HH:MM-HH:MM" in UTC, e.g. "Sat,Sun 00:00-06:00", it is deferred until the window opens
+	MaintenanceWindowAnnotation = LabelPrefix + "/maintenance-window"
+	// ClusterNodeDefaultsAnnotation annotation used to record the labels and taints the defaults of the ByoCluster
+	// added to the spec of an attached host, so they are removed when the host is released instead of being
+	// applied to the nodes of the next cluster
+	ClusterNodeDefaultsAnnotation = LabelPrefix + "/cluster-node-defaults"
+	// ForceCleanupAnnotation annotation of earlier releases forcing the cleanup of a host, removed
+	// by the agent when it cleans up the host
+	ForceCleanupAnnotation = LabelPrefix + "/force-cleanup"
+
+	// ForceCleanupAgentUnavailableReason is recorded when the controller forced a host cleanup
+	// because the agent did not complete it within the cleanup timeout
+	ForceCleanupAgentUnavailableReason = "AgentUnavailable"
 
 	// JoinModeKubeadm uses kubeadm join command to join the cluster (default)
 	JoinModeKubeadm JoinMode = "kubeadm"
@@ -32,6 +98,17 @@ const (
 	DownloadModeOffline DownloadMode = "offline"
 	// DownloadModeOnline downloads binaries from the network
 	DownloadModeOnline DownloadMode = "online"
+
+	// ByoHostPhaseAvailable is a host in the capacity pool that is not bound to a machine
+	ByoHostPhaseAvailable ByoHostPhase = "Available"
+	// ByoHostPhaseProvisioning is a host bound to a machine that is not yet bootstrapped
+	ByoHostPhaseProvisioning ByoHostPhase = "Provisioning"
+	// ByoHostPhaseProvisioned is a host bound to a machine and bootstrapped as a node
+	ByoHostPhaseProvisioned ByoHostPhase = "Provisioned"
+	// ByoHostPhaseCleaningUp is a host that is being released or deleted
+	ByoHostPhaseCleaningUp ByoHostPhase = "CleaningUp"
+	// ByoHostPhaseQuarantined is a host excluded from selection after repeated bootstrap failures
+	ByoHostPhaseQuarantined ByoHostPhase = "Quarantined"
 )
 
 // JoinMode defines how the node joins the cluster
@@ -40,6 +117,9 @@ type JoinMode string
 // DownloadMode defines how to obtain K8s binaries (only valid for TLSBootstrap mode)
 type DownloadMode string
 
+// ByoHostPhase is a summary of the state of the host in its lifecycle
+type ByoHostPhase string
+
 // ByoHostSpec defines the desired state of ByoHost
 type ByoHostSpec struct {
 	// BootstrapSecret is an optional reference to a Cluster API Secret
@@ -52,6 +132,12 @@ type ByoHostSpec struct {
 	// +optional
 	InstallationSecret *corev1.ObjectReference `json:"installationSecret,omitempty"`
 
+	// InstallEnv are environment variables the Agent exports before running the install script,
+	// e.g. NO_PROXY exceptions or registry mirrors specific to this host.
+	// Names must be valid shell variable names.
+	// +optional
+	InstallEnv map[string]string `json:"installEnv,omitempty"`
+
 	// UninstallationScript is an optional field to store uninstall script
 	// generated by InstallerController
 	// +optional
@@ -84,11 +170,42 @@ type ByoHostSpec struct {
 	// +optional
 	ManageKubeProxy bool `json:"manageKubeProxy,omitempty"`
 
+	// DisableKubeProxy makes the Agent skip the kube-proxy configuration, kubeconfig and unit entirely,
+	// e.g. for eBPF dataplanes like Cilium's kube-proxy replacement. ManageKubeProxy is treated as false.
+	// +optional
+	DisableKubeProxy bool `json:"disableKubeProxy,omitempty"`
+
+	// KubeletLogVerbosity overrides the verbosity of the kubelet logs configured by the Agent, e.g. raised
+	// to debug this host. Only applied in TLS Bootstrap mode, when the node is bootstrapped. A change on a
+	// bootstrapped node rewrites the kubelet configuration and restarts kubelet.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	KubeletLogVerbosity *int32 `json:"kubeletLogVerbosity,omitempty"`
+
+	// KubeletTLSMinVersion overrides the minimum TLS version the kubelet server accepts, configured by the
+	// Agent, e.g. to harden this host. Only applied in TLS Bootstrap mode, when the node is bootstrapped.
+	// +kubebuilder:validation:Enum=VersionTLS10;VersionTLS11;VersionTLS12;VersionTLS13
+	// +optional
+	KubeletTLSMinVersion string `json:"kubeletTLSMinVersion,omitempty"`
+
+	// KubeletTLSCipherSuites overrides the cipher suites the kubelet server accepts, configured by the Agent,
+	// as IANA names, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Names not supported by kubelet, insecure
+	// cipher suites and cipher suites along with VersionTLS13 are rejected. Only applied in TLS Bootstrap mode,
+	// when the node is bootstrapped.
+	// +optional
+	KubeletTLSCipherSuites []string `json:"kubeletTLSCipherSuites,omitempty"`
+
 	// Capacity represents the total resources of the host.
 	// This is used by the autoscaler for scale-from-zero and capacity-aware scheduling.
 	// +optional
 	Capacity map[corev1.ResourceName]resource.Quantity `json:"capacity,omitempty"`
 
+	// ReservedCapacity is the part of the Capacity reserved for the system and the daemons of the host,
+	// not available to the machine claiming the host. Hosts are matched against the capacity requirements
+	// and ranked by the selection strategy of a ByoMachine over the Capacity minus the ReservedCapacity.
+	// +optional
+	ReservedCapacity map[corev1.ResourceName]resource.Quantity `json:"reservedCapacity,omitempty"`
+
 	// Labels to be applied to the node when it joins the cluster.
 	// This allows for custom scheduling and selection of nodes based on workload requirements.
 	// +optional
@@ -108,6 +225,11 @@ type ByoHostSpec struct {
 
 // HostInfo is a set of details about the host platform.
 type HostInfo struct {
+	// Hostname reported by the operating system of the host, which may differ from the name of
+	// the ByoHost, e.g. a fully qualified name.
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+
 	// The Operating System reported by the host.
 	OSName string `json:"osname,omitempty"`
 
@@ -116,8 +238,38 @@ type HostInfo struct {
 
 	// The Architecture reported by the host.
 	Architecture string `json:"architecture,omitempty"`
+
+	// Kernel Version reported by the host (e.g. `uname -r`).
+	KernelVersion string `json:"kernelversion,omitempty"`
+
+	// ContainerRuntimeVersion reported by the host, in the <runtime>://<version>
+	// form used by the Node status (e.g. containerd://1.7.2).
+	ContainerRuntimeVersion string `json:"containerruntimeversion,omitempty"`
+
+	// SELinux is the mode of SELinux reported by the host.
+	// +kubebuilder:validation:Enum=Enforcing;Permissive;Disabled
+	// +optional
+	SELinux SecurityModuleMode `json:"selinux,omitempty"`
+
+	// AppArmor is the mode of AppArmor reported by the host. It is Permissive
+	// when AppArmor is enabled without any profile in enforce mode.
+	// +kubebuilder:validation:Enum=Enforcing;Permissive;Disabled
+	// +optional
+	AppArmor SecurityModuleMode `json:"apparmor,omitempty"`
 }
 
+// SecurityModuleMode is the mode of a Linux security module, SELinux or AppArmor, on the host
+type SecurityModuleMode string
+
+const (
+	// SecurityModuleEnforcing the security module enforces its policy
+	SecurityModuleEnforcing SecurityModuleMode = "Enforcing"
+	// SecurityModulePermissive the security module is enabled but only logs policy violations
+	SecurityModulePermissive SecurityModuleMode = "Permissive"
+	// SecurityModuleDisabled the security module is not enabled
+	SecurityModuleDisabled SecurityModuleMode = "Disabled"
+)
+
 // ByoHostStatus defines the observed state of ByoHost
 type ByoHostStatus struct {
 	// MachineRef is an optional reference to a Cluster API Machine
@@ -137,6 +289,51 @@ type ByoHostStatus struct {
 	// network interfaces.
 	// +optional
 	Network []NetworkStatus `json:"network,omitempty"`
+
+	// Phase summarizes the state of the host: Available, Provisioning, Provisioned,
+	// CleaningUp or Quarantined.
+	// +optional
+	Phase ByoHostPhase `json:"phase,omitempty"`
+
+	// LastForceCleanup records the last cleanup forced by the controller
+	// because the agent was unavailable. It is retained for observability.
+	// +optional
+	LastForceCleanup *ForceCleanupRecord `json:"lastForceCleanup,omitempty"`
+
+	// LastHeartbeatTime is the last time the agent of the host reported it is running. The agent bumps
+	// it periodically, so the controller tells a slow agent from a gone one before forcing a cleanup.
+	// +optional
+	LastHeartbeatTime *metav1.Time `json:"lastHeartbeatTime,omitempty"`
+
+	// ResolvedOSBundle is the BYOH bundle the installer of the host was resolved to from its OS and
+	// architecture, e.g. Ubuntu_22.04.1_x86-64. Set by the controller when it creates the install script.
+	// +optional
+	ResolvedOSBundle string `json:"resolvedOSBundle,omitempty"`
+
+	// ResolvedK8sFilter is the k8s version filter of the ResolvedOSBundle matching the k8s version
+	// installed, e.g. v1.29.*. Empty when the bundle supports no matching version.
+	// +optional
+	ResolvedK8sFilter string `json:"resolvedK8sFilter,omitempty"`
+}
+
+// ForceCleanupRecord describes a host cleanup forced by the controller.
+type ForceCleanupRecord struct {
+	// Timestamp is the time the cleanup was forced.
+	Timestamp metav1.Time `json:"timestamp"`
+
+	// Reason is why the cleanup was forced.
+	Reason string `json:"reason"`
+
+	// Timeout is the cleanup timeout the agent exceeded.
+	Timeout metav1.Duration `json:"timeout"`
+
+	// Elapsed is the time waited for the agent before the cleanup was forced.
+	Elapsed metav1.Duration `json:"elapsed"`
+
+	// AgentAcknowledged is set by the agent once it removed the residual
+	// Kubernetes state left on the host by the forced cleanup.
+	// +optional
+	AgentAcknowledged bool `json:"agentAcknowledged,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -145,6 +342,9 @@ type ByoHostStatus struct {
 //+kubebuilder:printcolumn:name="OSName",type="string",JSONPath=`.status.hostinfo.osname`
 //+kubebuilder:printcolumn:name="OSImage",type="string",JSONPath=`.status.hostinfo.osimage`
 //+kubebuilder:printcolumn:name="Arch",type="string",JSONPath=`.status.hostinfo.architecture`
+//+kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=`.metadata.labels['cluster\.x-k8s\.io/cluster-name']`,description="Cluster the host is bound to"
+//+kubebuilder:printcolumn:name="Machine",type="string",JSONPath=`.status.machineRef.name`,description="ByoMachine the host is bound to"
+//+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=`.status.phase`,description="Phase of the host"
 
 // ByoHost is the Schema for the byohosts API
 type ByoHost struct {
@@ -180,7 +380,87 @@ func (byoHost *ByoHost) SetConditions(conditions clusterv1.Conditions) {
 
 // IsAvailable checks if the ByoHost is available for allocation
 func (byoHost *ByoHost) IsAvailable() bool {
-	return byoHost.Status.MachineRef == nil
+	return byoHost.Status.MachineRef == nil && !byoHost.IsQuarantined()
+}
+
+// HasStrayBootstrapSecret checks if a free ByoHost, neither bound to a ByoMachine nor labeled for a
+// cluster, carries a BootstrapSecret. Only the attach flow sets it, so it was set externally.
+func (byoHost *ByoHost) HasStrayBootstrapSecret() bool {
+	_, labeled := byoHost.Labels[clusterv1.ClusterNameLabel]
+	return byoHost.Spec.BootstrapSecret != nil && byoHost.Status.MachineRef == nil && !labeled
+}
+
+// IsQuarantined checks if the ByoHost was quarantined after repeated bootstrap failures
+func (byoHost *ByoHost) IsQuarantined() bool {
+	_, ok := byoHost.Labels[QuarantinedLabel]
+	return ok
+}
+
+// ClusterNodeDefaults are the labels and taints the defaults of the ByoCluster added to the spec of an attached host
+// +kubebuilder:object:generate=false
+type ClusterNodeDefaults struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	Taints []corev1.Taint    `json:"taints,omitempty"`
+}
+
+// GetClusterNodeDefaults returns the cluster node defaults recorded in the ClusterNodeDefaultsAnnotation, empty when
+// none is recorded or the annotation cannot be parsed
+func (byoHost *ByoHost) GetClusterNodeDefaults() ClusterNodeDefaults {
+	var defaults ClusterNodeDefaults
+	if value, ok := byoHost.Annotations[ClusterNodeDefaultsAnnotation]; ok {
+		_ = json.Unmarshal([]byte(value), &defaults)
+	}
+	return defaults
+}
+
+// SetClusterNodeDefaults records the cluster node defaults added to the spec of the host in the
+// ClusterNodeDefaultsAnnotation, the annotation is removed when there are none
+func (byoHost *ByoHost) SetClusterNodeDefaults(defaults ClusterNodeDefaults) {
+	if len(defaults.Labels) == 0 && len(defaults.Taints) == 0 {
+		delete(byoHost.Annotations, ClusterNodeDefaultsAnnotation)
+		return
+	}
+	value, err := json.Marshal(defaults)
+	if err != nil {
+		return
+	}
+	if byoHost.Annotations == nil {
+		byoHost.Annotations = map[string]string{}
+	}
+	byoHost.Annotations[ClusterNodeDefaultsAnnotation] = string(value)
+}
+
+// RemoveClusterNodeDefaults removes the recorded cluster node defaults from the spec of the host, together with the
+// ClusterNodeDefaultsAnnotation. Labels and taints changed since they were added are kept.
+func (byoHost *ByoHost) RemoveClusterNodeDefaults() {
+	defaults := byoHost.GetClusterNodeDefaults()
+	delete(byoHost.Annotations, ClusterNodeDefaultsAnnotation)
+
+	for key, value := range defaults.Labels {
+		if current, ok := byoHost.Spec.Labels[key]; ok && current == value {
+			delete(byoHost.Spec.Labels, key)
+		}
+	}
+	if len(defaults.Taints) == 0 {
+		return
+	}
+	taints := byoHost.Spec.Taints[:0]
+	for _, taint := range byoHost.Spec.Taints {
+		added := false
+		for i := range defaults.Taints {
+			if taint.MatchTaint(&defaults.Taints[i]) && taint.Value == defaults.Taints[i].Value {
+				added = true
+				break
+			}
+		}
+		if !added {
+			taints = append(taints, taint)
+		}
+	}
+	if len(taints) == 0 {
+		taints = nil
+	}
+	byoHost.Spec.Taints = taints
 }
 
 // GetPriority returns the priority of the host, defaulting to 0
@@ -201,11 +481,29 @@ func (byoHost *ByoHost) MatchesRequirements(selector map[string]string, required
 	}
 
 	// Check capacity
+	allocatable := byoHost.AllocatableCapacity()
 	for resourceName, required := range requiredCapacity {
-		if available, exists := byoHost.Spec.Capacity[resourceName]; !exists || available.Cmp(required) < 0 {
+		if available, exists := allocatable[resourceName]; !exists || available.Cmp(required) < 0 {
 			return false
 		}
 	}
 
 	return true
 }
+
+// AllocatableCapacity returns the capacity of the host available to a machine, the Capacity minus the
+// ReservedCapacity, never below zero
+func (byoHost *ByoHost) AllocatableCapacity() map[corev1.ResourceName]resource.Quantity {
+	allocatable := make(map[corev1.ResourceName]resource.Quantity, len(byoHost.Spec.Capacity))
+	for resourceName, capacity := range byoHost.Spec.Capacity {
+		available := capacity.DeepCopy()
+		if reserved, ok := byoHost.Spec.ReservedCapacity[resourceName]; ok {
+			available.Sub(reserved)
+		}
+		if available.Sign() < 0 {
+			available = resource.Quantity{Format: capacity.Format}
+		}
+		allocatable[resourceName] = available
+	}
+	return allocatable
+}
@@ -5,18 +5,30 @@ package v1beta1
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"reflect"
 
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common/kubeletconfig"
 	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 //+kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-byohost,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=byohosts,verbs=create;update;delete,versions=v1beta1,name=vbyohost.kb.io,admissionReviewVersions={v1,v1beta1}
+// The agents update the status of their ByoHosts continuously, so the status webhook only validates updates and
+// does not block them while the webhook is unavailable
+//+kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-byohost-status,mutating=false,failurePolicy=ignore,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=byohosts/status,verbs=update,versions=v1beta1,name=vbyohoststatus.kb.io,admissionReviewVersions={v1,v1beta1}
 
 // +k8s:deepcopy-gen=false
 // ByoHostValidator validates ByoHosts
 type ByoHostValidator struct {
-	//	Client  client.Client
+	// Client looks up the Machine of a ByoHost whose MachineRef is cleared. The removal of the
+	// MachineRef is not validated without it.
+	Client  client.Client
 	decoder *admission.Decoder
 }
 
@@ -30,7 +42,7 @@ func (v *ByoHostValidator) Handle(ctx context.Context, req admission.Request) ad
 
 	switch req.Operation {
 	case v1.Create, v1.Update:
-		response = v.handleCreateUpdate(&req)
+		response = v.handleCreateUpdate(ctx, &req)
 	case v1.Delete:
 		response = v.handleDelete(&req)
 	default:
@@ -39,23 +51,61 @@ func (v *ByoHostValidator) Handle(ctx context.Context, req admission.Request) ad
 	return response
 }
 
-func (v *ByoHostValidator) handleCreateUpdate(req *admission.Request) admission.Response {
+func (v *ByoHostValidator) handleCreateUpdate(ctx context.Context, req *admission.Request) admission.Response {
 	byoHost := &ByoHost{}
 	err := v.decoder.Decode(*req, byoHost)
 	if err != nil {
 		return admission.Errored(http.StatusBadRequest, err)
 	}
+	oldByoHost := &ByoHost{}
+	if req.Operation == v1.Update {
+		if err := v.decoder.DecodeRaw(req.OldObject, oldByoHost); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
 	userName := req.UserInfo.Username
 
-	// Allow ByoHost creation from any authenticated user
-	if req.Operation == v1.Create {
+	// Clearing the MachineRef of a host whose node is still Ready orphans the running node, whoever clears it
+	if oldByoHost.Status.MachineRef != nil && byoHost.Status.MachineRef == nil && !isCleaningUp(oldByoHost) && !isCleaningUp(byoHost) {
+		ready, err := v.nodeReady(ctx, oldByoHost.Status.MachineRef)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if ready {
+			return admission.Denied("cannot clear MachineRef while the Node of the ByoHost is Ready, set the cleanup annotation to release the host")
+		}
+	}
+
+	// Only the MachineRef is validated on the status
+	if req.SubResource == "status" {
 		return admission.Allowed("")
 	}
 
+	// Reject kubelet TLS settings kubelet fails to start with. Only changed settings are validated, so
+	// hosts validated by an older release still get their finalizers and metadata updated.
+	if req.Operation == v1.Create || byoHost.Spec.KubeletTLSMinVersion != oldByoHost.Spec.KubeletTLSMinVersion ||
+		!reflect.DeepEqual(byoHost.Spec.KubeletTLSCipherSuites, oldByoHost.Spec.KubeletTLSCipherSuites) {
+		if err := kubeletconfig.ValidateTLSSettings(byoHost.Spec.KubeletTLSMinVersion, byoHost.Spec.KubeletTLSCipherSuites); err != nil {
+			return admission.Denied(fmt.Sprintf("invalid kubelet TLS settings: %v", err))
+		}
+	}
+
 	// allow manager service account to patch ByoHost
 	if userName == managerServiceAccount && req.Operation == v1.Update {
 		return admission.Allowed("")
 	}
+
+	// Only the attach flow of the manager sets the BootstrapSecret, reject it on a free host
+	if byoHost.HasStrayBootstrapSecret() {
+		if oldByoHost.Spec.BootstrapSecret == nil || *oldByoHost.Spec.BootstrapSecret != *byoHost.Spec.BootstrapSecret {
+			return admission.Denied("cannot set BootstrapSecret on a ByoHost that is not attached to a ByoMachine")
+		}
+	}
+
+	// Allow ByoHost creation from any authenticated user
+	if req.Operation == v1.Create {
+		return admission.Allowed("")
+	}
 	// Disabled hostname validation to allow any host name
 	// if !strings.Contains(byoHost.Name, substrs[2]) {
 	// 	return admission.Denied(fmt.Sprintf("%s cannot create/update resource %s", userName, byoHost.Name))
@@ -75,6 +125,44 @@ func (v *ByoHostValidator) handleDelete(req *admission.Request) admission.Respon
 	return admission.Allowed("")
 }
 
+// isCleaningUp checks if the host is marked for cleanup, which releases it from its ByoMachine
+func isCleaningUp(byoHost *ByoHost) bool {
+	_, ok := byoHost.Annotations[HostCleanupAnnotation]
+	return ok
+}
+
+// nodeReady checks if the Node of the ByoMachine referenced by the MachineRef is still Ready, as reported by the
+// NodeHealthy condition of the Machine owning the ByoMachine. A missing ByoMachine or Machine means the Node is gone.
+func (v *ByoHostValidator) nodeReady(ctx context.Context, machineRef *corev1.ObjectReference) (bool, error) {
+	if v.Client == nil {
+		return false, nil
+	}
+	byoMachine := &ByoMachine{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Namespace: machineRef.Namespace, Name: machineRef.Name}, byoMachine); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	for _, owner := range byoMachine.OwnerReferences {
+		gv, err := schema.ParseGroupVersion(owner.APIVersion)
+		if err != nil || gv.Group != clusterv1.GroupVersion.Group || owner.Kind != "Machine" {
+			continue
+		}
+		machine := &clusterv1.Machine{}
+		if err := v.Client.Get(ctx, client.ObjectKey{Namespace: byoMachine.Namespace, Name: owner.Name}, machine); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		if machine.Status.NodeRef == nil {
+			return false, nil
+		}
+		for _, condition := range machine.Status.Conditions {
+			if condition.Type == clusterv1.MachineNodeHealthyCondition {
+				return condition.Status == corev1.ConditionTrue, nil
+			}
+		}
+		return false, nil
+	}
+	return false, nil
+}
+
 // InjectDecoder injects the decoder.
 func (v *ByoHostValidator) InjectDecoder(d *admission.Decoder) error {
 	v.decoder = d
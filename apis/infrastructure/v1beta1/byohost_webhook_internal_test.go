@@ -15,6 +15,8 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
@@ -161,6 +163,63 @@ var _ = Describe("ByohostWebhook/Unit", func() {
 			Expect(resp.AdmissionResponse.Allowed).To(Equal(true))
 		})
 	})
+	Context("When the kubelet TLS settings of a ByoHost are set", func() {
+		var (
+			oldByoHost *ByoHost
+			byoHost    *ByoHost
+		)
+		BeforeEach(func() {
+			oldByoHost = &ByoHost{
+				TypeMeta:   metav1.TypeMeta{Kind: "ByoHost", APIVersion: "infrastructure.cluster.x-k8s.io/v1beta1"},
+				ObjectMeta: metav1.ObjectMeta{Name: "host1", Namespace: "default"},
+			}
+			byoHost = oldByoHost.DeepCopy()
+		})
+		handle := func(operation admissionv1.Operation) admission.Response {
+			oldRaw, err := json.Marshal(oldByoHost)
+			Expect(err).ShouldNot(HaveOccurred())
+			newRaw, err := json.Marshal(byoHost)
+			Expect(err).ShouldNot(HaveOccurred())
+			admissionRequest := admissionv1.AdmissionRequest{
+				Operation: operation,
+				UserInfo:  v1.UserInfo{Username: managerServiceAccount},
+				Object:    runtime.RawExtension{Raw: newRaw, Object: byoHost},
+			}
+			if operation == admissionv1.Update {
+				admissionRequest.OldObject = runtime.RawExtension{Raw: oldRaw, Object: oldByoHost}
+			}
+			return v.Handle(context.TODO(), admission.Request{AdmissionRequest: admissionRequest})
+		}
+		It("Should allow supported settings", func() {
+			byoHost.Spec.KubeletTLSMinVersion = "VersionTLS12"
+			byoHost.Spec.KubeletTLSCipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+			Expect(handle(admissionv1.Create).AdmissionResponse.Allowed).To(Equal(true))
+			Expect(handle(admissionv1.Update).AdmissionResponse.Allowed).To(Equal(true))
+		})
+		It("Should reject an unsupported cipher suite", func() {
+			byoHost.Spec.KubeletTLSCipherSuites = []string{"TLS_FOO"}
+			resp := handle(admissionv1.Create)
+			Expect(resp.AdmissionResponse.Allowed).To(Equal(false))
+			Expect(string(resp.AdmissionResponse.Result.Reason)).To(Equal(`invalid kubelet TLS settings: unsupported TLS cipher suite "TLS_FOO"`))
+		})
+		It("Should reject an insecure cipher suite", func() {
+			byoHost.Spec.KubeletTLSCipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"}
+			resp := handle(admissionv1.Update)
+			Expect(resp.AdmissionResponse.Allowed).To(Equal(false))
+			Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("insecure TLS cipher suite"))
+		})
+		It("Should reject cipher suites along with VersionTLS13", func() {
+			byoHost.Spec.KubeletTLSMinVersion = "VersionTLS13"
+			byoHost.Spec.KubeletTLSCipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+			Expect(handle(admissionv1.Update).AdmissionResponse.Allowed).To(Equal(false))
+		})
+		It("Should allow other updates of a host whose settings were stored before", func() {
+			oldByoHost.Spec.KubeletTLSCipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"}
+			byoHost = oldByoHost.DeepCopy()
+			byoHost.Finalizers = []string{"test-finalizer"}
+			Expect(handle(admissionv1.Update).AdmissionResponse.Allowed).To(Equal(true))
+		})
+	})
 	Context("When ByoHost gets an delete request", func() {
 		var (
 			byoHost    *ByoHost
@@ -217,4 +276,169 @@ var _ = Describe("ByohostWebhook/Unit", func() {
 			Expect(string(resp.AdmissionResponse.Result.Reason)).To(Equal("cannot delete ByoHost when MachineRef is assigned"))
 		})
 	})
+	Context("When a free ByoHost gets a BootstrapSecret", func() {
+		var (
+			oldByoHost *ByoHost
+			byoHost    *ByoHost
+			ctx        context.Context
+		)
+		BeforeEach(func() {
+			ctx = context.TODO()
+			oldByoHost = &ByoHost{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "ByoHost",
+					APIVersion: "infrastructure.cluster.x-k8s.io/v1beta1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "host1",
+					Namespace: "default",
+				},
+			}
+			byoHost = oldByoHost.DeepCopy()
+			byoHost.Spec.BootstrapSecret = &corev1.ObjectReference{Kind: "Secret", Namespace: "default", Name: "tampered-secret"}
+		})
+		handleUpdate := func(username string) admission.Response {
+			oldRaw, err := json.Marshal(oldByoHost)
+			Expect(err).ShouldNot(HaveOccurred())
+			newRaw, err := json.Marshal(byoHost)
+			Expect(err).ShouldNot(HaveOccurred())
+			admissionRequest := admissionv1.AdmissionRequest{
+				Operation: admissionv1.Update,
+				UserInfo:  v1.UserInfo{Username: username},
+				Object:    runtime.RawExtension{Raw: newRaw, Object: byoHost},
+				OldObject: runtime.RawExtension{Raw: oldRaw, Object: oldByoHost},
+			}
+			return v.Handle(ctx, admission.Request{AdmissionRequest: admissionRequest})
+		}
+		It("Should reject the update from the agent user", func() {
+			resp := handleUpdate("byoh:host:host1")
+			Expect(resp.AdmissionResponse.Allowed).To(Equal(false))
+			Expect(string(resp.AdmissionResponse.Result.Reason)).To(Equal("cannot set BootstrapSecret on a ByoHost that is not attached to a ByoMachine"))
+		})
+		It("Should reject the create request", func() {
+			byoHostRaw, err := json.Marshal(byoHost)
+			Expect(err).ShouldNot(HaveOccurred())
+			admissionRequest := admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				UserInfo:  v1.UserInfo{Username: "byoh:host:host1"},
+				Object:    runtime.RawExtension{Raw: byoHostRaw, Object: byoHost},
+			}
+			resp := v.Handle(ctx, admission.Request{AdmissionRequest: admissionRequest})
+			Expect(resp.AdmissionResponse.Allowed).To(Equal(false))
+		})
+		It("Should allow the update from the manager", func() {
+			Expect(handleUpdate(managerServiceAccount).AdmissionResponse.Allowed).To(Equal(true))
+		})
+		It("Should allow the update when the host is labeled for a cluster", func() {
+			byoHost.Labels = map[string]string{clusterv1.ClusterNameLabel: "test-cluster"}
+			Expect(handleUpdate("byoh:host:host1").AdmissionResponse.Allowed).To(Equal(true))
+		})
+		It("Should allow other updates of a host already carrying the BootstrapSecret", func() {
+			oldByoHost = byoHost.DeepCopy()
+			byoHost.Spec.Priority = new(int32)
+			Expect(handleUpdate("byoh:host:host1").AdmissionResponse.Allowed).To(Equal(true))
+		})
+	})
+	Context("When the MachineRef of a ByoHost is cleared", func() {
+		var (
+			oldByoHost *ByoHost
+			byoHost    *ByoHost
+			byoMachine *ByoMachine
+			machine    *clusterv1.Machine
+			ctx        context.Context
+		)
+		BeforeEach(func() {
+			ctx = context.TODO()
+			machine = &clusterv1.Machine{
+				ObjectMeta: metav1.ObjectMeta{Name: "machine1", Namespace: "default"},
+				Status: clusterv1.MachineStatus{
+					NodeRef: &corev1.ObjectReference{Kind: "Node", Name: "host1"},
+					Conditions: clusterv1.Conditions{
+						{Type: clusterv1.MachineNodeHealthyCondition, Status: corev1.ConditionTrue},
+					},
+				},
+			}
+			byoMachine = &ByoMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "byomachine1",
+					Namespace: "default",
+					OwnerReferences: []metav1.OwnerReference{
+						{APIVersion: clusterv1.GroupVersion.String(), Kind: "Machine", Name: "machine1", UID: "machine1-uid"},
+					},
+				},
+			}
+			oldByoHost = &ByoHost{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "ByoHost",
+					APIVersion: "infrastructure.cluster.x-k8s.io/v1beta1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "host1",
+					Namespace: "default",
+				},
+				Status: ByoHostStatus{
+					MachineRef: &corev1.ObjectReference{Kind: "ByoMachine", Namespace: "default", Name: "byomachine1"},
+				},
+			}
+			byoHost = oldByoHost.DeepCopy()
+			byoHost.Status.MachineRef = nil
+		})
+		handleUpdate := func(username string) admission.Response {
+			clusterSchema := runtime.NewScheme()
+			Expect(AddToScheme(clusterSchema)).To(Succeed())
+			Expect(clusterv1.AddToScheme(clusterSchema)).To(Succeed())
+			validator := &ByoHostValidator{
+				Client:  fake.NewClientBuilder().WithScheme(clusterSchema).WithObjects(byoMachine, machine).Build(),
+				decoder: decoder,
+			}
+			oldRaw, err := json.Marshal(oldByoHost)
+			Expect(err).ShouldNot(HaveOccurred())
+			newRaw, err := json.Marshal(byoHost)
+			Expect(err).ShouldNot(HaveOccurred())
+			admissionRequest := admissionv1.AdmissionRequest{
+				Operation:   admissionv1.Update,
+				SubResource: "status",
+				UserInfo:    v1.UserInfo{Username: username},
+				Object:      runtime.RawExtension{Raw: newRaw, Object: byoHost},
+				OldObject:   runtime.RawExtension{Raw: oldRaw, Object: oldByoHost},
+			}
+			return validator.Handle(ctx, admission.Request{AdmissionRequest: admissionRequest})
+		}
+		It("Should reject the update while the Node is Ready", func() {
+			resp := handleUpdate("random-user")
+			Expect(resp.AdmissionResponse.Allowed).To(Equal(false))
+			Expect(string(resp.AdmissionResponse.Result.Reason)).To(ContainSubstring("cannot clear MachineRef while the Node of the ByoHost is Ready"))
+		})
+		It("Should reject the update from the manager while the Node is Ready", func() {
+			Expect(handleUpdate(managerServiceAccount).AdmissionResponse.Allowed).To(Equal(false))
+		})
+		It("Should allow the update when the host is marked for cleanup", func() {
+			oldByoHost.Annotations = map[string]string{HostCleanupAnnotation: ""}
+			Expect(handleUpdate("random-user").AdmissionResponse.Allowed).To(Equal(true))
+		})
+		It("Should allow the update when the cleanup annotation is removed together with the MachineRef", func() {
+			oldByoHost.Annotations = map[string]string{HostCleanupAnnotation: ""}
+			byoHost.Annotations = nil
+			Expect(handleUpdate("byoh:host:host1").AdmissionResponse.Allowed).To(Equal(true))
+		})
+		It("Should allow the update when the Node is not Ready", func() {
+			machine.Status.Conditions[0].Status = corev1.ConditionFalse
+			Expect(handleUpdate("random-user").AdmissionResponse.Allowed).To(Equal(true))
+		})
+		It("Should allow the update when the Node is gone", func() {
+			machine.Status.NodeRef = nil
+			machine.Status.Conditions = nil
+			Expect(handleUpdate("random-user").AdmissionResponse.Allowed).To(Equal(true))
+		})
+		It("Should allow the update when the ByoMachine is gone", func() {
+			byoHost.Status.MachineRef = nil
+			oldByoHost.Status.MachineRef.Name = "deleted-byomachine"
+			Expect(handleUpdate("random-user").AdmissionResponse.Allowed).To(Equal(true))
+		})
+		It("Should allow other updates of an attached host", func() {
+			byoHost.Status.MachineRef = oldByoHost.Status.MachineRef.DeepCopy()
+			byoHost.Labels = map[string]string{"foo": "bar"}
+			Expect(handleUpdate("random-user").AdmissionResponse.Allowed).To(Equal(true))
+		})
+	})
 })
@@ -16,6 +16,14 @@ const (
 	// API Server.
 	MachineFinalizer = "byomachine.infrastructure.cluster.x-k8s.io"
 
+	// BootstrapTokenSecretAnnotation records the name of the kube-system bootstrap token secret
+	// generated for a TLS bootstrap join, so it can be deleted once the machine is Ready
+	BootstrapTokenSecretAnnotation = LabelPrefix + "/bootstrap-token-secret"
+
+	// ReleaseHostAnnotation on a ByoMachine releases its current ByoHost, which is cleaned up
+	// like on deletion, and attaches a different host without deleting the ByoMachine
+	ReleaseHostAnnotation = LabelPrefix + "/release"
+
 	// Scale-from-zero and autoscaling annotations
 	// See: https://cluster-api.sigs.k8s.io/tasks/automated-machine-management/autoscaling
 
@@ -52,6 +60,19 @@ const (
 	AutoscalingOptionsMaxNodeStartupTime            = "cluster.x-k8s.io/autoscaling-options-maxnodestartuptime"
 )
 
+// HostSelectionStrategy defines how a host is chosen among the available hosts of the same priority
+type HostSelectionStrategy string
+
+const (
+	// HostSelectionStrategyRoundRobin rotates through the hosts (default)
+	HostSelectionStrategyRoundRobin HostSelectionStrategy = "roundRobin"
+	// HostSelectionStrategyBestFit prefers the host left with the least free capacity once the
+	// capacity requirements of the machine are placed on it, keeping larger hosts for larger machines
+	HostSelectionStrategyBestFit HostSelectionStrategy = "bestFit"
+	// HostSelectionStrategyMostFree prefers the host left with the most free capacity
+	HostSelectionStrategyMostFree HostSelectionStrategy = "mostFree"
+)
+
 // ByoMachineSpec defines the desired state of ByoMachine
 type ByoMachineSpec struct {
 	// Label Selector to choose the byohost
@@ -87,6 +108,7 @@ type ByoMachineSpec struct {
 
 	// KubernetesVersion is the K8s version for binaries (only for TLSBootstrap mode).
 	// If not specified, it will be derived from the Machine or Cluster spec.
+	// It is normalized to the vX.Y.Z form by the webhook, e.g. 1.29.0 becomes v1.29.0.
 	// +optional
 	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
 
@@ -97,10 +119,29 @@ type ByoMachineSpec struct {
 	// +optional
 	ManageKubeProxy bool `json:"manageKubeProxy,omitempty"`
 
+	// DisableKubeProxy skips kube-proxy entirely on the host, e.g. for eBPF dataplanes like
+	// Cilium's kube-proxy replacement. The Agent writes no kube-proxy configuration, kubeconfig
+	// or unit and ManageKubeProxy is treated as false.
+	// +optional
+	DisableKubeProxy bool `json:"disableKubeProxy,omitempty"`
+
 	// CapacityRequirements specifies the minimum capacity required for this machine.
-	// The scheduler will only select hosts that have at least this capacity.
+	// The scheduler will only select hosts that have at least this capacity left over their reserved capacity.
 	// +optional
 	CapacityRequirements map[corev1.ResourceName]resource.Quantity `json:"capacityRequirements,omitempty"`
+
+	// RequiredArchitecture restricts host selection to hosts reporting this architecture
+	// in their host details, e.g. amd64 or arm64. Hosts of any architecture can be selected if not set.
+	// +optional
+	RequiredArchitecture string `json:"requiredArchitecture,omitempty"`
+
+	// SelectionStrategy is how a host is chosen among the available hosts of the highest priority.
+	// bestFit and mostFree compare the capacity of the hosts minus their ReservedCapacity left over once
+	// the CapacityRequirements are placed on them, over the required resources, or cpu and memory without
+	// requirements. Hosts fitting equally well, e.g. of equal capacity, are rotated through like with roundRobin, the default.
+	// +kubebuilder:validation:Enum=roundRobin;bestFit;mostFree
+	// +optional
+	SelectionStrategy HostSelectionStrategy `json:"selectionStrategy,omitempty"`
 }
 
 // NetworkStatus provides information about one of a VM's networks.
@@ -0,0 +1,203 @@
+// Copyright 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//+kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-byomachine,mutating=false,failurePolicy=ignore,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=byomachines;byomachinetemplates,verbs=create,versions=v1beta1,name=vbyomachine.kb.io,admissionReviewVersions={v1,v1beta1}
+
+// +k8s:deepcopy-gen=false
+// ByoMachineValidator validates ByoMachines and ByoMachineTemplates
+type ByoMachineValidator struct {
+	Client  client.Client
+	decoder *admission.Decoder
+}
+
+// Handle handles all the requests for ByoMachine and ByoMachineTemplate resources.
+// Requests are never rejected, but a warning is returned when the requested
+// CapacityRequirements cannot be satisfied by any registered ByoHost.
+func (v *ByoMachineValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != v1.Create {
+		return admission.Allowed("")
+	}
+
+	var requirements map[corev1.ResourceName]resource.Quantity
+	switch req.Kind.Kind {
+	case "ByoMachineTemplate":
+		byoMachineTemplate := &ByoMachineTemplate{}
+		if err := v.decoder.Decode(req, byoMachineTemplate); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		requirements = byoMachineTemplate.Spec.Template.Spec.CapacityRequirements
+	default:
+		byoMachine := &ByoMachine{}
+		if err := v.decoder.Decode(req, byoMachine); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		requirements = byoMachine.Spec.CapacityRequirements
+	}
+	if len(requirements) == 0 {
+		return admission.Allowed("")
+	}
+
+	hosts := &ByoHostList{}
+	if err := v.Client.List(ctx, hosts); err != nil {
+		// Warnings are best effort, never block the request on a lookup failure
+		return admission.Allowed("")
+	}
+	return admission.Allowed("").WithWarnings(capacityWarnings(hosts.Items, requirements)...)
+}
+
+// capacityWarnings returns the warnings for capacity requirements that no host
+// can satisfy, listing the shortfall against the largest registered capacity.
+// No warnings are returned when no hosts are registered yet.
+func capacityWarnings(hosts []ByoHost, requirements map[corev1.ResourceName]resource.Quantity) []string {
+	if len(hosts) == 0 {
+		return nil
+	}
+	for i := range hosts {
+		if hosts[i].MatchesRequirements(nil, requirements) {
+			return nil
+		}
+	}
+
+	names := make([]string, 0, len(requirements))
+	for name := range requirements {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	var warnings []string
+	for _, name := range names {
+		required := requirements[corev1.ResourceName(name)]
+		var largest *resource.Quantity
+		for i := range hosts {
+			if available, ok := hosts[i].Spec.Capacity[corev1.ResourceName(name)]; ok {
+				if largest == nil || available.Cmp(*largest) > 0 {
+					largest = &available
+				}
+			}
+		}
+		switch {
+		case largest == nil:
+			warnings = append(warnings, fmt.Sprintf("capacityRequirements %s=%s: no registered ByoHost reports %s capacity", name, required.String(), name))
+		case required.Cmp(*largest) > 0:
+			shortfall := required.DeepCopy()
+			shortfall.Sub(*largest)
+			warnings = append(warnings, fmt.Sprintf("capacityRequirements %s=%s exceeds the largest registered ByoHost capacity %s by %s", name, required.String(), largest.String(), shortfall.String()))
+		}
+	}
+	if len(warnings) == 0 {
+		warnings = append(warnings, "capacityRequirements cannot be satisfied by any single registered ByoHost")
+	}
+	return warnings
+}
+
+// InjectDecoder injects the decoder.
+func (v *ByoMachineValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+//+kubebuilder:webhook:path=/mutate-infrastructure-cluster-x-k8s-io-v1beta1-byomachine,mutating=true,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=byomachines;byomachinetemplates,verbs=create;update,versions=v1beta1,name=mbyomachine.kb.io,admissionReviewVersions={v1,v1beta1}
+
+// +k8s:deepcopy-gen=false
+// ByoMachineMutator normalizes the KubernetesVersion of ByoMachines and ByoMachineTemplates
+type ByoMachineMutator struct {
+	decoder *admission.Decoder
+}
+
+var (
+	kubernetesVersionRegex      = regexp.MustCompile(`^[vV]?(\d+\.\d+\.\d+(?:-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?)$`)
+	kubernetesMinorVersionRegex = regexp.MustCompile(`^[vV]?\d+\.\d+$`)
+)
+
+// NormalizeKubernetesVersion returns the canonical vX.Y.Z form of a Kubernetes version, which is used
+// as is in the download URLs of the binaries. A version without the patch number, e.g. 1.29, is rejected
+// since it can not be resolved to a patch release. An empty version is kept empty.
+func NormalizeKubernetesVersion(version string) (string, error) {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return "", nil
+	}
+	if kubernetesMinorVersionRegex.MatchString(version) {
+		return "", fmt.Errorf("kubernetesVersion %q has no patch version, specify the full version e.g. v%s.0", version, strings.TrimLeft(version, "vV"))
+	}
+	match := kubernetesVersionRegex.FindStringSubmatch(version)
+	if match == nil {
+		return "", fmt.Errorf("kubernetesVersion %q is invalid, it must be in the form vX.Y.Z e.g. v1.29.0", version)
+	}
+	return "v" + match[1], nil
+}
+
+// Handle normalizes the KubernetesVersion of ByoMachine and ByoMachineTemplate requests to vX.Y.Z,
+// and denies the requests whose KubernetesVersion can not be normalized. An update keeping the
+// stored KubernetesVersion is allowed as is, so objects created before the normalization can
+// still be updated, e.g. to remove their finalizers.
+func (m *ByoMachineMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	obj, version, err := m.decodeKubernetesVersion(req.Kind.Kind, req.Object)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	normalized, err := NormalizeKubernetesVersion(*version)
+	if err != nil {
+		if req.Operation == v1.Update {
+			_, oldVersion, oldErr := m.decodeKubernetesVersion(req.Kind.Kind, req.OldObject)
+			if oldErr == nil && *oldVersion == *version {
+				return admission.Allowed("")
+			}
+		}
+		return admission.Denied(err.Error())
+	}
+	if normalized == *version {
+		return admission.Allowed("")
+	}
+	*version = normalized
+
+	marshaled, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// decodeKubernetesVersion decodes a ByoMachine or ByoMachineTemplate and returns it with its KubernetesVersion
+func (m *ByoMachineMutator) decodeKubernetesVersion(kind string, raw runtime.RawExtension) (interface{}, *string, error) {
+	switch kind {
+	case "ByoMachineTemplate":
+		byoMachineTemplate := &ByoMachineTemplate{}
+		if err := m.decoder.DecodeRaw(raw, byoMachineTemplate); err != nil {
+			return nil, nil, err
+		}
+		return byoMachineTemplate, &byoMachineTemplate.Spec.Template.Spec.KubernetesVersion, nil
+	default:
+		byoMachine := &ByoMachine{}
+		if err := m.decoder.DecodeRaw(raw, byoMachine); err != nil {
+			return nil, nil, err
+		}
+		return byoMachine, &byoMachine.Spec.KubernetesVersion, nil
+	}
+}
+
+// InjectDecoder injects the decoder.
+func (m *ByoMachineMutator) InjectDecoder(d *admission.Decoder) error {
+	m.decoder = d
+	return nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("ByomachineWebhook/Unit", func() {
+	var (
+		ctx     context.Context
+		schema  *runtime.Scheme
+		decoder *admission.Decoder
+		v       *ByoMachineValidator
+	)
+
+	newHost := func(name, cpu, memory string) *ByoHost {
+		return &ByoHost{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: ByoHostSpec{
+				Capacity: map[corev1.ResourceName]resource.Quantity{
+					corev1.ResourceCPU:    resource.MustParse(cpu),
+					corev1.ResourceMemory: resource.MustParse(memory),
+				},
+			},
+		}
+	}
+
+	createRequest := func(kind string, obj runtime.Object) admission.Request {
+		raw, err := json.Marshal(obj)
+		Expect(err).ShouldNot(HaveOccurred())
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Kind:      metav1.GroupVersionKind{Group: GroupVersion.Group, Version: GroupVersion.Version, Kind: kind},
+			Object:    runtime.RawExtension{Raw: raw, Object: obj},
+		}}
+	}
+
+	BeforeEach(func() {
+		ctx = context.TODO()
+		schema = runtime.NewScheme()
+		Expect(AddToScheme(schema)).To(Succeed())
+		decoder, _ = admission.NewDecoder(schema)
+		v = &ByoMachineValidator{
+			Client: fake.NewClientBuilder().WithScheme(schema).WithObjects(
+				newHost("small", "2", "4Gi"),
+				newHost("large", "16", "64Gi"),
+			).Build(),
+			decoder: decoder,
+		}
+	})
+
+	Context("When a ByoMachine is created", func() {
+		It("Should allow without warnings when a host satisfies the requirements", func() {
+			byoMachine := &ByoMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"},
+				Spec: ByoMachineSpec{CapacityRequirements: map[corev1.ResourceName]resource.Quantity{
+					corev1.ResourceCPU:    resource.MustParse("8"),
+					corev1.ResourceMemory: resource.MustParse("32Gi"),
+				}},
+			}
+			resp := v.Handle(ctx, createRequest("ByoMachine", byoMachine))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(BeEmpty())
+		})
+
+		It("Should allow with a shortfall warning when no host has enough capacity", func() {
+			byoMachine := &ByoMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"},
+				Spec: ByoMachineSpec{CapacityRequirements: map[corev1.ResourceName]resource.Quantity{
+					corev1.ResourceCPU:    resource.MustParse("8"),
+					corev1.ResourceMemory: resource.MustParse("128Ti"),
+				}},
+			}
+			resp := v.Handle(ctx, createRequest("ByoMachine", byoMachine))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(HaveLen(1))
+			Expect(resp.Warnings[0]).To(ContainSubstring("memory=128Ti exceeds the largest registered ByoHost capacity 64Gi"))
+		})
+
+		It("Should warn when no single host satisfies all requirements", func() {
+			Expect(v.Client.Create(ctx, newHost("fat", "1", "256Gi"))).To(Succeed())
+			byoMachine := &ByoMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"},
+				Spec: ByoMachineSpec{CapacityRequirements: map[corev1.ResourceName]resource.Quantity{
+					corev1.ResourceCPU:    resource.MustParse("16"),
+					corev1.ResourceMemory: resource.MustParse("128Gi"),
+				}},
+			}
+			resp := v.Handle(ctx, createRequest("ByoMachine", byoMachine))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(ConsistOf("capacityRequirements cannot be satisfied by any single registered ByoHost"))
+		})
+
+		It("Should warn when no host reports the requested resource", func() {
+			byoMachine := &ByoMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"},
+				Spec: ByoMachineSpec{CapacityRequirements: map[corev1.ResourceName]resource.Quantity{
+					"nvidia.com/gpu": resource.MustParse("1"),
+				}},
+			}
+			resp := v.Handle(ctx, createRequest("ByoMachine", byoMachine))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(ConsistOf(ContainSubstring("no registered ByoHost reports nvidia.com/gpu capacity")))
+		})
+	})
+
+	Context("When a ByoMachineTemplate is created", func() {
+		It("Should allow with a warning for impossible requirements", func() {
+			template := &ByoMachineTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "template", Namespace: "default"},
+				Spec: ByoMachineTemplateSpec{Template: ByoMachineTemplateResource{Spec: ByoMachineSpec{
+					CapacityRequirements: map[corev1.ResourceName]resource.Quantity{
+						corev1.ResourceCPU: resource.MustParse("64"),
+					},
+				}}},
+			}
+			resp := v.Handle(ctx, createRequest("ByoMachineTemplate", template))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(ConsistOf(ContainSubstring("cpu=64 exceeds the largest registered ByoHost capacity 16 by 48")))
+		})
+
+		It("Should allow without warnings for satisfiable requirements", func() {
+			template := &ByoMachineTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "template", Namespace: "default"},
+				Spec: ByoMachineTemplateSpec{Template: ByoMachineTemplateResource{Spec: ByoMachineSpec{
+					CapacityRequirements: map[corev1.ResourceName]resource.Quantity{
+						corev1.ResourceCPU: resource.MustParse("2"),
+					},
+				}}},
+			}
+			resp := v.Handle(ctx, createRequest("ByoMachineTemplate", template))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(BeEmpty())
+		})
+	})
+
+	Context("When the KubernetesVersion of a ByoMachine is normalized", func() {
+		var m *ByoMachineMutator
+
+		newMachine := func(version string) *ByoMachine {
+			return &ByoMachine{
+				ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"},
+				Spec:       ByoMachineSpec{KubernetesVersion: version},
+			}
+		}
+
+		BeforeEach(func() {
+			m = &ByoMachineMutator{decoder: decoder}
+		})
+
+		DescribeTable("Should patch the version to the vX.Y.Z form",
+			func(version string) {
+				resp := m.Handle(ctx, createRequest("ByoMachine", newMachine(version)))
+				Expect(resp.Allowed).To(BeTrue())
+				Expect(resp.Patches).To(HaveLen(1))
+				Expect(resp.Patches[0].Path).To(Equal("/spec/kubernetesVersion"))
+				Expect(resp.Patches[0].Value).To(Equal("v1.29.0"))
+			},
+			Entry("without the v prefix", "1.29.0"),
+			Entry("with an upper case prefix", "V1.29.0"),
+			Entry("with surrounding spaces", " v1.29.0 "),
+		)
+
+		DescribeTable("Should allow the version without patching it",
+			func(version string) {
+				resp := m.Handle(ctx, createRequest("ByoMachine", newMachine(version)))
+				Expect(resp.Allowed).To(BeTrue())
+				Expect(resp.Patches).To(BeEmpty())
+			},
+			Entry("in the canonical form", "v1.29.0"),
+			Entry("with a pre-release", "v1.30.0-rc.1"),
+			Entry("when it is not set", ""),
+		)
+
+		DescribeTable("Should deny the version with guidance",
+			func(version, message string) {
+				resp := m.Handle(ctx, createRequest("ByoMachine", newMachine(version)))
+				Expect(resp.Allowed).To(BeFalse())
+				Expect(resp.Result.Message).To(ContainSubstring(message))
+			},
+			Entry("without a patch version", "1.29", "has no patch version, specify the full version e.g. v1.29.0"),
+			Entry("with the v prefix and without a patch version", "v1.29", "specify the full version e.g. v1.29.0"),
+			Entry("when it is not a version", "latest", "it must be in the form vX.Y.Z"),
+		)
+
+		Context("When a ByoMachine is updated", func() {
+			updateRequest := func(oldVersion, version string) admission.Request {
+				req := createRequest("ByoMachine", newMachine(version))
+				oldRaw, err := json.Marshal(newMachine(oldVersion))
+				Expect(err).ShouldNot(HaveOccurred())
+				req.Operation = admissionv1.Update
+				req.OldObject = runtime.RawExtension{Raw: oldRaw}
+				return req
+			}
+
+			It("Should allow an update keeping a stored version that can not be normalized", func() {
+				resp := m.Handle(ctx, updateRequest("1.29", "1.29"))
+				Expect(resp.Allowed).To(BeTrue())
+				Expect(resp.Patches).To(BeEmpty())
+			})
+
+			It("Should deny an update changing the version to one that can not be normalized", func() {
+				resp := m.Handle(ctx, updateRequest("v1.29.0", "1.30"))
+				Expect(resp.Allowed).To(BeFalse())
+				Expect(resp.Result.Message).To(ContainSubstring("has no patch version"))
+			})
+
+			It("Should normalize the version on update", func() {
+				resp := m.Handle(ctx, updateRequest("1.29", "1.30.1"))
+				Expect(resp.Allowed).To(BeTrue())
+				Expect(resp.Patches).To(HaveLen(1))
+				Expect(resp.Patches[0].Value).To(Equal("v1.30.1"))
+			})
+		})
+
+		It("Should normalize the version of a ByoMachineTemplate", func() {
+			template := &ByoMachineTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "template", Namespace: "default"},
+				Spec: ByoMachineTemplateSpec{Template: ByoMachineTemplateResource{Spec: ByoMachineSpec{
+					KubernetesVersion: "1.28.4",
+				}}},
+			}
+			resp := m.Handle(ctx, createRequest("ByoMachineTemplate", template))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(HaveLen(1))
+			Expect(resp.Patches[0].Path).To(Equal("/spec/template/spec/kubernetesVersion"))
+			Expect(resp.Patches[0].Value).To(Equal("v1.28.4"))
+		})
+	})
+})
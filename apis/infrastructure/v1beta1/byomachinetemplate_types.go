@@ -73,7 +73,7 @@ type ByoMachineTemplateStatus struct {
 	// +optional
 	Capacity corev1.ResourceList `json:"capacity,omitempty"`
 
-	// NodeInfo contains information about the node's architecture and OS.
+	// NodeInfo contains information about the node's architecture, OS, kernel and container runtime.
 	// +optional
 	NodeInfo *NodeInfo `json:"nodeInfo,omitempty"`
 }
@@ -87,6 +87,12 @@ type NodeInfo struct {
 	// OperatingSystem is the operating system of the node (e.g., linux, windows).
 	// +optional
 	OperatingSystem string `json:"operatingSystem,omitempty"`
+	// KernelVersion is the kernel version of the node (e.g., 5.15.0-91-generic).
+	// +optional
+	KernelVersion string `json:"kernelVersion,omitempty"`
+	// ContainerRuntimeVersion is the container runtime name and version of the node (e.g., containerd://1.7.2).
+	// +optional
+	ContainerRuntimeVersion string `json:"containerRuntimeVersion,omitempty"`
 }
 
 //+kubebuilder:object:root=true
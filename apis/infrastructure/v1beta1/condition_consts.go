@@ -17,6 +17,11 @@ const (
 	// components are currently installed on the node.
 	K8sComponentsInstallationSucceeded clusterv1.ConditionType = "K8sComponentsInstallationSucceeded"
 
+	// NodeNameUnique documents that no other ByoHost, e.g. registered by a misconfigured agent in another
+	// namespace, maps to the node name of the host. Hosts whose node name is not unique are not attached
+	// to ByoMachines.
+	NodeNameUnique clusterv1.ConditionType = "NodeNameUnique"
+
 	// WaitingForMachineRefReason indicates when a ByoHost is registered into a capacity pool and
 	// waiting for a byohost.Status.MachineRef to be assigned
 	WaitingForMachineRefReason = "WaitingForMachineRefToBeAssigned"
@@ -52,6 +57,18 @@ const (
 	// K8sComponentsInstallationFailedReason indicates that the installer failed to install all the
 	// k8s components on this host
 	K8sComponentsInstallationFailedReason = "K8sComponentsInstallationFailed"
+
+	// InsufficientDiskSpaceReason indicates that the free space on / or /var of the host is below
+	// the minimum the agent requires before running the install script
+	InsufficientDiskSpaceReason = "InsufficientDiskSpace"
+
+	// ClusterCAMismatchReason indicates that the node joined a cluster whose CA is not the CA of the
+	// bootstrap secret of the host, e.g. because of a misconfigured bootstrap. The node is reset.
+	ClusterCAMismatchReason = "ClusterCAMismatch"
+
+	// DuplicateNodeNameReason indicates that other ByoHosts map to the node name of the host, so their
+	// nodes would conflict on the providerID
+	DuplicateNodeNameReason = "DuplicateNodeName"
 )
 
 // Conditions and Reasons defined on BYOMachine
@@ -73,12 +90,44 @@ const (
 	// and a NodeRef to be assigned
 	WaitingForNodeRefReason = "WaitingForNodeRef"
 
+	// WaitingForKubeletCSRReason indicates that in TLS Bootstrap mode the kubelet of the host did not
+	// request its client certificate yet, e.g. as it is not started or cannot reach the API server
+	WaitingForKubeletCSRReason = "WaitingForKubeletCSR"
+
+	// WaitingForCSRApprovalReason indicates that in TLS Bootstrap mode the client certificate request
+	// of the kubelet is pending approval
+	WaitingForCSRApprovalReason = "WaitingForCSRApproval"
+
+	// KubeletCSRDeniedReason indicates that in TLS Bootstrap mode the client certificate request
+	// of the kubelet was denied
+	KubeletCSRDeniedReason = "KubeletCSRDenied"
+
+	// WaitingForBootstrapSlotReason indicates that the ByoMachine waits for a host to be attached as the
+	// MaxConcurrentBootstraps of the ByoCluster are reached
+	WaitingForBootstrapSlotReason = "WaitingForBootstrapSlot"
+
 	// BYOHostsUnavailableReason indicates that no byohosts are available in the capacity pool
 	BYOHostsUnavailableReason = "BYOHostsUnavailable"
 
 	// InstallationSecretNotAvailableReason indicates that the installation secret is not yet
 	// generated for a given BYOMachine
 	InstallationSecretNotAvailableReason = "InstallationSecretNotAvailable"
+
+	// WorkloadClusterUnreachableReason indicates that no client for the workload cluster could be
+	// acquired yet, e.g. right after a change of the control plane endpoint
+	WorkloadClusterUnreachableReason = "WorkloadClusterUnreachable"
+
+	// BootstrapDataMissingReason indicates that in TLS Bootstrap mode neither a CA certificate nor a
+	// bootstrap kubeconfig could be obtained for the node, the message tells which source to configure
+	BootstrapDataMissingReason = "BootstrapDataMissing"
+
+	// ByoHostReleasedReason indicates that the ByoHost was released on request of the
+	// ReleaseHostAnnotation and a different host is yet to be attached
+	ByoHostReleasedReason = "ByoHostReleased"
+
+	// InvalidProxyConfigurationReason indicates that a proxy annotation of the ByoCluster is malformed,
+	// so the installer config is not created until it is fixed
+	InvalidProxyConfigurationReason = "InvalidProxyConfiguration"
 )
 
 // Reasons common to all Byo Resources
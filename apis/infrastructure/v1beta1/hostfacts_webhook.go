@@ -0,0 +1,76 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	v1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// The namespaceSelector on the host facts label is set by config/default/hostfacts_namespaceselector_patch.yaml,
+// so only the ConfigMaps of the namespaces of the host facts are validated
+//+kubebuilder:webhook:path=/validate-v1-configmap-host-facts,mutating=false,failurePolicy=fail,sideEffects=None,groups="",resources=configmaps,verbs=create;update,versions=v1,name=vhostfacts.kb.io,admissionReviewVersions={v1,v1beta1}
+
+const (
+	// agentGroup is the group of the users the agents authenticate as
+	agentGroup = "byoh:hosts"
+	// agentUsernamePrefix prefixes the host name in the username of an agent
+	agentUsernamePrefix = "byoh:host:"
+)
+
+// HostFactsConfigMapName returns the name of the ConfigMap of the facts of the host
+func HostFactsConfigMapName(hostName string) string {
+	return hostName + "-facts"
+}
+
+// +k8s:deepcopy-gen=false
+// HostFactsValidator validates the ConfigMaps the agents write in the namespaces of the host facts. The
+// agents share the byohost-facts-writer-clusterrole, so an agent is only allowed to write the facts
+// ConfigMap of its own host.
+type HostFactsValidator struct{}
+
+// Handle handles the requests for the ConfigMaps of the namespaces of the host facts
+func (v *HostFactsValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != v1.Create && req.Operation != v1.Update {
+		return admission.Allowed("")
+	}
+	if !isAgent(req.UserInfo) {
+		return admission.Allowed("")
+	}
+	userName := req.UserInfo.Username
+	if !strings.HasPrefix(userName, agentUsernamePrefix) {
+		return admission.Denied(fmt.Sprintf("%s is not a valid agent username", userName))
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := json.Unmarshal(req.Object.Raw, configMap); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	name := HostFactsConfigMapName(strings.TrimPrefix(userName, agentUsernamePrefix))
+	if configMap.Name != name {
+		return admission.Denied(fmt.Sprintf("%s can only write the host facts ConfigMap %s", userName, name))
+	}
+	if configMap.Labels[HostFactsLabel] != "true" {
+		return admission.Denied(fmt.Sprintf("the host facts ConfigMap %s must be labeled %s=true", name, HostFactsLabel))
+	}
+	return admission.Allowed("")
+}
+
+// isAgent checks if the user is an agent
+func isAgent(userInfo authenticationv1.UserInfo) bool {
+	for _, group := range userInfo.Groups {
+		if group == agentGroup {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("HostFactsWebhook/Unit", func() {
+	var (
+		v         *HostFactsValidator
+		configMap *corev1.ConfigMap
+		userInfo  authenticationv1.UserInfo
+	)
+
+	BeforeEach(func() {
+		v = &HostFactsValidator{}
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "host1-facts",
+				Namespace: "inventory",
+				Labels:    map[string]string{HostFactsLabel: "true"},
+			},
+			Data: map[string]string{"os": "Ubuntu 22.04"},
+		}
+		userInfo = authenticationv1.UserInfo{Username: "byoh:host:host1", Groups: []string{agentGroup}}
+	})
+
+	handle := func(operation admissionv1.Operation) admission.Response {
+		raw, err := json.Marshal(configMap)
+		Expect(err).NotTo(HaveOccurred())
+		return v.Handle(context.TODO(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: operation,
+			UserInfo:  userInfo,
+			Object:    runtime.RawExtension{Raw: raw},
+		}})
+	}
+
+	It("Should allow an agent to write the facts ConfigMap of its host", func() {
+		Expect(handle(admissionv1.Create).Allowed).To(BeTrue())
+		Expect(handle(admissionv1.Update).Allowed).To(BeTrue())
+	})
+
+	It("Should reject an agent writing the facts ConfigMap of another host", func() {
+		configMap.Name = "host2-facts"
+		resp := handle(admissionv1.Update)
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(string(resp.Result.Reason)).To(Equal("byoh:host:host1 can only write the host facts ConfigMap host1-facts"))
+	})
+
+	It("Should reject an agent writing any other ConfigMap", func() {
+		configMap.Name = "kube-root-ca.crt"
+		Expect(handle(admissionv1.Create).Allowed).To(BeFalse())
+	})
+
+	It("Should reject a facts ConfigMap without the host facts label", func() {
+		configMap.Labels = nil
+		resp := handle(admissionv1.Create)
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(string(resp.Result.Reason)).To(ContainSubstring("must be labeled " + HostFactsLabel + "=true"))
+	})
+
+	It("Should reject a user of the agent group without an agent username", func() {
+		userInfo.Username = "someone"
+		resp := handle(admissionv1.Create)
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(string(resp.Result.Reason)).To(Equal("someone is not a valid agent username"))
+	})
+
+	It("Should allow the other users", func() {
+		userInfo = authenticationv1.UserInfo{Username: "admin", Groups: []string{"system:masters"}}
+		configMap.Name = "host2-facts"
+		Expect(handle(admissionv1.Update).Allowed).To(BeTrue())
+	})
+})
@@ -22,6 +22,65 @@ type K8sInstallerConfigSpec struct {
 
 	// BundleType is the type of bundle (e.g. k8s) that needs to be downloaded
 	BundleType string `json:"bundleType"`
+
+	// CNIPluginsVersion pins the version of the CNI plugins the install script downloads in online mode,
+	// e.g. v1.5.1. Overrides the CNIPluginsVersion of the ByoCluster. Defaults to v1.4.0.
+	// +kubebuilder:validation:Pattern=`^v\d+\.\d+\.\d+$`
+	// +optional
+	CNIPluginsVersion string `json:"cniPluginsVersion,omitempty"`
+
+	// ContainerdVersion pins the version of containerd the install script downloads in online mode,
+	// e.g. v1.7.22. Defaults to v1.7.0.
+	// +kubebuilder:validation:Pattern=`^v\d+\.\d+\.\d+$`
+	// +optional
+	ContainerdVersion string `json:"containerdVersion,omitempty"`
+
+	// FirewallMode is how the install script handles the ufw firewall of the host. OpenPorts, the default,
+	// only opens the FirewallPorts and allows routed pod traffic. Disable disables the firewall. The uninstall
+	// script only reverts the changes the install script recorded.
+	// +kubebuilder:validation:Enum=OpenPorts;Disable
+	// +optional
+	FirewallMode string `json:"firewallMode,omitempty"`
+
+	// FirewallPorts are the ports the install script opens in OpenPorts mode, e.g. 6443/tcp or 30000:32767/udp.
+	// Defaults to the ports of the Kubernetes components, e.g. the kubelet port 10250 and the NodePort range,
+	// and of the CNI overlays, i.e. VXLAN 8472/udp, Geneve 6081/udp and BGP 179/tcp.
+	// +kubebuilder:validation:items:Pattern=`^[0-9]+(:[0-9]+)?/(tcp|udp)$`
+	// +optional
+	FirewallPorts []string `json:"firewallPorts,omitempty"`
+
+	// KernelModules are loaded by the install script in addition to overlay and br_netfilter, e.g. ip_vs
+	// for kube-proxy in IPVS mode or the modules of a GPU or storage driver. The install fails when one
+	// of them is not available on the host. They are loaded again on boot.
+	// +kubebuilder:validation:items:Pattern=`^[A-Za-z0-9_-]+$`
+	// +optional
+	KernelModules []string `json:"kernelModules,omitempty"`
+
+	// RuncVersion pins the version of runc the install script downloads in online mode, e.g. v1.1.14.
+	// Defaults to v1.1.10.
+	// +kubebuilder:validation:Pattern=`^v\d+\.\d+\.\d+$`
+	// +optional
+	RuncVersion string `json:"runcVersion,omitempty"`
+
+	// RuntimeHandlers are containerd runtime handlers added by the install script next to runc, e.g. gVisor
+	// or Kata Containers. The runtime must be installed on the host, and a RuntimeClass whose handler is the
+	// name of the runtime handler selects it for a pod.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	RuntimeHandlers []ContainerdRuntimeHandler `json:"runtimeHandlers,omitempty"`
+}
+
+// ContainerdRuntimeHandler is a runtime handler of containerd
+type ContainerdRuntimeHandler struct {
+	// Name of the runtime handler, the handler of the RuntimeClasses selecting it, e.g. runsc
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// RuntimeType is the containerd shim of the runtime handler, e.g. io.containerd.runsc.v1 for gVisor
+	// or io.containerd.kata.v2 for Kata Containers
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9_.-]+$`
+	RuntimeType string `json:"runtimeType"`
 }
 
 // K8sInstallerConfigStatus defines the observed state of K8sInstallerConfig
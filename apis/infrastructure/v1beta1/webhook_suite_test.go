@@ -144,6 +144,9 @@ var _ = BeforeSuite(func() {
 	Expect(k8sClient).NotTo(BeNil())
 
 	mgr.GetWebhookServer().Register("/validate-infrastructure-cluster-x-k8s-io-v1beta1-byohost", &webhook.Admission{Handler: &byohv1beta1.ByoHostValidator{}})
+	mgr.GetWebhookServer().Register("/validate-infrastructure-cluster-x-k8s-io-v1beta1-byohost-status", &webhook.Admission{Handler: &byohv1beta1.ByoHostValidator{}})
+	mgr.GetWebhookServer().Register("/validate-infrastructure-cluster-x-k8s-io-v1beta1-byomachine", &webhook.Admission{Handler: &byohv1beta1.ByoMachineValidator{Client: k8sClient}})
+	mgr.GetWebhookServer().Register("/mutate-infrastructure-cluster-x-k8s-io-v1beta1-byomachine", &webhook.Admission{Handler: &byohv1beta1.ByoMachineMutator{}})
 
 	//+kubebuilder:scaffold:webhook
 
@@ -277,7 +277,7 @@ func (in *ByoCluster) DeepCopyInto(out *ByoCluster) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -335,6 +335,20 @@ func (in *ByoClusterList) DeepCopyObject() runtime.Object {
 func (in *ByoClusterSpec) DeepCopyInto(out *ByoClusterSpec) {
 	*out = *in
 	out.ControlPlaneEndpoint = in.ControlPlaneEndpoint
+	if in.DefaultNodeLabels != nil {
+		in, out := &in.DefaultNodeLabels, &out.DefaultNodeLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.DefaultNodeTaints != nil {
+		in, out := &in.DefaultNodeTaints, &out.DefaultNodeTaints
+		*out = make([]v1.Taint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ByoClusterSpec.
@@ -364,6 +378,11 @@ func (in *ByoClusterStatus) DeepCopyInto(out *ByoClusterStatus) {
 			(*out)[key] = *val.DeepCopy()
 		}
 	}
+	if in.HostPool != nil {
+		in, out := &in.HostPool, &out.HostPool
+		*out = new(HostPoolSummary)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ByoClusterStatus.
@@ -438,7 +457,7 @@ func (in *ByoClusterTemplateList) DeepCopyObject() runtime.Object {
 func (in *ByoClusterTemplateResource) DeepCopyInto(out *ByoClusterTemplateResource) {
 	*out = *in
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ByoClusterTemplateResource.
@@ -539,11 +558,28 @@ func (in *ByoHostSpec) DeepCopyInto(out *ByoHostSpec) {
 		*out = new(v1.ObjectReference)
 		**out = **in
 	}
+	if in.InstallEnv != nil {
+		in, out := &in.InstallEnv, &out.InstallEnv
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.UninstallationScript != nil {
 		in, out := &in.UninstallationScript, &out.UninstallationScript
 		*out = new(string)
 		**out = **in
 	}
+	if in.KubeletLogVerbosity != nil {
+		in, out := &in.KubeletLogVerbosity, &out.KubeletLogVerbosity
+		*out = new(int32)
+		**out = **in
+	}
+	if in.KubeletTLSCipherSuites != nil {
+		in, out := &in.KubeletTLSCipherSuites, &out.KubeletTLSCipherSuites
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Capacity != nil {
 		in, out := &in.Capacity, &out.Capacity
 		*out = make(map[v1.ResourceName]resource.Quantity, len(*in))
@@ -551,6 +587,13 @@ func (in *ByoHostSpec) DeepCopyInto(out *ByoHostSpec) {
 			(*out)[key] = val.DeepCopy()
 		}
 	}
+	if in.ReservedCapacity != nil {
+		in, out := &in.ReservedCapacity, &out.ReservedCapacity
+		*out = make(map[v1.ResourceName]resource.Quantity, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
 	if in.Labels != nil {
 		in, out := &in.Labels, &out.Labels
 		*out = make(map[string]string, len(*in))
@@ -605,6 +648,15 @@ func (in *ByoHostStatus) DeepCopyInto(out *ByoHostStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.LastForceCleanup != nil {
+		in, out := &in.LastForceCleanup, &out.LastForceCleanup
+		*out = new(ForceCleanupRecord)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastHeartbeatTime != nil {
+		in, out := &in.LastHeartbeatTime, &out.LastHeartbeatTime
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ByoHostStatus.
@@ -873,6 +925,39 @@ func (in *ByoMachineTemplateStatus) DeepCopy() *ByoMachineTemplateStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerdRuntimeHandler) DeepCopyInto(out *ContainerdRuntimeHandler) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerdRuntimeHandler.
+func (in *ContainerdRuntimeHandler) DeepCopy() *ContainerdRuntimeHandler {
+	if in == nil {
+		return nil
+	}
+	out := new(ContainerdRuntimeHandler)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ForceCleanupRecord) DeepCopyInto(out *ForceCleanupRecord) {
+	*out = *in
+	in.Timestamp.DeepCopyInto(&out.Timestamp)
+	out.Timeout = in.Timeout
+	out.Elapsed = in.Elapsed
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForceCleanupRecord.
+func (in *ForceCleanupRecord) DeepCopy() *ForceCleanupRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(ForceCleanupRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HostInfo) DeepCopyInto(out *HostInfo) {
 	*out = *in
@@ -888,12 +973,27 @@ func (in *HostInfo) DeepCopy() *HostInfo {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostPoolSummary) DeepCopyInto(out *HostPoolSummary) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostPoolSummary.
+func (in *HostPoolSummary) DeepCopy() *HostPoolSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(HostPoolSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *K8sInstallerConfig) DeepCopyInto(out *K8sInstallerConfig) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -950,6 +1050,21 @@ func (in *K8sInstallerConfigList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *K8sInstallerConfigSpec) DeepCopyInto(out *K8sInstallerConfigSpec) {
 	*out = *in
+	if in.FirewallPorts != nil {
+		in, out := &in.FirewallPorts, &out.FirewallPorts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.KernelModules != nil {
+		in, out := &in.KernelModules, &out.KernelModules
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RuntimeHandlers != nil {
+		in, out := &in.RuntimeHandlers, &out.RuntimeHandlers
+		*out = make([]ContainerdRuntimeHandler, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new K8sInstallerConfigSpec.
@@ -987,7 +1102,7 @@ func (in *K8sInstallerConfigTemplate) DeepCopyInto(out *K8sInstallerConfigTempla
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	out.Status = in.Status
 }
 
@@ -1044,7 +1159,7 @@ func (in *K8sInstallerConfigTemplateList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *K8sInstallerConfigTemplateResource) DeepCopyInto(out *K8sInstallerConfigTemplateResource) {
 	*out = *in
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new K8sInstallerConfigTemplateResource.
@@ -1060,7 +1175,7 @@ func (in *K8sInstallerConfigTemplateResource) DeepCopy() *K8sInstallerConfigTemp
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *K8sInstallerConfigTemplateSpec) DeepCopyInto(out *K8sInstallerConfigTemplateSpec) {
 	*out = *in
-	out.Template = in.Template
+	in.Template.DeepCopyInto(&out.Template)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new K8sInstallerConfigTemplateSpec.
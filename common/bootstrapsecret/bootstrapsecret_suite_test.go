@@ -0,0 +1,16 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package bootstrapsecret_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestBootstrapSecret(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "BootstrapSecret Suite")
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package bootstrapsecret
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Default keys of the artifacts of a bootstrap data secret, as laid out by the kubeadm bootstrap provider
+// and the secrets written by hand for TLS Bootstrap mode
+const (
+	// ValueKey holds the bootstrap data, e.g. the cloud-init script
+	ValueKey = "value"
+	// CACertificateKey holds the CA certificate of the workload cluster
+	CACertificateKey = "ca.crt"
+	// BootstrapKubeconfigKey holds the kubeconfig kubelet bootstraps its credentials with
+	BootstrapKubeconfigKey = "bootstrap-kubeconfig"
+	// KubeletConfigKey holds the KubeletConfiguration of the node
+	KubeletConfigKey = "kubelet-config.yaml"
+	// KubeProxyKubeconfigKey holds the kubeconfig of kube-proxy
+	KubeProxyKubeconfigKey = "kube-proxy.kubeconfig"
+)
+
+// artifacts are the default keys of the artifacts a KeyMap may map
+var artifacts = map[string]bool{
+	ValueKey:               true,
+	CACertificateKey:       true,
+	BootstrapKubeconfigKey: true,
+	KubeletConfigKey:       true,
+	KubeProxyKubeconfigKey: true,
+}
+
+// KeyMap maps the default key of an artifact of a bootstrap data secret to the key it is stored under, so the
+// secrets of bootstrap providers with another layout can be read. Artifacts not mapped are read from their default key.
+type KeyMap map[string]string
+
+// ParseKeyMap parses comma separated mappings in the form artifact=key, e.g. ca.crt=ca,bootstrap-kubeconfig=kubeconfig,
+// where artifact is the default key of the artifact
+func ParseKeyMap(value string) (KeyMap, error) {
+	keys := KeyMap{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		artifact, key, found := strings.Cut(pair, "=")
+		artifact, key = strings.TrimSpace(artifact), strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid bootstrap secret key mapping %q, expect artifact=key", pair)
+		}
+		if _, ok := keys[artifact]; ok {
+			return nil, fmt.Errorf("bootstrap secret artifact %q is mapped twice", artifact)
+		}
+		keys[artifact] = key
+	}
+	if err := keys.Validate(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Validate checks the artifacts are known and mapped to valid secret keys
+func (m KeyMap) Validate() error {
+	for artifact, key := range m {
+		if !artifacts[artifact] {
+			return fmt.Errorf("unknown bootstrap secret artifact %q, expect one of %s, %s, %s, %s or %s", artifact,
+				ValueKey, CACertificateKey, BootstrapKubeconfigKey, KubeletConfigKey, KubeProxyKubeconfigKey)
+		}
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			return fmt.Errorf("invalid key %q of bootstrap secret artifact %q: %s", key, artifact, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// Key returns the key the artifact is stored under
+func (m KeyMap) Key(artifact string) string {
+	if key, ok := m[artifact]; ok {
+		return key
+	}
+	return artifact
+}
+
+// Get returns the non-empty data of the artifact in the secret, and whether it was found
+func (m KeyMap) Get(secret *corev1.Secret, artifact string) ([]byte, bool) {
+	data, ok := secret.Data[m.Key(artifact)]
+	if !ok || len(data) == 0 {
+		return nil, false
+	}
+	return data, true
+}
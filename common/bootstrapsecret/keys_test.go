@@ -0,0 +1,95 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package bootstrapsecret_test
+
+import (
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common/bootstrapsecret"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Bootstrap secret keys", func() {
+	Context("When parsing a key map", func() {
+		It("should parse comma separated mappings", func() {
+			keys, err := bootstrapsecret.ParseKeyMap(" ca.crt=ca, bootstrap-kubeconfig=kubeconfig,")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(Equal(bootstrapsecret.KeyMap{
+				bootstrapsecret.CACertificateKey:       "ca",
+				bootstrapsecret.BootstrapKubeconfigKey: "kubeconfig",
+			}))
+		})
+
+		It("should parse an empty value", func() {
+			Expect(bootstrapsecret.ParseKeyMap("")).To(BeEmpty())
+		})
+
+		DescribeTable("should reject invalid mappings",
+			func(value, message string) {
+				_, err := bootstrapsecret.ParseKeyMap(value)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("missing key", "ca.crt", "expect artifact=key"),
+			Entry("empty key", "ca.crt=", "expect artifact=key"),
+			Entry("unknown artifact", "token=bootstrap-token", `unknown bootstrap secret artifact "token"`),
+			Entry("invalid key", "ca.crt=ca/crt", `invalid key "ca/crt" of bootstrap secret artifact "ca.crt"`),
+			Entry("artifact mapped twice", "ca.crt=ca,ca.crt=ca.pem", `"ca.crt" is mapped twice`),
+		)
+	})
+
+	Context("When locating the artifacts in a secret", func() {
+		var secret *corev1.Secret
+
+		BeforeEach(func() {
+			secret = &corev1.Secret{Data: map[string][]byte{
+				"userdata":         []byte("#cloud-config"),
+				"ca.pem":           []byte("ca"),
+				"kubeconfig":       []byte("bootstrap kubeconfig"),
+				"kubelet":          []byte("kubelet config"),
+				"proxy-kubeconfig": []byte("kube-proxy kubeconfig"),
+				"ca.crt":           []byte("default ca"),
+			}}
+		})
+
+		It("should locate each artifact under its mapped key", func() {
+			keys := bootstrapsecret.KeyMap{
+				bootstrapsecret.ValueKey:               "userdata",
+				bootstrapsecret.CACertificateKey:       "ca.pem",
+				bootstrapsecret.BootstrapKubeconfigKey: "kubeconfig",
+				bootstrapsecret.KubeletConfigKey:       "kubelet",
+				bootstrapsecret.KubeProxyKubeconfigKey: "proxy-kubeconfig",
+			}
+			Expect(keys.Validate()).To(Succeed())
+
+			for artifact, expected := range map[string]string{
+				bootstrapsecret.ValueKey:               "#cloud-config",
+				bootstrapsecret.CACertificateKey:       "ca",
+				bootstrapsecret.BootstrapKubeconfigKey: "bootstrap kubeconfig",
+				bootstrapsecret.KubeletConfigKey:       "kubelet config",
+				bootstrapsecret.KubeProxyKubeconfigKey: "kube-proxy kubeconfig",
+			} {
+				data, ok := keys.Get(secret, artifact)
+				Expect(ok).To(BeTrue(), artifact)
+				Expect(string(data)).To(Equal(expected), artifact)
+			}
+		})
+
+		It("should locate an artifact not mapped under its default key", func() {
+			var keys bootstrapsecret.KeyMap
+			Expect(keys.Key(bootstrapsecret.CACertificateKey)).To(Equal("ca.crt"))
+			data, ok := keys.Get(secret, bootstrapsecret.CACertificateKey)
+			Expect(ok).To(BeTrue())
+			Expect(string(data)).To(Equal("default ca"))
+
+			_, ok = keys.Get(secret, bootstrapsecret.KubeletConfigKey)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should not find an empty artifact", func() {
+			secret.Data["kubelet-config.yaml"] = []byte{}
+			_, ok := bootstrapsecret.KeyMap{}.Get(secret, bootstrapsecret.KubeletConfigKey)
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
@@ -5,6 +5,7 @@ package bootstraptoken
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
@@ -25,21 +26,58 @@ func GetTokenIDSecretFromBootstrapToken(tokenStr string) (tokenID, tokenSecret s
 	return substrs[1], substrs[2], nil
 }
 
-// GenerateSecretFromBootstrapTokenStr builds the secret object from the token string
-// It also adds default description and auth groups that can be used by the bootstrap-kubeconfig
-func GenerateSecretFromBootstrapToken(tokenStr string, ttl time.Duration) (*v1.Secret, error) {
+// DefaultUsages are the usages of a bootstrap token when none are configured
+var DefaultUsages = []string{"signing", "authentication"}
+
+// Options holds the operator settable usages and groups of a generated bootstrap token.
+// Empty values fall back to the package defaults.
+type Options struct {
+	// Usages are the usages of the token, e.g. authentication, each set as a usage-bootstrap-<usage> key
+	Usages []string
+	// ExtraGroups are the groups the token authenticates as, on top of system:bootstrappers.
+	// Each group must start with system:bootstrappers:
+	ExtraGroups []string
+}
+
+// Validate checks the usages are known and the groups are valid bootstrap token groups
+func (o Options) Validate() error {
+	if err := bootstraputil.ValidateUsages(o.Usages); err != nil {
+		return err
+	}
+	for _, group := range o.ExtraGroups {
+		if err := bootstraputil.ValidateBootstrapGroupName(group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenerateSecretFromBootstrapToken builds the secret object from the token string
+// It also adds the default description, and the configured usages and auth groups that can be used by the bootstrap-kubeconfig
+func GenerateSecretFromBootstrapToken(tokenStr string, ttl time.Duration, opts Options) (*v1.Secret, error) {
 	tokenID, tokenSecret, err := GetTokenIDSecretFromBootstrapToken(tokenStr)
 	if err != nil {
 		return nil, err
 	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if len(opts.Usages) == 0 {
+		opts.Usages = DefaultUsages
+	}
+	if len(opts.ExtraGroups) == 0 {
+		opts.ExtraGroups = []string{infrastructurev1beta1.BootstrapTokenExtraGroups}
+	}
+
 	secretData := map[string][]byte{
-		bootstrapapi.BootstrapTokenIDKey:               []byte(tokenID),
-		bootstrapapi.BootstrapTokenSecretKey:           []byte(tokenSecret),
-		bootstrapapi.BootstrapTokenExpirationKey:       []byte(time.Now().UTC().Add(ttl).Format(time.RFC3339)),
-		bootstrapapi.BootstrapTokenUsageSigningKey:     []byte("true"),
-		bootstrapapi.BootstrapTokenUsageAuthentication: []byte("true"),
-		bootstrapapi.BootstrapTokenDescriptionKey:      []byte(infrastructurev1beta1.BootstrapTokenDescription),
-		bootstrapapi.BootstrapTokenExtraGroupsKey:      []byte(infrastructurev1beta1.BootstrapTokenExtraGroups),
+		bootstrapapi.BootstrapTokenIDKey:          []byte(tokenID),
+		bootstrapapi.BootstrapTokenSecretKey:      []byte(tokenSecret),
+		bootstrapapi.BootstrapTokenExpirationKey:  []byte(time.Now().UTC().Add(ttl).Format(time.RFC3339)),
+		bootstrapapi.BootstrapTokenDescriptionKey: []byte(infrastructurev1beta1.BootstrapTokenDescription),
+		bootstrapapi.BootstrapTokenExtraGroupsKey: []byte(strings.Join(opts.ExtraGroups, ",")),
+	}
+	for _, usage := range opts.Usages {
+		secretData[bootstrapapi.BootstrapTokenUsagePrefix+usage] = []byte("true")
 	}
 
 	bootstrapSecret := &v1.Secret{
@@ -0,0 +1,52 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package bootstraptoken_test
+
+import (
+	"time"
+
+	infrav1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common/bootstraptoken"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
+)
+
+var _ = Describe("Bootstrap token secret", func() {
+	const tokenStr = "abcdef.0123456789abcdef"
+
+	It("should default the usages and groups", func() {
+		secret, err := bootstraptoken.GenerateSecretFromBootstrapToken(tokenStr, time.Minute, bootstraptoken.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(secret.Name).To(Equal("bootstrap-token-abcdef"))
+		Expect(string(secret.Data[bootstrapapi.BootstrapTokenExtraGroupsKey])).To(Equal(infrav1.BootstrapTokenExtraGroups))
+		Expect(secret.Data).To(HaveKeyWithValue(bootstrapapi.BootstrapTokenUsageSigningKey, []byte("true")))
+		Expect(secret.Data).To(HaveKeyWithValue(bootstrapapi.BootstrapTokenUsageAuthentication, []byte("true")))
+	})
+
+	It("should set the configured usages and groups", func() {
+		secret, err := bootstraptoken.GenerateSecretFromBootstrapToken(tokenStr, time.Minute, bootstraptoken.Options{
+			Usages:      []string{"authentication"},
+			ExtraGroups: []string{"system:bootstrappers:byoh:hosts", "system:bootstrappers:byoh:team-a"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(secret.Data[bootstrapapi.BootstrapTokenExtraGroupsKey])).To(Equal("system:bootstrappers:byoh:hosts,system:bootstrappers:byoh:team-a"))
+		Expect(secret.Data).To(HaveKeyWithValue(bootstrapapi.BootstrapTokenUsageAuthentication, []byte("true")))
+		Expect(secret.Data).NotTo(HaveKey(bootstrapapi.BootstrapTokenUsageSigningKey))
+	})
+
+	It("should reject a group outside system:bootstrappers", func() {
+		_, err := bootstraptoken.GenerateSecretFromBootstrapToken(tokenStr, time.Minute, bootstraptoken.Options{
+			ExtraGroups: []string{"system:nodes"},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject an unknown usage", func() {
+		_, err := bootstraptoken.GenerateSecretFromBootstrapToken(tokenStr, time.Minute, bootstraptoken.Options{
+			Usages: []string{"impersonation"},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+})
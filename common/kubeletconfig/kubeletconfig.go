@@ -0,0 +1,363 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package kubeletconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DefaultClusterDNS is the kubeadm default cluster DNS service IP
+	DefaultClusterDNS = "10.96.0.10"
+	// NodeLocalDNSAddress is the link-local address NodeLocal DNSCache listens on
+	NodeLocalDNSAddress = "169.254.20.10"
+	// DefaultClusterDomain is the kubeadm default DNS domain of the cluster
+	DefaultClusterDomain = "cluster.local"
+	// DefaultHealthzBindAddress is the default address the kubelet healthz endpoint binds to
+	DefaultHealthzBindAddress = "127.0.0.1"
+	// DefaultHealthzPort is the default port of the kubelet healthz endpoint
+	DefaultHealthzPort = 10248
+	// DefaultStaticPodPath is the kubeadm default directory kubelet reads static pod manifests from
+	DefaultStaticPodPath = "/etc/kubernetes/manifests"
+)
+
+// DefaultEvictionHard are the hard eviction thresholds of the default KubeletConfiguration
+var DefaultEvictionHard = map[string]string{
+	"imagefs.available": "15%",
+	"memory.available":  "100Mi",
+	"nodefs.available":  "10%",
+	"nodefs.inodesFree": "5%",
+}
+
+// evictionSignals are the eviction signals supported by kubelet
+var evictionSignals = map[string]bool{
+	"memory.available":       true,
+	"nodefs.available":       true,
+	"nodefs.inodesFree":      true,
+	"imagefs.available":      true,
+	"imagefs.inodesFree":     true,
+	"containerfs.available":  true,
+	"containerfs.inodesFree": true,
+	"pid.available":          true,
+}
+
+// Options holds the operator settable values of the default KubeletConfiguration.
+// Empty values fall back to the package defaults.
+type Options struct {
+	// ClusterDNS is the IP of the cluster DNS service
+	ClusterDNS string
+	// ClusterDomain is the DNS domain of the cluster
+	ClusterDomain string
+	// HealthzBindAddress is the address the kubelet healthz endpoint binds to
+	HealthzBindAddress string
+	// HealthzPort is the port of the kubelet healthz endpoint
+	HealthzPort int32
+	// EvictionHard are hard eviction thresholds by signal, e.g. memory.available: 200Mi.
+	// They override the DefaultEvictionHard threshold of the same signal.
+	EvictionHard map[string]string
+	// LogVerbosity is the verbosity of the kubelet logs, higher values log more
+	LogVerbosity int32
+	// StaticPodPath is the directory kubelet reads static pod manifests from
+	StaticPodPath string
+	// TLSMinVersion is the minimum TLS version the kubelet server accepts, e.g. VersionTLS12.
+	// The kubelet default is kept when empty.
+	TLSMinVersion string
+	// TLSCipherSuites are the cipher suites the kubelet server accepts, e.g.
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. The kubelet default is kept when empty.
+	TLSCipherSuites []string
+}
+
+// tlsVersions are the TLS versions supported as the minimum TLS version of kubelet
+var tlsVersions = map[string]bool{
+	"VersionTLS10": true,
+	"VersionTLS11": true,
+	"VersionTLS12": true,
+	"VersionTLS13": true,
+}
+
+// ValidateTLSMinVersion returns an error unless the version is empty or one supported by kubelet, e.g. VersionTLS12
+func ValidateTLSMinVersion(version string) error {
+	if version != "" && !tlsVersions[version] {
+		return fmt.Errorf("unsupported TLS version %q, expect one of VersionTLS10, VersionTLS11, VersionTLS12 or VersionTLS13", version)
+	}
+	return nil
+}
+
+// ValidateTLSCipherSuites returns an error naming the first cipher suite not supported by kubelet, or insecure.
+// Kubelet accepts the IANA names of the cipher suites implemented by Go, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+// those with known security issues, e.g. RC4 or 3DES ones, are rejected.
+func ValidateTLSCipherSuites(cipherSuites []string) error {
+	secure := map[string]bool{}
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = true
+	}
+	insecure := map[string]bool{}
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+	for _, name := range cipherSuites {
+		if insecure[name] {
+			return fmt.Errorf("insecure TLS cipher suite %q", name)
+		}
+		if !secure[name] {
+			return fmt.Errorf("unsupported TLS cipher suite %q", name)
+		}
+	}
+	return nil
+}
+
+// ValidateTLSSettings returns an error unless kubelet starts with the minimum TLS version and the cipher suites.
+// The cipher suites of TLS 1.3 are not configurable, so kubelet rejects cipher suites along with VersionTLS13.
+func ValidateTLSSettings(minVersion string, cipherSuites []string) error {
+	if err := ValidateTLSMinVersion(minVersion); err != nil {
+		return err
+	}
+	if err := ValidateTLSCipherSuites(cipherSuites); err != nil {
+		return err
+	}
+	if minVersion == "VersionTLS13" && len(cipherSuites) > 0 {
+		return fmt.Errorf("TLS cipher suites cannot be set with the minimum TLS version VersionTLS13, its cipher suites are not configurable")
+	}
+	return nil
+}
+
+// ParseTLSCipherSuites parses and validates comma separated cipher suite names, e.g.
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384
+func ParseTLSCipherSuites(value string) ([]string, error) {
+	var cipherSuites []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cipherSuites = append(cipherSuites, name)
+		}
+	}
+	if err := ValidateTLSCipherSuites(cipherSuites); err != nil {
+		return nil, err
+	}
+	return cipherSuites, nil
+}
+
+// renderTLSSettings renders the tlsCipherSuites and tlsMinVersion fields of a KubeletConfiguration,
+// leaving out those not set
+func renderTLSSettings(minVersion string, cipherSuites []string) string {
+	var b strings.Builder
+	if len(cipherSuites) > 0 {
+		b.WriteString("tlsCipherSuites:\n")
+		for _, name := range cipherSuites {
+			fmt.Fprintf(&b, "- %s\n", name)
+		}
+	}
+	if minVersion != "" {
+		fmt.Fprintf(&b, "tlsMinVersion: %s\n", minVersion)
+	}
+	return b.String()
+}
+
+// ParseEvictionHard parses comma separated hard eviction thresholds in the form signal=threshold,
+// e.g. memory.available=200Mi,nodefs.available=5%. A threshold is a quantity or a percentage.
+func ParseEvictionHard(value string) (map[string]string, error) {
+	thresholds := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		signal, threshold, found := strings.Cut(pair, "=")
+		signal, threshold = strings.TrimSpace(signal), strings.TrimSpace(threshold)
+		if !found || threshold == "" {
+			return nil, fmt.Errorf("invalid eviction threshold %q, expect signal=threshold", pair)
+		}
+		if !evictionSignals[signal] {
+			return nil, fmt.Errorf("unsupported eviction signal %q", signal)
+		}
+		if err := validateEvictionThreshold(threshold); err != nil {
+			return nil, fmt.Errorf("invalid threshold of eviction signal %q: %w", signal, err)
+		}
+		thresholds[signal] = threshold
+	}
+	return thresholds, nil
+}
+
+func validateEvictionThreshold(threshold string) error {
+	if percentage, ok := strings.CutSuffix(threshold, "%"); ok {
+		value, err := strconv.ParseFloat(percentage, 64)
+		if err != nil || value < 0 || value > 100 {
+			return fmt.Errorf("percentage %q must be between 0%% and 100%%", threshold)
+		}
+		return nil
+	}
+	quantity, err := resource.ParseQuantity(threshold)
+	if err != nil {
+		return err
+	}
+	if quantity.Sign() < 0 {
+		return fmt.Errorf("quantity %q must not be negative", threshold)
+	}
+	return nil
+}
+
+// renderEvictionHard renders the default thresholds, overridden by the given ones, as the
+// evictionHard map of a KubeletConfiguration, sorted by signal
+func renderEvictionHard(overrides map[string]string) string {
+	thresholds := make(map[string]string, len(DefaultEvictionHard)+len(overrides))
+	for signal, threshold := range DefaultEvictionHard {
+		thresholds[signal] = threshold
+	}
+	for signal, threshold := range overrides {
+		thresholds[signal] = threshold
+	}
+
+	signals := make([]string, 0, len(thresholds))
+	for signal := range thresholds {
+		signals = append(signals, signal)
+	}
+	sort.Strings(signals)
+
+	var b strings.Builder
+	for _, signal := range signals {
+		fmt.Fprintf(&b, "  %s: %s\n", signal, thresholds[signal])
+	}
+	return b.String()
+}
+
+// GenerateDefaultKubeletConfig generates the default KubeletConfiguration used in TLS Bootstrap mode
+// when the target cluster does not provide one. Both the controller and the agent use it, so a node
+// gets the same configuration whichever side generated it.
+func GenerateDefaultKubeletConfig(opts Options) string {
+	if opts.ClusterDNS == "" {
+		opts.ClusterDNS = DefaultClusterDNS
+	}
+	if opts.ClusterDomain == "" {
+		opts.ClusterDomain = DefaultClusterDomain
+	}
+	if opts.HealthzBindAddress == "" {
+		opts.HealthzBindAddress = DefaultHealthzBindAddress
+	}
+	if opts.HealthzPort == 0 {
+		opts.HealthzPort = DefaultHealthzPort
+	}
+	if opts.StaticPodPath == "" {
+		opts.StaticPodPath = DefaultStaticPodPath
+	}
+
+	return fmt.Sprintf(`apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+authentication:
+  anonymous:
+    enabled: false
+  webhook:
+    cacheTTL: 2m0s
+    enabled: true
+  x509:
+    clientCAFile: /etc/kubernetes/pki/ca.crt
+authorization:
+  mode: Webhook
+  webhook:
+    cacheAuthorizedTTL: 5m0s
+    cacheUnauthorizedTTL: 30s
+cgroupDriver: systemd
+clusterDNS:
+- %s
+clusterDomain: %s
+containerLogMaxFiles: 5
+containerLogMaxSize: 10Mi
+contentType: application/vnd.kubernetes.protobuf
+evictionHard:
+%sevictionPressureTransitionPeriod: 5m0s
+fileCheckFrequency: 20s
+healthzBindAddress: %s
+healthzPort: %d
+imageGCHighThresholdPercent: 85
+imageGCLowThresholdPercent: 80
+imageMinimumGCAge: 2m0s
+logging:
+  verbosity: %d
+nodeStatusUpdateFrequency: 10s
+rotateCertificates: true
+runtimeRequestTimeout: 2m0s
+staticPodPath: %s
+streamingConnectionIdleTimeout: 4h0m0s
+syncFrequency: 1m0s
+%svolumeStatsAggPeriod: 1m0s
+`, opts.ClusterDNS, opts.ClusterDomain, renderEvictionHard(opts.EvictionHard), opts.HealthzBindAddress, opts.HealthzPort, opts.LogVerbosity, opts.StaticPodPath,
+		renderTLSSettings(opts.TLSMinVersion, opts.TLSCipherSuites))
+}
+
+// ParseConfigFields parses the top level fields of a YAML component configuration, e.g. a KubeletConfiguration.
+// The name of the component, e.g. kubelet, names the configuration in errors.
+func ParseConfigFields(name, config string) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(config), &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse the %s configuration: %w", name, err)
+	}
+	return fields, nil
+}
+
+// SetConfigFields sets fields of a YAML component configuration, e.g. one provided by the target cluster. The set
+// function changes the parsed fields and returns whether it changed any. An unchanged configuration is returned
+// as is, otherwise its other fields are kept but may be reordered.
+func SetConfigFields(name, config string, set func(fields map[string]interface{}) bool) (string, error) {
+	fields, err := ParseConfigFields(name, config)
+	if err != nil {
+		return "", err
+	}
+	if !set(fields) {
+		return config, nil
+	}
+
+	data, err := yaml.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("failed to render the %s configuration: %w", name, err)
+	}
+	return string(data), nil
+}
+
+// WithLogVerbosity sets the verbosity of the kubelet logs in the given KubeletConfiguration, e.g. one
+// provided by the target cluster. A configuration already set to the verbosity is returned as is.
+func WithLogVerbosity(config string, verbosity int32) (string, error) {
+	return SetConfigFields("kubelet", config, func(fields map[string]interface{}) bool {
+		logging, ok := fields["logging"].(map[string]interface{})
+		if !ok {
+			logging = map[string]interface{}{}
+		}
+		if logging["verbosity"] == float64(verbosity) {
+			return false
+		}
+		logging["verbosity"] = verbosity
+		fields["logging"] = logging
+		return true
+	})
+}
+
+// WithStaticPodPath sets the directory kubelet reads static pod manifests from in the given KubeletConfiguration,
+// e.g. one provided by the target cluster, so it matches the --pod-manifest-path kubelet is started with. A
+// configuration already set to the path is returned as is.
+func WithStaticPodPath(config, path string) (string, error) {
+	return SetConfigFields("kubelet", config, func(fields map[string]interface{}) bool {
+		if fields["staticPodPath"] == path {
+			return false
+		}
+		fields["staticPodPath"] = path
+		return true
+	})
+}
+
+// WithTLSSettings sets the minimum TLS version and the cipher suites of the kubelet server in the given
+// KubeletConfiguration, e.g. one provided by the target cluster. Empty values keep the provided fields.
+func WithTLSSettings(config, minVersion string, cipherSuites []string) (string, error) {
+	return SetConfigFields("kubelet", config, func(fields map[string]interface{}) bool {
+		if minVersion != "" {
+			fields["tlsMinVersion"] = minVersion
+		}
+		if len(cipherSuites) > 0 {
+			fields["tlsCipherSuites"] = cipherSuites
+		}
+		return minVersion != "" || len(cipherSuites) > 0
+	})
+}
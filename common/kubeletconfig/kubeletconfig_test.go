@@ -0,0 +1,227 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package kubeletconfig_test
+
+import (
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common/kubeletconfig"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Default kubelet configuration", func() {
+	Context("When rendering the eviction thresholds", func() {
+		It("should use the defaults when no threshold is configured", func() {
+			config := kubeletconfig.GenerateDefaultKubeletConfig(kubeletconfig.Options{})
+			Expect(config).To(ContainSubstring("evictionHard:\n" +
+				"  imagefs.available: 15%\n" +
+				"  memory.available: 100Mi\n" +
+				"  nodefs.available: 10%\n" +
+				"  nodefs.inodesFree: 5%\n" +
+				"evictionPressureTransitionPeriod"))
+		})
+
+		It("should override the default of the configured signals only", func() {
+			config := kubeletconfig.GenerateDefaultKubeletConfig(kubeletconfig.Options{
+				EvictionHard: map[string]string{"memory.available": "500Mi", "pid.available": "10%"},
+			})
+			Expect(config).To(ContainSubstring("evictionHard:\n" +
+				"  imagefs.available: 15%\n" +
+				"  memory.available: 500Mi\n" +
+				"  nodefs.available: 10%\n" +
+				"  nodefs.inodesFree: 5%\n" +
+				"  pid.available: 10%\n" +
+				"evictionPressureTransitionPeriod"))
+		})
+	})
+
+	Context("When parsing eviction thresholds", func() {
+		It("should parse quantities and percentages", func() {
+			thresholds, err := kubeletconfig.ParseEvictionHard(" memory.available=200Mi, nodefs.available=5.5%,")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(thresholds).To(Equal(map[string]string{"memory.available": "200Mi", "nodefs.available": "5.5%"}))
+		})
+
+		It("should parse an empty value", func() {
+			Expect(kubeletconfig.ParseEvictionHard("")).To(BeEmpty())
+		})
+
+		DescribeTable("should reject invalid thresholds",
+			func(value, message string) {
+				_, err := kubeletconfig.ParseEvictionHard(value)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("missing threshold", "memory.available", "expect signal=threshold"),
+			Entry("empty threshold", "memory.available=", "expect signal=threshold"),
+			Entry("unknown signal", "memory.free=100Mi", `unsupported eviction signal "memory.free"`),
+			Entry("invalid quantity", "memory.available=lots", `invalid threshold of eviction signal "memory.available"`),
+			Entry("negative quantity", "memory.available=-1Mi", "must not be negative"),
+			Entry("percentage above 100", "nodefs.available=150%", "must be between 0% and 100%"),
+		)
+	})
+
+	Context("When setting the log verbosity", func() {
+		It("should render the verbosity into the default configuration", func() {
+			Expect(kubeletconfig.GenerateDefaultKubeletConfig(kubeletconfig.Options{})).To(ContainSubstring("logging:\n  verbosity: 0\n"))
+			Expect(kubeletconfig.GenerateDefaultKubeletConfig(kubeletconfig.Options{LogVerbosity: 4})).To(ContainSubstring("logging:\n  verbosity: 4\n"))
+		})
+
+		It("should set the verbosity of a provided configuration and keep its other fields", func() {
+			config, err := kubeletconfig.WithLogVerbosity("kind: KubeletConfiguration\nlogging:\n  format: json\n  verbosity: 0\nclusterDomain: example.local\n", 6)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(ContainSubstring("logging:\n  format: json\n  verbosity: 6\n"))
+			Expect(config).To(ContainSubstring("clusterDomain: example.local\n"))
+			Expect(config).To(ContainSubstring("kind: KubeletConfiguration\n"))
+		})
+
+		It("should keep a configuration already set to the verbosity", func() {
+			provided := "kind: KubeletConfiguration\nlogging:\n  verbosity: 4\n"
+			Expect(kubeletconfig.WithLogVerbosity(provided, 4)).To(Equal(provided))
+		})
+
+		It("should add the logging section when missing", func() {
+			config, err := kubeletconfig.WithLogVerbosity("kind: KubeletConfiguration\n", 2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(ContainSubstring("logging:\n  verbosity: 2\n"))
+		})
+
+		It("should reject an invalid configuration", func() {
+			_, err := kubeletconfig.WithLogVerbosity("kind: [", 2)
+			Expect(err).To(MatchError(ContainSubstring("failed to parse the kubelet configuration")))
+		})
+	})
+
+	Context("When setting the static pod path", func() {
+		It("should render the default path into the default configuration", func() {
+			Expect(kubeletconfig.GenerateDefaultKubeletConfig(kubeletconfig.Options{})).To(ContainSubstring("staticPodPath: /etc/kubernetes/manifests\n"))
+		})
+
+		It("should render a custom path into the default configuration", func() {
+			config := kubeletconfig.GenerateDefaultKubeletConfig(kubeletconfig.Options{StaticPodPath: "/etc/kubelet.d"})
+			Expect(config).To(ContainSubstring("staticPodPath: /etc/kubelet.d\n"))
+			Expect(config).NotTo(ContainSubstring("/etc/kubernetes/manifests"))
+		})
+
+		It("should set the path of a provided configuration and keep its other fields", func() {
+			config, err := kubeletconfig.WithStaticPodPath("kind: KubeletConfiguration\nstaticPodPath: /etc/kubernetes/manifests\nclusterDomain: example.local\n", "/etc/kubelet.d")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(ContainSubstring("staticPodPath: /etc/kubelet.d\n"))
+			Expect(config).To(ContainSubstring("clusterDomain: example.local\n"))
+		})
+
+		It("should keep a provided configuration already set to the path as is", func() {
+			provided := "kind: KubeletConfiguration\nstaticPodPath: /etc/kubelet.d # custom\n"
+			Expect(kubeletconfig.WithStaticPodPath(provided, "/etc/kubelet.d")).To(Equal(provided))
+		})
+
+		It("should reject an invalid configuration", func() {
+			_, err := kubeletconfig.WithStaticPodPath("kind: [", "/etc/kubelet.d")
+			Expect(err).To(MatchError(ContainSubstring("failed to parse the kubelet configuration")))
+		})
+	})
+
+	Context("When setting the TLS settings", func() {
+		It("should leave them out of the default configuration when not set", func() {
+			config := kubeletconfig.GenerateDefaultKubeletConfig(kubeletconfig.Options{})
+			Expect(config).NotTo(ContainSubstring("tlsMinVersion"))
+			Expect(config).NotTo(ContainSubstring("tlsCipherSuites"))
+		})
+
+		It("should render valid settings into the default configuration", func() {
+			config := kubeletconfig.GenerateDefaultKubeletConfig(kubeletconfig.Options{
+				TLSMinVersion:   "VersionTLS12",
+				TLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+			})
+			Expect(config).To(ContainSubstring("tlsCipherSuites:\n- TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256\n- TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384\ntlsMinVersion: VersionTLS12\nvolumeStatsAggPeriod: 1m0s\n"))
+		})
+
+		It("should set the settings of a provided configuration and keep its other fields", func() {
+			config, err := kubeletconfig.WithTLSSettings("kind: KubeletConfiguration\ntlsMinVersion: VersionTLS10\nclusterDomain: example.local\n",
+				"VersionTLS12", []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(ContainSubstring("tlsMinVersion: VersionTLS12\n"))
+			Expect(config).To(ContainSubstring("tlsCipherSuites:\n- TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256\n"))
+			Expect(config).To(ContainSubstring("clusterDomain: example.local\n"))
+		})
+
+		It("should keep the provided settings when not set", func() {
+			config, err := kubeletconfig.WithTLSSettings("kind: KubeletConfiguration\ntlsMinVersion: VersionTLS12\n", "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(ContainSubstring("tlsMinVersion: VersionTLS12\n"))
+			Expect(config).NotTo(ContainSubstring("tlsCipherSuites"))
+		})
+
+		It("should reject an invalid configuration", func() {
+			_, err := kubeletconfig.WithTLSSettings("kind: [", "VersionTLS12", nil)
+			Expect(err).To(MatchError(ContainSubstring("failed to parse the kubelet configuration")))
+		})
+
+		It("should accept the supported TLS versions", func() {
+			for _, version := range []string{"", "VersionTLS10", "VersionTLS11", "VersionTLS12", "VersionTLS13"} {
+				Expect(kubeletconfig.ValidateTLSMinVersion(version)).To(Succeed())
+			}
+		})
+
+		It("should reject an unsupported TLS version", func() {
+			Expect(kubeletconfig.ValidateTLSMinVersion("TLS1.2")).To(MatchError(ContainSubstring(`unsupported TLS version "TLS1.2"`)))
+		})
+
+		It("should parse comma separated cipher suites", func() {
+			cipherSuites, err := kubeletconfig.ParseTLSCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cipherSuites).To(Equal([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"}))
+		})
+
+		It("should parse an empty value", func() {
+			Expect(kubeletconfig.ParseTLSCipherSuites("")).To(BeEmpty())
+		})
+
+		DescribeTable("should reject invalid cipher suite names",
+			func(value string) {
+				_, err := kubeletconfig.ParseTLSCipherSuites(value)
+				Expect(err).To(MatchError(ContainSubstring("unsupported TLS cipher suite")))
+			},
+			Entry("unknown name", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_FOO"),
+			Entry("OpenSSL name", "ECDHE-RSA-AES128-GCM-SHA256"),
+			Entry("lower case name", "tls_ecdhe_rsa_with_aes_128_gcm_sha256"),
+		)
+
+		It("should reject insecure cipher suites", func() {
+			_, err := kubeletconfig.ParseTLSCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_RSA_WITH_RC4_128_SHA")
+			Expect(err).To(MatchError(`insecure TLS cipher suite "TLS_RSA_WITH_RC4_128_SHA"`))
+			Expect(kubeletconfig.ValidateTLSCipherSuites([]string{"TLS_RSA_WITH_3DES_EDE_CBC_SHA"})).To(MatchError(ContainSubstring("insecure TLS cipher suite")))
+		})
+
+		It("should accept cipher suites along with a minimum TLS version below VersionTLS13", func() {
+			Expect(kubeletconfig.ValidateTLSSettings("VersionTLS12", []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})).To(Succeed())
+			Expect(kubeletconfig.ValidateTLSSettings("VersionTLS13", nil)).To(Succeed())
+			Expect(kubeletconfig.ValidateTLSSettings("", nil)).To(Succeed())
+		})
+
+		It("should reject cipher suites along with the minimum TLS version VersionTLS13", func() {
+			err := kubeletconfig.ValidateTLSSettings("VersionTLS13", []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})
+			Expect(err).To(MatchError(ContainSubstring("cannot be set with the minimum TLS version VersionTLS13")))
+		})
+	})
+
+	Context("When setting the fields of a configuration", func() {
+		It("should return an unchanged configuration as is", func() {
+			provided := "kind: KubeProxyConfiguration # provided\nmode: ipvs\n"
+			Expect(kubeletconfig.SetConfigFields("kube-proxy", provided, func(map[string]interface{}) bool { return false })).To(Equal(provided))
+		})
+
+		It("should render the changed fields and keep the other fields", func() {
+			config, err := kubeletconfig.SetConfigFields("kube-proxy", "kind: KubeProxyConfiguration\nmode: ipvs\n", func(fields map[string]interface{}) bool {
+				fields["hostnameOverride"] = "host1"
+				return true
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(Equal("hostnameOverride: host1\nkind: KubeProxyConfiguration\nmode: ipvs\n"))
+		})
+
+		It("should name the component of an invalid configuration", func() {
+			_, err := kubeletconfig.SetConfigFields("kube-proxy", "kind: [", func(map[string]interface{}) bool { return true })
+			Expect(err).To(MatchError(ContainSubstring("failed to parse the kube-proxy configuration")))
+		})
+	})
+})
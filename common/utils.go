@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -54,12 +55,22 @@ func GunzipData(data []byte) ([]byte, error) {
 	return resB.Bytes(), nil
 }
 
-// RemoveGlob removes glob file as specified path
+// RemoveGlob removes glob file as specified path.
+// It refuses empty and relative paths, globs expanded directly under the root directory,
+// e.g. /* when a misconfigured path variable is empty, and removing any top-level directory.
 func RemoveGlob(path string) error {
+	if err := checkSafeGlob(path); err != nil {
+		return err
+	}
 	contents, err := filepath.Glob(path)
 	if err != nil {
 		return err
 	}
+	for _, item := range contents {
+		if depth := pathDepth(item); depth < 2 {
+			return errors.Errorf("refusing to remove %s matched by %s, it is a top-level directory", item, path)
+		}
+	}
 	for _, item := range contents {
 		err = os.RemoveAll(item)
 		if err != nil {
@@ -69,6 +80,35 @@ func RemoveGlob(path string) error {
 	return nil
 }
 
+// checkSafeGlob rejects the glob patterns whose matches may include the root directory or its
+// direct children, i.e. the patterns with a wildcard in their first path element
+func checkSafeGlob(path string) error {
+	if strings.TrimSpace(path) == "" {
+		return errors.New("refusing to remove an empty path")
+	}
+	if !filepath.IsAbs(path) {
+		return errors.Errorf("refusing to remove %s, the path must be absolute", path)
+	}
+	cleaned := filepath.Clean(path)
+	if cleaned == "/" {
+		return errors.Errorf("refusing to remove %s, it is the root directory", path)
+	}
+	first := strings.SplitN(strings.TrimPrefix(cleaned, "/"), "/", 2)[0]
+	if strings.ContainsAny(first, `*?[\`) {
+		return errors.Errorf("refusing to remove %s, the pattern matches top-level directories", path)
+	}
+	return nil
+}
+
+// pathDepth returns the number of elements of an absolute path, 0 for the root directory
+func pathDepth(path string) int {
+	trimmed := strings.Trim(filepath.Clean(path), "/")
+	if trimmed == "" {
+		return 0
+	}
+	return strings.Count(trimmed, "/") + 1
+}
+
 const (
 	// ProviderIDPrefix is the prefix for BYOH provider IDs
 	ProviderIDPrefix = "byoh://"
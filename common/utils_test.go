@@ -0,0 +1,62 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package common_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RemoveGlob", func() {
+	DescribeTable("Should refuse dangerous patterns",
+		func(pattern, message string) {
+			Expect(common.RemoveGlob(pattern)).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("empty path", "", "empty path"),
+		Entry("blank path", "  ", "empty path"),
+		Entry("relative path", "run/kubeadm/*", "must be absolute"),
+		Entry("root directory", "/", "root directory"),
+		Entry("root directory reached through dot dot", "/run/..", "root directory"),
+		Entry("every top-level directory", "/*", "matches top-level directories"),
+		Entry("an empty path variable", "//*", "matches top-level directories"),
+		Entry("top-level directories with a prefix", "/e*", "matches top-level directories"),
+		Entry("top-level directories through dot dot", "/run/../*/kubeadm", "matches top-level directories"),
+		Entry("a top-level directory", "/etc", "top-level directory"),
+	)
+
+	Context("When the pattern is safe", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+			for _, name := range []string{"kubeadm.yaml", "kubeadm.conf", "kubelet.conf"} {
+				Expect(os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600)).To(Succeed())
+			}
+			Expect(os.MkdirAll(filepath.Join(dir, "manifests", "etcd"), 0o755)).To(Succeed())
+		})
+
+		It("Should remove the files and directories matched by the glob", func() {
+			Expect(common.RemoveGlob(filepath.Join(dir, "*"))).To(Succeed())
+			entries, err := os.ReadDir(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+			Expect(dir).To(BeADirectory())
+		})
+
+		It("Should only remove the files matched by the glob", func() {
+			Expect(common.RemoveGlob(filepath.Join(dir, "kubeadm.*"))).To(Succeed())
+			Expect(filepath.Join(dir, "kubeadm.yaml")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(dir, "kubeadm.conf")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(dir, "kubelet.conf")).To(BeAnExistingFile())
+		})
+
+		It("Should succeed when nothing matches", func() {
+			Expect(common.RemoveGlob(filepath.Join(dir, "missing", "*"))).To(Succeed())
+		})
+	})
+})
@@ -27,6 +27,9 @@ import (
 type BootstrapKubeconfigReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// TokenOptions configure the usages and groups of the bootstrap tokens hosts register with
+	TokenOptions bootstraptoken.Options
 }
 
 const (
@@ -82,7 +85,7 @@ func (r *BootstrapKubeconfigReconciler) Reconcile(ctx context.Context, req ctrl.
 		return ctrl.Result{}, err
 	}
 
-	bootstrapKubeconfigSecret, err := bootstraptoken.GenerateSecretFromBootstrapToken(tokenStr, ttl)
+	bootstrapKubeconfigSecret, err := bootstraptoken.GenerateSecretFromBootstrapToken(tokenStr, ttl, r.TokenOptions)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
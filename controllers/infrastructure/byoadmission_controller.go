@@ -5,23 +5,67 @@ package controllers
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/pem"
 	"strings"
+	"time"
 
+	infrav1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/prometheus/client_golang/prometheus"
 	certv1 "k8s.io/api/certificates/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// CSRApprovalLatency observes the time from the creation of a CSR to its approval,
+// which directly delays the readiness of TLS bootstrapped nodes
+var CSRApprovalLatency = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "byoh_csr_approval_latency_seconds",
+		Help:    "Time from the creation of a CertificateSigningRequest to its approval by the ByoAdmission controller",
+		Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 120, 300},
+	},
+	[]string{"signer"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(CSRApprovalLatency)
+}
+
+// Reasons of the Denied condition of the kubelet CSRs of the nodes backed by a ByoHost
+const (
+	// ByoHostCleaningUpReason is the reason of a CSR denied because the ByoHost of the node is being cleaned up
+	ByoHostCleaningUpReason = "ByoHostCleaningUp"
+	// ByoHostQuarantinedReason is the reason of a CSR denied because the ByoHost of the node is quarantined
+	ByoHostQuarantinedReason = "ByoHostQuarantined"
+	// ByoHostNotBoundReason is the reason of a CSR denied because the ByoHost of the node is not bound to a Machine
+	ByoHostNotBoundReason = "ByoHostNotBound"
+)
+
 // ByoAdmissionReconciler reconciles a ByoAdmission object
 type ByoAdmissionReconciler struct {
 	ClientSet clientset.Interface
+	// Client is used to look up the ByoHost backing a kubelet serving CSR. Its cache must have the
+	// ByoHostNameField index, see IndexByoHostByName.
+	Client client.Client
+	// Namespace restricts the lookup of the ByoHost backing a node to the namespace the hosts are registered in.
+	// All the namespaces are searched when empty.
+	Namespace string
+	// Recorder emits a warning Event on CSRs approved later than SlowApprovalThreshold
+	Recorder record.EventRecorder
+	// SlowApprovalThreshold is the approval latency above which a warning Event is emitted.
+	// No Event is emitted when zero.
+	SlowApprovalThreshold time.Duration
 }
 
 //+kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=create;get;list;watch
@@ -73,13 +117,37 @@ func (r *ByoAdmissionReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		}
 
 	case "kubernetes.io/kube-apiserver-client-kubelet":
-		// Approve kubelet client certificates (newer k8s versions prefer this signer)
+		// Approve kubelet client certificates (newer k8s versions prefer this signer).
+		// A lingering kubelet of a released host must not rejoin the cluster, so the
+		// client certificate of a node backed by a ByoHost is only issued while it is bound.
+		byoHost, err := r.getByoHostForNode(ctx, csrCommonName(csr))
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if byoHost != nil {
+			if reason, message := csrDenyReason(byoHost); reason != "" {
+				logger.Info("Denying kubelet client CSR", "CSR", csr.Name, "ByoHost", byoHost.Name, "reason", message)
+				return r.denyCSR(ctx, csr, reason, message)
+			}
+		}
 		logger.Info("Approving kubelet client CSR", "CSR", csr.Name)
 
 	case certv1.KubeletServingSignerName:
-		// Approve kubelet serving certificates
-		// Kubelet creates this CSR when using TLS Bootstrap mode
-		logger.Info("Approving kubelet serving CSR", "CSR", csr.Name)
+		// Kubelet creates this CSR when using TLS Bootstrap mode and again on every
+		// serving certificate rotation, so the host binding is re-checked each time
+		byoHost, err := r.getByoHostForNode(ctx, csr.Spec.Username)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if byoHost == nil {
+			logger.V(4).Info("Skipping kubelet serving CSR of a node not backed by a ByoHost", "CSR", csr.Name, "username", csr.Spec.Username)
+			return ctrl.Result{}, nil
+		}
+		if reason, message := csrDenyReason(byoHost); reason != "" {
+			logger.Info("Denying kubelet serving CSR", "CSR", csr.Name, "ByoHost", byoHost.Name, "reason", message)
+			return r.denyCSR(ctx, csr, reason, message)
+		}
+		logger.Info("Approving kubelet serving CSR", "CSR", csr.Name, "ByoHost", byoHost.Name)
 
 	default:
 		logger.V(4).Info("Skipping CSR with unknown signer", "CSR", csr.Name, "signer", csr.Spec.SignerName)
@@ -100,7 +168,87 @@ func (r *ByoAdmissionReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	}
 
 	logger.Info("CSR Approved", "object", req.NamespacedName)
+	r.observeApprovalLatency(csr)
+
+	return ctrl.Result{}, nil
+}
+
+// observeApprovalLatency records the time the CSR waited for its approval
+func (r *ByoAdmissionReconciler) observeApprovalLatency(csr *certv1.CertificateSigningRequest) {
+	if csr.CreationTimestamp.IsZero() {
+		return
+	}
+	latency := time.Since(csr.CreationTimestamp.Time)
+	CSRApprovalLatency.WithLabelValues(csr.Spec.SignerName).Observe(latency.Seconds())
 
+	if r.Recorder != nil && r.SlowApprovalThreshold > 0 && latency > r.SlowApprovalThreshold {
+		r.Recorder.Eventf(csr, corev1.EventTypeWarning, "CSRApprovalSlow", "CSR approved %s after its creation, exceeding %s", latency.Round(time.Second), r.SlowApprovalThreshold)
+	}
+}
+
+// getByoHostForNode returns the ByoHost named after the node that requested the CSR,
+// or nil if the requester is not a node or no such ByoHost exists. Of the hosts registered
+// under the same name in several namespaces the one bound to a Machine is returned, hosts
+// sharing their node name are never attached so at most one is bound.
+func (r *ByoAdmissionReconciler) getByoHostForNode(ctx context.Context, username string) (*infrav1.ByoHost, error) {
+	if !strings.HasPrefix(username, "system:node:") {
+		return nil, nil
+	}
+	nodeName := strings.TrimPrefix(username, "system:node:")
+
+	hosts, err := byoHostsByName(ctx, r.Client, nodeName, r.Namespace)
+	if err != nil || len(hosts) == 0 {
+		return nil, err
+	}
+	for i := range hosts {
+		if hosts[i].Status.MachineRef != nil {
+			return &hosts[i], nil
+		}
+	}
+	return &hosts[0], nil
+}
+
+// csrDenyReason returns the reason and the message of why a kubelet certificate must not be issued for the
+// node of the ByoHost, or empty strings if the host is healthy and bound to a Machine.
+func csrDenyReason(byoHost *infrav1.ByoHost) (string, string) {
+	if byoHostPhase(byoHost) == infrav1.ByoHostPhaseCleaningUp {
+		return ByoHostCleaningUpReason, "ByoHost " + byoHost.Name + " is being cleaned up"
+	}
+	if byoHost.IsQuarantined() {
+		return ByoHostQuarantinedReason, "ByoHost " + byoHost.Name + " is quarantined"
+	}
+	if byoHost.Status.MachineRef == nil {
+		return ByoHostNotBoundReason, "ByoHost " + byoHost.Name + " is not bound to a Machine"
+	}
+	return "", ""
+}
+
+// csrCommonName returns the subject common name of the certificate request, which is
+// system:node:<node name> for kubelet client certificates, or an empty string if it cannot be parsed.
+func csrCommonName(csr *certv1.CertificateSigningRequest) string {
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil {
+		return ""
+	}
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return ""
+	}
+	return request.Subject.CommonName
+}
+
+// denyCSR sets the "Denied" condition on the CSR with the given reason and message.
+func (r *ByoAdmissionReconciler) denyCSR(ctx context.Context, csr *certv1.CertificateSigningRequest, reason, message string) (ctrl.Result, error) {
+	csr.Status.Conditions = append(csr.Status.Conditions, certv1.CertificateSigningRequestCondition{
+		Type:    certv1.CertificateDenied,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+	if _, err := r.ClientSet.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx, csr.Name, csr, metav1.UpdateOptions{}); err != nil {
+		return reconcile.Result{}, err
+	}
+	log.FromContext(ctx).Info("CSR Denied", "CSR", csr.Name)
 	return ctrl.Result{}, nil
 }
 
@@ -5,7 +5,11 @@ package controllers_test
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	controllers "github.com/mensylisir/cluster-api-provider-bringyourownhost/controllers/infrastructure"
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/test/builder"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -13,9 +17,19 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// indexedClientBuilder returns a fake client builder with the ByoHost index the ByoAdmission controller looks up hosts with
+func indexedClientBuilder() *fake.ClientBuilder {
+	return fake.NewClientBuilder().WithScheme(scheme.Scheme).
+		WithIndex(&infrastructurev1beta1.ByoHost{}, controllers.ByoHostNameField, controllers.ByoHostNameIndexer)
+}
+
 var _ = Describe("Controllers/ByoadmissionController", func() {
 	var (
 		err error
@@ -59,6 +73,42 @@ var _ = Describe("Controllers/ByoadmissionController", func() {
 			}))
 		})
 
+		It("should observe the approval latency and warn about a slow approval", func() {
+			approvalLatencySamples := func() uint64 {
+				families, err := metrics.Registry.Gather()
+				Expect(err).NotTo(HaveOccurred())
+				for _, family := range families {
+					if family.GetName() != "byoh_csr_approval_latency_seconds" {
+						continue
+					}
+					for _, metric := range family.GetMetric() {
+						if metric.GetLabel()[0].GetValue() == CSR.Spec.SignerName {
+							return metric.GetHistogram().GetSampleCount()
+						}
+					}
+				}
+				return 0
+			}
+			CSR.Spec.SignerName = "kubernetes.io/kube-apiserver-client-kubelet"
+			samplesBefore := approvalLatencySamples()
+
+			CSR.CreationTimestamp = v1.NewTime(time.Now().Add(-2 * time.Minute))
+			_, err = clientSetFake.CertificatesV1().CertificateSigningRequests().Create(ctx, CSR, v1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			fakeRecorder := record.NewFakeRecorder(1)
+			latencyReconciler := &controllers.ByoAdmissionReconciler{
+				ClientSet:             clientSetFake,
+				Recorder:              fakeRecorder,
+				SlowApprovalThreshold: time.Minute,
+			}
+			_, err = latencyReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: defaultByoHostName}})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(approvalLatencySamples()).To(Equal(samplesBefore + 1))
+			Expect(fakeRecorder.Events).To(Receive(HavePrefix(fmt.Sprintf("Warning CSRApprovalSlow CSR approved %s after its creation", 2*time.Minute))))
+		})
+
 		It("should not approve a denied CSR", func() {
 			// Create a fake denied CSR request
 			CSR.Status.Conditions = append(CSR.Status.Conditions, certv1.CertificateSigningRequestCondition{
@@ -95,4 +145,195 @@ var _ = Describe("Controllers/ByoadmissionController", func() {
 
 	})
 
+	Context("When a kubelet serving CSR is created", func() {
+		var servingReconciler *controllers.ByoAdmissionReconciler
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			CSR, err = builder.CertificateSigningRequest(defaultByoHostName, "system:node:"+defaultByoHostName, "system:nodes", 2048).Build()
+			Expect(err).NotTo(HaveOccurred())
+			CSR.Spec.SignerName = certv1.KubeletServingSignerName
+			CSR.Spec.Username = "system:node:" + defaultByoHostName
+			CSR.Spec.Usages = []certv1.KeyUsage{certv1.UsageServerAuth}
+			_, err = clientSetFake.CertificatesV1().CertificateSigningRequests().Create(ctx, CSR, v1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		reconcileCSR := func() *certv1.CertificateSigningRequest {
+			_, err = servingReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: defaultByoHostName}})
+			Expect(err).ShouldNot(HaveOccurred())
+			updatedCSR, err := clientSetFake.CertificatesV1().CertificateSigningRequests().Get(ctx, defaultByoHostName, v1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			return updatedCSR
+		}
+
+		It("should approve the rotated serving CSR of a host still bound to a Machine", func() {
+			byoHost := builder.ByoHost(defaultNamespace, defaultByoHostName).Build()
+			byoHost.Name = defaultByoHostName
+			byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Namespace: defaultNamespace, Name: "test-byomachine"}
+			servingReconciler = &controllers.ByoAdmissionReconciler{
+				ClientSet: clientSetFake,
+				Client:    indexedClientBuilder().WithObjects(byoHost).Build(),
+			}
+
+			Expect(reconcileCSR().Status.Conditions).Should(ContainElement(certv1.CertificateSigningRequestCondition{
+				Type:   certv1.CertificateApproved,
+				Reason: "Approved by ByoAdmission Controller",
+				Status: corev1.ConditionTrue,
+			}))
+		})
+
+		It("should deny the rotated serving CSR of a released host", func() {
+			byoHost := builder.ByoHost(defaultNamespace, defaultByoHostName).Build()
+			byoHost.Name = defaultByoHostName
+			servingReconciler = &controllers.ByoAdmissionReconciler{
+				ClientSet: clientSetFake,
+				Client:    indexedClientBuilder().WithObjects(byoHost).Build(),
+			}
+
+			conditions := reconcileCSR().Status.Conditions
+			Expect(conditions).Should(ContainElement(certv1.CertificateSigningRequestCondition{
+				Type:    certv1.CertificateDenied,
+				Reason:  controllers.ByoHostNotBoundReason,
+				Message: "ByoHost " + defaultByoHostName + " is not bound to a Machine",
+				Status:  corev1.ConditionTrue,
+			}))
+			Expect(conditions).To(HaveLen(1))
+		})
+
+		It("should deny the serving CSR of a host being cleaned up", func() {
+			byoHost := builder.ByoHost(defaultNamespace, defaultByoHostName).Build()
+			byoHost.Name = defaultByoHostName
+			byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Namespace: defaultNamespace, Name: "test-byomachine"}
+			byoHost.Annotations = map[string]string{infrastructurev1beta1.HostCleanupAnnotation: ""}
+			servingReconciler = &controllers.ByoAdmissionReconciler{
+				ClientSet: clientSetFake,
+				Client:    indexedClientBuilder().WithObjects(byoHost).Build(),
+			}
+
+			Expect(reconcileCSR().Status.Conditions).Should(ConsistOf(certv1.CertificateSigningRequestCondition{
+				Type:    certv1.CertificateDenied,
+				Reason:  controllers.ByoHostCleaningUpReason,
+				Message: "ByoHost " + defaultByoHostName + " is being cleaned up",
+				Status:  corev1.ConditionTrue,
+			}))
+		})
+
+		It("should leave the serving CSR of a node without ByoHost pending", func() {
+			servingReconciler = &controllers.ByoAdmissionReconciler{
+				ClientSet: clientSetFake,
+				Client:    indexedClientBuilder().Build(),
+			}
+
+			Expect(reconcileCSR().Status.Conditions).To(BeEmpty())
+		})
+
+		It("should look up the host bound to a Machine among the hosts sharing its node name", func() {
+			byoHost := builder.ByoHost(defaultNamespace, defaultByoHostName).Build()
+			byoHost.Name = defaultByoHostName
+			byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Namespace: defaultNamespace, Name: "test-byomachine"}
+			duplicate := builder.ByoHost("other", defaultByoHostName).Build()
+			duplicate.Name = defaultByoHostName
+			servingReconciler = &controllers.ByoAdmissionReconciler{
+				ClientSet: clientSetFake,
+				Client:    indexedClientBuilder().WithObjects(duplicate, byoHost).Build(),
+			}
+
+			Expect(reconcileCSR().Status.Conditions).Should(ConsistOf(certv1.CertificateSigningRequestCondition{
+				Type:   certv1.CertificateApproved,
+				Reason: "Approved by ByoAdmission Controller",
+				Status: corev1.ConditionTrue,
+			}))
+		})
+
+		It("should only look up the host in the configured namespace", func() {
+			byoHost := builder.ByoHost(defaultNamespace, defaultByoHostName).Build()
+			byoHost.Name = defaultByoHostName
+			byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Namespace: defaultNamespace, Name: "test-byomachine"}
+			servingReconciler = &controllers.ByoAdmissionReconciler{
+				ClientSet: clientSetFake,
+				Client:    indexedClientBuilder().WithObjects(byoHost).Build(),
+				Namespace: "other",
+			}
+
+			Expect(reconcileCSR().Status.Conditions).To(BeEmpty())
+		})
+
+		AfterEach(func() {
+			Expect(clientSetFake.CertificatesV1().CertificateSigningRequests().Delete(ctx, defaultByoHostName, v1.DeleteOptions{})).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("When a kubelet client CSR is created", func() {
+		var clientReconciler *controllers.ByoAdmissionReconciler
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			CSR, err = builder.CertificateSigningRequest(defaultByoHostName, "system:node:"+defaultByoHostName, "system:nodes", 2048).Build()
+			Expect(err).NotTo(HaveOccurred())
+			CSR.Spec.SignerName = "kubernetes.io/kube-apiserver-client-kubelet"
+			_, err = clientSetFake.CertificatesV1().CertificateSigningRequests().Create(ctx, CSR, v1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		reconcileCSR := func(byoHost *infrastructurev1beta1.ByoHost) []certv1.CertificateSigningRequestCondition {
+			clientReconciler = &controllers.ByoAdmissionReconciler{
+				ClientSet: clientSetFake,
+				Client:    indexedClientBuilder().WithObjects(byoHost).Build(),
+			}
+			_, err = clientReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: defaultByoHostName}})
+			Expect(err).ShouldNot(HaveOccurred())
+			updatedCSR, err := clientSetFake.CertificatesV1().CertificateSigningRequests().Get(ctx, defaultByoHostName, v1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			return updatedCSR.Status.Conditions
+		}
+
+		boundByoHost := func() *infrastructurev1beta1.ByoHost {
+			byoHost := builder.ByoHost(defaultNamespace, defaultByoHostName).Build()
+			byoHost.Name = defaultByoHostName
+			byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Namespace: defaultNamespace, Name: "test-byomachine"}
+			return byoHost
+		}
+
+		deniedWith := func(reason, message string) certv1.CertificateSigningRequestCondition {
+			return certv1.CertificateSigningRequestCondition{
+				Type:    certv1.CertificateDenied,
+				Reason:  reason,
+				Message: message,
+				Status:  corev1.ConditionTrue,
+			}
+		}
+
+		It("should approve the CSR of a healthy host bound to a Machine", func() {
+			Expect(reconcileCSR(boundByoHost())).Should(ConsistOf(certv1.CertificateSigningRequestCondition{
+				Type:   certv1.CertificateApproved,
+				Reason: "Approved by ByoAdmission Controller",
+				Status: corev1.ConditionTrue,
+			}))
+		})
+
+		It("should deny the CSR of a host being cleaned up", func() {
+			byoHost := boundByoHost()
+			byoHost.Annotations = map[string]string{infrastructurev1beta1.HostCleanupAnnotation: ""}
+			Expect(reconcileCSR(byoHost)).Should(ConsistOf(deniedWith(controllers.ByoHostCleaningUpReason, "ByoHost "+defaultByoHostName+" is being cleaned up")))
+		})
+
+		It("should deny the CSR of a quarantined host", func() {
+			byoHost := boundByoHost()
+			byoHost.Labels = map[string]string{infrastructurev1beta1.QuarantinedLabel: "true"}
+			Expect(reconcileCSR(byoHost)).Should(ConsistOf(deniedWith(controllers.ByoHostQuarantinedReason, "ByoHost "+defaultByoHostName+" is quarantined")))
+		})
+
+		It("should deny the CSR of a released host", func() {
+			byoHost := boundByoHost()
+			byoHost.Status.MachineRef = nil
+			Expect(reconcileCSR(byoHost)).Should(ConsistOf(deniedWith(controllers.ByoHostNotBoundReason, "ByoHost "+defaultByoHostName+" is not bound to a Machine")))
+		})
+
+		AfterEach(func() {
+			Expect(clientSetFake.CertificatesV1().CertificateSigningRequests().Delete(ctx, defaultByoHostName, v1.DeleteOptions{})).ShouldNot(HaveOccurred())
+		})
+	})
 })
@@ -8,13 +8,17 @@ import (
 	"reflect"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
@@ -46,6 +50,7 @@ type ByoClusterReconciler struct {
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byoclusters/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byoclusters/finalizers,verbs=update
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byohosts,verbs=get;list;watch
 
 // Reconcile handles the byo cluster reconciliations
 func (r *ByoClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
@@ -177,6 +182,12 @@ func (r ByoClusterReconciler) reconcileNormal(ctx context.Context, byoCluster *i
 
 	byoCluster.Status.Ready = true
 
+	hostsList := &infrav1.ByoHostList{}
+	if err := r.Client.List(ctx, hostsList); err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "failed to list ByoHosts")
+	}
+	byoCluster.Status.HostPool = summarizeHostPool(hostsList.Items, cluster)
+
 	logger := log.FromContext(ctx)
 
 	// NOTE: Infrastructure Provider should ONLY set InfrastructureReady.
@@ -194,6 +205,98 @@ func (r ByoClusterReconciler) reconcileNormal(ctx context.Context, byoCluster *i
 	return reconcile.Result{}, nil
 }
 
+// summarizeHostPool counts the hosts the cluster can use by state. These are the hosts bound to
+// the cluster and the unbound hosts, which ByoMachines select from regardless of their namespace.
+func summarizeHostPool(hosts []infrav1.ByoHost, cluster *clusterv1.Cluster) *infrav1.HostPoolSummary {
+	summary := &infrav1.HostPoolSummary{}
+	for i := range hosts {
+		host := &hosts[i]
+		clusterName, bound := host.Labels[clusterv1.ClusterNameLabel]
+		if bound && (clusterName != cluster.Name || !boundToNamespace(host, cluster.Namespace)) {
+			continue
+		}
+
+		summary.Total++
+		phase := byoHostPhase(host)
+		switch {
+		case bound && host.Status.MachineRef != nil:
+			summary.Bound++
+		case !bound && phase == infrav1.ByoHostPhaseAvailable:
+			summary.Available++
+		}
+		if phase == infrav1.ByoHostPhaseQuarantined || phase == infrav1.ByoHostPhaseCleaningUp {
+			summary.Unschedulable++
+		}
+		if record := host.Status.LastForceCleanup; record != nil && !record.AgentAcknowledged {
+			summary.AgentsUnreachable++
+		}
+	}
+	return summary
+}
+
+// boundToNamespace checks the host is not bound to a ByoMachine of another namespace
+func boundToNamespace(host *infrav1.ByoHost, namespace string) bool {
+	return host.Status.MachineRef == nil || host.Status.MachineRef.Namespace == namespace
+}
+
+// ByoHostToByoClusters maps a ByoHost to all the ByoClusters, as unbound hosts are part of the
+// host pool of every cluster
+func (r *ByoClusterReconciler) ByoHostToByoClusters(o client.Object) []ctrl.Request {
+	if _, ok := o.(*infrav1.ByoHost); !ok {
+		return nil
+	}
+
+	byoClusterList := &infrav1.ByoClusterList{}
+	if err := r.Client.List(context.TODO(), byoClusterList); err != nil {
+		return nil
+	}
+
+	result := make([]ctrl.Request, 0, len(byoClusterList.Items))
+	for i := range byoClusterList.Items {
+		result = append(result, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&byoClusterList.Items[i])})
+	}
+	return result
+}
+
+// hostPoolState is the state of a ByoHost the host pool summary is computed from
+type hostPoolState struct {
+	clusterName       string
+	bound             bool
+	machineRef        corev1.ObjectReference
+	available         bool
+	unschedulable     bool
+	agentsUnreachable bool
+}
+
+func poolStateOf(host *infrav1.ByoHost) hostPoolState {
+	phase := byoHostPhase(host)
+	state := hostPoolState{
+		available:     phase == infrav1.ByoHostPhaseAvailable,
+		unschedulable: phase == infrav1.ByoHostPhaseQuarantined || phase == infrav1.ByoHostPhaseCleaningUp,
+	}
+	state.clusterName, state.bound = host.Labels[clusterv1.ClusterNameLabel]
+	if host.Status.MachineRef != nil {
+		state.machineRef = *host.Status.MachineRef
+	}
+	if record := host.Status.LastForceCleanup; record != nil && !record.AgentAcknowledged {
+		state.agentsUnreachable = true
+	}
+	return state
+}
+
+// hostPoolChanged filters the updates of the ByoHosts to the ones changing the host pool summary, e.g. of
+// the labels or the MachineRef, rather than every status update of the agents
+var hostPoolChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldHost, okOld := e.ObjectOld.(*infrav1.ByoHost)
+		newHost, okNew := e.ObjectNew.(*infrav1.ByoHost)
+		if !okOld || !okNew {
+			return false
+		}
+		return poolStateOf(oldHost) != poolStateOf(newHost)
+	},
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ByoClusterReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -204,5 +307,11 @@ func (r *ByoClusterReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Ma
 			&source.Kind{Type: &clusterv1.Cluster{}},
 			handler.EnqueueRequestsFromMapFunc(clusterutilv1.ClusterToInfrastructureMapFunc(ctx, infrav1.GroupVersion.WithKind(clusterControlledTypeGVK.Kind), mgr.GetClient(), &infrav1.ByoCluster{})),
 		).
+		// Watch the ByoHosts to keep the host pool summary up to date.
+		Watches(
+			&source.Kind{Type: &infrav1.ByoHost{}},
+			handler.EnqueueRequestsFromMapFunc(r.ByoHostToByoClusters),
+			builder.WithPredicates(hostPoolChanged),
+		).
 		Complete(r)
 }
@@ -0,0 +1,150 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	infrav1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("ByoClusterController/Unit", func() {
+	Context("When summarizing the host pool of a cluster", func() {
+		var cluster *clusterv1.Cluster
+
+		// poolHost builds a host of the pool, bound to the given cluster when clusterName is set
+		poolHost := func(name, clusterName string) infrav1.ByoHost {
+			host := infrav1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{}}}
+			if clusterName != "" {
+				host.Labels[clusterv1.ClusterNameLabel] = clusterName
+				host.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Namespace: "default", Name: name}
+			}
+			return host
+		}
+
+		BeforeEach(func() {
+			cluster = &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+		})
+
+		It("should count the hosts of a synthetic pool by state", func() {
+			quarantined := poolHost("quarantined", "")
+			quarantined.Labels[infrav1.QuarantinedLabel] = ""
+			cleaning := poolHost("cleaning", "test-cluster")
+			cleaning.Annotations = map[string]string{infrav1.HostCleanupAnnotation: ""}
+			unreachable := poolHost("unreachable", "")
+			unreachable.Status.LastForceCleanup = &infrav1.ForceCleanupRecord{Reason: infrav1.ForceCleanupAgentUnavailableReason}
+			acknowledged := poolHost("acknowledged", "")
+			acknowledged.Status.LastForceCleanup = &infrav1.ForceCleanupRecord{Reason: infrav1.ForceCleanupAgentUnavailableReason, AgentAcknowledged: true}
+			otherNamespace := poolHost("other-namespace", "test-cluster")
+			otherNamespace.Status.MachineRef.Namespace = "other"
+
+			hosts := []infrav1.ByoHost{
+				poolHost("available", ""),
+				poolHost("bound-1", "test-cluster"),
+				poolHost("bound-2", "test-cluster"),
+				poolHost("other-cluster", "other-cluster"),
+				quarantined, cleaning, unreachable, acknowledged, otherNamespace,
+			}
+
+			Expect(summarizeHostPool(hosts, cluster)).To(Equal(&infrav1.HostPoolSummary{
+				Total:             7,
+				Available:         3,
+				Bound:             3,
+				Unschedulable:     2,
+				AgentsUnreachable: 1,
+			}))
+		})
+
+		It("should report an empty pool", func() {
+			Expect(summarizeHostPool(nil, cluster)).To(Equal(&infrav1.HostPoolSummary{}))
+		})
+	})
+
+	Context("When the state of a host of the pool changes", func() {
+		var (
+			ctx           context.Context
+			r             *ByoClusterReconciler
+			byoClusterKey types.NamespacedName
+			byoHost       *infrav1.ByoHost
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			scheme := runtime.NewScheme()
+			Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+			Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+			cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+			byoCluster := &infrav1.ByoCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-byocluster",
+					Namespace: "default",
+					OwnerReferences: []metav1.OwnerReference{
+						{APIVersion: clusterv1.GroupVersion.String(), Kind: "Cluster", Name: cluster.Name},
+					},
+				},
+			}
+			byoHost = &infrav1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: "default"}}
+			byoClusterKey = types.NamespacedName{Name: byoCluster.Name, Namespace: byoCluster.Namespace}
+			r = &ByoClusterReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster, byoCluster, byoHost).Build()}
+		})
+
+		reconcileHostPool := func() *infrav1.HostPoolSummary {
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: byoClusterKey})
+			Expect(err).NotTo(HaveOccurred())
+			byoCluster := &infrav1.ByoCluster{}
+			Expect(r.Client.Get(ctx, byoClusterKey, byoCluster)).To(Succeed())
+			return byoCluster.Status.HostPool
+		}
+
+		It("should update the summary on reconcile", func() {
+			Expect(reconcileHostPool()).To(Equal(&infrav1.HostPoolSummary{Total: 1, Available: 1}))
+
+			Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(byoHost), byoHost)).To(Succeed())
+			byoHost.Labels = map[string]string{clusterv1.ClusterNameLabel: "test-cluster"}
+			byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Namespace: "default", Name: "test-machine"}
+			Expect(r.Client.Update(ctx, byoHost)).To(Succeed())
+			Expect(reconcileHostPool()).To(Equal(&infrav1.HostPoolSummary{Total: 1, Bound: 1}))
+
+			byoHost.Labels = map[string]string{infrav1.QuarantinedLabel: ""}
+			byoHost.Status.MachineRef = nil
+			Expect(r.Client.Update(ctx, byoHost)).To(Succeed())
+			Expect(reconcileHostPool()).To(Equal(&infrav1.HostPoolSummary{Total: 1, Unschedulable: 1}))
+		})
+
+		It("should map a host to every ByoCluster", func() {
+			Expect(r.ByoHostToByoClusters(byoHost)).To(ConsistOf(ctrl.Request{NamespacedName: byoClusterKey}))
+		})
+
+		It("should only watch the updates of a host changing the summary", func() {
+			updated := byoHost.DeepCopy()
+			conditions.MarkTrue(updated, infrav1.K8sNodeBootstrapSucceeded)
+			updated.Status.HostDetails.OSImage = "Ubuntu 22.04 LTS"
+			Expect(hostPoolChanged.Update(event.UpdateEvent{ObjectOld: byoHost, ObjectNew: updated})).To(BeFalse())
+
+			relabeled := byoHost.DeepCopy()
+			relabeled.Labels = map[string]string{infrav1.QuarantinedLabel: ""}
+			Expect(hostPoolChanged.Update(event.UpdateEvent{ObjectOld: byoHost, ObjectNew: relabeled})).To(BeTrue())
+
+			attached := byoHost.DeepCopy()
+			attached.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Namespace: "default", Name: "test-machine"}
+			Expect(hostPoolChanged.Update(event.UpdateEvent{ObjectOld: byoHost, ObjectNew: attached})).To(BeTrue())
+
+			Expect(hostPoolChanged.Create(event.CreateEvent{Object: byoHost})).To(BeTrue())
+			Expect(hostPoolChanged.Delete(event.DeleteEvent{Object: byoHost})).To(BeTrue())
+		})
+	})
+})
@@ -7,17 +7,23 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
 )
@@ -32,29 +38,34 @@ const (
 	// maxHostCleanupTimeout is the maximum timeout value
 	maxHostCleanupTimeout = 15 * time.Minute
 
-	// forceCleanupAuditAnnotation is the annotation to track force cleanup operations
-	forceCleanupAuditAnnotation = "byoh.infrastructure.cluster.x-k8s.io/force-cleanup-audit"
-	// cleanupStartedAtAnnotation is the timestamp when cleanup annotation was first detected
-	cleanupStartedAtAnnotation = "byoh.infrastructure.cluster.x-k8s.io/cleanup-started-at"
+	// DefaultForceCleanupConfirmationWindow is the default time the agent gets to show activity once the
+	// cleanup timeout is exceeded, before the Node is force deleted
+	DefaultForceCleanupConfirmationWindow = time.Minute
 )
 
 // ByoHostReconciler reconciles a ByoHost object
 type ByoHostReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// ForceCleanupConfirmationWindow is how long the agent still gets to show activity once the cleanup
+	// timeout is exceeded, so a briefly slow agent does not have its Node deleted. The force cleanup
+	// happens as soon as the timeout is exceeded when zero.
+	ForceCleanupConfirmationWindow time.Duration
 }
 
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byohosts,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byohosts/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byohosts/finalizers,verbs=update
 //+kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=create;get;watch
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
-func (r *ByoHostReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
+func (r *ByoHostReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, reterr error) {
 	logger := log.FromContext(ctx)
 
 	// Fetch the ByoHost instance
@@ -73,12 +84,14 @@ func (r *ByoHostReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_
 	}
 
 	defer func() {
-		if err := helper.Patch(ctx, byoHost); err != nil && reterr == nil {
-			logger.Error(err, "failed to patch byohost")
-			reterr = err
-		}
+		byoHost.Status.Phase = byoHostPhase(byoHost)
+		handleDeferredPatchError(logger, "byohost", helper.Patch(ctx, byoHost), &res, &reterr)
 	}()
 
+	if err := r.markDuplicateNodeName(ctx, byoHost); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// Handle Host Cleanup
 	if _, ok := byoHost.Annotations[infrastructurev1beta1.HostCleanupAnnotation]; ok {
 		logger.Info("Host cleanup annotation detected", "host", byoHost.Name)
@@ -92,22 +105,22 @@ func (r *ByoHostReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_
 
 		if !byoHost.DeletionTimestamp.IsZero() {
 			// ByoHost is being deleted
+			cleanupStarted = byoHost.DeletionTimestamp.Time
 			deletionDuration := time.Since(byoHost.DeletionTimestamp.Time)
 			if deletionDuration > cleanupTimeout {
 				logger.Info("ByoHost deletion timeout exceeded, forcing cleanup",
 					"timeout", cleanupTimeout, "elapsed", deletionDuration)
 				shouldForceCleanup = true
 			}
-		} else if startedAtStr, ok := byoHost.Annotations[cleanupStartedAtAnnotation]; ok {
+		} else if startedAtStr, ok := byoHost.Annotations[infrastructurev1beta1.CleanupStartedAtAnnotation]; ok {
 			// Cleanup annotation was set previously, check if timeout exceeded
 			if startedAt, err := time.Parse(time.RFC3339, startedAtStr); err == nil {
+				cleanupStarted = startedAt
 				elapsed := time.Since(startedAt)
 				if elapsed > cleanupTimeout {
 					logger.Info("Cleanup annotation timeout exceeded, forcing cleanup",
 						"timeout", cleanupTimeout, "elapsed", elapsed)
 					shouldForceCleanup = true
-				} else {
-					cleanupStarted = startedAt
 				}
 			}
 		} else {
@@ -115,11 +128,17 @@ func (r *ByoHostReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_
 			if byoHost.Annotations == nil {
 				byoHost.Annotations = make(map[string]string)
 			}
-			byoHost.Annotations[cleanupStartedAtAnnotation] = time.Now().Format(time.RFC3339)
+			byoHost.Annotations[infrastructurev1beta1.CleanupStartedAtAnnotation] = time.Now().Format(time.RFC3339)
 			logger.Info("Recording cleanup start time", "timeout", cleanupTimeout)
 		}
 
 		if shouldForceCleanup {
+			if wait := maintenanceWindowWait(ctx, byoHost, time.Now()); wait > 0 {
+				return ctrl.Result{RequeueAfter: wait}, nil
+			}
+			if confirmed, requeueAfter := r.confirmForceCleanup(ctx, byoHost); !confirmed {
+				return ctrl.Result{RequeueAfter: requeueAfter}, nil
+			}
 			logger.Info("Force cleanup: Agent unavailable or timeout exceeded",
 				"forceCleanup", shouldForceCleanup)
 
@@ -138,19 +157,25 @@ func (r *ByoHostReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_
 
 			// Clear MachineRef
 			byoHost.Status.MachineRef = nil
-
-			// Record force cleanup in audit log
-			auditEntry := fmt.Sprintf("timestamp=%s,reason=agent_unavailable,timeout=%v,elapsed=%v,controller=byohost-controller",
-				time.Now().Format(time.RFC3339), cleanupTimeout, time.Since(cleanupStarted))
-			byoHost.Annotations[forceCleanupAuditAnnotation] = auditEntry
-			logger.Info("Force cleanup recorded in audit log", "audit", auditEntry)
+			// The agent does not remove the defaults of the cluster, they must not apply to the next one
+			byoHost.RemoveClusterNodeDefaults()
+
+			// Record the force cleanup in the status, it is kept until the next force cleanup
+			byoHost.Status.LastForceCleanup = &infrastructurev1beta1.ForceCleanupRecord{
+				Timestamp: metav1.Now(),
+				Reason:    infrastructurev1beta1.ForceCleanupAgentUnavailableReason,
+				Timeout:   metav1.Duration{Duration: cleanupTimeout},
+				Elapsed:   metav1.Duration{Duration: time.Since(cleanupStarted).Round(time.Second)},
+			}
+			logger.Info("Force cleanup recorded in status", "reason", byoHost.Status.LastForceCleanup.Reason,
+				"timeout", cleanupTimeout, "elapsed", byoHost.Status.LastForceCleanup.Elapsed.Duration)
 
 			conditions.MarkTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded)
 
 			// Remove cleanup-related annotations
 			delete(byoHost.Annotations, infrastructurev1beta1.HostCleanupAnnotation)
-			delete(byoHost.Annotations, cleanupStartedAtAnnotation)
-			delete(byoHost.Annotations, forceCleanupAuditAnnotation)
+			delete(byoHost.Annotations, infrastructurev1beta1.CleanupStartedAtAnnotation)
+			delete(byoHost.Annotations, infrastructurev1beta1.ForceCleanupConfirmationAnnotation)
 
 			logger.Info("Host released successfully")
 			return ctrl.Result{}, nil
@@ -163,9 +188,236 @@ func (r *ByoHostReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_
 		return ctrl.Result{RequeueAfter: cleanupTimeout}, nil
 	}
 
+	// Release the host once the cluster it is attached to is gone
+	if err := r.releaseHostOfDeletedCluster(ctx, byoHost); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// releaseHostOfDeletedCluster returns a host labeled for a deleted Cluster to the pool. A host still
+// attached to a ByoMachine is marked for cleanup, so that the agent resets it and drops the labels.
+// A host already detached, e.g. after a forced cleanup, only has the stale cluster-name label removed.
+func (r *ByoHostReconciler) releaseHostOfDeletedCluster(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
+	logger := log.FromContext(ctx)
+
+	clusterKey, ok := hostClusterKey(byoHost)
+	if !ok {
+		return nil
+	}
+	err := r.Client.Get(ctx, clusterKey, &clusterv1.Cluster{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	_, attached := byoHost.Labels[infrastructurev1beta1.AttachedByoMachineLabel]
+	if !attached && byoHost.Status.MachineRef == nil {
+		logger.Info("Removing the cluster label of a deleted cluster", "cluster", clusterKey)
+		delete(byoHost.Labels, clusterv1.ClusterNameLabel)
+		byoHost.RemoveClusterNodeDefaults()
+		return nil
+	}
+
+	logger.Info("Cluster of the host was deleted, releasing the host", "cluster", clusterKey)
+	if byoHost.Annotations == nil {
+		byoHost.Annotations = map[string]string{}
+	}
+	byoHost.Annotations[infrastructurev1beta1.HostCleanupAnnotation] = ""
+	byoHost.Status.MachineRef = nil
+	delete(byoHost.Annotations, HostLeaseAnnotationKey)
+	delete(byoHost.Labels, infrastructurev1beta1.AttachedByoMachineLabel)
+	return nil
+}
+
+// markDuplicateNodeName flags the host with the NodeNameUnique condition when other ByoHosts map to its node
+// name, e.g. registered by a misconfigured agent in another namespace, as their nodes would conflict on the
+// providerID. The agent registers a host under its hostname, which is also the name of its Node.
+func (r *ByoHostReconciler) markDuplicateNodeName(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) error {
+	duplicates, err := r.duplicateByoHosts(ctx, byoHost)
+	if err != nil {
+		return err
+	}
+	if len(duplicates) == 0 {
+		conditions.MarkTrue(byoHost, infrastructurev1beta1.NodeNameUnique)
+		return nil
+	}
+
+	log.FromContext(ctx).Info("Other ByoHosts map to the node name of the host", "node", byoHost.Name, "duplicates", duplicates)
+	conditions.MarkFalse(byoHost, infrastructurev1beta1.NodeNameUnique, infrastructurev1beta1.DuplicateNodeNameReason, clusterv1.ConditionSeverityWarning,
+		"ByoHosts %s map to node %s as well", strings.Join(duplicates, ", "), byoHost.Name)
+	return nil
+}
+
+// duplicateByoHosts returns the keys of the other ByoHosts, not being deleted, mapping to the node name of the host
+func (r *ByoHostReconciler) duplicateByoHosts(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) ([]string, error) {
+	hosts, err := byoHostsByName(ctx, r.Client, byoHost.Name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var duplicates []string
+	for i := range hosts {
+		host := &hosts[i]
+		if host.Name != byoHost.Name || host.Namespace == byoHost.Namespace || !host.DeletionTimestamp.IsZero() {
+			continue
+		}
+		duplicates = append(duplicates, client.ObjectKeyFromObject(host).String())
+	}
+	sort.Strings(duplicates)
+	return duplicates, nil
+}
+
+// ByoHostToDuplicates maps a ByoHost to the other ByoHosts mapping to its node name, so that their NodeNameUnique
+// condition follows the registration and deletion of the host
+func (r *ByoHostReconciler) ByoHostToDuplicates(o client.Object) []ctrl.Request {
+	hosts, err := byoHostsByName(context.TODO(), r.Client, o.GetName(), "")
+	if err != nil {
+		return nil
+	}
+
+	var result []ctrl.Request
+	for i := range hosts {
+		host := &hosts[i]
+		if host.Name != o.GetName() || host.Namespace == o.GetNamespace() {
+			continue
+		}
+		result = append(result, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(host)})
+	}
+	return result
+}
+
+// hostClusterKey returns the key of the Cluster a host is labeled for. The Cluster lives in the
+// namespace of the ByoMachine the host is attached to, which defaults to the namespace of the host.
+func hostClusterKey(byoHost *infrastructurev1beta1.ByoHost) (client.ObjectKey, bool) {
+	clusterName, ok := byoHost.Labels[clusterv1.ClusterNameLabel]
+	if !ok || clusterName == "" {
+		return client.ObjectKey{}, false
+	}
+
+	namespace := byoHost.Namespace
+	if byoHost.Status.MachineRef != nil && byoHost.Status.MachineRef.Namespace != "" {
+		namespace = byoHost.Status.MachineRef.Namespace
+	} else if machine, ok := byoHost.Labels[infrastructurev1beta1.AttachedByoMachineLabel]; ok {
+		// The label value is <namespace>.<name>, namespaces cannot contain dots
+		if machineNamespace, _, found := strings.Cut(machine, "."); found {
+			namespace = machineNamespace
+		}
+	}
+	return client.ObjectKey{Namespace: namespace, Name: clusterName}, true
+}
+
+// ClusterToByoHosts maps a Cluster to the ByoHosts labeled for it, so that they get released once the
+// Cluster is deleted
+func (r *ByoHostReconciler) ClusterToByoHosts(o client.Object) []ctrl.Request {
+	c, ok := o.(*clusterv1.Cluster)
+	if !ok {
+		return nil
+	}
+
+	byoHostList := &infrastructurev1beta1.ByoHostList{}
+	if err := r.Client.List(context.TODO(), byoHostList, client.MatchingLabels{clusterv1.ClusterNameLabel: c.Name}); err != nil {
+		return nil
+	}
+
+	result := make([]ctrl.Request, 0, len(byoHostList.Items))
+	for i := range byoHostList.Items {
+		if key, _ := hostClusterKey(&byoHostList.Items[i]); key.Namespace != c.Namespace {
+			continue
+		}
+		result = append(result, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&byoHostList.Items[i])})
+	}
+	return result
+}
+
+// byoHostPhase computes the phase of the ByoHost from its current state
+func byoHostPhase(byoHost *infrastructurev1beta1.ByoHost) infrastructurev1beta1.ByoHostPhase {
+	_, cleaningUp := byoHost.Annotations[infrastructurev1beta1.HostCleanupAnnotation]
+	switch {
+	case cleaningUp || !byoHost.DeletionTimestamp.IsZero():
+		return infrastructurev1beta1.ByoHostPhaseCleaningUp
+	case byoHost.IsQuarantined():
+		return infrastructurev1beta1.ByoHostPhaseQuarantined
+	case byoHost.Status.MachineRef == nil:
+		return infrastructurev1beta1.ByoHostPhaseAvailable
+	case conditions.IsTrue(byoHost, infrastructurev1beta1.K8sNodeBootstrapSucceeded):
+		return infrastructurev1beta1.ByoHostPhaseProvisioned
+	default:
+		return infrastructurev1beta1.ByoHostPhaseProvisioning
+	}
+}
+
+// confirmForceCleanup returns whether the agent stayed silent for the ForceCleanupConfirmationWindow since the
+// cleanup timeout of the host was exceeded, and else when to check again. An agent sending a heartbeat or updating a
+// condition of the host within the window aborts the force cleanup and gets a full cleanup timeout again.
+func (r *ByoHostReconciler) confirmForceCleanup(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost) (bool, time.Duration) {
+	logger := log.FromContext(ctx)
+
+	if r.ForceCleanupConfirmationWindow <= 0 {
+		return true, 0
+	}
+	confirmationStarted, err := time.Parse(time.RFC3339, byoHost.Annotations[infrastructurev1beta1.ForceCleanupConfirmationAnnotation])
+	if err != nil {
+		byoHost.Annotations[infrastructurev1beta1.ForceCleanupConfirmationAnnotation] = time.Now().Format(time.RFC3339)
+		logger.Info("Cleanup timeout exceeded, confirming the agent is unavailable before the force cleanup",
+			"window", r.ForceCleanupConfirmationWindow)
+		return false, r.ForceCleanupConfirmationWindow
+	}
+	if agentActiveSince(byoHost, confirmationStarted) {
+		logger.Info("Agent is active again, aborting the force cleanup")
+		delete(byoHost.Annotations, infrastructurev1beta1.ForceCleanupConfirmationAnnotation)
+		byoHost.Annotations[infrastructurev1beta1.CleanupStartedAtAnnotation] = time.Now().Format(time.RFC3339)
+		return false, r.getCleanupTimeout(byoHost)
+	}
+	if remaining := r.ForceCleanupConfirmationWindow - time.Since(confirmationStarted); remaining > 0 {
+		return false, remaining
+	}
+	return true, 0
+}
+
+// maintenanceWindowWait returns how long the force cleanup of the host is deferred until its maintenance window opens,
+// zero when the host has no maintenance window or it is open. An invalid window is ignored, so a typo does not keep a
+// host whose agent is gone bound forever.
+func maintenanceWindowWait(ctx context.Context, byoHost *infrastructurev1beta1.ByoHost, now time.Time) time.Duration {
+	logger := log.FromContext(ctx)
+
+	value, ok := byoHost.Annotations[infrastructurev1beta1.MaintenanceWindowAnnotation]
+	if !ok {
+		return 0
+	}
+	window, err := parseMaintenanceWindow(value)
+	if err != nil {
+		logger.Error(err, "ignoring the invalid maintenance window of the host")
+		return 0
+	}
+	wait := window.untilOpen(now)
+	if wait > 0 {
+		logger.Info("Deferring the force cleanup until the maintenance window opens", "window", value, "opensIn", wait)
+	}
+	return wait
+}
+
+// agentActiveSince returns whether the agent of the host sent a heartbeat, or changed a condition of the host, since
+// the given time. The conditions cover the agents that do not send heartbeats.
+func agentActiveSince(byoHost *infrastructurev1beta1.ByoHost, since time.Time) bool {
+	if heartbeat := byoHost.Status.LastHeartbeatTime; heartbeat != nil && !heartbeat.Time.Before(since) {
+		return true
+	}
+	for _, condition := range byoHost.GetConditions() {
+		if condition.Type == infrastructurev1beta1.NodeNameUnique {
+			// Set by this controller
+			continue
+		}
+		if !condition.LastTransitionTime.Time.Before(since) {
+			return true
+		}
+	}
+	return false
+}
+
 // getCleanupTimeout calculates the timeout for host cleanup based on host capacity and configuration
 // This allows for dynamic adjustment of timeout based on host size and environment conditions
 func (r *ByoHostReconciler) getCleanupTimeout(byoHost *infrastructurev1beta1.ByoHost) time.Duration {
@@ -219,9 +471,19 @@ func (r *ByoHostReconciler) getCleanupTimeout(byoHost *infrastructurev1beta1.Byo
 	return timeout
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. The ByoHostNameField index must be registered.
 func (r *ByoHostReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrastructurev1beta1.ByoHost{}).
+		// Watch the Clusters to release their hosts once they are deleted.
+		Watches(
+			&source.Kind{Type: &clusterv1.Cluster{}},
+			handler.EnqueueRequestsFromMapFunc(r.ClusterToByoHosts),
+		).
+		// Watch the other ByoHosts to flag the hosts sharing a node name.
+		Watches(
+			&source.Kind{Type: &infrastructurev1beta1.ByoHost{}},
+			handler.EnqueueRequestsFromMapFunc(r.ByoHostToDuplicates),
+		).
 		Complete(r)
 }
@@ -0,0 +1,614 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-logr/logr"
+	infrav1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// indexedClientBuilder returns a fake client builder with the ByoHost index the controllers look up hosts with
+func indexedClientBuilder(scheme *runtime.Scheme) *fake.ClientBuilder {
+	return fake.NewClientBuilder().WithScheme(scheme).WithIndex(&infrav1.ByoHost{}, ByoHostNameField, ByoHostNameIndexer)
+}
+
+var _ = Describe("ByoHostController/Unit", func() {
+	Context("When the agent does not complete the host cleanup in time", func() {
+		var (
+			ctx     context.Context
+			r       *ByoHostReconciler
+			hostKey types.NamespacedName
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+			byoHost := &infrav1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-host",
+					Namespace: "default",
+					Annotations: map[string]string{
+						infrav1.HostCleanupAnnotation:      "",
+						infrav1.CleanupStartedAtAnnotation: time.Now().Add(-20 * time.Minute).Format(time.RFC3339),
+					},
+				},
+				Status: infrav1.ByoHostStatus{
+					MachineRef: &corev1.ObjectReference{Kind: "ByoMachine", Namespace: "default", Name: "test-machine"},
+				},
+			}
+			hostKey = types.NamespacedName{Name: byoHost.Name, Namespace: byoHost.Namespace}
+			r = &ByoHostReconciler{Client: indexedClientBuilder(scheme).WithObjects(byoHost).Build()}
+		})
+
+		It("should record the force cleanup in the status and keep it", func() {
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: hostKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			byoHost := &infrav1.ByoHost{}
+			Expect(r.Client.Get(ctx, hostKey, byoHost)).To(Succeed())
+			Expect(byoHost.Status.MachineRef).To(BeNil())
+			Expect(byoHost.Annotations).NotTo(HaveKey(infrav1.HostCleanupAnnotation))
+			Expect(byoHost.Status.LastForceCleanup).NotTo(BeNil())
+			Expect(byoHost.Status.LastForceCleanup.Reason).To(Equal(infrav1.ForceCleanupAgentUnavailableReason))
+			Expect(byoHost.Status.LastForceCleanup.Timeout.Duration).To(Equal(defaultHostCleanupTimeout))
+			Expect(byoHost.Status.LastForceCleanup.Elapsed.Duration).To(BeNumerically(">=", 20*time.Minute))
+			Expect(byoHost.Status.LastForceCleanup.Timestamp.IsZero()).To(BeFalse())
+			Expect(byoHost.Status.LastForceCleanup.AgentAcknowledged).To(BeFalse())
+			recorded := byoHost.Status.LastForceCleanup.DeepCopy()
+
+			// A later reconcile without a pending cleanup retains the record
+			_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: hostKey})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Client.Get(ctx, hostKey, byoHost)).To(Succeed())
+			Expect(byoHost.Status.LastForceCleanup).To(Equal(recorded))
+		})
+	})
+	Context("When the force cleanup of a host is confirmed", func() {
+		var (
+			ctx     context.Context
+			r       *ByoHostReconciler
+			hostKey types.NamespacedName
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+			byoHost := &infrav1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-host",
+					Namespace: "default",
+					Annotations: map[string]string{
+						infrav1.HostCleanupAnnotation:      "",
+						infrav1.CleanupStartedAtAnnotation: time.Now().Add(-20 * time.Minute).Format(time.RFC3339),
+					},
+				},
+				Status: infrav1.ByoHostStatus{
+					MachineRef: &corev1.ObjectReference{Kind: "ByoMachine", Namespace: "default", Name: "test-machine"},
+				},
+			}
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test-host"}}
+			hostKey = types.NamespacedName{Name: byoHost.Name, Namespace: byoHost.Namespace}
+			r = &ByoHostReconciler{
+				Client:                         indexedClientBuilder(scheme).WithObjects(byoHost, node).Build(),
+				ForceCleanupConfirmationWindow: time.Minute,
+			}
+		})
+
+		reconcileHost := func() (ctrl.Result, *infrav1.ByoHost) {
+			result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: hostKey})
+			Expect(err).NotTo(HaveOccurred())
+			byoHost := &infrav1.ByoHost{}
+			Expect(r.Client.Get(ctx, hostKey, byoHost)).To(Succeed())
+			return result, byoHost
+		}
+
+		// expireConfirmationWindow moves the start of the confirmation window of the host past the window
+		expireConfirmationWindow := func(byoHost *infrav1.ByoHost) {
+			byoHost.Annotations[infrav1.ForceCleanupConfirmationAnnotation] = time.Now().Add(-2 * time.Minute).Format(time.RFC3339)
+			Expect(r.Client.Update(ctx, byoHost)).To(Succeed())
+		}
+
+		nodeExists := func() bool {
+			err := r.Client.Get(ctx, client.ObjectKey{Name: "test-host"}, &corev1.Node{})
+			if apierrors.IsNotFound(err) {
+				return false
+			}
+			Expect(err).NotTo(HaveOccurred())
+			return true
+		}
+
+		It("should keep the Node until the confirmation window elapsed", func() {
+			result, byoHost := reconcileHost()
+			Expect(result.RequeueAfter).To(Equal(time.Minute))
+			Expect(byoHost.Annotations).To(HaveKey(infrav1.ForceCleanupConfirmationAnnotation))
+			Expect(byoHost.Status.MachineRef).NotTo(BeNil())
+			Expect(byoHost.Status.LastForceCleanup).To(BeNil())
+			Expect(nodeExists()).To(BeTrue())
+
+			result, _ = reconcileHost()
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			Expect(nodeExists()).To(BeTrue())
+		})
+
+		It("should force the cleanup when the agent stayed silent", func() {
+			_, byoHost := reconcileHost()
+			expireConfirmationWindow(byoHost)
+
+			_, byoHost = reconcileHost()
+			Expect(nodeExists()).To(BeFalse())
+			Expect(byoHost.Status.MachineRef).To(BeNil())
+			Expect(byoHost.Status.LastForceCleanup).NotTo(BeNil())
+			Expect(byoHost.Annotations).NotTo(HaveKey(infrav1.HostCleanupAnnotation))
+			Expect(byoHost.Annotations).NotTo(HaveKey(infrav1.ForceCleanupConfirmationAnnotation))
+		})
+
+		It("should abort the force cleanup when the agent recovers within the window", func() {
+			_, byoHost := reconcileHost()
+			// The agent makes progress on the cleanup
+			conditions.MarkFalse(byoHost, infrav1.K8sNodeBootstrapSucceeded, infrav1.K8sNodeAbsentReason, clusterv1.ConditionSeverityInfo, "")
+			Expect(r.Client.Status().Update(ctx, byoHost)).To(Succeed())
+			expireConfirmationWindow(byoHost)
+
+			result, byoHost := reconcileHost()
+			Expect(result.RequeueAfter).To(Equal(defaultHostCleanupTimeout))
+			Expect(nodeExists()).To(BeTrue())
+			Expect(byoHost.Status.MachineRef).NotTo(BeNil())
+			Expect(byoHost.Status.LastForceCleanup).To(BeNil())
+			Expect(byoHost.Annotations).To(HaveKey(infrav1.HostCleanupAnnotation))
+			Expect(byoHost.Annotations).NotTo(HaveKey(infrav1.ForceCleanupConfirmationAnnotation))
+			startedAt, err := time.Parse(time.RFC3339, byoHost.Annotations[infrav1.CleanupStartedAtAnnotation])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(time.Since(startedAt)).To(BeNumerically("<", time.Minute))
+		})
+
+		It("should abort the force cleanup when the agent sends a heartbeat within the window", func() {
+			_, byoHost := reconcileHost()
+			now := metav1.Now()
+			byoHost.Status.LastHeartbeatTime = &now
+			Expect(r.Client.Status().Update(ctx, byoHost)).To(Succeed())
+			expireConfirmationWindow(byoHost)
+
+			result, byoHost := reconcileHost()
+			Expect(result.RequeueAfter).To(Equal(defaultHostCleanupTimeout))
+			Expect(nodeExists()).To(BeTrue())
+			Expect(byoHost.Status.MachineRef).NotTo(BeNil())
+			Expect(byoHost.Annotations).NotTo(HaveKey(infrav1.ForceCleanupConfirmationAnnotation))
+		})
+
+		It("should not count a heartbeat from before the window as agent activity", func() {
+			byoHost := &infrav1.ByoHost{}
+			heartbeat := metav1.NewTime(time.Now().Add(-2 * time.Minute))
+			byoHost.Status.LastHeartbeatTime = &heartbeat
+			Expect(agentActiveSince(byoHost, time.Now().Add(-time.Minute))).To(BeFalse())
+
+			heartbeat = metav1.Now()
+			Expect(agentActiveSince(byoHost, time.Now().Add(-time.Minute))).To(BeTrue())
+		})
+
+		It("should not count the conditions set by the controller as agent activity", func() {
+			byoHost := &infrav1.ByoHost{}
+			conditions.MarkTrue(byoHost, infrav1.NodeNameUnique)
+			Expect(agentActiveSince(byoHost, time.Now().Add(-time.Minute))).To(BeFalse())
+
+			conditions.MarkTrue(byoHost, infrav1.K8sNodeBootstrapSucceeded)
+			Expect(agentActiveSince(byoHost, time.Now().Add(-time.Minute))).To(BeTrue())
+		})
+	})
+
+	Context("When the force cleanup of a host is restricted to a maintenance window", func() {
+		var (
+			ctx     context.Context
+			r       *ByoHostReconciler
+			hostKey types.NamespacedName
+		)
+
+		// createHost creates a host whose cleanup timeout is exceeded with the given maintenance window
+		createHost := func(window string) {
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+			byoHost := &infrav1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-host",
+					Namespace: "default",
+					Annotations: map[string]string{
+						infrav1.HostCleanupAnnotation:       "",
+						infrav1.CleanupStartedAtAnnotation:  time.Now().Add(-20 * time.Minute).Format(time.RFC3339),
+						infrav1.MaintenanceWindowAnnotation: window,
+					},
+				},
+				Status: infrav1.ByoHostStatus{
+					MachineRef: &corev1.ObjectReference{Kind: "ByoMachine", Namespace: "default", Name: "test-machine"},
+				},
+			}
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test-host"}}
+			hostKey = types.NamespacedName{Name: byoHost.Name, Namespace: byoHost.Namespace}
+			r = &ByoHostReconciler{Client: indexedClientBuilder(scheme).WithObjects(byoHost, node).Build()}
+		}
+
+		// timeRange returns the HH:MM-HH:MM range in UTC between the given offsets from now
+		timeRange := func(from, to time.Duration) string {
+			now := time.Now().UTC()
+			return now.Add(from).Format("15:04") + "-" + now.Add(to).Format("15:04")
+		}
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+		})
+
+		It("should defer the force cleanup while the window is closed", func() {
+			createHost(timeRange(2*time.Hour, 3*time.Hour))
+
+			result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: hostKey})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("~", 2*time.Hour, time.Minute))
+
+			byoHost := &infrav1.ByoHost{}
+			Expect(r.Client.Get(ctx, hostKey, byoHost)).To(Succeed())
+			Expect(byoHost.Status.MachineRef).NotTo(BeNil())
+			Expect(byoHost.Status.LastForceCleanup).To(BeNil())
+			Expect(byoHost.Annotations).To(HaveKey(infrav1.HostCleanupAnnotation))
+			Expect(r.Client.Get(ctx, client.ObjectKey{Name: "test-host"}, &corev1.Node{})).To(Succeed())
+		})
+
+		It("should force the cleanup while the window is open", func() {
+			createHost(timeRange(-time.Hour, time.Hour))
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: hostKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			byoHost := &infrav1.ByoHost{}
+			Expect(r.Client.Get(ctx, hostKey, byoHost)).To(Succeed())
+			Expect(byoHost.Status.MachineRef).To(BeNil())
+			Expect(byoHost.Status.LastForceCleanup).NotTo(BeNil())
+			Expect(apierrors.IsNotFound(r.Client.Get(ctx, client.ObjectKey{Name: "test-host"}, &corev1.Node{}))).To(BeTrue())
+		})
+
+		It("should ignore an invalid window", func() {
+			createHost("whenever")
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: hostKey})
+			Expect(err).NotTo(HaveOccurred())
+
+			byoHost := &infrav1.ByoHost{}
+			Expect(r.Client.Get(ctx, hostKey, byoHost)).To(Succeed())
+			Expect(byoHost.Status.LastForceCleanup).NotTo(BeNil())
+		})
+
+		// Wednesday noon
+		wednesday := time.Date(2024, time.June, 5, 12, 0, 0, 0, time.UTC)
+
+		DescribeTable("should compute when the window opens",
+			func(value string, expected time.Duration) {
+				window, err := parseMaintenanceWindow(value)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(window.untilOpen(wednesday)).To(Equal(expected))
+			},
+			Entry("within a daily window", "10:00-14:00", time.Duration(0)),
+			Entry("before a daily window", "13:00-14:00", time.Hour),
+			Entry("before a window crossing midnight", "22:00-06:00", 10*time.Hour),
+			Entry("within a window crossing midnight opened the day before", "Tue 22:00-13:00", time.Duration(0)),
+			Entry("before a window on the weekend", "Sat,Sun 00:00-06:00", 60*time.Hour),
+			Entry("before a range of days wrapping around the week", "Fri-Mon 10:00-11:00", 46*time.Hour),
+			Entry("after the window of the day", "Wed 08:00-09:00", 7*24*time.Hour-4*time.Hour),
+		)
+
+		DescribeTable("should reject an invalid window",
+			func(value string) {
+				_, err := parseMaintenanceWindow(value)
+				Expect(err).To(HaveOccurred())
+			},
+			Entry("without a time range", "Mon-Fri"),
+			Entry("with an unknown day", "Someday 10:00-11:00"),
+			Entry("with an hour only", "10-11"),
+			Entry("with an invalid time", "10:00-25:00"),
+			Entry("with extra fields", "Mon 10:00-11:00 UTC"),
+		)
+	})
+
+	Context("When computing the phase of a ByoHost", func() {
+		var byoHost *infrav1.ByoHost
+
+		BeforeEach(func() {
+			byoHost = &infrav1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: "default"}}
+		})
+
+		It("should be available when not bound to a machine", func() {
+			Expect(byoHostPhase(byoHost)).To(Equal(infrav1.ByoHostPhaseAvailable))
+		})
+
+		It("should be provisioning until the node is bootstrapped", func() {
+			byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Namespace: "default", Name: "test-machine"}
+			Expect(byoHostPhase(byoHost)).To(Equal(infrav1.ByoHostPhaseProvisioning))
+
+			conditions.MarkTrue(byoHost, infrav1.K8sNodeBootstrapSucceeded)
+			Expect(byoHostPhase(byoHost)).To(Equal(infrav1.ByoHostPhaseProvisioned))
+		})
+
+		It("should be quarantined when labeled so", func() {
+			byoHost.Labels = map[string]string{infrav1.QuarantinedLabel: ""}
+			Expect(byoHostPhase(byoHost)).To(Equal(infrav1.ByoHostPhaseQuarantined))
+		})
+
+		It("should be cleaning up once marked for cleanup", func() {
+			byoHost.Status.MachineRef = &corev1.ObjectReference{Kind: "ByoMachine", Namespace: "default", Name: "test-machine"}
+			byoHost.Labels = map[string]string{infrav1.QuarantinedLabel: ""}
+			byoHost.Annotations = map[string]string{infrav1.HostCleanupAnnotation: ""}
+			Expect(byoHostPhase(byoHost)).To(Equal(infrav1.ByoHostPhaseCleaningUp))
+		})
+
+		It("should record the phase in the status on reconcile", func() {
+			scheme := runtime.NewScheme()
+			Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+			r := &ByoHostReconciler{Client: indexedClientBuilder(scheme).WithObjects(byoHost).Build()}
+			hostKey := types.NamespacedName{Name: byoHost.Name, Namespace: byoHost.Namespace}
+
+			_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: hostKey})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Client.Get(context.TODO(), hostKey, byoHost)).To(Succeed())
+			Expect(byoHost.Status.Phase).To(Equal(infrav1.ByoHostPhaseAvailable))
+		})
+	})
+
+	Context("When the cluster of a ByoHost was deleted", func() {
+		var (
+			ctx     context.Context
+			scheme  *runtime.Scheme
+			byoHost *infrav1.ByoHost
+			hostKey types.NamespacedName
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			scheme = runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+			Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+			byoHost = &infrav1.ByoHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-host",
+					Namespace: "default",
+					Labels: map[string]string{
+						clusterv1.ClusterNameLabel:      "test-cluster",
+						infrav1.AttachedByoMachineLabel: "workload.test-machine",
+					},
+					Annotations: map[string]string{HostLeaseAnnotationKey: "lease"},
+				},
+				Status: infrav1.ByoHostStatus{
+					MachineRef: &corev1.ObjectReference{Kind: "ByoMachine", Namespace: "workload", Name: "test-machine"},
+				},
+			}
+			hostKey = types.NamespacedName{Name: byoHost.Name, Namespace: byoHost.Namespace}
+		})
+
+		reconcileHost := func(r *ByoHostReconciler) *infrav1.ByoHost {
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: hostKey})
+			Expect(err).NotTo(HaveOccurred())
+			host := &infrav1.ByoHost{}
+			Expect(r.Client.Get(ctx, hostKey, host)).To(Succeed())
+			return host
+		}
+
+		It("should release an attached host for cleanup", func() {
+			r := &ByoHostReconciler{Client: indexedClientBuilder(scheme).WithObjects(byoHost).Build()}
+
+			host := reconcileHost(r)
+			Expect(host.Status.MachineRef).To(BeNil())
+			Expect(host.Labels).NotTo(HaveKey(infrav1.AttachedByoMachineLabel))
+			Expect(host.Annotations).To(HaveKey(infrav1.HostCleanupAnnotation))
+			Expect(host.Annotations).NotTo(HaveKey(HostLeaseAnnotationKey))
+			// The agent removes the cluster label once it reset the host
+			Expect(host.Labels).To(HaveKeyWithValue(clusterv1.ClusterNameLabel, "test-cluster"))
+		})
+
+		It("should return a detached host to the pool", func() {
+			delete(byoHost.Labels, infrav1.AttachedByoMachineLabel)
+			byoHost.Status.MachineRef = nil
+			r := &ByoHostReconciler{Client: indexedClientBuilder(scheme).WithObjects(byoHost).Build()}
+
+			host := reconcileHost(r)
+			Expect(host.Labels).NotTo(HaveKey(clusterv1.ClusterNameLabel))
+			Expect(host.Annotations).NotTo(HaveKey(infrav1.HostCleanupAnnotation))
+			Expect(host.Status.Phase).To(Equal(infrav1.ByoHostPhaseAvailable))
+		})
+
+		It("should keep a host whose cluster exists", func() {
+			cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "workload"}}
+			r := &ByoHostReconciler{Client: indexedClientBuilder(scheme).WithObjects(byoHost, cluster).Build()}
+
+			host := reconcileHost(r)
+			Expect(host.Status.MachineRef).NotTo(BeNil())
+			Expect(host.Labels).To(HaveKey(infrav1.AttachedByoMachineLabel))
+			Expect(host.Annotations).NotTo(HaveKey(infrav1.HostCleanupAnnotation))
+		})
+
+		It("should map a cluster to the hosts labeled for it", func() {
+			otherNamespace := byoHost.DeepCopy()
+			otherNamespace.Name = "other-namespace"
+			otherNamespace.Status.MachineRef.Namespace = "other"
+			r := &ByoHostReconciler{Client: indexedClientBuilder(scheme).WithObjects(byoHost, otherNamespace).Build()}
+
+			cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "workload"}}
+			Expect(r.ClusterToByoHosts(cluster)).To(ConsistOf(ctrl.Request{NamespacedName: hostKey}))
+		})
+	})
+
+	Context("When two ByoHosts map to the same node name", func() {
+		var (
+			ctx        context.Context
+			r          *ByoHostReconciler
+			hostKey    types.NamespacedName
+			otherKey   types.NamespacedName
+			uniqueKey  types.NamespacedName
+			reconciled func(types.NamespacedName) *infrav1.ByoHost
+		)
+
+		BeforeEach(func() {
+			ctx = context.TODO()
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+			// A misconfigured agent registered the same host in another namespace
+			byoHost := &infrav1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Namespace: "default"}}
+			duplicate := &infrav1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Namespace: "other"}}
+			unique := &infrav1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "node-2", Namespace: "default"}}
+			hostKey = client.ObjectKeyFromObject(byoHost)
+			otherKey = client.ObjectKeyFromObject(duplicate)
+			uniqueKey = client.ObjectKeyFromObject(unique)
+			r = &ByoHostReconciler{Client: indexedClientBuilder(scheme).WithObjects(byoHost, duplicate, unique).Build()}
+
+			reconciled = func(key types.NamespacedName) *infrav1.ByoHost {
+				_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+				Expect(err).NotTo(HaveOccurred())
+				host := &infrav1.ByoHost{}
+				Expect(r.Client.Get(ctx, key, host)).To(Succeed())
+				return host
+			}
+		})
+
+		It("should flag both hosts with a duplicate node name", func() {
+			host := reconciled(hostKey)
+			Expect(conditions.IsFalse(host, infrav1.NodeNameUnique)).To(BeTrue())
+			Expect(conditions.GetReason(host, infrav1.NodeNameUnique)).To(Equal(infrav1.DuplicateNodeNameReason))
+			Expect(conditions.GetMessage(host, infrav1.NodeNameUnique)).To(ContainSubstring("other/node-1"))
+
+			other := reconciled(otherKey)
+			Expect(conditions.IsFalse(other, infrav1.NodeNameUnique)).To(BeTrue())
+			Expect(conditions.GetMessage(other, infrav1.NodeNameUnique)).To(ContainSubstring("default/node-1"))
+
+			Expect(conditions.IsTrue(reconciled(uniqueKey), infrav1.NodeNameUnique)).To(BeTrue())
+		})
+
+		It("should clear the flag once the duplicate is deleted", func() {
+			Expect(conditions.IsFalse(reconciled(hostKey), infrav1.NodeNameUnique)).To(BeTrue())
+
+			Expect(r.Client.Delete(ctx, &infrav1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: otherKey.Name, Namespace: otherKey.Namespace}})).To(Succeed())
+			Expect(conditions.IsTrue(reconciled(hostKey), infrav1.NodeNameUnique)).To(BeTrue())
+		})
+
+		It("should map a host to the other hosts with its node name", func() {
+			host := &infrav1.ByoHost{}
+			Expect(r.Client.Get(ctx, hostKey, host)).To(Succeed())
+			Expect(r.ByoHostToDuplicates(host)).To(ConsistOf(ctrl.Request{NamespacedName: otherKey}))
+
+			unique := &infrav1.ByoHost{}
+			Expect(r.Client.Get(ctx, uniqueKey, unique)).To(Succeed())
+			Expect(r.ByoHostToDuplicates(unique)).To(BeEmpty())
+		})
+
+		It("should not attach either host to a machine", func() {
+			machineReconciler := &ByoMachineReconciler{}
+			var hosts []infrav1.ByoHost
+			for _, key := range []types.NamespacedName{hostKey, otherKey} {
+				hosts = append(hosts, *reconciled(key))
+			}
+			Expect(machineReconciler.selectHostForClaim(hosts, "cluster", &infrav1.ByoMachine{})).To(BeNil())
+
+			hosts = append(hosts, *reconciled(uniqueKey))
+			Expect(machineReconciler.selectHostForClaim(hosts, "cluster", &infrav1.ByoMachine{}).Name).To(Equal("node-2"))
+		})
+	})
+
+	Context("When the deferred patch of a ByoHost conflicts", func() {
+		var (
+			r       *ByoHostReconciler
+			hostKey types.NamespacedName
+		)
+
+		BeforeEach(func() {
+			scheme := runtime.NewScheme()
+			Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+			byoHost := &infrav1.ByoHost{ObjectMeta: metav1.ObjectMeta{Name: "test-host", Namespace: "default"}}
+			hostKey = types.NamespacedName{Name: byoHost.Name, Namespace: byoHost.Namespace}
+			r = &ByoHostReconciler{Client: conflictingPatchClient{indexedClientBuilder(scheme).WithObjects(byoHost).Build()}}
+		})
+
+		It("should requeue without an error", func() {
+			res, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: hostKey})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Requeue).To(BeTrue())
+		})
+	})
+
+	Context("When classifying the error of a deferred patch", func() {
+		conflict := apierrors.NewConflict(schema.GroupResource{Resource: "byohosts"}, "test-host", errors.New("the object has been modified"))
+
+		It("should requeue quietly on a conflict, even aggregated", func() {
+			for _, patchErr := range []error{conflict, kerrors.NewAggregate([]error{conflict, conflict})} {
+				var res ctrl.Result
+				var reterr error
+				handleDeferredPatchError(logr.Discard(), "byohost", patchErr, &res, &reterr)
+				Expect(reterr).NotTo(HaveOccurred())
+				Expect(res.Requeue).To(BeTrue())
+			}
+		})
+
+		It("should return any other error", func() {
+			patchErr := kerrors.NewAggregate([]error{conflict, errors.New("connection refused")})
+			var res ctrl.Result
+			var reterr error
+			handleDeferredPatchError(logr.Discard(), "byohost", patchErr, &res, &reterr)
+			Expect(reterr).To(Equal(patchErr))
+			Expect(res.Requeue).To(BeFalse())
+		})
+
+		It("should keep the error returned by the reconcile", func() {
+			reconcileErr := errors.New("reconcile failed")
+			res := ctrl.Result{RequeueAfter: time.Minute}
+			reterr := reconcileErr
+			handleDeferredPatchError(logr.Discard(), "byohost", conflict, &res, &reterr)
+			Expect(reterr).To(Equal(reconcileErr))
+			Expect(res).To(Equal(ctrl.Result{RequeueAfter: time.Minute}))
+		})
+	})
+})
+
+// conflictingPatchClient fails every patch with a conflict, as if the object was updated concurrently
+type conflictingPatchClient struct {
+	client.Client
+}
+
+func (c conflictingPatchClient) Patch(_ context.Context, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+	return apierrors.NewConflict(schema.GroupResource{}, obj.GetName(), errors.New("the object has been modified"))
+}
+
+func (c conflictingPatchClient) Status() client.SubResourceWriter {
+	return conflictingStatusWriter{c.Client.Status()}
+}
+
+type conflictingStatusWriter struct {
+	client.SubResourceWriter
+}
+
+func (w conflictingStatusWriter) Patch(_ context.Context, obj client.Object, _ client.Patch, _ ...client.SubResourcePatchOption) error {
+	return apierrors.NewConflict(schema.GroupResource{}, obj.GetName(), errors.New("the object has been modified"))
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"fmt"
+
+	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/test/builder"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+var _ = Describe("Controllers/ByohostController", func() {
+	Context("When listing ByoHosts with kubectl", func() {
+		var (
+			byoHost     *infrastructurev1beta1.ByoHost
+			machineName = "printer-column-machine"
+		)
+
+		BeforeEach(func() {
+			byoHost = builder.ByoHost(defaultNamespace, "printer-column-host").
+				WithLabels(map[string]string{clusterv1.ClusterNameLabel: defaultClusterName}).
+				Build()
+			Expect(k8sManager.GetClient().Create(ctx, byoHost)).Should(Succeed())
+
+			byoHost.Status.MachineRef = &corev1.ObjectReference{
+				Kind:      "ByoMachine",
+				Namespace: defaultNamespace,
+				Name:      machineName,
+			}
+			byoHost.Status.Phase = infrastructurev1beta1.ByoHostPhaseProvisioned
+			Expect(k8sManager.GetClient().Status().Update(ctx, byoHost)).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(k8sManager.GetClient().Delete(ctx, byoHost)).Should(Succeed())
+		})
+
+		It("should render the bound cluster, machine and phase columns", func() {
+			clientset, err := kubernetes.NewForConfig(cfg)
+			Expect(err).NotTo(HaveOccurred())
+
+			raw, err := clientset.Discovery().RESTClient().Get().
+				AbsPath(fmt.Sprintf("/apis/%s/namespaces/%s/byohosts/%s",
+					infrastructurev1beta1.GroupVersion.String(), defaultNamespace, byoHost.Name)).
+				SetHeader("Accept", "application/json;as=Table;v=v1;g=meta.k8s.io").
+				DoRaw(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			table := &metav1.Table{}
+			Expect(json.Unmarshal(raw, table)).To(Succeed())
+			Expect(table.Rows).To(HaveLen(1))
+
+			cells := map[string]interface{}{}
+			for i, column := range table.ColumnDefinitions {
+				cells[column.Name] = table.Rows[0].Cells[i]
+			}
+			Expect(cells).To(HaveKeyWithValue("Cluster", defaultClusterName))
+			Expect(cells).To(HaveKeyWithValue("Machine", machineName))
+			Expect(cells).To(HaveKeyWithValue("Phase", string(infrastructurev1beta1.ByoHostPhaseProvisioned)))
+		})
+	})
+})
@@ -0,0 +1,64 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	infrav1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ByoHostNameField is the field index of the ByoHosts by name. The agent registers a host under its hostname,
+// which is also the name of its Node, so the index looks up the hosts of a node in any namespace without
+// listing all the ByoHosts.
+const ByoHostNameField = "metadata.name"
+
+// ByoHostNameIndexer is the IndexerFunc of the ByoHostNameField index
+func ByoHostNameIndexer(o client.Object) []string {
+	return []string{o.GetName()}
+}
+
+// IndexByoHostByName registers the ByoHostNameField index, once per manager before the controllers using it
+// are set up
+func IndexByoHostByName(ctx context.Context, indexer client.FieldIndexer) error {
+	return indexer.IndexField(ctx, &infrav1.ByoHost{}, ByoHostNameField, ByoHostNameIndexer)
+}
+
+// byoHostsByName lists the ByoHosts with the given name, in the namespace or in all namespaces when empty
+func byoHostsByName(ctx context.Context, c client.Reader, name, namespace string) ([]infrav1.ByoHost, error) {
+	hostsList := &infrav1.ByoHostList{}
+	if err := c.List(ctx, hostsList, client.InNamespace(namespace), client.MatchingFields{ByoHostNameField: name}); err != nil {
+		return nil, err
+	}
+	return hostsList.Items, nil
+}
+
+// ByoHostMachineUIDField is the field index of the ByoHosts by the UID of the ByoMachine in their MachineRef, so
+// the host bound to a ByoMachine is looked up without listing all the ByoHosts, its attach label missing included
+const ByoHostMachineUIDField = "status.machineRef.uid"
+
+// ByoHostMachineUIDIndexer is the IndexerFunc of the ByoHostMachineUIDField index
+func ByoHostMachineUIDIndexer(o client.Object) []string {
+	host, ok := o.(*infrav1.ByoHost)
+	if !ok || host.Status.MachineRef == nil || host.Status.MachineRef.UID == "" {
+		return nil
+	}
+	return []string{string(host.Status.MachineRef.UID)}
+}
+
+// IndexByoHostByMachineUID registers the ByoHostMachineUIDField index, once per manager before the controllers
+// using it are set up
+func IndexByoHostByMachineUID(ctx context.Context, indexer client.FieldIndexer) error {
+	return indexer.IndexField(ctx, &infrav1.ByoHost{}, ByoHostMachineUIDField, ByoHostMachineUIDIndexer)
+}
+
+// byoHostsBoundTo lists the ByoHosts whose MachineRef is the ByoMachine, by its UID
+func byoHostsBoundTo(ctx context.Context, c client.Reader, byoMachine *infrav1.ByoMachine) ([]infrav1.ByoHost, error) {
+	hostsList := &infrav1.ByoHostList{}
+	if err := c.List(ctx, hostsList, client.MatchingFields{ByoHostMachineUIDField: string(byoMachine.UID)}); err != nil {
+		return nil, err
+	}
+	return hostsList.Items, nil
+}
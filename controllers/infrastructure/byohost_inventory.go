@@ -0,0 +1,134 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	infrav1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// HostInventoryVersion is the version of the host inventory schema.
+	// It is bumped on any incompatible change so external consumers can detect it.
+	HostInventoryVersion = "v2"
+	// HostInventoryPath is the path the host inventory endpoint is served on
+	HostInventoryPath = "/byohosts/inventory"
+)
+
+// HostInventory is a machine-readable snapshot of the ByoHost pool,
+// meant to be consumed by external schedulers and placement engines.
+type HostInventory struct {
+	// Version is the schema version, see HostInventoryVersion
+	Version string `json:"version"`
+	// Hosts are sorted by namespace and name
+	Hosts []HostInventoryEntry `json:"hosts"`
+}
+
+// HostInventoryEntry describes a single ByoHost of the inventory
+type HostInventoryEntry struct {
+	Namespace    string            `json:"namespace"`
+	Name         string            `json:"name"`
+	Phase        string            `json:"phase"`
+	Priority     int32             `json:"priority"`
+	Architecture string            `json:"architecture,omitempty"`
+	OSImage      string            `json:"osImage,omitempty"`
+	Capacity     map[string]string `json:"capacity,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Binding      *HostBinding      `json:"binding,omitempty"`
+}
+
+// HostBinding describes the ByoMachine a host is attached to
+type HostBinding struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Cluster   string `json:"cluster,omitempty"`
+}
+
+// BuildHostInventory builds the inventory snapshot of the given hosts
+func BuildHostInventory(hosts []infrav1.ByoHost) HostInventory {
+	inventory := HostInventory{
+		Version: HostInventoryVersion,
+		Hosts:   make([]HostInventoryEntry, 0, len(hosts)),
+	}
+	for i := range hosts {
+		inventory.Hosts = append(inventory.Hosts, hostInventoryEntry(&hosts[i]))
+	}
+	sort.Slice(inventory.Hosts, func(i, j int) bool {
+		if inventory.Hosts[i].Namespace != inventory.Hosts[j].Namespace {
+			return inventory.Hosts[i].Namespace < inventory.Hosts[j].Namespace
+		}
+		return inventory.Hosts[i].Name < inventory.Hosts[j].Name
+	})
+	return inventory
+}
+
+// ExportHostInventory lists the ByoHosts matching opts and returns their inventory snapshot as JSON
+func ExportHostInventory(ctx context.Context, c client.Reader, opts ...client.ListOption) ([]byte, error) {
+	hostsList := &infrav1.ByoHostList{}
+	if err := c.List(ctx, hostsList, opts...); err != nil {
+		return nil, err
+	}
+	return json.Marshal(BuildHostInventory(hostsList.Items))
+}
+
+// NewHostInventoryHandler returns a read-only HTTP handler serving the host inventory.
+// The optional namespace query parameter restricts the inventory to a namespace.
+func NewHostInventoryHandler(c client.Reader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var opts []client.ListOption
+		if namespace := req.URL.Query().Get("namespace"); namespace != "" {
+			opts = append(opts, client.InNamespace(namespace))
+		}
+		data, err := ExportHostInventory(req.Context(), c, opts...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	})
+}
+
+func hostInventoryEntry(byoHost *infrav1.ByoHost) HostInventoryEntry {
+	entry := HostInventoryEntry{
+		Namespace:    byoHost.Namespace,
+		Name:         byoHost.Name,
+		Phase:        string(byoHostPhase(byoHost)),
+		Priority:     byoHost.GetPriority(),
+		Architecture: byoHost.Status.HostDetails.Architecture,
+		OSImage:      byoHost.Status.HostDetails.OSImage,
+	}
+	if len(byoHost.Spec.Capacity) > 0 {
+		entry.Capacity = make(map[string]string, len(byoHost.Spec.Capacity))
+		for name, quantity := range byoHost.Spec.Capacity {
+			entry.Capacity[string(name)] = quantity.String()
+		}
+	}
+	if len(byoHost.Labels) > 0 {
+		entry.Labels = make(map[string]string, len(byoHost.Labels))
+		for k, v := range byoHost.Labels {
+			entry.Labels[k] = v
+		}
+	}
+	if byoHost.Status.MachineRef != nil {
+		entry.Binding = &HostBinding{
+			Namespace: byoHost.Status.MachineRef.Namespace,
+			Name:      byoHost.Status.MachineRef.Name,
+			Cluster:   byoHost.Labels[clusterv1.ClusterNameLabel],
+		}
+	}
+	return entry
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	controllers "github.com/mensylisir/cluster-api-provider-bringyourownhost/controllers/infrastructure"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("ByoHost inventory", func() {
+	var hosts []infrastructurev1beta1.ByoHost
+
+	BeforeEach(func() {
+		priority := int32(10)
+		hosts = []infrastructurev1beta1.ByoHost{
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "host-b",
+					Namespace: "pool",
+					Labels:    map[string]string{clusterv1.ClusterNameLabel: "cluster-1", "site": "apac"},
+				},
+				Spec: infrastructurev1beta1.ByoHostSpec{
+					Capacity: map[corev1.ResourceName]resource.Quantity{
+						corev1.ResourceCPU:    resource.MustParse("8"),
+						corev1.ResourceMemory: resource.MustParse("16Gi"),
+					},
+				},
+				Status: infrastructurev1beta1.ByoHostStatus{
+					MachineRef:  &corev1.ObjectReference{Kind: "ByoMachine", Namespace: "default", Name: "machine-1"},
+					HostDetails: infrastructurev1beta1.HostInfo{Architecture: "amd64", OSImage: "Ubuntu 22.04 LTS"},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "host-a", Namespace: "pool"},
+				Spec:       infrastructurev1beta1.ByoHostSpec{Priority: &priority},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "host-c",
+					Namespace: "pool",
+					Labels:    map[string]string{infrastructurev1beta1.QuarantinedLabel: "true"},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "host-d",
+					Namespace:   "other",
+					Annotations: map[string]string{infrastructurev1beta1.HostCleanupAnnotation: ""},
+				},
+				Status: infrastructurev1beta1.ByoHostStatus{
+					MachineRef: &corev1.ObjectReference{Kind: "ByoMachine", Namespace: "default", Name: "machine-2"},
+				},
+			},
+		}
+	})
+
+	It("should serialize the pool in a stable schema", func() {
+		data, err := json.Marshal(controllers.BuildHostInventory(hosts))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{
+			"version": "v2",
+			"hosts": [
+				{"namespace": "other", "name": "host-d", "phase": "CleaningUp", "priority": 0,
+				 "binding": {"namespace": "default", "name": "machine-2"}},
+				{"namespace": "pool", "name": "host-a", "phase": "Available", "priority": 10},
+				{"namespace": "pool", "name": "host-b", "phase": "Provisioning", "priority": 0,
+				 "architecture": "amd64", "osImage": "Ubuntu 22.04 LTS",
+				 "capacity": {"cpu": "8", "memory": "16Gi"},
+				 "labels": {"cluster.x-k8s.io/cluster-name": "cluster-1", "site": "apac"},
+				 "binding": {"namespace": "default", "name": "machine-1", "cluster": "cluster-1"}},
+				{"namespace": "pool", "name": "host-c", "phase": "Quarantined", "priority": 0,
+				 "labels": {"byoh.infrastructure.cluster.x-k8s.io/quarantined": "true"}}
+			]
+		}`))
+	})
+
+	It("should serialize an empty pool with an empty host list", func() {
+		data, err := json.Marshal(controllers.BuildHostInventory(nil))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{"version": "v2", "hosts": []}`))
+	})
+
+	Context("When served over HTTP", func() {
+		var handler http.Handler
+
+		BeforeEach(func() {
+			scheme := runtime.NewScheme()
+			Expect(infrastructurev1beta1.AddToScheme(scheme)).To(Succeed())
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+			for i := range hosts {
+				builder = builder.WithObjects(&hosts[i])
+			}
+			handler = controllers.NewHostInventoryHandler(builder.Build())
+		})
+
+		It("should return the inventory filtered by namespace", func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, controllers.HostInventoryPath+"?namespace=other", http.NoBody).WithContext(context.TODO()))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+
+			inventory := controllers.HostInventory{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &inventory)).To(Succeed())
+			Expect(inventory.Hosts).To(HaveLen(1))
+			Expect(inventory.Hosts[0].Name).To(Equal("host-d"))
+		})
+
+		It("should be read-only", func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, controllers.HostInventoryPath, http.NoBody))
+			Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+})
@@ -9,10 +9,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -24,8 +27,8 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/record"
+	certutil "k8s.io/client-go/util/cert"
 	"sigs.k8s.io/cluster-api/controllers/external"
-	"sigs.k8s.io/cluster-api/controllers/remote"
 	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
@@ -42,11 +45,15 @@ import (
 	"github.com/go-logr/logr"
 	infrav1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common/bootstrapsecret"
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common/bootstraptoken"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common/kubeletconfig"
 	appsv1 "k8s.io/api/apps/v1"
+	certv1 "k8s.io/api/certificates/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	bootstraputil "k8s.io/cluster-bootstrap/token/util"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/annotations"
@@ -63,26 +70,105 @@ const (
 
 	// HostLeaseAnnotationKey annotation key for lease-based locking
 	HostLeaseAnnotationKey = "byohost.infrastructure.cluster.x-k8s.io/lease"
-	// HostLeaseTimeoutSeconds lease timeout in seconds (30 seconds)
-	HostLeaseTimeoutSeconds = 30
-	// MaxRetries maximum number of retries for attaching a host
-	MaxRetries = 5
+	// DefaultHostLeaseTimeout is the default time a lease on a ByoHost is held before another ByoMachine may claim it
+	DefaultHostLeaseTimeout = 30 * time.Second
+	// DefaultHostAttachMaxRetries is the default number of hosts tried when attaching a host to a ByoMachine
+	DefaultHostAttachMaxRetries = 5
+
+	// DefaultRemoteClientRetries is the default number of retries when acquiring the workload cluster client
+	DefaultRemoteClientRetries = 3
+	// DefaultDeletionTimeout is the default bound of the deletion of a ByoMachine waiting for the cleanup of its host,
+	// above the longest host cleanup timeout of the ByoHost controller
+	DefaultDeletionTimeout = 30 * time.Minute
+	// DefaultCordonTimeout is the default bound of the time spent acquiring the workload cluster client to cordon
+	// the node of a host, so a cleanup is requeued rather than held up by a workload cluster that is not reachable
+	DefaultCordonTimeout = 2 * time.Second
 
 	// hostCleanupTimeout reference timeout for ByoMachine deletion
 	// This should match the default value in byohost_controller.go
 	hostCleanupTimeout = 5 * time.Minute
 )
 
+// errBootstrapDataMissing is returned when none of the methods of TLS Bootstrap mode provided
+// a CA certificate or a bootstrap kubeconfig
+var errBootstrapDataMissing = errors.New("failed to obtain CA certificate or bootstrap kubeconfig for TLS Bootstrap mode")
+
+// IRemoteClientGetter returns a client for the workload cluster, e.g. remote.ClusterCacheTracker
+type IRemoteClientGetter interface {
+	GetClient(ctx context.Context, cluster client.ObjectKey) (client.Client, error)
+}
+
 // ByoMachineReconciler reconciles a ByoMachine object
 type ByoMachineReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
-	Tracker  *remote.ClusterCacheTracker
+	Tracker  IRemoteClientGetter
 	Recorder record.EventRecorder
 
+	// RemoteClientRetries is the number of times a ByoMachine is requeued, with exponential backoff, when
+	// acquiring the workload cluster client fails before the workload cluster is reported as not reachable.
+	// RemoteClientTimeout bounds the time spent acquiring the client in a reconcile. No bound when zero.
+	RemoteClientRetries int
+	RemoteClientTimeout time.Duration
+	// DeletionTimeout bounds the deletion of a ByoMachine waiting for the cleanup of its host. Once exceeded the
+	// finalizer is removed regardless, e.g. when both the agent and the force cleanup of the ByoHost controller
+	// are stuck. No bound when zero.
+	DeletionTimeout time.Duration
+	// CordonTimeout bounds the time spent acquiring the workload cluster client to cordon the node of a host
+	// before its cleanup. DefaultCordonTimeout is used when zero.
+	CordonTimeout time.Duration
+	// HostLeaseTimeout is the time a lease on a ByoHost is held before another ByoMachine may claim it, e.g. longer
+	// with slow API servers. HostAttachMaxRetries is the number of hosts tried when attaching a host to a ByoMachine.
+	// DefaultHostLeaseTimeout and DefaultHostAttachMaxRetries are used when zero.
+	HostLeaseTimeout     time.Duration
+	HostAttachMaxRetries int
+
+	// KubeletHealthzBindAddress and KubeletHealthzPort configure the kubelet healthz endpoint
+	// in the generated default KubeletConfiguration. Defaults are used when empty.
+	KubeletHealthzBindAddress string
+	KubeletHealthzPort        int32
+	// KubeletEvictionHard are hard eviction thresholds by signal overriding the defaults of the
+	// generated default KubeletConfiguration
+	KubeletEvictionHard map[string]string
+	// BootstrapTokenOptions configure the usages and groups of the bootstrap tokens kubelet joins
+	// the workload cluster with in TLS Bootstrap mode
+	BootstrapTokenOptions bootstraptoken.Options
+	// BootstrapSecretKeys map the keys the bootstrap data secret of a Machine stores the artifacts of TLS Bootstrap
+	// mode under, for bootstrap providers with another layout than the default keys
+	BootstrapSecretKeys bootstrapsecret.KeyMap
+	// HostScorers rank the available hosts when a ByoMachine claims one, see HostScorer.
+	// DefaultHostScorers are used when empty.
+	HostScorers []HostScorer
+
 	// roundRobinIndex tracks the last selected host for round-robin selection
 	// This is only for in-memory tracking and is not persisted
 	roundRobinIndex map[string]int
+	// reservations are the in-process reservations of the selected hosts by the namespace/name of the host,
+	// see hostReservation. The lease on a host keeps the other controller processes from claiming it.
+	reservations map[string]hostReservation
+	// roundRobinMu guards roundRobinIndex and reservations, which are shared across concurrent reconciles
+	roundRobinMu sync.Mutex
+	// remoteClientFailures counts the consecutive failures to acquire the workload cluster client by the
+	// namespace/name of the ByoMachine and the remoteClientPath acquiring it, guarded by remoteClientMu
+	remoteClientFailures map[string]int
+	remoteClientMu       sync.Mutex
+}
+
+// remoteClientPath names the step of the reconcile acquiring the workload cluster client, so that the
+// failures of one step do not count against, nor are reset by, the other
+type remoteClientPath string
+
+const (
+	remoteClientPathProviderID remoteClientPath = "providerID"
+	remoteClientPathCordon     remoteClientPath = "cordon"
+)
+
+// hostReservation reserves a selected ByoHost for the ByoMachine it was selected for, so the concurrent
+// reconciles of this process do not select the same host while the ByoMachine claims it. It is released once
+// the attach is done, or else expires after the host lease timeout.
+type hostReservation struct {
+	machine string
+	expires time.Time
 }
 
 // lockInfo holds lease lock information for a ByoHost
@@ -101,7 +187,7 @@ type lockInfo struct {
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;machines,verbs=get;list;watch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;machines/status,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
-// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;delete
 // +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -116,7 +202,7 @@ type lockInfo struct {
 
 // Reconcile handles ByoMachine events
 // nolint: gocyclo, funlen
-func (r *ByoMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
+func (r *ByoMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, reterr error) {
 	logger := log.FromContext(ctx)
 	logger.Info("Reconcile request received")
 
@@ -168,10 +254,7 @@ func (r *ByoMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	helper, _ := patch.NewHelper(byoMachine, r.Client)
 	defer func() {
-		if err = helper.Patch(ctx, byoMachine); err != nil && reterr == nil {
-			logger.Error(err, "failed to patch byomachine")
-			reterr = err
-		}
+		handleDeferredPatchError(logger, "byomachine", helper.Patch(ctx, byoMachine), &res, &reterr)
 	}()
 
 	// Fetch the BYOHost which is referencing this machine, if any
@@ -179,6 +262,11 @@ func (r *ByoMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
+	if refByoHost != nil && refByoHost.Status.MachineRef != nil && refByoHost.Status.MachineRef.UID != byoMachine.UID {
+		if refByoHost, err = r.correctStaleAttachLabel(ctx, byoMachine, refByoHost); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 	if refByoHost != nil {
 		logger = logger.WithValues("BYOHost", refByoHost.Name)
 	}
@@ -217,6 +305,36 @@ func (r *ByoMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	return r.reconcileNormal(ctx, machineScope)
 }
 
+// handleDeferredPatchError folds the error of the patch deferred by a reconcile into its result. A conflict
+// means the object was updated concurrently during the reconcile, it is retried by a quiet rate limited
+// requeue instead of being surfaced as a reconcile error. An error returned by the reconcile takes precedence.
+func handleDeferredPatchError(logger logr.Logger, kind string, patchErr error, res *ctrl.Result, reterr *error) {
+	if patchErr == nil || *reterr != nil {
+		return
+	}
+	if isConflictError(patchErr) {
+		logger.V(4).Info("Conflict patching "+kind+", requeueing", "error", patchErr.Error())
+		res.Requeue = true
+		return
+	}
+	logger.Error(patchErr, "failed to patch "+kind)
+	*reterr = patchErr
+}
+
+// isConflictError reports whether err, possibly aggregated by the patch helper, only consists of conflicts
+func isConflictError(err error) bool {
+	var aggregate kerrors.Aggregate
+	if errors.As(err, &aggregate) {
+		for _, e := range aggregate.Errors() {
+			if !isConflictError(e) {
+				return false
+			}
+		}
+		return len(aggregate.Errors()) > 0
+	}
+	return apierrors.IsConflict(err)
+}
+
 // FetchAttachedByoHost fetches BYOHost attached to this machine
 func (r *ByoMachineReconciler) FetchAttachedByoHost(ctx context.Context, byomachineName, byomachineNamespace string) (*infrav1.ByoHost, error) {
 	logger := log.FromContext(ctx)
@@ -246,24 +364,93 @@ func (r *ByoMachineReconciler) FetchAttachedByoHost(ctx context.Context, byomach
 	return refByoHost, nil
 }
 
+// correctStaleAttachLabel removes the AttachedByoMachineLabel from a ByoHost that is bound to a different
+// ByoMachine UID, e.g. to a deleted ByoMachine that was quickly recreated with the same name. A host still
+// bound to the previous ByoMachine of this name is released for cleanup, as its deletion would have done.
+// The host bound to the current ByoMachine UID, if any, gets the label restored and is returned instead.
+func (r *ByoMachineReconciler) correctStaleAttachLabel(ctx context.Context, byoMachine *infrav1.ByoMachine, byoHost *infrav1.ByoHost) (*infrav1.ByoHost, error) {
+	logger := log.FromContext(ctx)
+	staleRef := byoHost.Status.MachineRef
+	logger.Info("ByoHost is labeled for this ByoMachine but bound to a different UID, removing the stale label",
+		"byohost", byoHost.Name, "boundUID", staleRef.UID)
+
+	helper, err := patch.NewHelper(byoHost, r.Client)
+	if err != nil {
+		return nil, err
+	}
+	delete(byoHost.Labels, infrav1.AttachedByoMachineLabel)
+	if staleRef.Namespace == byoMachine.Namespace && staleRef.Name == byoMachine.Name {
+		if byoHost.Annotations == nil {
+			byoHost.Annotations = map[string]string{}
+		}
+		byoHost.Annotations[infrav1.HostCleanupAnnotation] = ""
+		byoHost.Status.MachineRef = nil
+		delete(byoHost.Annotations, HostLeaseAnnotationKey)
+	}
+	if err := helper.Patch(ctx, byoHost); err != nil {
+		return nil, err
+	}
+	r.Recorder.Eventf(byoMachine, corev1.EventTypeWarning, "StaleByoHostLabelRemoved",
+		"Removed stale attach label from ByoHost %s bound to ByoMachine UID %s", byoHost.Name, staleRef.UID)
+
+	hosts, err := byoHostsBoundTo(ctx, r.Client, byoMachine)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hosts {
+		host := &hosts[i]
+		logger.Info("Restoring the attach label of the ByoHost bound to this ByoMachine", "byohost", host.Name)
+		helper, err := patch.NewHelper(host, r.Client)
+		if err != nil {
+			return nil, err
+		}
+		if host.Labels == nil {
+			host.Labels = map[string]string{}
+		}
+		host.Labels[infrav1.AttachedByoMachineLabel] = byoMachine.Namespace + "." + byoMachine.Name
+		if err := helper.Patch(ctx, host); err != nil {
+			return nil, err
+		}
+		return host, nil
+	}
+	return nil, nil
+}
+
 func (r *ByoMachineReconciler) reconcileDelete(ctx context.Context, machineScope *byoMachineScope) (reconcile.Result, error) {
 	logger := log.FromContext(ctx).WithValues("cluster", machineScope.Cluster.Name)
 	logger.Info("Deleting ByoMachine")
 
+	// The bootstrap token of a ByoMachine deleted before its node joined is not deleted otherwise
+	if err := r.cleanupBootstrapTokenSecret(ctx, machineScope.ByoMachine); err != nil {
+		logger.Error(err, "failed to delete bootstrap token secret")
+		return reconcile.Result{}, err
+	}
+
+	if deleting := machineScope.ByoMachine.DeletionTimestamp; r.DeletionTimeout > 0 && !deleting.IsZero() && time.Since(deleting.Time) > r.DeletionTimeout {
+		host := "none"
+		if machineScope.ByoHost != nil {
+			host = machineScope.ByoHost.Name
+		}
+		logger.Info("Deletion timeout exceeded, removing the finalizer without waiting for the host cleanup",
+			"timeout", r.DeletionTimeout, "byohost", host)
+		r.Recorder.Eventf(machineScope.ByoMachine, corev1.EventTypeWarning, "ByoMachineDeletionForced",
+			"Deletion forced after %s, the cleanup of ByoHost %s was not confirmed", r.DeletionTimeout, host)
+		// CleanupCompleted is left unset, the host may still carry the node
+		machineScope.ByoMachine.Status.NodeRef = nil
+		controllerutil.RemoveFinalizer(machineScope.ByoMachine, infrav1.MachineFinalizer)
+		return reconcile.Result{}, nil
+	}
+
 	// If ByoHost is not found via label (e.g., stale label from previous Machine),
 	// try to find it by matching machineRef.UID with byoMachine.UID
 	if machineScope.ByoHost == nil {
-		hostsList := &infrav1.ByoHostList{}
-		if err := r.Client.List(ctx, hostsList); err != nil {
+		hosts, err := byoHostsBoundTo(ctx, r.Client, machineScope.ByoMachine)
+		if err != nil {
 			return reconcile.Result{}, err
 		}
-		for i := range hostsList.Items {
-			host := &hostsList.Items[i]
-			if host.Status.MachineRef != nil && host.Status.MachineRef.UID == machineScope.ByoMachine.UID {
-				logger.Info("Found ByoHost via machineRef UID match", "byohost", host.Name)
-				machineScope.ByoHost = host
-				break
-			}
+		if len(hosts) > 0 {
+			logger.Info("Found ByoHost via machineRef UID match", "byohost", hosts[0].Name)
+			machineScope.ByoHost = &hosts[0]
 		}
 	}
 
@@ -291,8 +478,8 @@ func (r *ByoMachineReconciler) reconcileDelete(ctx context.Context, machineScope
 		} else {
 			// Add annotation to trigger host cleanup
 			logger.Info("Releasing ByoHost", "byohost", machineScope.ByoHost.Name)
-			if err := r.markHostForCleanup(ctx, machineScope); err != nil {
-				return reconcile.Result{}, err
+			if result, err := r.markHostForCleanup(ctx, machineScope); err != nil || !result.IsZero() {
+				return result, err
 			}
 			r.Recorder.Eventf(machineScope.ByoHost, corev1.EventTypeNormal, "ByoHostReleaseSucceeded", "ByoHost Released by %s", machineScope.ByoMachine.Name)
 			r.Recorder.Eventf(machineScope.ByoMachine, corev1.EventTypeNormal, "ByoHostReleaseSucceeded", "Released ByoHost %s", machineScope.ByoHost.Name)
@@ -320,6 +507,14 @@ func (r *ByoMachineReconciler) reconcileNormal(ctx context.Context, machineScope
 
 	controllerutil.AddFinalizer(machineScope.ByoMachine, infrav1.MachineFinalizer)
 
+	// The bootstrap token of a ready ByoMachine is no longer needed, a failed deletion is retried until it is gone
+	if machineScope.ByoMachine.Status.Ready {
+		if err := r.cleanupBootstrapTokenSecret(ctx, machineScope.ByoMachine); err != nil {
+			logger.Error(err, "failed to delete bootstrap token secret")
+			return ctrl.Result{}, err
+		}
+	}
+
 	// Check if Machine is marked for remediation by MachineHealthCheck
 	if machineScope.Machine.Annotations != nil {
 		if _, isRemediation := machineScope.Machine.Annotations["cluster.x-k8s.io/remediation-for"]; isRemediation {
@@ -334,14 +529,14 @@ func (r *ByoMachineReconciler) reconcileNormal(ctx context.Context, machineScope
 						if err := r.Client.Get(ctx, types.NamespacedName{Name: nodeRef.Name}, node); err != nil {
 							// Node doesn't exist, safe to cleanup immediately
 							logger.Info("Node no longer exists, proceeding with immediate cleanup")
-							if err := r.markHostForCleanup(ctx, machineScope); err != nil {
-								return reconcile.Result{}, err
+							if result, err := r.markHostForCleanup(ctx, machineScope); err != nil || !result.IsZero() {
+								return result, err
 							}
 						} else if !node.DeletionTimestamp.IsZero() {
 							// Node is being deleted, safe to cleanup
 							logger.Info("Node is being deleted, proceeding with cleanup")
-							if err := r.markHostForCleanup(ctx, machineScope); err != nil {
-								return reconcile.Result{}, err
+							if result, err := r.markHostForCleanup(ctx, machineScope); err != nil || !result.IsZero() {
+								return result, err
 							}
 						}
 					}
@@ -350,6 +545,17 @@ func (r *ByoMachineReconciler) reconcileNormal(ctx context.Context, machineScope
 		}
 	}
 
+	if _, ok := machineScope.ByoMachine.Annotations[infrav1.ReleaseHostAnnotation]; ok {
+		result, err := r.releaseByoHost(ctx, machineScope)
+		if err != nil {
+			logger.Error(err, "failed to release byohost")
+			return ctrl.Result{}, err
+		}
+		if !result.IsZero() {
+			return result, nil
+		}
+	}
+
 	if machineScope.ByoHost != nil {
 		// if there is already byohost associated with it, make sure the paused status of byohost is false
 		if err := r.setPausedConditionForByoHost(ctx, machineScope, false); err != nil {
@@ -366,9 +572,11 @@ func (r *ByoMachineReconciler) reconcileNormal(ctx context.Context, machineScope
 	}
 
 	if !machineScope.Cluster.Status.InfrastructureReady {
-		logger.Info("Cluster infrastructure is not ready yet")
-		conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady, infrav1.WaitingForClusterInfrastructureReason, clusterv1.ConditionSeverityInfo, "")
-		return reconcile.Result{}, nil
+		message := clusterInfrastructureWaitMessage(machineScope)
+		logger.Info("Cluster infrastructure is not ready yet", "reason", message)
+		conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady, infrav1.WaitingForClusterInfrastructureReason, clusterv1.ConditionSeverityInfo, "%s", message)
+		// The Cluster watch may miss the change that unblocks the cluster, e.g. an endpoint set later on the ByoCluster
+		return reconcile.Result{RequeueAfter: RequeueForbyohost}, nil
 	}
 
 	// For TLS Bootstrap mode, we create our own bootstrap secret directly
@@ -386,7 +594,7 @@ func (r *ByoMachineReconciler) reconcileNormal(ctx context.Context, machineScope
 	// then pick one from the host capacity pool
 	if machineScope.ByoHost == nil {
 		logger.Info("Attempting host reservation")
-		if res, err := r.attachByoHost(ctx, machineScope); err != nil {
+		if res, err := r.attachByoHost(ctx, machineScope); err != nil || machineScope.ByoHost == nil {
 			return res, err
 		}
 		conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady, infrav1.InstallationSecretNotAvailableReason, clusterv1.ConditionSeverityInfo, "")
@@ -398,6 +606,11 @@ func (r *ByoMachineReconciler) reconcileNormal(ctx context.Context, machineScope
 		machineScope.ByoMachine.Status.HostInfo = machineScope.ByoHost.Status.HostDetails
 	}
 
+	if err := r.syncControlPlaneEndpoint(ctx, machineScope); err != nil {
+		logger.Error(err, "failed to update the control plane endpoint of the byohost")
+		return ctrl.Result{}, err
+	}
+
 	if machineScope.ByoMachine.Spec.InstallerRef != nil && machineScope.ByoHost.Spec.InstallationSecret == nil {
 		res, err := r.setInstallationSecretForByoHost(ctx, machineScope)
 		if err != nil {
@@ -413,24 +626,61 @@ func (r *ByoMachineReconciler) reconcileNormal(ctx context.Context, machineScope
 	return r.updateNodeProviderID(ctx, machineScope)
 }
 
+// clusterInfrastructureWaitMessage tells what keeps the infrastructure of the cluster from being ready
+func clusterInfrastructureWaitMessage(machineScope *byoMachineScope) string {
+	var missing []string
+	if machineScope.Cluster.Spec.InfrastructureRef == nil {
+		missing = append(missing, fmt.Sprintf("Cluster %s has no infrastructureRef", machineScope.Cluster.Name))
+	}
+	if machineScope.ByoCluster.Spec.ControlPlaneEndpoint.Host == "" {
+		missing = append(missing, fmt.Sprintf("control plane endpoint of ByoCluster %s is not set", machineScope.ByoCluster.Name))
+	}
+	if !machineScope.ByoCluster.Status.Ready {
+		missing = append(missing, fmt.Sprintf("ByoCluster %s is not ready", machineScope.ByoCluster.Name))
+	}
+	if len(missing) == 0 {
+		return fmt.Sprintf("waiting for Cluster %s to observe the ready ByoCluster %s", machineScope.Cluster.Name, machineScope.ByoCluster.Name)
+	}
+	return strings.Join(missing, "; ")
+}
+
 func (r *ByoMachineReconciler) updateNodeProviderID(ctx context.Context, machineScope *byoMachineScope) (ctrl.Result, error) {
 	logger := log.FromContext(ctx).WithValues("cluster", machineScope.Cluster.Name)
+	// The API server of a deleting cluster may already be gone, reaching it only produces errors
+	if !machineScope.Cluster.DeletionTimestamp.IsZero() {
+		logger.Info("Cluster is being deleted, skipping the node providerID update")
+		return ctrl.Result{}, nil
+	}
 	remoteClient, err := r.getRemoteClient(ctx, machineScope.ByoMachine)
 	if err != nil {
+		// The tracker transiently fails right after control plane endpoint changes, so the client is
+		// acquired again on a requeue with backoff instead of blocking the reconcile
+		failures := r.recordRemoteClientFailure(machineScope.ByoMachine, remoteClientPathProviderID)
+		if failures <= r.RemoteClientRetries {
+			logger.V(4).Info("Failed to get workload cluster client, requeuing", "attempt", failures, "error", err.Error())
+			return ctrl.Result{RequeueAfter: remoteClientBackoff(failures)}, nil
+		}
 		logger.Error(err, "failed to get remote client")
-		return ctrl.Result{}, err
+		conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady, infrav1.WorkloadClusterUnreachableReason,
+			clusterv1.ConditionSeverityWarning, "%v", err)
+		return ctrl.Result{RequeueAfter: RequeueForbyohost}, nil
 	}
+	r.resetRemoteClientFailures(machineScope.ByoMachine, remoteClientPathProviderID)
 
 	providerID, node, err := r.setNodeProviderID(ctx, remoteClient, machineScope.ByoHost)
 	if err != nil {
 		// Check if the error is because the Node doesn't exist yet
 		// This is expected when the kubelet is still bootstrapping
 		if apierrors.IsNotFound(err) {
+			reason, severity, message := infrav1.WaitingForNodeRefReason, clusterv1.ConditionSeverityInfo,
+				fmt.Sprintf("Waiting for node %s to be registered", machineScope.ByoHost.Name)
+			// In TLS Bootstrap mode the kubelet client CSR tells where the join is held up
+			if machineScope.ByoMachine.Spec.JoinMode == infrav1.JoinModeTLSBootstrap {
+				reason, severity, message = kubeletCSRState(ctx, remoteClient, machineScope.ByoHost.Name)
+			}
 			logger.Info("Node not found yet, waiting for kubelet to register the node",
-				"node", machineScope.ByoHost.Name)
-			conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady,
-				infrav1.WaitingForNodeRefReason, clusterv1.ConditionSeverityInfo,
-				"Waiting for node %s to be registered", machineScope.ByoHost.Name)
+				"node", machineScope.ByoHost.Name, "reason", reason)
+			conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady, reason, severity, "%s", message)
 			// Requeue after a short delay instead of returning an error
 			return ctrl.Result{RequeueAfter: RequeueForbyohost}, nil
 		}
@@ -455,14 +705,77 @@ func (r *ByoMachineReconciler) updateNodeProviderID(ctx context.Context, machine
 	// Set Addresses from ByoHost.Network if not already set
 	// This propagates network information to Machine.status.addresses
 	if len(machineScope.ByoMachine.Status.Addresses) == 0 && machineScope.ByoHost != nil {
-		machineScope.ByoMachine.Status.Addresses = r.convertNetworkToAddresses(machineScope.ByoHost.Status.Network)
+		machineScope.ByoMachine.Status.Addresses = r.convertNetworkToAddresses(machineScope.ByoHost)
 	}
 
 	conditions.MarkTrue(machineScope.ByoMachine, infrav1.BYOHostReady)
 	r.Recorder.Eventf(machineScope.ByoMachine, corev1.EventTypeNormal, "NodeProvisionedSucceeded", "Provisioned Node %s", machineScope.ByoHost.Name)
+
+	// The node has joined, the bootstrap token is no longer needed
+	if err := r.cleanupBootstrapTokenSecret(ctx, machineScope.ByoMachine); err != nil {
+		logger.Error(err, "failed to delete bootstrap token secret")
+		return ctrl.Result{}, err
+	}
 	return ctrl.Result{}, nil
 }
 
+// kubeletCSRState returns the BYOHostReady reason, severity and message of a node not registered yet
+// in TLS Bootstrap mode, from the latest kubelet client CSR of the node in the workload cluster
+func kubeletCSRState(ctx context.Context, remoteClient client.Client, nodeName string) (string, clusterv1.ConditionSeverity, string) {
+	csrList := &certv1.CertificateSigningRequestList{}
+	if err := remoteClient.List(ctx, csrList); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list the kubelet CSRs", "node", nodeName)
+		return infrav1.WaitingForNodeRefReason, clusterv1.ConditionSeverityInfo, fmt.Sprintf("Waiting for node %s to be registered", nodeName)
+	}
+
+	var latest *certv1.CertificateSigningRequest
+	for i := range csrList.Items {
+		csr := &csrList.Items[i]
+		if csr.Spec.SignerName != certv1.KubeAPIServerClientKubeletSignerName || csrCommonName(csr) != "system:node:"+nodeName {
+			continue
+		}
+		if latest == nil || latest.CreationTimestamp.Before(&csr.CreationTimestamp) {
+			latest = csr
+		}
+	}
+
+	switch {
+	case latest == nil:
+		return infrav1.WaitingForKubeletCSRReason, clusterv1.ConditionSeverityInfo,
+			fmt.Sprintf("Waiting for the kubelet of node %s to request its client certificate", nodeName)
+	case checkCSRCondition(latest.Status.Conditions, certv1.CertificateDenied):
+		return infrav1.KubeletCSRDeniedReason, clusterv1.ConditionSeverityWarning,
+			fmt.Sprintf("Client certificate request %s of node %s was denied", latest.Name, nodeName)
+	case !checkCSRCondition(latest.Status.Conditions, certv1.CertificateApproved):
+		return infrav1.WaitingForCSRApprovalReason, clusterv1.ConditionSeverityInfo,
+			fmt.Sprintf("Waiting for client certificate request %s of node %s to be approved", latest.Name, nodeName)
+	default:
+		return infrav1.WaitingForNodeRefReason, clusterv1.ConditionSeverityInfo, fmt.Sprintf("Waiting for node %s to be registered", nodeName)
+	}
+}
+
+// cleanupBootstrapTokenSecret deletes the bootstrap token secret generated for the ByoMachine,
+// instead of leaving the token valid until its TTL expires
+func (r *ByoMachineReconciler) cleanupBootstrapTokenSecret(ctx context.Context, byoMachine *infrav1.ByoMachine) error {
+	secretName, ok := byoMachine.Annotations[infrav1.BootstrapTokenSecretAnnotation]
+	if !ok {
+		return nil
+	}
+
+	tokenSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: metav1.NamespaceSystem,
+		},
+	}
+	if err := r.Client.Delete(ctx, tokenSecret); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	log.FromContext(ctx).Info("Deleted bootstrap token secret", "secret", secretName)
+	delete(byoMachine.Annotations, infrav1.BootstrapTokenSecretAnnotation)
+	return nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ByoMachineReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
 	var (
@@ -567,14 +880,57 @@ func (r *ByoMachineReconciler) getRemoteClient(ctx context.Context, byoMachine *
 	if err != nil {
 		return nil, err
 	}
+
+	if r.RemoteClientTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.RemoteClientTimeout)
+		defer cancel()
+	}
 	remoteClient, err := r.Tracker.GetClient(ctx, util.ObjectKey(cluster))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("workload cluster not yet reachable: %w", err)
 	}
-
 	return remoteClient, nil
 }
 
+// recordRemoteClientFailure counts a failure of the path to acquire the workload cluster client of the
+// ByoMachine and returns the number of consecutive failures of the path
+func (r *ByoMachineReconciler) recordRemoteClientFailure(byoMachine *infrav1.ByoMachine, path remoteClientPath) int {
+	r.remoteClientMu.Lock()
+	defer r.remoteClientMu.Unlock()
+	if r.remoteClientFailures == nil {
+		r.remoteClientFailures = make(map[string]int)
+	}
+	key := remoteClientFailuresKey(byoMachine, path)
+	r.remoteClientFailures[key]++
+	return r.remoteClientFailures[key]
+}
+
+// resetRemoteClientFailures forgets the failures of the path to acquire the workload cluster client of the
+// ByoMachine
+func (r *ByoMachineReconciler) resetRemoteClientFailures(byoMachine *infrav1.ByoMachine, path remoteClientPath) {
+	r.remoteClientMu.Lock()
+	defer r.remoteClientMu.Unlock()
+	delete(r.remoteClientFailures, remoteClientFailuresKey(byoMachine, path))
+}
+
+func remoteClientFailuresKey(byoMachine *infrav1.ByoMachine, path remoteClientPath) string {
+	return byoMachine.Namespace + "/" + byoMachine.Name + "/" + string(path)
+}
+
+// remoteClientBackoff returns the delay of the requeue after the nth consecutive failure to acquire the
+// workload cluster client: 1s, 2s, 4s, ... up to RequeueForbyohost
+func remoteClientBackoff(failures int) time.Duration {
+	if failures > 4 {
+		return RequeueForbyohost
+	}
+	delay := time.Duration(1<<uint(failures-1)) * time.Second
+	if delay > RequeueForbyohost {
+		return RequeueForbyohost
+	}
+	return delay
+}
+
 func (r *ByoMachineReconciler) setPausedConditionForByoHost(ctx context.Context, machineScope *byoMachineScope, isPaused bool) error {
 	helper, err := patch.NewHelper(machineScope.ByoHost, r.Client)
 	if err != nil {
@@ -593,6 +949,31 @@ func (r *ByoMachineReconciler) setPausedConditionForByoHost(ctx context.Context,
 	return helper.Patch(ctx, machineScope.ByoHost)
 }
 
+// syncControlPlaneEndpoint updates the EndPointIPAnnotation of the attached ByoHost when the control plane endpoint
+// of the cluster changed since the host was attached, e.g. after its VIP moved, so the agent points the kubeconfigs
+// of the node at the new endpoint
+func (r *ByoMachineReconciler) syncControlPlaneEndpoint(ctx context.Context, machineScope *byoMachineScope) error {
+	endpoint := machineScope.Cluster.Spec.ControlPlaneEndpoint
+	current, ok := machineScope.ByoHost.Annotations[infrav1.EndPointIPAnnotation]
+	if !ok || endpoint.Host == "" || current == endpoint.String() {
+		return nil
+	}
+
+	helper, err := patch.NewHelper(machineScope.ByoHost, r.Client)
+	if err != nil {
+		return err
+	}
+	machineScope.ByoHost.Annotations[infrav1.EndPointIPAnnotation] = endpoint.String()
+	if err := helper.Patch(ctx, machineScope.ByoHost); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Control plane endpoint changed, updated the byohost", "byohost", machineScope.ByoHost.Name,
+		"previous", current, "endpoint", endpoint.String())
+	r.Recorder.Eventf(machineScope.ByoHost, corev1.EventTypeNormal, "ControlPlaneEndpointChanged",
+		"Control plane endpoint changed from %s to %s", current, endpoint.String())
+	return nil
+}
+
 func (r *ByoMachineReconciler) setInstallationSecretForByoHost(ctx context.Context, machineScope *byoMachineScope) (ctrl.Result, error) {
 	logger := log.FromContext(ctx).WithValues("cluster", machineScope.Cluster.Name)
 	installerConfig, ready, err := r.getInstallerConfigAndStatus(ctx, machineScope)
@@ -643,6 +1024,20 @@ func (r *ByoMachineReconciler) attachByoHost(ctx context.Context, machineScope *
 		return ctrl.Result{}, nil
 	}
 
+	if maxBootstraps := machineScope.ByoCluster.Spec.MaxConcurrentBootstraps; maxBootstraps > 0 {
+		bootstrapping, err := r.countBootstrappingHosts(ctx, machineScope.Cluster)
+		if err != nil {
+			logger.Error(err, "failed to count the bootstrapping byohosts")
+			return ctrl.Result{RequeueAfter: RequeueForbyohost}, err
+		}
+		if bootstrapping >= maxBootstraps {
+			logger.Info("Maximum of concurrent bootstraps reached, waiting..", "bootstrapping", bootstrapping, "maxConcurrentBootstraps", maxBootstraps)
+			conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady, infrav1.WaitingForBootstrapSlotReason, clusterv1.ConditionSeverityInfo,
+				"%d of at most %d hosts of the cluster are bootstrapping", bootstrapping, maxBootstraps)
+			return ctrl.Result{RequeueAfter: RequeueForbyohost}, nil
+		}
+	}
+
 	hostsList := &infrav1.ByoHostList{}
 	// LabelSelector filter for byohosts
 	if machineScope.ByoMachine.Spec.Selector != nil {
@@ -657,6 +1052,9 @@ func (r *ByoMachineReconciler) attachByoHost(ctx context.Context, machineScope *
 
 	byohostLabels, _ := labels.NewRequirement(clusterv1.ClusterNameLabel, selection.DoesNotExist, nil)
 	selector = selector.Add(*byohostLabels)
+	// Skip hosts quarantined by the agent after repeated bootstrap failures
+	quarantinedLabel, _ := labels.NewRequirement(infrav1.QuarantinedLabel, selection.DoesNotExist, nil)
+	selector = selector.Add(*quarantinedLabel)
 
 	err = r.Client.List(ctx, hostsList, &client.ListOptions{LabelSelector: selector})
 	if err != nil {
@@ -674,7 +1072,11 @@ func (r *ByoMachineReconciler) attachByoHost(ctx context.Context, machineScope *
 	clusterName := machineScope.ByoMachine.Labels[clusterv1.ClusterNameLabel]
 	controllerID := fmt.Sprintf("byomachine-controller-%s", machineScope.ByoMachine.Name)
 
-	for attempt := 0; attempt < MaxRetries; attempt++ {
+	// The host selected last stays reserved until the attach is done, a claimed host is no longer available and
+	// a stale cached copy of it fails to be leased
+	defer r.releaseReservation(machineScope.ByoMachine)
+
+	for attempt := 0; attempt < r.hostAttachMaxRetries(); attempt++ {
 		// Select a host using round-robin to avoid bias
 		selectedHost := r.selectHostForClaim(hostsList.Items, clusterName, machineScope.ByoMachine)
 		if selectedHost == nil {
@@ -778,6 +1180,14 @@ func (r *ByoMachineReconciler) attachByoHost(ctx context.Context, machineScope *
 			continue
 		}
 
+		// A free host carrying a BootstrapSecret was tampered with externally, drop it before the claim
+		if latestHost.HasStrayBootstrapSecret() {
+			logger.Info("Clearing the BootstrapSecret of a free ByoHost", "byohost", latestHost.Name, "secret", latestHost.Spec.BootstrapSecret.Name)
+			r.Recorder.Eventf(latestHost, corev1.EventTypeWarning, "StrayBootstrapSecretCleared",
+				"Cleared BootstrapSecret %s set on the ByoHost while it was not attached", latestHost.Spec.BootstrapSecret.Name)
+			latestHost.Spec.BootstrapSecret = nil
+		}
+
 		// Set MachineRef
 		latestHost.Status.MachineRef = &corev1.ObjectReference{
 			APIVersion: machineScope.ByoMachine.APIVersion,
@@ -798,6 +1208,15 @@ func (r *ByoMachineReconciler) attachByoHost(ctx context.Context, machineScope *
 		// For TLS Bootstrap mode, create and use the TLS bootstrap secret
 		if machineScope.ByoMachine.Spec.JoinMode == infrav1.JoinModeTLSBootstrap {
 			tlsBootstrapSecret, err := r.createBootstrapSecretTLSBootstrap(ctx, machineScope, latestHost)
+			if errors.Is(err, errBootstrapDataMissing) {
+				// Retrying does not help until one of the methods is configured, report how to fix it instead
+				_ = r.releaseLease(ctx, latestHost)
+				message := bootstrapDataMissingMessage(machineScope)
+				logger.Info("No bootstrap data for TLS Bootstrap mode, waiting", "reason", message)
+				conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady, infrav1.BootstrapDataMissingReason, clusterv1.ConditionSeverityWarning, "%s", message)
+				r.Recorder.Event(machineScope.ByoMachine, corev1.EventTypeWarning, infrav1.BootstrapDataMissingReason, message)
+				return ctrl.Result{RequeueAfter: RequeueForbyohost}, nil
+			}
 			if err != nil {
 				logger.Error(err, "failed to create TLS bootstrap secret")
 				// Release the lease before returning
@@ -831,9 +1250,14 @@ func (r *ByoMachineReconciler) attachByoHost(ctx context.Context, machineScope *
 		// Sync ManageKubeProxy from ByoMachine to ByoHost
 		// For TLSBootstrap mode, always default to true
 		// For other modes, use the value set by user (default false if not set)
-		if machineScope.ByoMachine.Spec.JoinMode == infrav1.JoinModeTLSBootstrap {
+		// DisableKubeProxy always wins, kube-proxy is then not managed at all
+		latestHost.Spec.DisableKubeProxy = machineScope.ByoMachine.Spec.DisableKubeProxy
+		switch {
+		case machineScope.ByoMachine.Spec.DisableKubeProxy:
+			latestHost.Spec.ManageKubeProxy = false
+		case machineScope.ByoMachine.Spec.JoinMode == infrav1.JoinModeTLSBootstrap:
 			latestHost.Spec.ManageKubeProxy = true
-		} else {
+		default:
 			latestHost.Spec.ManageKubeProxy = machineScope.ByoMachine.Spec.ManageKubeProxy
 		}
 
@@ -863,6 +1287,9 @@ func (r *ByoMachineReconciler) attachByoHost(ctx context.Context, machineScope *
 		}
 		logger.Info("Syncing Machine labels to ByoHost spec.labels", "labels", latestHost.Spec.Labels)
 
+		// Merge the cluster-wide node defaults behind the host specific values
+		applyClusterNodeDefaults(latestHost, machineScope.ByoCluster)
+
 		err = byohostHelper.Patch(ctx, latestHost)
 		if err != nil {
 			logger.Error(err, "failed to patch byohost, will retry", "byohost", latestHost.Name)
@@ -888,6 +1315,60 @@ func (r *ByoMachineReconciler) attachByoHost(ctx context.Context, machineScope *
 	return ctrl.Result{RequeueAfter: RequeueForbyohost}, errors.New("failed to attach byohost after all retries")
 }
 
+// countBootstrappingHosts counts the hosts attached to the cluster whose node is not bootstrapped yet
+func (r *ByoMachineReconciler) countBootstrappingHosts(ctx context.Context, cluster *clusterv1.Cluster) (int32, error) {
+	hostsList := &infrav1.ByoHostList{}
+	if err := r.Client.List(ctx, hostsList, client.MatchingLabels{clusterv1.ClusterNameLabel: cluster.Name}); err != nil {
+		return 0, err
+	}
+	var bootstrapping int32
+	for i := range hostsList.Items {
+		host := &hostsList.Items[i]
+		if boundToNamespace(host, cluster.Namespace) && byoHostPhase(host) == infrav1.ByoHostPhaseProvisioning {
+			bootstrapping++
+		}
+	}
+	return bootstrapping, nil
+}
+
+// applyClusterNodeDefaults merges ByoCluster.Spec.DefaultNodeLabels and DefaultNodeTaints
+// into the ByoHost spec. Labels already set on the host, and host taints with the same
+// key and effect, take precedence over the cluster defaults. The added defaults are recorded
+// on the host, so they are removed again when the host is released.
+func applyClusterNodeDefaults(byoHost *infrav1.ByoHost, byoCluster *infrav1.ByoCluster) {
+	if byoCluster == nil {
+		return
+	}
+	added := byoHost.GetClusterNodeDefaults()
+	if len(byoCluster.Spec.DefaultNodeLabels) > 0 && byoHost.Spec.Labels == nil {
+		byoHost.Spec.Labels = make(map[string]string)
+	}
+	for k, v := range byoCluster.Spec.DefaultNodeLabels {
+		if _, ok := byoHost.Spec.Labels[k]; !ok {
+			byoHost.Spec.Labels[k] = v
+			if added.Labels == nil {
+				added.Labels = make(map[string]string)
+			}
+			added.Labels[k] = v
+		}
+	}
+
+	for _, defaultTaint := range byoCluster.Spec.DefaultNodeTaints {
+		overridden := false
+		for _, taint := range byoHost.Spec.Taints {
+			if taint.Key == defaultTaint.Key && taint.Effect == defaultTaint.Effect {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			byoHost.Spec.Taints = append(byoHost.Spec.Taints, defaultTaint)
+			added.Taints = append(added.Taints, defaultTaint)
+		}
+	}
+	byoHost.SetClusterNodeDefaults(added)
+}
+
 // ByoHostToByoMachineMapFunc returns a handler.ToRequestsFunc that watches for
 // Machine events and returns reconciliation requests for an infrastructure provider object
 func ByoHostToByoMachineMapFunc(gvk schema.GroupVersionKind) handler.MapFunc {
@@ -919,7 +1400,22 @@ func ByoHostToByoMachineMapFunc(gvk schema.GroupVersionKind) handler.MapFunc {
 	}
 }
 
-func (r *ByoMachineReconciler) markHostForCleanup(ctx context.Context, machineScope *byoMachineScope) error {
+// markHostForCleanup marks the host for the cleanup by the agent and releases it. The cleanup waits, with a
+// requeue, for the workload cluster client to cordon the node of the host, up to RemoteClientRetries times.
+func (r *ByoMachineReconciler) markHostForCleanup(ctx context.Context, machineScope *byoMachineScope) (ctrl.Result, error) {
+	// Stop scheduling pods on the node as soon as the cleanup starts, i.e. while the host is still bound
+	if machineScope.ByoHost.Status.MachineRef != nil {
+		if err := r.cordonNode(ctx, machineScope); err != nil {
+			failures := r.recordRemoteClientFailure(machineScope.ByoMachine, remoteClientPathCordon)
+			if failures <= r.RemoteClientRetries {
+				log.FromContext(ctx).V(4).Info("Failed to get workload cluster client to cordon the node, requeuing", "attempt", failures, "error", err.Error())
+				return ctrl.Result{RequeueAfter: remoteClientBackoff(failures)}, nil
+			}
+			log.FromContext(ctx).Error(err, "failed to get remote client, not cordoning the node")
+		}
+		r.resetRemoteClientFailures(machineScope.ByoMachine, remoteClientPathCordon)
+	}
+
 	helper, _ := patch.NewHelper(machineScope.ByoHost, r.Client)
 
 	if machineScope.ByoHost.Annotations == nil {
@@ -935,7 +1431,140 @@ func (r *ByoMachineReconciler) markHostForCleanup(ctx context.Context, machineSc
 	delete(machineScope.ByoHost.Annotations, HostLeaseAnnotationKey)
 
 	// Issue the patch for byohost
-	return helper.Patch(ctx, machineScope.ByoHost)
+	return ctrl.Result{}, helper.Patch(ctx, machineScope.ByoHost)
+}
+
+// cordonNode marks the Node of the host unschedulable in the workload cluster, so that no pods are scheduled on
+// it until the agent resets it. Only failing to get the workload cluster client, within the cordon timeout, is
+// returned. Failing to reach the Node does not hold up the cleanup.
+func (r *ByoMachineReconciler) cordonNode(ctx context.Context, machineScope *byoMachineScope) error {
+	logger := log.FromContext(ctx)
+	// The API server of a deleting cluster may already be gone, reaching it only delays the cleanup
+	if machineScope.Cluster != nil && !machineScope.Cluster.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	nodeName := machineScope.ByoHost.Name
+	if nodeRef := machineScope.ByoMachine.Status.NodeRef; nodeRef != nil {
+		nodeName = nodeRef.Name
+	}
+	clientCtx, cancel := context.WithTimeout(ctx, r.cordonTimeout())
+	defer cancel()
+	remoteClient, err := r.getRemoteClient(clientCtx, machineScope.ByoMachine)
+	if err != nil {
+		return err
+	}
+
+	node := &corev1.Node{}
+	if err := remoteClient.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		if !apierrors.IsNotFound(err) {
+			logger.Error(err, "failed to get the node to cordon", "node", nodeName)
+		}
+		return nil
+	}
+	if node.Spec.Unschedulable {
+		return nil
+	}
+	helper, err := patch.NewHelper(node, remoteClient)
+	if err != nil {
+		logger.Error(err, "failed to cordon the node", "node", nodeName)
+		return nil
+	}
+	node.Spec.Unschedulable = true
+	if err := helper.Patch(ctx, node); err != nil {
+		logger.Error(err, "failed to cordon the node", "node", nodeName)
+		return nil
+	}
+	logger.Info("Cordoned the node before the host cleanup", "node", nodeName)
+	r.Recorder.Eventf(machineScope.ByoMachine, corev1.EventTypeNormal, "NodeCordoned", "Cordoned node %s before the cleanup of ByoHost %s", nodeName, machineScope.ByoHost.Name)
+	return nil
+}
+
+func (r *ByoMachineReconciler) cordonTimeout() time.Duration {
+	if r.CordonTimeout > 0 {
+		return r.CordonTimeout
+	}
+	return DefaultCordonTimeout
+}
+
+// releaseByoHost releases the attached ByoHost on request of the ReleaseHostAnnotation, so that
+// a different host gets attached to the ByoMachine in the same reconcile
+func (r *ByoMachineReconciler) releaseByoHost(ctx context.Context, machineScope *byoMachineScope) (ctrl.Result, error) {
+	logger := log.FromContext(ctx).WithValues("cluster", machineScope.Cluster.Name)
+
+	// The ProviderID of a machine bound to a node is immutable, so its Machine has to be
+	// deleted to move it to a different host
+	if machineScope.ByoMachine.Spec.ProviderID != "" {
+		logger.Info("Not releasing the ByoHost of a ByoMachine bound to a node", "providerID", machineScope.ByoMachine.Spec.ProviderID)
+		r.Recorder.Eventf(machineScope.ByoMachine, corev1.EventTypeWarning, "ByoHostReleaseRefused", "ByoMachine is bound to node with ProviderID %s, delete its Machine to replace the host", machineScope.ByoMachine.Spec.ProviderID)
+		delete(machineScope.ByoMachine.Annotations, infrav1.ReleaseHostAnnotation)
+		return ctrl.Result{}, nil
+	}
+
+	if machineScope.ByoHost != nil {
+		releasedHost := machineScope.ByoHost.Name
+		logger.Info("Releasing ByoHost on request", "byohost", releasedHost)
+
+		if result, err := r.markHostForCleanup(ctx, machineScope); err != nil || !result.IsZero() {
+			return result, err
+		}
+		// Detach the host from this ByoMachine right away. The cluster-name label is kept until the
+		// agent finished the cleanup, which keeps the released host out of the selection.
+		helper, _ := patch.NewHelper(machineScope.ByoHost, r.Client)
+		delete(machineScope.ByoHost.Labels, infrav1.AttachedByoMachineLabel)
+		if err := helper.Patch(ctx, machineScope.ByoHost); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.Recorder.Eventf(machineScope.ByoHost, corev1.EventTypeNormal, "ByoHostReleaseSucceeded", "ByoHost Released by %s", machineScope.ByoMachine.Name)
+		r.Recorder.Eventf(machineScope.ByoMachine, corev1.EventTypeNormal, "ByoHostReleaseSucceeded", "Released ByoHost %s", releasedHost)
+		machineScope.ByoHost = nil
+	}
+
+	// Forget everything learned from the released host
+	machineScope.ByoMachine.Status.Ready = false
+	machineScope.ByoMachine.Status.HostInfo = infrav1.HostInfo{}
+	machineScope.ByoMachine.Status.NodeRef = nil
+	machineScope.ByoMachine.Status.Addresses = nil
+	conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady, infrav1.ByoHostReleasedReason, clusterv1.ConditionSeverityInfo, "")
+
+	delete(machineScope.ByoMachine.Annotations, infrav1.ReleaseHostAnnotation)
+	return ctrl.Result{}, nil
+}
+
+// validateProxyAnnotation checks the value of a proxy annotation of the ByoCluster: the http-proxy and
+// https-proxy annotations must be an http, https or socks5 URL with a host, the no-proxy annotation a
+// comma separated list of hosts, domains, IPs or CIDRs
+func validateProxyAnnotation(key, value string) error {
+	if strings.HasPrefix(key, "infrastructure.cluster.x-k8s.io/no-proxy") {
+		for _, entry := range strings.Split(value, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			if strings.Contains(entry, "://") || strings.ContainsAny(entry, " \t") {
+				return fmt.Errorf("invalid entry %q in the proxy annotation %s", entry, key)
+			}
+			if strings.Contains(entry, "/") {
+				if _, _, err := net.ParseCIDR(entry); err != nil {
+					return fmt.Errorf("invalid CIDR %q in the proxy annotation %s", entry, key)
+				}
+			}
+		}
+		return nil
+	}
+	proxyURL, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("invalid URL in the proxy annotation %s: %w", key, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("invalid URL %q in the proxy annotation %s, expected an http, https or socks5 scheme", value, key)
+	}
+	if proxyURL.Hostname() == "" {
+		return fmt.Errorf("invalid URL %q in the proxy annotation %s, the host is missing", value, key)
+	}
+	return nil
 }
 
 func (r *ByoMachineReconciler) getInstallerConfig(ctx context.Context, byoMachine *infrav1.ByoMachine) (*unstructured.Unstructured, error) {
@@ -979,6 +1608,12 @@ func (r *ByoMachineReconciler) createInstallerConfig(ctx context.Context, machin
 			if strings.HasPrefix(k, "infrastructure.cluster.x-k8s.io/http-proxy") ||
 				strings.HasPrefix(k, "infrastructure.cluster.x-k8s.io/https-proxy") ||
 				strings.HasPrefix(k, "infrastructure.cluster.x-k8s.io/no-proxy") {
+				if err = validateProxyAnnotation(k, v); err != nil {
+					// A malformed proxy would break the install on the host, reject it before any host is bootstrapped
+					conditions.MarkFalse(machineScope.ByoMachine, infrav1.BYOHostReady, infrav1.InvalidProxyConfigurationReason, clusterv1.ConditionSeverityError, "%s", err.Error())
+					r.Recorder.Eventf(machineScope.ByoMachine, corev1.EventTypeWarning, "InvalidProxyConfiguration", "ByoCluster %s: %s", machineScope.ByoCluster.Name, err.Error())
+					return err
+				}
 				installerAnnotations[k] = v
 			}
 		}
@@ -1020,21 +1655,59 @@ func (r *ByoMachineReconciler) createInstallerConfig(ctx context.Context, machin
 }
 
 // convertNetworkToAddresses converts ByoHost.Network status to MachineAddress slice.
-// IP addresses are mapped to MachineExternalIP (both IPv4 and IPv6).
+// Private IP addresses (RFC 1918, IPv6 ULA) are mapped to MachineInternalIP, the other ones to MachineExternalIP.
+// Loopback, link-local and unparsable addresses are skipped, and the prefix length the agent reports is stripped.
+// The name of the ByoHost, which the Node is named after, is mapped to MachineHostName so CAPI matches the Node, and a
+// different hostname reported by the host, e.g. a fully qualified name, to MachineInternalDNS.
 // Network interface names are not mapped as there is no suitable MachineAddressType.
-func (r *ByoMachineReconciler) convertNetworkToAddresses(network []infrav1.NetworkStatus) []clusterv1.MachineAddress {
+func (r *ByoMachineReconciler) convertNetworkToAddresses(byoHost *infrav1.ByoHost) []clusterv1.MachineAddress {
 	var addresses []clusterv1.MachineAddress
-	for _, net := range network {
-		for _, ip := range net.IPAddrs {
+	for _, netStatus := range byoHost.Status.Network {
+		for _, addr := range netStatus.IPAddrs {
+			ip := parseHostIP(addr)
+			if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+				continue
+			}
+			addressType := clusterv1.MachineExternalIP
+			if ip.IsPrivate() {
+				addressType = clusterv1.MachineInternalIP
+			}
 			addresses = append(addresses, clusterv1.MachineAddress{
-				Type:    clusterv1.MachineExternalIP,
-				Address: ip,
+				Type:    addressType,
+				Address: ip.String(),
 			})
 		}
 	}
+	addresses = append(addresses, clusterv1.MachineAddress{Type: clusterv1.MachineHostName, Address: byoHost.Name})
+	if hostname := byoHost.Status.HostDetails.Hostname; hostname != "" && hostname != byoHost.Name {
+		addresses = append(addresses, clusterv1.MachineAddress{Type: clusterv1.MachineInternalDNS, Address: hostname})
+	}
 	return addresses
 }
 
+// parseHostIP parses an IP address with or without a prefix length, e.g. 192.168.1.10/24, and returns nil
+// when it is neither
+func parseHostIP(addr string) net.IP {
+	if ip, _, err := net.ParseCIDR(addr); err == nil {
+		return ip
+	}
+	return net.ParseIP(addr)
+}
+
+// bootstrapDataMissingMessage tells which of the methods of TLS Bootstrap mode to configure
+// to provide the CA certificate or the bootstrap kubeconfig of the ByoMachine
+func bootstrapDataMissingMessage(machineScope *byoMachineScope) string {
+	secretName := "<bootstrap data secret>"
+	if machineScope.Machine.Spec.Bootstrap.DataSecretName != nil {
+		secretName = *machineScope.Machine.Spec.Bootstrap.DataSecretName
+	}
+	return fmt.Sprintf("no CA certificate or bootstrap kubeconfig found for TLS Bootstrap mode, configure one of: "+
+		"spec.bootstrapConfigRef referencing a BootstrapKubeconfig whose status holds the bootstrap kubeconfig data; "+
+		"a bootstrap-kubeconfig or ca.crt key in the bootstrap data secret %s/%s; "+
+		"a kubeconfig of the management cluster for the controller to generate a bootstrap token with",
+		machineScope.ByoMachine.Namespace, secretName)
+}
+
 // createBootstrapSecretTLSBootstrap creates a bootstrap secret for TLS Bootstrap mode.
 // This secret contains the CA certificate and bootstrap kubeconfig that the Agent
 // uses to connect to the cluster and perform TLS bootstrapping.
@@ -1056,7 +1729,7 @@ func (r *ByoMachineReconciler) createBootstrapSecretTLSBootstrap(ctx context.Con
 		} else if bkc.Status.BootstrapKubeconfigData != nil && len(*bkc.Status.BootstrapKubeconfigData) > 0 {
 			bootstrapKubeconfigData = []byte(*bkc.Status.BootstrapKubeconfigData)
 			if caData == nil {
-				caData = extractCAFromKubeconfig(bootstrapKubeconfigData)
+				caData = r.extractCA(ctx, machineScope.ByoMachine, bootstrapKubeconfigData)
 			}
 			logger.Info("Found BootstrapKubeconfig from spec.bootstrapConfigRef", "name", bkc.Name)
 		}
@@ -1077,7 +1750,7 @@ func (r *ByoMachineReconciler) createBootstrapSecretTLSBootstrap(ctx context.Con
 					if bkc.Status.BootstrapKubeconfigData != nil && len(*bkc.Status.BootstrapKubeconfigData) > 0 {
 						bootstrapKubeconfigData = []byte(*bkc.Status.BootstrapKubeconfigData)
 						if caData == nil {
-							caData = extractCAFromKubeconfig(bootstrapKubeconfigData)
+							caData = r.extractCA(ctx, machineScope.ByoMachine, bootstrapKubeconfigData)
 						}
 						logger.Info("Found BootstrapKubeconfig with data", "name", bkc.Name)
 						break
@@ -1099,17 +1772,17 @@ func (r *ByoMachineReconciler) createBootstrapSecretTLSBootstrap(ctx context.Con
 			logger.Error(err, "failed to get bootstrap secret")
 		} else {
 			// Check for pre-existing bootstrap-kubeconfig
-			if data, ok := bootstrapSecret.Data["bootstrap-kubeconfig"]; ok && len(data) > 0 {
+			if data, ok := r.BootstrapSecretKeys.Get(bootstrapSecret, bootstrapsecret.BootstrapKubeconfigKey); ok {
 				bootstrapKubeconfigData = data
 				if caData == nil {
-					caData = extractCAFromKubeconfig(data)
+					caData = r.extractCA(ctx, machineScope.ByoMachine, data)
 				}
 				logger.Info("Found bootstrap-kubeconfig in bootstrap secret")
 			}
 
 			// Check for CA certificate directly
 			if caData == nil {
-				if data, ok := bootstrapSecret.Data["ca.crt"]; ok && len(data) > 0 {
+				if data, ok := r.BootstrapSecretKeys.Get(bootstrapSecret, bootstrapsecret.CACertificateKey); ok {
 					caData = data
 					logger.Info("Found ca.crt in bootstrap secret")
 				}
@@ -1117,7 +1790,7 @@ func (r *ByoMachineReconciler) createBootstrapSecretTLSBootstrap(ctx context.Con
 
 			// Try to extract CA from the cloud-init value
 			if caData == nil {
-				if data, ok := bootstrapSecret.Data["value"]; ok && len(data) > 0 {
+				if data, ok := r.BootstrapSecretKeys.Get(bootstrapSecret, bootstrapsecret.ValueKey); ok {
 					caData = extractCAFromCloudInit(string(data))
 					if caData != nil {
 						logger.Info("Extracted CA from cloud-init script")
@@ -1158,14 +1831,22 @@ func (r *ByoMachineReconciler) createBootstrapSecretTLSBootstrap(ctx context.Con
 		// Get the in-cluster config to create a bootstrap kubeconfig
 		restConfig, err := clientcmd.DefaultClientConfig.ClientConfig()
 		if err == nil {
-			bootstrapKubeconfigContent, _, err := generateBootstrapKubeconfigWithToken(ctx, restConfig, r.Client, apiServerEndpoint)
+			bootstrapKubeconfigContent, tokenStr, err := generateBootstrapKubeconfigWithToken(ctx, restConfig, r.Client, apiServerEndpoint, r.BootstrapTokenOptions)
 			if err == nil {
 				logger.Info("Generated bootstrap kubeconfig with new bootstrap token")
 				bootstrapKubeconfigData = []byte(bootstrapKubeconfigContent)
 
+				// Remember the token secret so it is removed as soon as the node has joined
+				if tokenID, _, err := bootstraptoken.GetTokenIDSecretFromBootstrapToken(tokenStr); err == nil {
+					if machineScope.ByoMachine.Annotations == nil {
+						machineScope.ByoMachine.Annotations = make(map[string]string)
+					}
+					machineScope.ByoMachine.Annotations[infrav1.BootstrapTokenSecretAnnotation] = bootstraputil.BootstrapTokenSecretName(tokenID)
+				}
+
 				// Extract CA from the generated kubeconfig
 				if caData == nil {
-					caData = extractCAFromKubeconfig(bootstrapKubeconfigData)
+					caData = r.extractCA(ctx, machineScope.ByoMachine, bootstrapKubeconfigData)
 				}
 			} else {
 				logger.V(4).Info("Failed to generate bootstrap kubeconfig", "error", err)
@@ -1177,7 +1858,7 @@ func (r *ByoMachineReconciler) createBootstrapSecretTLSBootstrap(ctx context.Con
 
 	// Validate that we have at least some data
 	if len(caData) == 0 && len(bootstrapKubeconfigData) == 0 {
-		return nil, fmt.Errorf("failed to obtain CA certificate or bootstrap kubeconfig for TLS Bootstrap mode")
+		return nil, errBootstrapDataMissing
 	}
 
 	logger.Info("Creating TLS Bootstrap secret",
@@ -1296,7 +1977,7 @@ func (r *ByoMachineReconciler) createBootstrapSecretTLSBootstrap(ctx context.Con
 						}
 					}
 
-					defaultConfig := generateDefaultKubeletConfig(machineScope.Cluster, detectedClusterDNS)
+					defaultConfig := r.defaultKubeletConfig(detectedClusterDNS, clusterDomain(machineScope.Cluster))
 					tlsBootstrapSecret.Data["kubelet-config.yaml"] = []byte(defaultConfig)
 				}
 			}
@@ -1338,12 +2019,12 @@ func (r *ByoMachineReconciler) createBootstrapSecretTLSBootstrap(ctx context.Con
 		}, bootstrapSecret); err == nil {
 			// Copy kubelet-config.yaml if present (and not already set)
 			if _, ok := tlsBootstrapSecret.Data["kubelet-config.yaml"]; !ok {
-				if data, ok := bootstrapSecret.Data["kubelet-config.yaml"]; ok {
+				if data, ok := r.BootstrapSecretKeys.Get(bootstrapSecret, bootstrapsecret.KubeletConfigKey); ok {
 					tlsBootstrapSecret.Data["kubelet-config.yaml"] = data
 				}
 			}
 			// Copy kube-proxy.kubeconfig if present
-			if data, ok := bootstrapSecret.Data["kube-proxy.kubeconfig"]; ok {
+			if data, ok := r.BootstrapSecretKeys.Get(bootstrapSecret, bootstrapsecret.KubeProxyKubeconfigKey); ok {
 				tlsBootstrapSecret.Data["kube-proxy.kubeconfig"] = data
 			}
 		}
@@ -1408,7 +2089,7 @@ users:
   user:
     client-certificate: /var/lib/kubelet/pki/kubelet-client-current.pem
     client-key: /var/lib/kubelet/pki/kubelet-client-current.pem
- `, caDataStr, apiServerEndpoint)
+`, caDataStr, apiServerEndpoint)
 			tlsBootstrapSecret.Data["kube-proxy.kubeconfig"] = []byte(kubeProxyKubeconfig)
 			logger.Info("Generated kube-proxy.kubeconfig referencing kubelet certificate")
 		} else if len(bootstrapKubeconfigData) > 0 {
@@ -1430,78 +2111,23 @@ users:
 	return tlsBootstrapSecret, nil
 }
 
-// generateDefaultKubeletConfig generates a default KubeletConfiguration
-func generateDefaultKubeletConfig(cluster *clusterv1.Cluster, detectedDNS string) string {
-	// Try to derive ClusterDNS from Service CIDR (convention: 10th IP)
-	// Default to standard Kubeadm default if not found
-	clusterDNS := "10.96.0.10"
-
-	// If we detected a real CoreDNS IP from the cluster, use it!
-	if detectedDNS != "" {
-		clusterDNS = detectedDNS
-	} else if cluster.Spec.ClusterNetwork != nil &&
-		cluster.Spec.ClusterNetwork.Services != nil &&
-		len(cluster.Spec.ClusterNetwork.Services.CIDRBlocks) > 0 {
-		// Calculate standard 10th IP logic or just pick the 10th if it's a standard /12 or /16
-		// For robustness, we'll stick to 10.96.0.10 if we can't easily calc,
-		// but ideally we should parse the CIDR.
-		// For now, using a safe default for standard Kubeadm clusters.
-		// If users have custom DNS, they SHOULD provide kubelet-config ConfigMap.
-	}
-
-	return fmt.Sprintf(`apiVersion: kubelet.config.k8s.io/v1beta1
-kind: KubeletConfiguration
-authentication:
-  anonymous:
-    enabled: false
-  webhook:
-    cacheTTL: 0s
-    enabled: true
-  x509:
-    clientCAFile: /etc/kubernetes/pki/ca.crt
-authorization:
-  mode: Webhook
-  webhook:
-    cacheAuthorizedTTL: 0s
-    cacheUnauthorizedTTL: 0s
-cgroupDriver: systemd
-clusterDNS:
-- %s
-clusterDomain: cluster.local
-containerLogMaxFiles: 5
-containerLogMaxSize: 10Mi
-contentType: application/vnd.kubernetes.protobuf
-cpuManagerReconcilePeriod: 0s
-evictionHard:
-  imagefs.available: 15%%
-  memory.available: 100Mi
-  nodefs.available: 10%%
-  nodefs.inodesFree: 5%%
-evictionPressureTransitionPeriod: 5m0s
-fileCheckFrequency: 0s
-healthzBindAddress: 127.0.0.1
-healthzPort: 10248
-httpCheckFrequency: 0s
-imageMinimumGCAge: 2m0s
-imageGCHighThresholdPercent: 85
-imageGCLowThresholdPercent: 80
-logging:
-  flushFrequency: 0
-  text:
-    infoBufferSize: "0"
-  verbosity: 0
-memorySwap: {}
-nodeStatusReportFrequency: 0s
-nodeStatusUpdateFrequency: 0s
-rotateCertificates: true
-runtimeRequestTimeout: 0s
-shutdownGracePeriod: 0s
-shutdownGracePeriodCriticalPods: 0s
-staticPodPath: /etc/kubernetes/manifests
-streamingConnectionIdleTimeout: 0s
-syncFrequency: 0s
-volumeStatsAggPeriod: 0s
-`, clusterDNS)
+// defaultKubeletConfig generates the default KubeletConfiguration with the configured kubelet healthz endpoint
+func (r *ByoMachineReconciler) defaultKubeletConfig(clusterDNS, clusterDomain string) string {
+	return kubeletconfig.GenerateDefaultKubeletConfig(kubeletconfig.Options{
+		ClusterDNS:         clusterDNS,
+		ClusterDomain:      clusterDomain,
+		HealthzBindAddress: r.KubeletHealthzBindAddress,
+		HealthzPort:        r.KubeletHealthzPort,
+		EvictionHard:       r.KubeletEvictionHard,
+	})
+}
+
+// clusterDomain returns the service domain of the cluster network, empty when the Cluster does not set one
+func clusterDomain(cluster *clusterv1.Cluster) string {
+	if cluster == nil || cluster.Spec.ClusterNetwork == nil {
+		return ""
+	}
+	return cluster.Spec.ClusterNetwork.ServiceDomain
 }
 
 // generateDefaultKubeProxyConfig generates a default KubeProxyConfiguration
@@ -1548,7 +2174,7 @@ portRange: ""
 }
 
 // generateBootstrapKubeconfigWithToken creates a kubeconfig and returns the token used
-func generateBootstrapKubeconfigWithToken(ctx context.Context, restConfig *rest.Config, client client.Client, apiServerEndpoint string) (string, string, error) {
+func generateBootstrapKubeconfigWithToken(ctx context.Context, restConfig *rest.Config, client client.Client, apiServerEndpoint string, tokenOptions bootstraptoken.Options) (string, string, error) {
 	// Generate a new bootstrap token
 	tokenStr, err := bootstraputil.GenerateBootstrapToken()
 	if err != nil {
@@ -1557,7 +2183,7 @@ func generateBootstrapKubeconfigWithToken(ctx context.Context, restConfig *rest.
 
 	// Create bootstrap token secret
 	ttl := time.Minute * 30
-	tokenSecret, err := bootstraptoken.GenerateSecretFromBootstrapToken(tokenStr, ttl)
+	tokenSecret, err := bootstraptoken.GenerateSecretFromBootstrapToken(tokenStr, ttl, tokenOptions)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to create token secret: %w", err)
 	}
@@ -1632,48 +2258,68 @@ users:
 `, caData, apiServerEndpoint, tokenStr)
 }
 
+// extractCA extracts the CA of a bootstrap kubeconfig and warns on the ByoMachine when the kubeconfig
+// is malformed and the simple parser had to be used
+func (r *ByoMachineReconciler) extractCA(ctx context.Context, byoMachine *infrav1.ByoMachine, kubeconfigData []byte) []byte {
+	caData, usedFallback := extractCAFromKubeconfig(ctx, kubeconfigData)
+	if usedFallback {
+		r.Recorder.Event(byoMachine, corev1.EventTypeWarning, "BootstrapKubeconfigMalformed",
+			"bootstrap kubeconfig is not valid YAML, the CA was extracted with the simple parser")
+	}
+	return caData
+}
+
 // extractCAFromKubeconfig extracts CA data from a kubeconfig file
-// Uses proper YAML parsing to extract certificate-authority-data from clusters
-func extractCAFromKubeconfig(kubeconfigData []byte) []byte {
-	logger := log.FromContext(context.Background())
+// Uses proper YAML parsing to extract certificate-authority-data from clusters, and reports whether it fell
+// back to the simple extraction. CA data not parsing as x509 certificates is rejected.
+func extractCAFromKubeconfig(ctx context.Context, kubeconfigData []byte) (caData []byte, usedFallback bool) {
+	logger := log.FromContext(ctx)
 	logger.V(4).Info("Extracting CA from kubeconfig", "dataLen", len(kubeconfigData))
 
 	// Define a minimal kubeconfig structure for parsing
 	type kubeconfigCluster struct {
 		Cluster struct {
-			CertificateAuthorityData []byte `yaml:"certificate-authority-data"`
-		} `yaml:"cluster"`
+			CertificateAuthorityData []byte `json:"certificate-authority-data"`
+		} `json:"cluster"`
 	}
 
 	type kubeconfig struct {
-		Clusters []kubeconfigCluster `yaml:"clusters"`
+		Clusters []kubeconfigCluster `json:"clusters"`
 	}
 
 	var config kubeconfig
 	if err := yaml.Unmarshal(kubeconfigData, &config); err != nil {
-		logger.V(4).Info("YAML parsing failed, using simple extraction", "error", err)
-		// Fallback to simple extraction if YAML parsing fails
-		return extractCAFromKubeconfigSimple(kubeconfigData)
-	}
-
-	logger.V(4).Info("YAML parsing succeeded", "numClusters", len(config.Clusters))
+		logger.Info("Kubeconfig is not valid YAML, falling back to the simple CA extraction", "error", err)
+		caData, usedFallback = extractCAFromKubeconfigSimple(ctx, kubeconfigData), true
+	} else {
+		logger.V(4).Info("YAML parsing succeeded", "numClusters", len(config.Clusters))
 
-	// Look for certificate-authority-data in any cluster
-	for i, cluster := range config.Clusters {
-		if len(cluster.Cluster.CertificateAuthorityData) > 0 {
-			logger.V(4).Info("Found CA in cluster", "index", i, "caDataLen", len(cluster.Cluster.CertificateAuthorityData))
-			return cluster.Cluster.CertificateAuthorityData
+		// Look for certificate-authority-data in any cluster
+		for i, cluster := range config.Clusters {
+			if len(cluster.Cluster.CertificateAuthorityData) > 0 {
+				logger.V(4).Info("Found CA in cluster", "index", i, "caDataLen", len(cluster.Cluster.CertificateAuthorityData))
+				caData = cluster.Cluster.CertificateAuthorityData
+				break
+			}
 		}
 	}
 
-	logger.V(4).Info("No CA found in kubeconfig")
-	return nil
+	if len(caData) == 0 {
+		logger.V(4).Info("No CA found in kubeconfig")
+		return nil, usedFallback
+	}
+	if _, err := certutil.ParseCertsPEM(caData); err != nil {
+		logger.Info("Ignoring the CA of the kubeconfig, it is not a valid x509 certificate", "error", err)
+		return nil, usedFallback
+	}
+	return caData, usedFallback
 }
 
 // extractCAFromKubeconfigSimple provides a simple fallback extraction method
-// for kubeconfig files that may not parse correctly with the structured approach
-func extractCAFromKubeconfigSimple(kubeconfigData []byte) []byte {
-	logger := log.FromContext(context.Background())
+// for kubeconfig files that may not parse correctly with the structured approach.
+// The base64 value is taken from the certificate-authority-data line, or from the next line when empty.
+func extractCAFromKubeconfigSimple(ctx context.Context, kubeconfigData []byte) []byte {
+	logger := log.FromContext(ctx)
 	dataStr := string(kubeconfigData)
 	if !strings.Contains(dataStr, "certificate-authority-data:") {
 		logger.V(4).Info("No certificate-authority-data found in kubeconfig")
@@ -1682,18 +2328,23 @@ func extractCAFromKubeconfigSimple(kubeconfigData []byte) []byte {
 
 	lines := strings.Split(dataStr, "\n")
 	for i, line := range lines {
-		if strings.Contains(line, "certificate-authority-data:") && i+1 < len(lines) {
-			caBase64 := strings.TrimSpace(lines[i+1])
-			// Remove potential quotes and extra whitespace
-			caBase64 = strings.Trim(caBase64, "\"'\"")
-			logger.V(4).Info("Found certificate-authority-data", "line", i, "caBase64Len", len(caBase64))
-
-			if decoded, err := base64.StdEncoding.DecodeString(caBase64); err == nil {
-				logger.V(4).Info("Successfully decoded CA", "decodedLen", len(decoded))
-				return decoded
-			} else {
-				logger.V(4).Info("Failed to decode CA", "error", err)
-			}
+		_, caBase64, found := strings.Cut(line, "certificate-authority-data:")
+		if !found {
+			continue
+		}
+		caBase64 = strings.TrimSpace(caBase64)
+		if caBase64 == "" && i+1 < len(lines) {
+			caBase64 = strings.TrimSpace(lines[i+1])
+		}
+		// Remove potential quotes and extra whitespace
+		caBase64 = strings.Trim(caBase64, "\"'")
+		logger.V(4).Info("Found certificate-authority-data", "line", i, "caBase64Len", len(caBase64))
+
+		if decoded, err := base64.StdEncoding.DecodeString(caBase64); err == nil {
+			logger.V(4).Info("Successfully decoded CA", "decodedLen", len(decoded))
+			return decoded
+		} else {
+			logger.V(4).Info("Failed to decode CA", "error", err)
 		}
 	}
 	return nil
@@ -1720,6 +2371,22 @@ func extractCAFromCloudInit(script string) []byte {
 	return nil
 }
 
+// hostLeaseTimeout returns the HostLeaseTimeout, or the DefaultHostLeaseTimeout when not set
+func (r *ByoMachineReconciler) hostLeaseTimeout() time.Duration {
+	if r.HostLeaseTimeout > 0 {
+		return r.HostLeaseTimeout
+	}
+	return DefaultHostLeaseTimeout
+}
+
+// hostAttachMaxRetries returns the HostAttachMaxRetries, or the DefaultHostAttachMaxRetries when not set
+func (r *ByoMachineReconciler) hostAttachMaxRetries() int {
+	if r.HostAttachMaxRetries > 0 {
+		return r.HostAttachMaxRetries
+	}
+	return DefaultHostAttachMaxRetries
+}
+
 // tryAcquireLease attempts to acquire a lease on the given ByoHost
 // Returns true if lease was acquired, false if lease is held by another instance
 func (r *ByoMachineReconciler) tryAcquireLease(ctx context.Context, byoHost *infrav1.ByoHost, machineName string, controllerID string) (bool, error) {
@@ -1730,7 +2397,7 @@ func (r *ByoMachineReconciler) tryAcquireLease(ctx context.Context, byoHost *inf
 		var currentLock lockInfo
 		if err := json.Unmarshal([]byte(leaseStr), &currentLock); err == nil {
 			// Check if lease has expired
-			if currentLock.AcquireTime.Add(time.Duration(HostLeaseTimeoutSeconds) * time.Second).After(now) {
+			if currentLock.AcquireTime.Add(r.hostLeaseTimeout()).After(now) {
 				// Lease is still valid and held by someone
 				return false, nil
 			}
@@ -1801,12 +2468,22 @@ func exponentialBackoff(attempt int) time.Duration {
 	return time.Duration(1<<uint(attempt-1)) * 100 * time.Millisecond
 }
 
-// selectHostForClaim implements priority-based selection with round-robin for hosts with the same priority
+// selectHostForClaim selects the available host with the highest score of the HostScorers, round-robin among
+// the hosts with the same score. The selected host is reserved for the machine, hosts reserved for other
+// machines are not selected.
 func (r *ByoMachineReconciler) selectHostForClaim(hostsList []infrav1.ByoHost, clusterName string, machine *infrav1.ByoMachine) *infrav1.ByoHost {
 	if len(hostsList) == 0 {
 		return nil
 	}
 
+	// The index map and the reservations are shared by all workers when MaxConcurrentReconciles > 1, the
+	// selection and the reservation of the host must be atomic for two workers not to select the same host
+	r.roundRobinMu.Lock()
+	defer r.roundRobinMu.Unlock()
+
+	now := time.Now()
+	machineKey := client.ObjectKeyFromObject(machine).String()
+
 	// Filter available hosts that match capacity requirements
 	var availableHosts []infrav1.ByoHost
 	for _, host := range hostsList {
@@ -1814,6 +2491,21 @@ func (r *ByoMachineReconciler) selectHostForClaim(hostsList []infrav1.ByoHost, c
 			continue
 		}
 
+		// Skip hosts another machine of this process is claiming
+		if r.reservedByOther(&host, machineKey, now) {
+			continue
+		}
+
+		// Skip hosts sharing their node name with other ByoHosts, their nodes would conflict on the providerID
+		if conditions.IsFalse(&host, infrav1.NodeNameUnique) {
+			continue
+		}
+
+		// Skip hosts of another architecture, they would download binaries the machine cannot run
+		if machine.Spec.RequiredArchitecture != "" && host.Status.HostDetails.Architecture != machine.Spec.RequiredArchitecture {
+			continue
+		}
+
 		// Check if host matches capacity requirements
 		if machine.Spec.CapacityRequirements != nil {
 			if !host.MatchesRequirements(nil, machine.Spec.CapacityRequirements) {
@@ -1828,41 +2520,73 @@ func (r *ByoMachineReconciler) selectHostForClaim(hostsList []infrav1.ByoHost, c
 		return nil
 	}
 
-	// Find the maximum priority among available hosts
-	maxPriority := int32(0)
-	for _, host := range availableHosts {
-		if priority := host.GetPriority(); priority > maxPriority {
-			maxPriority = priority
-		}
+	scorers := r.HostScorers
+	if len(scorers) == 0 {
+		scorers = DefaultHostScorers()
 	}
 
-	// Collect hosts with the highest priority
-	var highPriorityHosts []infrav1.ByoHost
-	for _, host := range availableHosts {
-		if host.GetPriority() == maxPriority {
-			highPriorityHosts = append(highPriorityHosts, host)
-		}
+	// Collect the hosts with the highest score
+	topScoredHosts := highestScoredHosts(scorers, availableHosts, machine)
+
+	// Narrow the top scored hosts down to the ones fitting the capacity requirements best, by the selection strategy
+	if strategy := machine.Spec.SelectionStrategy; strategy == infrav1.HostSelectionStrategyBestFit || strategy == infrav1.HostSelectionStrategyMostFree {
+		topScoredHosts = highestScoredHosts([]HostScorer{newCapacityScorer(topScoredHosts, machine)}, topScoredHosts, machine)
 	}
 
 	// Initialize round-robin index for this cluster if not exists
 	if r.roundRobinIndex == nil {
 		r.roundRobinIndex = make(map[string]int)
 	}
-	if _, exists := r.roundRobinIndex[clusterName]; !exists {
-		r.roundRobinIndex[clusterName] = 0
-	}
 
-	// Get current index and return the host (using high priority hosts)
-	currentIndex := r.roundRobinIndex[clusterName]
-	selectedHost := &highPriorityHosts[currentIndex]
+	// Get current index and return the host (using the top scored hosts)
+	// The candidate list may have shrunk since the last selection, so keep the index in range
+	currentIndex := r.roundRobinIndex[clusterName] % len(topScoredHosts)
+	selectedHost := &topScoredHosts[currentIndex]
 
 	// Increment index for next selection (wrap around)
-	r.roundRobinIndex[clusterName] = (currentIndex + 1) % len(highPriorityHosts)
+	r.roundRobinIndex[clusterName] = (currentIndex + 1) % len(topScoredHosts)
 
-	// Return the selected host
+	r.reserveHost(selectedHost, machineKey, now)
 	return selectedHost
 }
 
+// reservedByOther returns whether the host is reserved for another machine than the given one.
+// It must be called with roundRobinMu held.
+func (r *ByoMachineReconciler) reservedByOther(host *infrav1.ByoHost, machineKey string, now time.Time) bool {
+	reservation, ok := r.reservations[client.ObjectKeyFromObject(host).String()]
+	return ok && reservation.machine != machineKey && now.Before(reservation.expires)
+}
+
+// reserveHost reserves the host for the machine for the host lease timeout, replacing the previous reservation
+// of the machine and dropping the expired ones. It must be called with roundRobinMu held.
+func (r *ByoMachineReconciler) reserveHost(host *infrav1.ByoHost, machineKey string, now time.Time) {
+	if r.reservations == nil {
+		r.reservations = make(map[string]hostReservation)
+	}
+	for key, reservation := range r.reservations {
+		if reservation.machine == machineKey || !now.Before(reservation.expires) {
+			delete(r.reservations, key)
+		}
+	}
+	r.reservations[client.ObjectKeyFromObject(host).String()] = hostReservation{
+		machine: machineKey,
+		expires: now.Add(r.hostLeaseTimeout()),
+	}
+}
+
+// releaseReservation drops the reservation of a host for the machine, e.g. when the machine failed to claim it
+func (r *ByoMachineReconciler) releaseReservation(machine *infrav1.ByoMachine) {
+	machineKey := client.ObjectKeyFromObject(machine).String()
+
+	r.roundRobinMu.Lock()
+	defer r.roundRobinMu.Unlock()
+	for key, reservation := range r.reservations {
+		if reservation.machine == machineKey {
+			delete(r.reservations, key)
+		}
+	}
+}
+
 // generateProviderID generates a standardized ProviderID for a ByoHost
 // This ensures consistency across all injection points (cloud-init, kubelet args, Node objects)
 func generateProviderID(host *infrav1.ByoHost) string {
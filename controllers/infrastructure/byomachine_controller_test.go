@@ -7,15 +7,18 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common/bootstraptoken"
 	controllers "github.com/mensylisir/cluster-api-provider-bringyourownhost/controllers/infrastructure"
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/test/builder"
 	eventutils "github.com/mensylisir/cluster-api-provider-bringyourownhost/test/utils/events"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
@@ -279,6 +282,27 @@ var _ = Describe("Controllers/ByomachineController", func() {
 				Expect(node.Spec.ProviderID).To(ContainSubstring(common.ProviderIDPrefix))
 			})
 
+			It("replaces a BootstrapSecret set on the free host when claiming it", func() {
+				ph, err := patch.NewHelper(byoHost, k8sClientUncached)
+				Expect(err).ShouldNot(HaveOccurred())
+				byoHost.Spec.BootstrapSecret = &corev1.ObjectReference{Kind: "Secret", Namespace: defaultNamespace, Name: "tampered-secret"}
+				Expect(ph.Patch(ctx, byoHost, patch.WithStatusObservedGeneration{})).Should(Succeed())
+				WaitForObjectToBeUpdatedInCache(byoHost, func(object client.Object) bool {
+					return object.(*infrastructurev1beta1.ByoHost).Spec.BootstrapSecret != nil
+				})
+
+				_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+				Expect(err).ToNot(HaveOccurred())
+
+				claimedByoHost := &infrastructurev1beta1.ByoHost{}
+				Expect(k8sClientUncached.Get(ctx, byoHostLookupKey, claimedByoHost)).To(Succeed())
+				Expect(claimedByoHost.Status.MachineRef.Name).To(Equal(byoMachine.Name))
+				Expect(claimedByoHost.Spec.BootstrapSecret.Name).To(Equal(*machine.Spec.Bootstrap.DataSecretName))
+
+				events := eventutils.CollectEvents(recorder.Events)
+				Expect(events).Should(ContainElement("Warning StrayBootstrapSecretCleared Cleared BootstrapSecret tampered-secret set on the ByoHost while it was not attached"))
+			})
+
 			Context("When ByoMachine is attached to a host", func() {
 				BeforeEach(func() {
 					ph, err := patch.NewHelper(byoHost, k8sClientUncached)
@@ -344,6 +368,34 @@ var _ = Describe("Controllers/ByomachineController", func() {
 
 				})
 
+				It("should delete the bootstrap token secret once the node is ready", func() {
+					tokenSecret, err := bootstraptoken.GenerateSecretFromBootstrapToken("abcdef.0123456789abcdef", 30*time.Minute, bootstraptoken.Options{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(k8sClientUncached.Create(ctx, tokenSecret)).Should(Succeed())
+
+					ph, err := patch.NewHelper(byoMachine, k8sClientUncached)
+					Expect(err).ShouldNot(HaveOccurred())
+					annotations.AddAnnotations(byoMachine, map[string]string{
+						infrastructurev1beta1.BootstrapTokenSecretAnnotation: tokenSecret.Name,
+					})
+					Expect(ph.Patch(ctx, byoMachine, patch.WithStatusObservedGeneration{})).Should(Succeed())
+					WaitForObjectToBeUpdatedInCache(byoMachine, func(object client.Object) bool {
+						_, ok := object.GetAnnotations()[infrastructurev1beta1.BootstrapTokenSecretAnnotation]
+						return ok
+					})
+
+					_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+					Expect(err).ToNot(HaveOccurred())
+
+					err = k8sClientUncached.Get(ctx, client.ObjectKeyFromObject(tokenSecret), &corev1.Secret{})
+					Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+					createdByoMachine := &infrastructurev1beta1.ByoMachine{}
+					Expect(k8sClientUncached.Get(ctx, byoMachineLookupKey, createdByoMachine)).To(Succeed())
+					Expect(createdByoMachine.Status.Ready).To(BeTrue())
+					Expect(createdByoMachine.Annotations).NotTo(HaveKey(infrastructurev1beta1.BootstrapTokenSecretAnnotation))
+				})
+
 				It("should set host platform info from byohost to byomachine", func() {
 					ph, err := patch.NewHelper(byoHost, k8sClientUncached)
 					Expect(err).ShouldNot(HaveOccurred())
@@ -787,6 +839,84 @@ var _ = Describe("Controllers/ByomachineController", func() {
 				Expect(node.Spec.ProviderID).To(ContainSubstring(common.ProviderIDPrefix))
 			})
 
+			It("releases the attached host and claims another one when the release annotation is set", func() {
+				ph, err := patch.NewHelper(byoHost1, k8sClientUncached)
+				Expect(err).ShouldNot(HaveOccurred())
+				byoHost1.Status.MachineRef = &corev1.ObjectReference{
+					Kind:       "ByoMachine",
+					Namespace:  byoMachine.Namespace,
+					Name:       byoMachine.Name,
+					UID:        byoMachine.UID,
+					APIVersion: byoHost1.APIVersion,
+				}
+				byoHost1.Labels = map[string]string{
+					clusterv1.ClusterNameLabel:                    capiCluster.Name,
+					infrastructurev1beta1.AttachedByoMachineLabel: byoMachine.Namespace + "." + byoMachine.Name,
+				}
+				Expect(ph.Patch(ctx, byoHost1, patch.WithStatusObservedGeneration{})).Should(Succeed())
+				WaitForObjectToBeUpdatedInCache(byoHost1, func(object client.Object) bool {
+					return object.(*infrastructurev1beta1.ByoHost).Status.MachineRef != nil
+				})
+
+				ph, err = patch.NewHelper(byoMachine, k8sClientUncached)
+				Expect(err).ShouldNot(HaveOccurred())
+				annotations.AddAnnotations(byoMachine, map[string]string{infrastructurev1beta1.ReleaseHostAnnotation: ""})
+				Expect(ph.Patch(ctx, byoMachine, patch.WithStatusObservedGeneration{})).Should(Succeed())
+				WaitForObjectToBeUpdatedInCache(byoMachine, func(object client.Object) bool {
+					_, ok := object.GetAnnotations()[infrastructurev1beta1.ReleaseHostAnnotation]
+					return ok
+				})
+
+				_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+				Expect(err).ToNot(HaveOccurred())
+
+				releasedByoHost := &infrastructurev1beta1.ByoHost{}
+				Expect(k8sClientUncached.Get(ctx, client.ObjectKeyFromObject(byoHost1), releasedByoHost)).To(Succeed())
+				Expect(releasedByoHost.Status.MachineRef).To(BeNil())
+				Expect(releasedByoHost.Annotations).To(HaveKey(infrastructurev1beta1.HostCleanupAnnotation))
+				Expect(releasedByoHost.Labels).NotTo(HaveKey(infrastructurev1beta1.AttachedByoMachineLabel))
+
+				claimedByoHost := &infrastructurev1beta1.ByoHost{}
+				Expect(k8sClientUncached.Get(ctx, client.ObjectKeyFromObject(byoHost2), claimedByoHost)).To(Succeed())
+				Expect(claimedByoHost.Status.MachineRef).NotTo(BeNil())
+				Expect(claimedByoHost.Status.MachineRef.Name).To(Equal(byoMachine.Name))
+
+				createdByoMachine := &infrastructurev1beta1.ByoMachine{}
+				Expect(k8sClientUncached.Get(ctx, byoMachineLookupKey, createdByoMachine)).To(Succeed())
+				Expect(createdByoMachine.Annotations).NotTo(HaveKey(infrastructurev1beta1.ReleaseHostAnnotation))
+				Expect(createdByoMachine.Status.Ready).To(BeTrue())
+
+				events := eventutils.CollectEvents(recorder.Events)
+				Expect(events).To(ContainElements(
+					fmt.Sprintf("Normal ByoHostReleaseSucceeded Released ByoHost %s", byoHost1.Name),
+					fmt.Sprintf("Normal ByoHostAttachSucceeded Attached ByoHost %s", byoHost2.Name),
+				))
+			})
+
+			It("refuses to release the host of a machine bound to a node", func() {
+				ph, err := patch.NewHelper(byoMachine, k8sClientUncached)
+				Expect(err).ShouldNot(HaveOccurred())
+				byoMachine.Spec.ProviderID = common.GenerateProviderID(byoHost1.Name)
+				annotations.AddAnnotations(byoMachine, map[string]string{infrastructurev1beta1.ReleaseHostAnnotation: ""})
+				Expect(ph.Patch(ctx, byoMachine, patch.WithStatusObservedGeneration{})).Should(Succeed())
+				WaitForObjectToBeUpdatedInCache(byoMachine, func(object client.Object) bool {
+					_, ok := object.GetAnnotations()[infrastructurev1beta1.ReleaseHostAnnotation]
+					return ok
+				})
+
+				_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+				Expect(err).ToNot(HaveOccurred())
+
+				createdByoMachine := &infrastructurev1beta1.ByoMachine{}
+				Expect(k8sClientUncached.Get(ctx, byoMachineLookupKey, createdByoMachine)).To(Succeed())
+				Expect(createdByoMachine.Annotations).NotTo(HaveKey(infrastructurev1beta1.ReleaseHostAnnotation))
+				Expect(createdByoMachine.Spec.ProviderID).To(Equal(common.GenerateProviderID(byoHost1.Name)))
+
+				events := eventutils.CollectEvents(recorder.Events)
+				Expect(events).To(ContainElement(HavePrefix("Warning ByoHostReleaseRefused")))
+				Expect(events).NotTo(ContainElement(HavePrefix("Normal ByoHostReleaseSucceeded")))
+			})
+
 			AfterEach(func() {
 				Expect(k8sClientUncached.Delete(ctx, byoHost1)).Should(Succeed())
 				Expect(k8sClientUncached.Delete(ctx, byoHost2)).Should(Succeed())
@@ -865,21 +995,20 @@ var _ = Describe("Controllers/ByomachineController", func() {
 			})
 		})
 
-		It("should mark BYOHostReady as False", func() {
-			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
+		It("should mark BYOHostReady as False with what is missing and requeue", func() {
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: byoMachineLookupKey})
 			Expect(err).To(BeNil())
+			Expect(result.RequeueAfter).To(Equal(controllers.RequeueForbyohost))
 
 			createdByoMachine := &infrastructurev1beta1.ByoMachine{}
 			err = k8sClientUncached.Get(ctx, byoMachineLookupKey, createdByoMachine)
 			Expect(err).ShouldNot(HaveOccurred())
 
 			actualCondition := conditions.Get(createdByoMachine, infrastructurev1beta1.BYOHostReady)
-			Expect(*actualCondition).To(conditions.MatchCondition(clusterv1.Condition{
-				Type:     infrastructurev1beta1.BYOHostReady,
-				Status:   corev1.ConditionFalse,
-				Reason:   infrastructurev1beta1.WaitingForClusterInfrastructureReason,
-				Severity: clusterv1.ConditionSeverityInfo,
-			}))
+			Expect(actualCondition.Status).To(Equal(corev1.ConditionFalse))
+			Expect(actualCondition.Reason).To(Equal(infrastructurev1beta1.WaitingForClusterInfrastructureReason))
+			Expect(actualCondition.Severity).To(Equal(clusterv1.ConditionSeverityInfo))
+			Expect(actualCondition.Message).To(ContainSubstring(fmt.Sprintf("control plane endpoint of ByoCluster %s is not set", byoCluster.Name)))
 
 			// assert events
 			events := eventutils.CollectEvents(recorder.Events)
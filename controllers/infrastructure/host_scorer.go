@@ -0,0 +1,135 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"math"
+
+	infrav1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// HostScorer scores an available ByoHost for a ByoMachine claiming a host. The scores of all the
+// scorers of the reconciler are summed, the hosts with the highest total are preferred and ties
+// are broken round-robin.
+type HostScorer interface {
+	Score(host *infrav1.ByoHost, machine *infrav1.ByoMachine) int
+}
+
+// HostScorerFunc adapts a function to a HostScorer
+type HostScorerFunc func(host *infrav1.ByoHost, machine *infrav1.ByoMachine) int
+
+// Score calls the function
+func (f HostScorerFunc) Score(host *infrav1.ByoHost, machine *infrav1.ByoMachine) int {
+	return f(host, machine)
+}
+
+// PriorityScorer scores a host by its priority, so hosts of a higher priority are claimed first
+type PriorityScorer struct{}
+
+// Score returns the priority of the host
+func (PriorityScorer) Score(host *infrav1.ByoHost, _ *infrav1.ByoMachine) int {
+	return int(host.GetPriority())
+}
+
+// DefaultHostScorers returns the scorers used when the reconciler is not configured with any
+func DefaultHostScorers() []HostScorer {
+	return []HostScorer{PriorityScorer{}}
+}
+
+// hostScore returns the sum of the scores of the host for the machine
+func hostScore(scorers []HostScorer, host *infrav1.ByoHost, machine *infrav1.ByoMachine) int {
+	score := 0
+	for _, scorer := range scorers {
+		score += scorer.Score(host, machine)
+	}
+	return score
+}
+
+// highestScoredHosts returns the hosts with the highest sum of the scores of the scorers for the machine
+func highestScoredHosts(scorers []HostScorer, hosts []infrav1.ByoHost, machine *infrav1.ByoMachine) []infrav1.ByoHost {
+	var highest []infrav1.ByoHost
+	maxScore := 0
+	for i := range hosts {
+		score := hostScore(scorers, &hosts[i], machine)
+		if len(highest) == 0 || score > maxScore {
+			maxScore = score
+			highest = highest[:0]
+		}
+		if score == maxScore {
+			highest = append(highest, hosts[i])
+		}
+	}
+	return highest
+}
+
+// capacityScorer scores a host by the capacity it is left with once the capacity requirements of the
+// machine are placed on it, for the bestFit and mostFree selection strategies. The capacity of a host is
+// its allocatable capacity, the Capacity minus the ReservedCapacity. Each resource is weighed relative to
+// the largest leftover among the hosts being ranked, so no resource outweighs another by its unit.
+type capacityScorer struct {
+	strategy      infrav1.HostSelectionStrategy
+	resourceNames []corev1.ResourceName
+	// largest is the largest leftover of each resource among the hosts
+	largest []float64
+}
+
+// newCapacityScorer returns a capacityScorer ranking the hosts for the machine by its selection strategy.
+// The hosts are compared over the required resources, or cpu and memory when the machine has no requirements.
+func newCapacityScorer(hosts []infrav1.ByoHost, machine *infrav1.ByoMachine) *capacityScorer {
+	resourceNames := []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+	if len(machine.Spec.CapacityRequirements) > 0 {
+		resourceNames = resourceNames[:0]
+		for resourceName := range machine.Spec.CapacityRequirements {
+			resourceNames = append(resourceNames, resourceName)
+		}
+	}
+
+	scorer := &capacityScorer{
+		strategy:      machine.Spec.SelectionStrategy,
+		resourceNames: resourceNames,
+		largest:       make([]float64, len(resourceNames)),
+	}
+	for i := range hosts {
+		for j, leftover := range scorer.leftovers(&hosts[i], machine) {
+			if leftover > scorer.largest[j] {
+				scorer.largest[j] = leftover
+			}
+		}
+	}
+	return scorer
+}
+
+// leftovers returns the capacity of each resource the host is left with, a host lacking the resource has none
+func (s *capacityScorer) leftovers(host *infrav1.ByoHost, machine *infrav1.ByoMachine) []float64 {
+	allocatable := host.AllocatableCapacity()
+	leftovers := make([]float64, len(s.resourceNames))
+	for j, resourceName := range s.resourceNames {
+		available, ok := allocatable[resourceName]
+		if !ok {
+			continue
+		}
+		if required, ok := machine.Spec.CapacityRequirements[resourceName]; ok {
+			available.Sub(required)
+		}
+		leftovers[j] = available.AsApproximateFloat64()
+	}
+	return leftovers
+}
+
+// Score returns the weighed leftover capacity of the host in thousandths, negated for bestFit so the
+// host left with the least capacity scores the highest
+func (s *capacityScorer) Score(host *infrav1.ByoHost, machine *infrav1.ByoMachine) int {
+	free := 0.0
+	for j, leftover := range s.leftovers(host, machine) {
+		if s.largest[j] > 0 {
+			free += leftover / s.largest[j]
+		}
+	}
+	score := int(math.Round(free * 1000))
+	if s.strategy == infrav1.HostSelectionStrategyBestFit {
+		return -score
+	}
+	return score
+}
@@ -52,6 +52,8 @@ type k8sInstallerConfigScope struct {
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=k8sinstallerconfigs/finalizers,verbs=update
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byomachines,verbs=get;list;watch
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byomachines/status,verbs=get
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byohosts,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=byohosts/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups="",resources=secrets;events,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -157,6 +159,33 @@ func (r *K8sInstallerConfigReconciler) reconcileNormal(ctx context.Context, scop
 	var installerObj installer.K8sInstaller
 	var err error
 
+	// Cluster level installer settings are best effort, the defaults are used without a ByoCluster
+	byoCluster := r.getByoCluster(ctx, scope)
+	var cniPluginsVersion, imgpkgVersion, imgpkgBaseURL string
+	if byoCluster != nil {
+		cniPluginsVersion = byoCluster.Spec.CNIPluginsVersion
+		imgpkgVersion = byoCluster.Spec.ImgpkgVersion
+		imgpkgBaseURL = byoCluster.Spec.ImgpkgBaseURL
+	}
+	// The versions pinned by the installer config win over the cluster level ones
+	if scope.Config.Spec.CNIPluginsVersion != "" {
+		cniPluginsVersion = scope.Config.Spec.CNIPluginsVersion
+	}
+	opts := installer.Options{
+		OSDist:            scope.ByoMachine.Status.HostInfo.OSImage,
+		Arch:              scope.ByoMachine.Status.HostInfo.Architecture,
+		K8sVersion:        k8sVersion,
+		CNIPluginsVersion: cniPluginsVersion,
+		ContainerdVersion: scope.Config.Spec.ContainerdVersion,
+		RuncVersion:       scope.Config.Spec.RuncVersion,
+		ImgpkgVersion:     imgpkgVersion,
+		ImgpkgBaseURL:     imgpkgBaseURL,
+		KernelModules:     scope.Config.Spec.KernelModules,
+		FirewallMode:      scope.Config.Spec.FirewallMode,
+		FirewallPorts:     scope.Config.Spec.FirewallPorts,
+		RuntimeHandlers:   getRuntimeHandlers(scope.Config),
+	}
+
 	if joinMode == infrav1.JoinModeTLSBootstrap {
 		// Use kubexm installer for TLS Bootstrap mode
 		downloadMode := string(scope.ByoMachine.Spec.DownloadMode)
@@ -165,20 +194,14 @@ func (r *K8sInstallerConfigReconciler) reconcileNormal(ctx context.Context, scop
 		}
 
 		// Get proxy configuration from ByoCluster annotations
-		proxyConfig := r.getProxyConfig(ctx, scope)
+		proxyConfig := getProxyConfig(byoCluster)
 
 		// Use standard downloader for offline support
 		downloader := installer.NewBundleDownloader(scope.Config.Spec.BundleType, scope.Config.Spec.BundleRepo, "{{.BUNDLE_DOWNLOAD_PATH}}", logger)
 
-		installerObj, err = installer.NewKubexmInstaller(
-			ctx,
-			scope.ByoMachine.Status.HostInfo.OSImage,
-			scope.ByoMachine.Status.HostInfo.Architecture,
-			k8sVersion,
-			downloadMode,
-			proxyConfig,
-			downloader,
-		)
+		opts.DownloadMode = downloadMode
+		opts.ProxyConfig = proxyConfig
+		installerObj, err = installer.NewKubexmInstaller(ctx, opts, downloader)
 		if err != nil {
 			logger.Error(err, "failed to create kubexm installer instance", "osImage", scope.ByoMachine.Status.HostInfo.OSImage, "architecture", scope.ByoMachine.Status.HostInfo.Architecture, "k8sVersion", k8sVersion, "downloadMode", downloadMode)
 			return ctrl.Result{}, err
@@ -187,7 +210,7 @@ func (r *K8sInstallerConfigReconciler) reconcileNormal(ctx context.Context, scop
 	} else {
 		// Use standard kubeadm installer (default)
 		downloader := installer.NewBundleDownloader(scope.Config.Spec.BundleType, scope.Config.Spec.BundleRepo, "{{.BUNDLE_DOWNLOAD_PATH}}", logger)
-		installerObj, err = installer.NewInstaller(ctx, scope.ByoMachine.Status.HostInfo.OSImage, scope.ByoMachine.Status.HostInfo.Architecture, k8sVersion, downloader)
+		installerObj, err = installer.NewInstaller(ctx, opts, downloader)
 		if err != nil {
 			logger.Error(err, "failed to create installer instance", "osImage", scope.ByoMachine.Status.HostInfo.OSImage, "architecture", scope.ByoMachine.Status.HostInfo.Architecture, "k8sVersion", k8sVersion)
 			return ctrl.Result{}, err
@@ -200,15 +223,53 @@ func (r *K8sInstallerConfigReconciler) reconcileNormal(ctx context.Context, scop
 		return ctrl.Result{}, err
 	}
 
+	r.recordResolvedBundle(ctx, scope, k8sVersion)
+
 	return ctrl.Result{}, nil
 }
 
-// getProxyConfig extracts proxy configuration from ByoCluster annotations
-func (r *K8sInstallerConfigReconciler) getProxyConfig(ctx context.Context, scope *k8sInstallerConfigScope) map[string]string {
-	proxyConfig := map[string]string{}
-	cluster, err := util.GetClusterFromMetadata(ctx, r.Client, scope.ByoMachine.ObjectMeta)
+// recordResolvedBundle records the BYOH bundle and k8s version filter the OS of the host was resolved to on the
+// status of the attached ByoHost, so operators can confirm the expected bundle was chosen. It is best effort, the
+// install script does not depend on it.
+func (r *K8sInstallerConfigReconciler) recordResolvedBundle(ctx context.Context, scope *k8sInstallerConfigScope, k8sVersion string) {
+	logger := scope.Logger
+	hostInfo := scope.ByoMachine.Status.HostInfo
+	osBundle, k8sFilter, err := installer.ResolveBundle(hostInfo.OSImage, hostInfo.Architecture, k8sVersion)
 	if err != nil {
-		return proxyConfig
+		logger.Info("No bundle resolved for the host", "osImage", hostInfo.OSImage, "architecture", hostInfo.Architecture)
+		return
+	}
+
+	hostsList := &infrav1.ByoHostList{}
+	if err := r.Client.List(ctx, hostsList, client.InNamespace(scope.ByoMachine.Namespace),
+		client.MatchingLabels{infrav1.AttachedByoMachineLabel: scope.ByoMachine.Namespace + "." + scope.ByoMachine.Name}); err != nil || len(hostsList.Items) == 0 {
+		logger.Info("No attached ByoHost to record the resolved bundle on", "osBundle", osBundle, "k8sFilter", k8sFilter)
+		return
+	}
+
+	byoHost := &hostsList.Items[0]
+	if byoHost.Status.ResolvedOSBundle == osBundle && byoHost.Status.ResolvedK8sFilter == k8sFilter {
+		return
+	}
+	helper, err := patch.NewHelper(byoHost, r.Client)
+	if err != nil {
+		logger.Error(err, "failed to record the resolved bundle", "byoHost", byoHost.Name)
+		return
+	}
+	byoHost.Status.ResolvedOSBundle = osBundle
+	byoHost.Status.ResolvedK8sFilter = k8sFilter
+	if err := helper.Patch(ctx, byoHost); err != nil {
+		logger.Error(err, "failed to record the resolved bundle", "byoHost", byoHost.Name)
+		return
+	}
+	logger.Info("Recorded the resolved bundle", "byoHost", byoHost.Name, "osBundle", osBundle, "k8sFilter", k8sFilter)
+}
+
+// getByoCluster returns the ByoCluster of the ByoMachine, or nil when it cannot be found
+func (r *K8sInstallerConfigReconciler) getByoCluster(ctx context.Context, scope *k8sInstallerConfigScope) *infrav1.ByoCluster {
+	cluster, err := util.GetClusterFromMetadata(ctx, r.Client, scope.ByoMachine.ObjectMeta)
+	if err != nil || cluster.Spec.InfrastructureRef == nil {
+		return nil
 	}
 
 	byoCluster := &infrav1.ByoCluster{}
@@ -216,6 +277,15 @@ func (r *K8sInstallerConfigReconciler) getProxyConfig(ctx context.Context, scope
 		Namespace: scope.ByoMachine.Namespace,
 		Name:      cluster.Spec.InfrastructureRef.Name,
 	}, byoCluster); err != nil {
+		return nil
+	}
+	return byoCluster
+}
+
+// getProxyConfig extracts proxy configuration from ByoCluster annotations
+func getProxyConfig(byoCluster *infrav1.ByoCluster) map[string]string {
+	proxyConfig := map[string]string{}
+	if byoCluster == nil {
 		return proxyConfig
 	}
 
@@ -234,6 +304,15 @@ func (r *K8sInstallerConfigReconciler) getProxyConfig(ctx context.Context, scope
 	return proxyConfig
 }
 
+// getRuntimeHandlers returns the containerd runtime handlers of the config by name
+func getRuntimeHandlers(config *infrav1.K8sInstallerConfig) map[string]string {
+	handlers := map[string]string{}
+	for _, handler := range config.Spec.RuntimeHandlers {
+		handlers[handler.Name] = handler.RuntimeType
+	}
+	return handlers
+}
+
 // getBootstrapKubeconfigData fetches the bootstrap-kubeconfig data for kubexm mode
 func (r *K8sInstallerConfigReconciler) getBootstrapKubeconfigData(ctx context.Context, scope *k8sInstallerConfigScope) ([]byte, error) {
 	// Look for BootstrapKubeconfig in the same namespace
@@ -296,6 +296,139 @@ var _ = Describe("Controllers/K8sInstallerConfigController", func() {
 			Expect(exists).To(BeTrue())
 		})
 
+		It("should render the CNI plugins version pinned on the ByoCluster", func() {
+			pinnedCluster := &infrav1.ByoCluster{}
+			Expect(k8sClientUncached.Get(ctx, types.NamespacedName{Name: byoCluster.Name, Namespace: byoCluster.Namespace}, pinnedCluster)).To(Succeed())
+			unpinned := pinnedCluster.DeepCopy()
+			pinnedCluster.Spec.CNIPluginsVersion = "v1.5.1"
+			Expect(k8sClientUncached.Patch(ctx, pinnedCluster, client.MergeFrom(unpinned))).Should(Succeed())
+			DeferCleanup(func() {
+				pinned := pinnedCluster.DeepCopy()
+				pinnedCluster.Spec.CNIPluginsVersion = ""
+				Expect(k8sClientUncached.Patch(ctx, pinnedCluster, client.MergeFrom(pinned))).Should(Succeed())
+			})
+			WaitForObjectToBeUpdatedInCache(pinnedCluster, func(object client.Object) bool {
+				return object.(*infrav1.ByoCluster).Spec.CNIPluginsVersion == "v1.5.1"
+			})
+
+			_, err := k8sInstallerConfigReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      k8sinstallerConfig.Name,
+					Namespace: k8sinstallerConfig.Namespace}})
+			Expect(err).NotTo(HaveOccurred())
+
+			createdSecret := &corev1.Secret{}
+			Expect(k8sClientUncached.Get(ctx, installerSecretLookupKey, createdSecret)).To(Succeed())
+			Expect(string(createdSecret.Data["install"])).To(ContainSubstring("CNI_PLUGINS_VERSION=v1.5.1"))
+		})
+
+		It("should render the containerd and runc versions pinned on the K8sInstallerConfig", func() {
+			pinnedConfig := &infrav1.K8sInstallerConfig{}
+			Expect(k8sClientUncached.Get(ctx, types.NamespacedName{Name: k8sinstallerConfig.Name, Namespace: k8sinstallerConfig.Namespace}, pinnedConfig)).To(Succeed())
+			unpinned := pinnedConfig.DeepCopy()
+			pinnedConfig.Spec.ContainerdVersion = "v1.7.22"
+			pinnedConfig.Spec.RuncVersion = "v1.1.14"
+			Expect(k8sClientUncached.Patch(ctx, pinnedConfig, client.MergeFrom(unpinned))).Should(Succeed())
+			DeferCleanup(func() {
+				pinned := pinnedConfig.DeepCopy()
+				pinnedConfig.Spec.ContainerdVersion = ""
+				pinnedConfig.Spec.RuncVersion = ""
+				Expect(k8sClientUncached.Patch(ctx, pinnedConfig, client.MergeFrom(pinned))).Should(Succeed())
+			})
+			WaitForObjectToBeUpdatedInCache(pinnedConfig, func(object client.Object) bool {
+				return object.(*infrav1.K8sInstallerConfig).Spec.RuncVersion == "v1.1.14"
+			})
+
+			_, err := k8sInstallerConfigReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      k8sinstallerConfig.Name,
+					Namespace: k8sinstallerConfig.Namespace}})
+			Expect(err).NotTo(HaveOccurred())
+
+			createdSecret := &corev1.Secret{}
+			Expect(k8sClientUncached.Get(ctx, installerSecretLookupKey, createdSecret)).To(Succeed())
+			Expect(string(createdSecret.Data["install"])).To(ContainSubstring(`CONTAINERD_VERSION="v1.7.22"`))
+			Expect(string(createdSecret.Data["install"])).To(ContainSubstring(`RUNC_VERSION="v1.1.14"`))
+		})
+
+		It("should record the resolved bundle on the status of the attached ByoHost", func() {
+			byoHost := builder.ByoHost(defaultNamespace, "resolved-bundle-host").
+				WithLabels(map[string]string{infrav1.AttachedByoMachineLabel: byoMachine.Namespace + "." + byoMachine.Name}).
+				Build()
+			Expect(k8sClientUncached.Create(ctx, byoHost)).Should(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClientUncached.Delete(ctx, byoHost)).Should(Succeed())
+			})
+
+			versioned := k8sinstallerConfig.DeepCopy()
+			annotations.AddAnnotations(versioned, map[string]string{infrav1.K8sVersionAnnotation: "v1.25.3"})
+			Expect(k8sClientUncached.Patch(ctx, versioned, client.MergeFrom(k8sinstallerConfig))).Should(Succeed())
+			WaitForObjectToBeUpdatedInCache(versioned, func(object client.Object) bool {
+				return object.GetAnnotations()[infrav1.K8sVersionAnnotation] == "v1.25.3"
+			})
+			WaitForObjectsToBePopulatedInCache(byoHost)
+
+			_, err := k8sInstallerConfigReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      k8sinstallerConfig.Name,
+					Namespace: k8sinstallerConfig.Namespace}})
+			Expect(err).NotTo(HaveOccurred())
+
+			updatedByoHost := &infrav1.ByoHost{}
+			Expect(k8sClientUncached.Get(ctx, types.NamespacedName{Name: byoHost.Name, Namespace: byoHost.Namespace}, updatedByoHost)).To(Succeed())
+			Expect(updatedByoHost.Status.ResolvedOSBundle).To(Equal("Ubuntu_20.04.1_x86-64"))
+			Expect(updatedByoHost.Status.ResolvedK8sFilter).To(Equal("v1.25.*"))
+		})
+
+		It("should render the imgpkg mirror configured on the ByoCluster", func() {
+			mirroredCluster := &infrav1.ByoCluster{}
+			Expect(k8sClientUncached.Get(ctx, types.NamespacedName{Name: byoCluster.Name, Namespace: byoCluster.Namespace}, mirroredCluster)).To(Succeed())
+			unmirrored := mirroredCluster.DeepCopy()
+			mirroredCluster.Spec.ImgpkgVersion = "v0.39.0"
+			mirroredCluster.Spec.ImgpkgBaseURL = "https://mirror.example.com/carvel/imgpkg"
+			Expect(k8sClientUncached.Patch(ctx, mirroredCluster, client.MergeFrom(unmirrored))).Should(Succeed())
+			DeferCleanup(func() {
+				mirrored := mirroredCluster.DeepCopy()
+				mirroredCluster.Spec.ImgpkgVersion = ""
+				mirroredCluster.Spec.ImgpkgBaseURL = ""
+				Expect(k8sClientUncached.Patch(ctx, mirroredCluster, client.MergeFrom(mirrored))).Should(Succeed())
+			})
+			WaitForObjectToBeUpdatedInCache(mirroredCluster, func(object client.Object) bool {
+				return object.(*infrav1.ByoCluster).Spec.ImgpkgBaseURL == "https://mirror.example.com/carvel/imgpkg"
+			})
+
+			_, err := k8sInstallerConfigReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      k8sinstallerConfig.Name,
+					Namespace: k8sinstallerConfig.Namespace}})
+			Expect(err).NotTo(HaveOccurred())
+
+			createdSecret := &corev1.Secret{}
+			Expect(k8sClientUncached.Get(ctx, installerSecretLookupKey, createdSecret)).To(Succeed())
+			Expect(string(createdSecret.Data["install"])).To(ContainSubstring("IMGPKG_VERSION=v0.39.0"))
+			Expect(string(createdSecret.Data["install"])).To(ContainSubstring("IMGPKG_BASE_URL=https://mirror.example.com/carvel/imgpkg"))
+		})
+
+		It("should render the kernel modules required by the K8sInstallerConfig", func() {
+			ph, err := patch.NewHelper(k8sinstallerConfig, k8sClientUncached)
+			Expect(err).ShouldNot(HaveOccurred())
+			k8sinstallerConfig.Spec.KernelModules = []string{"ip_vs", "ip_vs_rr"}
+			Expect(ph.Patch(ctx, k8sinstallerConfig)).Should(Succeed())
+			WaitForObjectToBeUpdatedInCache(k8sinstallerConfig, func(object client.Object) bool {
+				return len(object.(*infrav1.K8sInstallerConfig).Spec.KernelModules) == 2
+			})
+
+			_, err = k8sInstallerConfigReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      k8sinstallerConfig.Name,
+					Namespace: k8sinstallerConfig.Namespace}})
+			Expect(err).NotTo(HaveOccurred())
+
+			createdSecret := &corev1.Secret{}
+			Expect(k8sClientUncached.Get(ctx, installerSecretLookupKey, createdSecret)).To(Succeed())
+			Expect(string(createdSecret.Data["install"])).To(ContainSubstring(`REQUIRED_KERNEL_MODULES="ip_vs ip_vs_rr"`))
+		})
+
 		It("should be add secret reference to K8sInstallerConfig", func() {
 			_, err := k8sInstallerConfigReconciler.Reconcile(ctx, reconcile.Request{
 				NamespacedName: types.NamespacedName{
@@ -0,0 +1,126 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// weekdays maps the abbreviated names of the days of a maintenance window to their time.Weekday
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// maintenanceWindow is a daily time range in UTC, optionally restricted to some days of the week, during which
+// destructive operations on a host such as its force cleanup are allowed
+type maintenanceWindow struct {
+	// days the window opens on, by time.Weekday
+	days [7]bool
+	// start is the time of day the window opens at, since midnight UTC
+	start time.Duration
+	// length is how long the window stays open, a window closing before it opens ends the next day
+	length time.Duration
+}
+
+// parseMaintenanceWindow parses a maintenance window of the form "[DAYS ]HH:MM-HH:MM" in UTC, e.g. "22:00-06:00"
+// or "Sat,Sun 00:00-23:59". DAYS is a comma separated list of days or ranges of days, e.g. "Mon-Fri", the window
+// opens on. A window crossing midnight ends the day after it opened.
+func parseMaintenanceWindow(value string) (*maintenanceWindow, error) {
+	window := &maintenanceWindow{}
+	fields := strings.Fields(value)
+	switch len(fields) {
+	case 1:
+		for day := range window.days {
+			window.days[day] = true
+		}
+	case 2:
+		if err := window.parseDays(fields[0]); err != nil {
+			return nil, err
+		}
+		fields = fields[1:]
+	default:
+		return nil, fmt.Errorf("invalid maintenance window %q, expected [DAYS ]HH:MM-HH:MM", value)
+	}
+
+	startStr, endStr, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid time range %q, expected HH:MM-HH:MM", fields[0])
+	}
+	start, err := parseTimeOfDay(startStr)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTimeOfDay(endStr)
+	if err != nil {
+		return nil, err
+	}
+	window.start = start
+	window.length = end - start
+	if window.length <= 0 {
+		window.length += 24 * time.Hour
+	}
+	return window, nil
+}
+
+// parseDays sets the days of the window from a comma separated list of days or ranges of days
+func (w *maintenanceWindow) parseDays(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		firstStr, lastStr, isRange := strings.Cut(item, "-")
+		first, ok := weekdays[strings.ToLower(firstStr)]
+		if !ok {
+			return fmt.Errorf("invalid day %q, expected one of Mon, Tue, Wed, Thu, Fri, Sat, Sun", firstStr)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[strings.ToLower(lastStr)]; !ok {
+				return fmt.Errorf("invalid day %q, expected one of Mon, Tue, Wed, Thu, Fri, Sat, Sun", lastStr)
+			}
+		}
+		// A range may wrap around the end of the week, e.g. Fri-Mon
+		for day := first; ; day = (day + 1) % 7 {
+			w.days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseTimeOfDay parses a HH:MM time of day into the time since midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// untilOpen returns how long it takes for the window to open from the given time, zero when it is open
+func (w *maintenanceWindow) untilOpen(now time.Time) time.Duration {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	// The window opened the day before may still be open, the next one opens within a week
+	for day := -1; day <= 7; day++ {
+		opens := midnight.AddDate(0, 0, day).Add(w.start)
+		if !w.days[opens.Weekday()] {
+			continue
+		}
+		if now.Before(opens) {
+			return opens.Sub(now)
+		}
+		if now.Before(opens.Add(w.length)) {
+			return 0
+		}
+	}
+	return 0
+}
@@ -123,6 +123,9 @@ var _ = BeforeSuite(func() {
 		node,
 	).Build()
 
+	Expect(controllers.IndexByoHostByName(context.TODO(), k8sManager.GetFieldIndexer())).To(Succeed())
+	Expect(controllers.IndexByoHostByMachineUID(context.TODO(), k8sManager.GetFieldIndexer())).To(Succeed())
+
 	recorder = record.NewFakeRecorder(32)
 	reconciler = &controllers.ByoMachineReconciler{
 		Client:   k8sManager.GetClient(),
@@ -140,6 +143,7 @@ var _ = BeforeSuite(func() {
 
 	byoAdmissionReconciler = &controllers.ByoAdmissionReconciler{
 		ClientSet: clientSetFake,
+		Client:    k8sManager.GetClient(),
 	}
 	err = byoAdmissionReconciler.SetupWithManager(k8sManager)
 	Expect(err).NotTo(HaveOccurred())
@@ -51,48 +51,127 @@ var archOldNameMap = map[string]string{
 	"arm64": "aarch64",
 }
 
-// NewInstaller will return a new installer
-func NewInstaller(ctx context.Context, osDist, arch, k8sVersion string, downloader *BundleDownloader) (K8sInstaller, error) {
-	bundleArchName := arch
-	// replacing the arch name to old name to match with the bundle name
-	if _, exists := archOldNameMap[arch]; exists {
-		bundleArchName = archOldNameMap[arch]
+// Options are the settings of the installers. The defaults are used for the empty versions and URLs.
+type Options struct {
+	// OSDist and Arch are the OS distribution and architecture of the host, e.g. Ubuntu 22.04.3 LTS and amd64
+	OSDist string
+	Arch   string
+	// K8sVersion is the Kubernetes version installed
+	K8sVersion string
+	// DownloadMode is online or offline, only used by the kubexm installer
+	DownloadMode string
+	// CNIPluginsVersion pins the CNI plugins downloaded in online mode
+	CNIPluginsVersion string
+	// ContainerdVersion and RuncVersion pin containerd and runc downloaded in online mode
+	ContainerdVersion string
+	RuncVersion       string
+	// ImgpkgVersion and ImgpkgBaseURL pin the imgpkg release fetched when the host lacks imgpkg
+	ImgpkgVersion string
+	ImgpkgBaseURL string
+	// KernelModules are loaded and verified by the install script in addition to the ones every installer requires
+	KernelModules []string
+	// FirewallMode is OpenPorts, which opens the ports of the Kubernetes components, or Disable, which disables
+	// the firewall. OpenPorts is used when empty.
+	FirewallMode string
+	// FirewallPorts are the ports opened in OpenPorts mode, e.g. 6443/tcp or 30000:32767/udp, the ports of the
+	// Kubernetes components and the CNI overlays when empty
+	FirewallPorts []string
+	// RuntimeHandlers are additional containerd runtime handlers, by name their runtime type,
+	// e.g. runsc: io.containerd.runsc.v1 for gVisor
+	RuntimeHandlers map[string]string
+	// ProxyConfig are the http-proxy, https-proxy and no-proxy settings of the downloads, only used by the
+	// kubexm installer
+	ProxyConfig map[string]string
+}
+
+// scriptOptions returns the options the scripts of the installers are rendered with for the bundle address
+func (o Options) scriptOptions(bundleAddrs string) algo.Options {
+	return algo.Options{
+		Arch:              o.Arch,
+		BundleAddrs:       bundleAddrs,
+		K8sVersion:        o.K8sVersion,
+		DownloadMode:      o.DownloadMode,
+		CNIPluginsVersion: o.CNIPluginsVersion,
+		ContainerdVersion: o.ContainerdVersion,
+		RuncVersion:       o.RuncVersion,
+		ImgpkgVersion:     o.ImgpkgVersion,
+		ImgpkgBaseURL:     o.ImgpkgBaseURL,
+		KernelModules:     o.KernelModules,
+		FirewallMode:      o.FirewallMode,
+		FirewallPorts:     o.FirewallPorts,
+		RuntimeHandlers:   o.RuntimeHandlers,
+		ProxyConfig:       o.ProxyConfig,
 	}
-	// normalizing os image name and adding arch
-	osArch := strings.ReplaceAll(osDist, " ", "_") + "_" + bundleArchName
+}
+
+// NewInstaller will return a new installer for the OS distribution of the options
+func NewInstaller(ctx context.Context, opts Options, downloader *BundleDownloader) (K8sInstaller, error) {
+	osArch := normalizeOsArch(opts.OSDist, opts.Arch)
 
 	reg := GetSupportedRegistry()
 	if len(reg.ListK8s(osArch)) == 0 {
 		return nil, ErrOsK8sNotSupported
 	}
 	osbundle := reg.ResolveOsToOsBundle(osArch)
-	addrs := downloader.GetBundleAddr(osbundle, k8sVersion)
+	scriptOpts := opts.scriptOptions(downloader.GetBundleAddr(osbundle, opts.K8sVersion))
+	// the proxy settings are only supported by the kubexm installer
+	scriptOpts.ProxyConfig = nil
+
+	if strings.Contains(osbundle, "RHEL_9") {
+		return algo.NewRHEL9Installer(ctx, scriptOpts)
+	}
 
 	if strings.Contains(osbundle, "Ubuntu_24.04") {
-		return algo.NewUbuntu24_04Installer(ctx, arch, addrs, k8sVersion, nil)
+		return algo.NewUbuntu24_04Installer(ctx, scriptOpts)
 	}
 
 	if strings.Contains(osbundle, "Ubuntu_22.04") {
-		return algo.NewUbuntu22_04Installer(ctx, arch, addrs, k8sVersion, nil)
+		return algo.NewUbuntu22_04Installer(ctx, scriptOpts)
 	}
 
-	return algo.NewUbuntu20_04Installer(ctx, arch, addrs, k8sVersion, nil)
+	return algo.NewUbuntu20_04Installer(ctx, scriptOpts)
 }
 
-// NewKubexmInstaller creates a new installer for kubexm (TLS Bootstrap) mode
-// This installer is used when JoinMode is "tlsBootstrap" and installs
-// Kubernetes binaries directly without using kubeadm
-func NewKubexmInstaller(ctx context.Context, osDist, arch, k8sVersion, downloadMode string, proxyConfig map[string]string, downloader *BundleDownloader) (K8sInstaller, error) {
-	// For offline mode, we need the bundle address
+// ResolveBundle returns the BYOH bundle installers for the OS distribution and architecture are created for,
+// e.g. Ubuntu_22.04.1_x86-64, and the k8s version filter of the bundle matching the k8s version, e.g. v1.29.*,
+// which is empty when none matches. ErrOsK8sNotSupported is returned when no bundle supports the OS.
+func ResolveBundle(osDist, arch, k8sVersion string) (osBundle, k8sFilter string, err error) {
+	osArch := normalizeOsArch(osDist, arch)
+
+	reg := GetSupportedRegistry()
+	if len(reg.ListK8s(osArch)) == 0 {
+		return "", "", ErrOsK8sNotSupported
+	}
+	osBundle = reg.ResolveOsToOsBundle(osArch)
+	return osBundle, reg.ResolveK8sFilter(osBundle, k8sVersion), nil
+}
+
+// normalizeOsArch returns the OS distribution and architecture in the form of the OS filters of the registry,
+// e.g. Ubuntu_22.04.3_LTS_x86-64 for Ubuntu 22.04.3 LTS on amd64
+func normalizeOsArch(osDist, arch string) string {
 	bundleArchName := arch
+	// replacing the arch name to old name to match with the bundle name
 	if _, exists := archOldNameMap[arch]; exists {
 		bundleArchName = archOldNameMap[arch]
 	}
 	// normalizing os image name and adding arch
+	return strings.ReplaceAll(osDist, " ", "_") + "_" + bundleArchName
+}
+
+// NewKubexmInstaller creates a new installer for kubexm (TLS Bootstrap) mode
+// This installer is used when JoinMode is "tlsBootstrap" and installs
+// Kubernetes binaries directly without using kubeadm.
+func NewKubexmInstaller(ctx context.Context, opts Options, downloader *BundleDownloader) (K8sInstaller, error) {
+	// For offline mode, we need the bundle address
+	bundleArchName := opts.Arch
+	if _, exists := archOldNameMap[opts.Arch]; exists {
+		bundleArchName = archOldNameMap[opts.Arch]
+	}
+	// normalizing os image name and adding arch
 	// Note: Kubexm might be OS-agnostic, but we use the same bundle lookup logic for consistency
 	// if we want to reuse the same bundles as Kubeadm mode.
 	// For now, let's assume we reuse Ubuntu 20.04 bundle logic as a base for binary lookup if needed.
-	osArch := strings.ReplaceAll(osDist, " ", "_") + "_" + bundleArchName
+	osArch := strings.ReplaceAll(opts.OSDist, " ", "_") + "_" + bundleArchName
 
 	reg := GetSupportedRegistry()
 	var addrs string
@@ -102,21 +181,21 @@ func NewKubexmInstaller(ctx context.Context, osDist, arch, k8sVersion, downloadM
 	// Let's try to resolve it, if fail, maybe fallback or empty (for online mode).
 	if len(reg.ListK8s(osArch)) > 0 {
 		osbundle := reg.ResolveOsToOsBundle(osArch)
-		addrs = downloader.GetBundleAddr(osbundle, k8sVersion)
+		addrs = downloader.GetBundleAddr(osbundle, opts.K8sVersion)
 	} else {
 		// Fallback for unknown OS or generic usage?
 		// If downloadMode is offline, we MUST have a bundle.
-		if downloadMode == "offline" {
+		if opts.DownloadMode == "offline" {
 			// Try a default known bundle (e.g. Ubuntu 20.04) just to get the binaries?
 			// Or return error.
 			// Let's assume Ubuntu 20.04 as a safe default for Linux binaries.
 			defaultOS := "Ubuntu_20.04" + "_" + bundleArchName
 			if len(reg.ListK8s(defaultOS)) > 0 {
 				osbundle := reg.ResolveOsToOsBundle(defaultOS)
-				addrs = downloader.GetBundleAddr(osbundle, k8sVersion)
+				addrs = downloader.GetBundleAddr(osbundle, opts.K8sVersion)
 			}
 		}
 	}
 
-	return algo.NewKubexmInstaller(ctx, arch, addrs, k8sVersion, downloadMode, proxyConfig)
+	return algo.NewKubexmInstaller(ctx, opts.scriptOptions(addrs))
 }
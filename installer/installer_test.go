@@ -5,9 +5,14 @@ package installer_test
 
 import (
 	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/mensylisir/cluster-api-provider-bringyourownhost/installer"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/installer/internal/algo"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -28,7 +33,7 @@ var _ = Describe("Byohost Installer Tests", func() {
 
 	Context("When installer object is created for valid OS and arch", func() {
 		It("should create the object successfully", func() {
-			_, err := installer.NewInstaller(context.TODO(), os, arch, k8sversion, downloader)
+			_, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion}, downloader)
 			Expect(err).ShouldNot(HaveOccurred())
 		})
 	})
@@ -37,7 +42,7 @@ var _ = Describe("Byohost Installer Tests", func() {
 		It("should create the object successfully", func() {
 			os = "Ubuntu 24.04"
 			k8sversion = "v1.27.1"
-			_, err := installer.NewInstaller(context.TODO(), os, arch, k8sversion, downloader)
+			_, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion}, downloader)
 			Expect(err).ShouldNot(HaveOccurred())
 		})
 	})
@@ -46,15 +51,48 @@ var _ = Describe("Byohost Installer Tests", func() {
 		It("should create the object successfully", func() {
 			os = "Ubuntu 22.04"
 			k8sversion = "v1.26.1"
-			_, err := installer.NewInstaller(context.TODO(), os, arch, k8sversion, downloader)
+			_, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion}, downloader)
 			Expect(err).ShouldNot(HaveOccurred())
 		})
 	})
 
+	Context("When installer object is created for RHEL 9, Rocky Linux 9 and CentOS Stream 9", func() {
+		It("should create the object successfully", func() {
+			for _, osDist := range []string{"Red Hat Enterprise Linux 9.3 (Plow)", "Rocky Linux 9.4 (Blue Onyx)", "CentOS Stream 9"} {
+				_, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: osDist, Arch: arch, K8sVersion: "v1.29.3"}, downloader)
+				Expect(err).ShouldNot(HaveOccurred())
+			}
+		})
+
+		It("should render scripts using dnf, firewalld and a permissive SELinux", func() {
+			k8sInstaller, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: "Rocky Linux 9.4 (Blue Onyx)", Arch: arch, K8sVersion: "v1.29.3"}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			install := k8sInstaller.Install()
+			Expect(install).To(ContainSubstring(`dnf install -y "$@"`))
+			Expect(install).To(ContainSubstring("pkg_install iptables"))
+			Expect(install).To(ContainSubstring(`firewall-cmd --permanent --add-port="${port/:/-}"`))
+			Expect(install).To(ContainSubstring(`configure_firewall "$FIREWALL_MODE" $FIREWALL_PORTS`))
+			Expect(install).To(ContainSubstring("setenforce 0"))
+			Expect(install).To(ContainSubstring("s/^SELINUX=enforcing$/SELINUX=permissive/"))
+			Expect(install).To(ContainSubstring("K8S_VERSION=v1.29.3"))
+			Expect(install).To(ContainSubstring("BUNDLE_ADDR=repoAddr/byoh-bundle-rhel_9_x86-64_k8s:v1.29.3"))
+
+			uninstall := k8sInstaller.Uninstall()
+			Expect(uninstall).To(ContainSubstring(`firewall-cmd --permanent --remove-port="${value/:/-}"`))
+			Expect(uninstall).To(ContainSubstring("setenforce 1"))
+
+			for _, script := range []string{install, uninstall, k8sInstaller.Upgrade()} {
+				Expect(script).NotTo(ContainSubstring("apt-get"))
+				Expect(script).NotTo(ContainSubstring("ufw"))
+			}
+		})
+	})
+
 	Context("When installer object is created for invalid arch", func() {
 		It("should fail create the object", func() {
 			arch = "arm64"
-			_, err := installer.NewInstaller(context.TODO(), os, arch, k8sversion, downloader)
+			_, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion}, downloader)
 			Expect(err).To(MatchError(installer.ErrOsK8sNotSupported))
 		})
 	})
@@ -62,8 +100,559 @@ var _ = Describe("Byohost Installer Tests", func() {
 	Context("When installer object is created for invalid OS", func() {
 		It("should fail create the object", func() {
 			os = "rhel"
-			_, err := installer.NewInstaller(context.TODO(), os, arch, k8sversion, downloader)
+			_, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion}, downloader)
+			Expect(err).To(MatchError(installer.ErrOsK8sNotSupported))
+		})
+	})
+
+	Context("When the install script downloads the Kubernetes binaries", func() {
+		It("should retry each download of the online kubeadm install on its own", func() {
+			k8sInstaller, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			script := k8sInstaller.Install()
+			Expect(script).To(ContainSubstring("retry() {"))
+			Expect(script).To(ContainSubstring(`download_file "${K8S_DOWNLOAD_URL}/kubeadm" /usr/local/bin/kubeadm`))
+			Expect(script).To(ContainSubstring(`download_file "${K8S_DOWNLOAD_URL}/kubelet" /usr/local/bin/kubelet`))
+			Expect(script).To(ContainSubstring("retry imgpkg pull"))
+			Expect(script).NotTo(ContainSubstring(`curl -fsSL "${K8S_DOWNLOAD_URL}`))
+		})
+
+		It("should retry each download of the kubexm install and upgrade on its own", func() {
+			k8sInstaller, err := installer.NewKubexmInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, DownloadMode: "online"}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			for _, script := range []string{k8sInstaller.Install(), k8sInstaller.Upgrade()} {
+				Expect(script).To(ContainSubstring("download_file() {"))
+				Expect(script).To(ContainSubstring(`download_file "${K8S_DOWNLOAD_URL}/kubelet" /usr/local/bin/kubelet`))
+				Expect(script).To(ContainSubstring(`download_file "${K8S_DOWNLOAD_URL}/kube-proxy" /usr/local/bin/kube-proxy`))
+				Expect(script).NotTo(ContainSubstring(`curl -fsSL "${K8S_DOWNLOAD_URL}`))
+			}
+		})
+	})
+
+	Context("When the CNI plugins version is pinned", func() {
+		It("should download the configured CNI plugins version in online mode", func() {
+			k8sInstaller, err := installer.NewKubexmInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, DownloadMode: "online", CNIPluginsVersion: "v1.5.1"}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			script := k8sInstaller.Install()
+			Expect(script).To(ContainSubstring("CNI_PLUGINS_VERSION=v1.5.1"))
+			Expect(script).To(ContainSubstring(`releases/download/${CNI_PLUGINS_VERSION}/cni-plugins-linux-${ARCH}-${CNI_PLUGINS_VERSION}.tgz`))
+			Expect(script).NotTo(ContainSubstring("v1.4.0"))
+		})
+
+		It("should download the configured CNI plugins version with the kubeadm installer", func() {
+			for _, osDist := range []string{"Ubuntu 20.04", "Ubuntu 22.04", "Ubuntu 24.04"} {
+				k8sInstaller, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: osDist, Arch: arch, K8sVersion: "v1.27.1", CNIPluginsVersion: "v1.5.1"}, downloader)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(k8sInstaller.Install()).To(ContainSubstring("CNI_PLUGINS_VERSION=v1.5.1"))
+			}
+		})
+
+		It("should default to the built-in CNI plugins version", func() {
+			k8sInstaller, err := installer.NewKubexmInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, DownloadMode: "online"}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(k8sInstaller.Install()).To(ContainSubstring("CNI_PLUGINS_VERSION=v1.4.0"))
+		})
+	})
+
+	Context("When the bundle of a host is resolved", func() {
+		It("should resolve the bundle and k8s filter of the OS and k8s version", func() {
+			osBundle, k8sFilter, err := installer.ResolveBundle("Ubuntu 22.04.3 LTS", "amd64", "v1.29.3")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(osBundle).To(Equal("Ubuntu_22.04.1_x86-64"))
+			Expect(k8sFilter).To(Equal("v1.29.*"))
+
+			osBundle, k8sFilter, err = installer.ResolveBundle("Rocky Linux 9.4 (Blue Onyx)", "amd64", "v1.30.1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(osBundle).To(Equal("RHEL_9_x86-64"))
+			Expect(k8sFilter).To(Equal("v1.30.*"))
+		})
+
+		It("should resolve the bundle without a k8s filter for an unsupported k8s version", func() {
+			osBundle, k8sFilter, err := installer.ResolveBundle("Ubuntu 20.04.6 LTS", "amd64", "v1.22.1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(osBundle).To(Equal("Ubuntu_20.04.1_x86-64"))
+			Expect(k8sFilter).To(BeEmpty())
+		})
+
+		It("should return an error for an unsupported OS", func() {
+			_, _, err := installer.ResolveBundle("Windows Server 2022", "amd64", "v1.29.3")
 			Expect(err).To(MatchError(installer.ErrOsK8sNotSupported))
 		})
 	})
+
+	Context("When the containerd and runc versions are pinned", func() {
+		It("should download the configured versions in online mode", func() {
+			k8sInstaller, err := installer.NewKubexmInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, DownloadMode: "online", CNIPluginsVersion: "v1.5.1", ContainerdVersion: "v1.7.22", RuncVersion: "v1.1.14"}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			script := k8sInstaller.Install()
+			Expect(script).To(ContainSubstring(`CONTAINERD_VERSION="v1.7.22"`))
+			Expect(script).To(ContainSubstring(`RUNC_VERSION="v1.1.14"`))
+			Expect(script).To(ContainSubstring("CNI_PLUGINS_VERSION=v1.5.1"))
+			Expect(script).NotTo(ContainSubstring("v1.7.0"))
+			Expect(script).NotTo(ContainSubstring("v1.1.10"))
+		})
+
+		It("should download the configured versions with the kubeadm installer", func() {
+			for _, osDist := range []string{"Ubuntu 20.04", "Ubuntu 22.04", "Ubuntu 24.04", "Rocky Linux 9.4 (Blue Onyx)"} {
+				k8sInstaller, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: osDist, Arch: arch, K8sVersion: "v1.29.3", ContainerdVersion: "v1.7.22", RuncVersion: "v1.1.14"}, downloader)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(k8sInstaller.Install()).To(ContainSubstring(`CONTAINERD_VERSION="v1.7.22"`), osDist)
+				Expect(k8sInstaller.Install()).To(ContainSubstring(`RUNC_VERSION="v1.1.14"`), osDist)
+			}
+		})
+
+		It("should default to the built-in versions", func() {
+			k8sInstaller, err := installer.NewKubexmInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, DownloadMode: "online"}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(k8sInstaller.Install()).To(ContainSubstring(`CONTAINERD_VERSION="v1.7.0"`))
+			Expect(k8sInstaller.Install()).To(ContainSubstring(`RUNC_VERSION="v1.1.10"`))
+		})
+	})
+
+	Context("When imgpkg is downloaded from a mirror", func() {
+		It("should render the configured imgpkg version and base URL", func() {
+			k8sInstaller, err := installer.NewKubexmInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, DownloadMode: "offline", ImgpkgVersion: "v0.39.0", ImgpkgBaseURL: "https://mirror.example.com/carvel/imgpkg"}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			script := k8sInstaller.Install()
+			Expect(script).To(ContainSubstring("IMGPKG_VERSION=v0.39.0"))
+			Expect(script).To(ContainSubstring("IMGPKG_BASE_URL=https://mirror.example.com/carvel/imgpkg"))
+			Expect(script).To(ContainSubstring("$dl_bin $IMGPKG_BASE_URL/$IMGPKG_VERSION/imgpkg-linux-$ARCH"))
+			Expect(script).NotTo(ContainSubstring("github.com/vmware-tanzu/carvel-imgpkg"))
+		})
+
+		It("should render the configured imgpkg source with the kubeadm installer", func() {
+			for _, osDist := range []string{"Ubuntu 20.04", "Ubuntu 22.04", "Ubuntu 24.04"} {
+				k8sInstaller, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: osDist, Arch: arch, K8sVersion: "v1.27.1", ImgpkgVersion: "v0.39.0", ImgpkgBaseURL: "https://mirror.example.com/carvel/imgpkg"}, downloader)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				script := k8sInstaller.Install()
+				Expect(script).To(ContainSubstring("IMGPKG_VERSION=v0.39.0"))
+				Expect(script).To(ContainSubstring("IMGPKG_BASE_URL=https://mirror.example.com/carvel/imgpkg"))
+			}
+		})
+
+		It("should default to the upstream imgpkg release", func() {
+			k8sInstaller, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			script := k8sInstaller.Install()
+			Expect(script).To(ContainSubstring("IMGPKG_VERSION=v0.36.4"))
+			Expect(script).To(ContainSubstring("IMGPKG_BASE_URL=github.com/vmware-tanzu/carvel-imgpkg/releases/download"))
+		})
+	})
+
+	Context("When additional kernel modules are required", func() {
+		It("should load and verify the configured kernel modules", func() {
+			k8sInstaller, err := installer.NewKubexmInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, DownloadMode: "online", KernelModules: []string{"ip_vs", "nvidia-uvm"}}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			script := k8sInstaller.Install()
+			Expect(script).To(ContainSubstring("load_kernel_modules() {"))
+			Expect(script).To(ContainSubstring(`[ ! -d "/sys/module/${module//-/_}" ]`))
+			Expect(script).To(ContainSubstring(`REQUIRED_KERNEL_MODULES="ip_vs nvidia-uvm"`))
+			Expect(script).To(ContainSubstring("load_kernel_modules overlay br_netfilter $REQUIRED_KERNEL_MODULES"))
+			Expect(script).To(ContainSubstring("/etc/modules-load.d/byoh-required-modules.conf"))
+			Expect(k8sInstaller.Uninstall()).To(ContainSubstring("rm -f /etc/modules-load.d/byoh-required-modules.conf"))
+		})
+
+		It("should load the configured kernel modules with the kubeadm installer", func() {
+			for _, osDist := range []string{"Ubuntu 20.04", "Ubuntu 22.04", "Ubuntu 24.04"} {
+				k8sInstaller, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: osDist, Arch: arch, K8sVersion: "v1.27.1", KernelModules: []string{"ip_vs"}}, downloader)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				script := k8sInstaller.Install()
+				Expect(script).To(ContainSubstring(`REQUIRED_KERNEL_MODULES="ip_vs"`))
+				Expect(script).To(ContainSubstring("load_kernel_modules overlay br_netfilter $REQUIRED_KERNEL_MODULES"))
+			}
+		})
+
+		It("should only load the default kernel modules when none are configured", func() {
+			k8sInstaller, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(k8sInstaller.Install()).To(ContainSubstring(`REQUIRED_KERNEL_MODULES=""`))
+		})
+
+		It("should reject an invalid kernel module name", func() {
+			_, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, KernelModules: []string{"ip_vs; reboot"}}, downloader)
+			Expect(err).To(MatchError(ContainSubstring(`invalid kernel module name "ip_vs; reboot"`)))
+		})
+	})
+
+	Context("When the install script configures the firewall", func() {
+		It("should open the ports of the Kubernetes components by default", func() {
+			for _, osDist := range []string{"Ubuntu 20.04", "Ubuntu 22.04", "Ubuntu 24.04"} {
+				k8sInstaller, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: osDist, Arch: arch, K8sVersion: "v1.27.1"}, downloader)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				script := k8sInstaller.Install()
+				Expect(script).To(ContainSubstring("FIREWALL_MODE=OpenPorts"))
+				Expect(script).To(ContainSubstring(`FIREWALL_PORTS="6443/tcp 2379:2380/tcp 10250/tcp 10256/tcp 10257/tcp 10259/tcp 30000:32767/tcp 30000:32767/udp 8472/udp 6081/udp 179/tcp"`))
+				Expect(script).To(ContainSubstring(`configure_firewall "$FIREWALL_MODE" $FIREWALL_PORTS`))
+				Expect(script).NotTo(ContainSubstring("## disable firewall"))
+				Expect(k8sInstaller.Uninstall()).To(ContainSubstring("restore_firewall\n"))
+				Expect(k8sInstaller.Uninstall()).NotTo(ContainSubstring("## enable firewall"))
+			}
+		})
+
+		It("should disable the firewall when configured", func() {
+			k8sInstaller, err := installer.NewKubexmInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, DownloadMode: "online", FirewallMode: "Disable"}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(k8sInstaller.Install()).To(ContainSubstring("FIREWALL_MODE=Disable"))
+			Expect(k8sInstaller.Uninstall()).To(ContainSubstring("restore_firewall\n"))
+		})
+
+		It("should open the configured ports instead of the default ones", func() {
+			k8sInstaller, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, FirewallPorts: []string{"6443/tcp", "4789/udp"}}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(k8sInstaller.Install()).To(ContainSubstring(`FIREWALL_PORTS="6443/tcp 4789/udp"`))
+		})
+
+		It("should reject an invalid firewall port", func() {
+			_, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, FirewallPorts: []string{"6443/tcp; reboot"}}, downloader)
+			Expect(err).To(MatchError(ContainSubstring(`invalid firewall port "6443/tcp; reboot"`)))
+		})
+
+		It("should reject an invalid firewall mode", func() {
+			_, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, FirewallMode: "Open"}, downloader)
+			Expect(err).To(MatchError(ContainSubstring(`invalid firewall mode "Open"`)))
+		})
+	})
+
+	Context("When containerd runtime handlers are configured", func() {
+		runtimeHandlers := map[string]string{"runsc": "io.containerd.runsc.v1", "kata": "io.containerd.kata.v2"}
+
+		It("should add the runtime handlers to the containerd config", func() {
+			for _, osDist := range []string{"Ubuntu 20.04", "Ubuntu 22.04", "Ubuntu 24.04"} {
+				k8sInstaller, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: osDist, Arch: arch, K8sVersion: "v1.27.1", RuntimeHandlers: runtimeHandlers}, downloader)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				script := k8sInstaller.Install()
+				Expect(script).To(ContainSubstring(`RUNTIME_HANDLERS="kata=io.containerd.kata.v2 runsc=io.containerd.runsc.v1"`))
+				Expect(script).To(ContainSubstring("configure_runtime_handlers /etc/containerd/config.toml $RUNTIME_HANDLERS"))
+			}
+
+			k8sInstaller, err := installer.NewKubexmInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, DownloadMode: "online", RuntimeHandlers: runtimeHandlers}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(k8sInstaller.Install()).To(ContainSubstring(`RUNTIME_HANDLERS="kata=io.containerd.kata.v2 runsc=io.containerd.runsc.v1"`))
+		})
+
+		It("should not add any runtime handler by default", func() {
+			k8sInstaller, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(k8sInstaller.Install()).To(ContainSubstring(`RUNTIME_HANDLERS=""`))
+		})
+
+		It("should reject an invalid runtime handler", func() {
+			_, err := installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, RuntimeHandlers: map[string]string{"gVisor": "io.containerd.runsc.v1"}}, downloader)
+			Expect(err).To(MatchError(ContainSubstring(`invalid runtime handler name "gVisor"`)))
+
+			_, err = installer.NewInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, RuntimeHandlers: map[string]string{"runsc": "runsc; reboot"}}, downloader)
+			Expect(err).To(MatchError(ContainSubstring(`invalid runtime type "runsc; reboot"`)))
+		})
+	})
+
+	Context("When the offline install script fetches the bundle", func() {
+		It("should copy the bundle from the bundle cache before pulling it", func() {
+			k8sInstaller, err := installer.NewKubexmInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, DownloadMode: "offline"}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			for _, script := range []string{k8sInstaller.Install(), k8sInstaller.Upgrade()} {
+				Expect(script).To(ContainSubstring("pull_bundle() {"))
+				Expect(script).To(ContainSubstring(`BUNDLE_CACHE_PATH="{{.BundleCachePath}}"`))
+				Expect(script).To(ContainSubstring("pull_bundle $BUNDLE_ADDR $BUNDLE_PATH"))
+				Expect(script).NotTo(ContainSubstring("retry imgpkg pull -i $BUNDLE_ADDR"))
+			}
+		})
+	})
+
+	Context("When the install script configures containerd", func() {
+		It("should merge the required settings instead of overwriting the config", func() {
+			k8sInstaller, err := installer.NewKubexmInstaller(context.TODO(), installer.Options{OSDist: os, Arch: arch, K8sVersion: k8sversion, DownloadMode: "online"}, downloader)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			script := k8sInstaller.Install()
+			Expect(script).To(ContainSubstring("configure_containerd() {"))
+			Expect(script).To(ContainSubstring("configure_containerd /etc/containerd/config.toml"))
+			Expect(script).NotTo(ContainSubstring("containerd config default > /etc/containerd/config.toml"))
+		})
+	})
+})
+
+var _ = Describe("Firewalld", func() {
+	var state string
+
+	// runFirewallFunc runs the firewall function with a running firewall-cmd stub recording its calls, which
+	// reports the given rules as already present
+	runFirewallFunc := func(present, function string, args ...string) string {
+		binDir := GinkgoT().TempDir()
+		calls := filepath.Join(binDir, "calls")
+		stub := "#!/bin/sh\ncase \"$*\" in *--query-*) echo \"$*\" | grep -qe \"" + present + "\" || exit 1;; esac\necho \"$@\" >> " + calls + "\n"
+		Expect(os.WriteFile(filepath.Join(binDir, "firewall-cmd"), []byte(stub), 0o755)).To(Succeed())
+
+		cmd := exec.Command("bash", append([]string{"-euo", "pipefail", "-c", algo.StepFirewalldFuncs + function + ` "$0" "$@"`, "OpenPorts"}, args...)...)
+		cmd.Env = append(os.Environ(), "PATH="+binDir+":"+os.Getenv("PATH"), "FIREWALL_STATE_FILE="+state)
+		out, err := cmd.CombinedOutput()
+		GinkgoWriter.Println(string(out))
+		Expect(err).NotTo(HaveOccurred())
+
+		recorded, err := os.ReadFile(calls)
+		Expect(err).NotTo(HaveOccurred())
+		return string(recorded)
+	}
+
+	BeforeEach(func() {
+		state = filepath.Join(GinkgoT().TempDir(), "firewall-rules")
+	})
+
+	It("should open the ports with firewalld port ranges and allow forwarding", func() {
+		Expect(runFirewallFunc("^$", "configure_firewall", "6443/tcp", "30000:32767/udp")).To(Equal(
+			"--state\n--permanent --add-port=6443/tcp\n--permanent --add-port=30000-32767/udp\n--permanent --add-forward\n--reload\n"))
+		Expect(os.ReadFile(state)).To(BeEquivalentTo("port 6443/tcp\nport 30000:32767/udp\nforward\n"))
+	})
+
+	It("should only close the recorded rules on restore", func() {
+		runFirewallFunc("query-port=6443/tcp\\|query-forward", "configure_firewall", "6443/tcp", "2379:2380/tcp")
+		Expect(os.ReadFile(state)).To(BeEquivalentTo("port 2379:2380/tcp\n"))
+
+		Expect(runFirewallFunc("^$", "restore_firewall")).To(Equal(
+			"--state\n--permanent --remove-port=2379-2380/tcp\n--reload\n"))
+		Expect(state).NotTo(BeAnExistingFile())
+	})
+})
+
+var _ = Describe("Bundle cache", func() {
+	const bundleAddr = "projects.registry.vmware.com/cluster_api_provider_bringyourownhost/byoh-bundle-ubuntu_20.04.1_x86-64_k8s:v1.22.9"
+	var (
+		cacheDir   string
+		bundlePath string
+		pulledFile string
+	)
+
+	// pullBundle runs pull_bundle with an imgpkg stub that records it has been called
+	pullBundle := func() error {
+		binDir := GinkgoT().TempDir()
+		stub := "#!/bin/sh\ntouch " + pulledFile + "\n"
+		Expect(os.WriteFile(filepath.Join(binDir, "imgpkg"), []byte(stub), 0o755)).To(Succeed())
+
+		cmd := exec.Command("bash", "-c", algo.StepRetryFuncs+algo.StepBundleCacheFuncs+`pull_bundle "$0" "$1"`, bundleAddr, bundlePath)
+		cmd.Env = append(os.Environ(), "PATH="+binDir+":"+os.Getenv("PATH"), "BUNDLE_CACHE_PATH="+cacheDir)
+		out, err := cmd.CombinedOutput()
+		GinkgoWriter.Println(string(out))
+		return err
+	}
+
+	BeforeEach(func() {
+		cacheDir = GinkgoT().TempDir()
+		downloadDir := GinkgoT().TempDir()
+		bundlePath = filepath.Join(downloadDir, bundleAddr)
+		pulledFile = filepath.Join(downloadDir, "pulled")
+	})
+
+	It("should short-circuit the pull when the bundle is cached", func() {
+		Expect(os.MkdirAll(filepath.Join(cacheDir, bundleAddr, "bin"), 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(cacheDir, bundleAddr, "bin", "kubelet"), []byte("kubelet"), 0o755)).To(Succeed())
+
+		Expect(pullBundle()).To(Succeed())
+		Expect(filepath.Join(bundlePath, "bin", "kubelet")).To(BeAnExistingFile())
+		Expect(pulledFile).NotTo(BeAnExistingFile())
+	})
+
+	It("should pull the bundle when it is not cached", func() {
+		Expect(pullBundle()).To(Succeed())
+		Expect(pulledFile).To(BeAnExistingFile())
+	})
+
+	It("should pull the bundle when the cached bundle is empty", func() {
+		Expect(os.MkdirAll(filepath.Join(cacheDir, bundleAddr), 0o755)).To(Succeed())
+
+		Expect(pullBundle()).To(Succeed())
+		Expect(pulledFile).To(BeAnExistingFile())
+	})
+})
+
+var _ = Describe("Containerd config", func() {
+	const defaultConfig = `version = 2
+[plugins]
+  [plugins."io.containerd.grpc.v1.cri"]
+    sandbox_image = "registry.k8s.io/pause:3.8"
+    [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+      SystemdCgroup = false
+`
+	var (
+		configDir  string
+		configFile string
+	)
+
+	// runContainerdFunc runs the containerd config function with a containerd stub printing the default config
+	runContainerdFunc := func(function string, args ...string) string {
+		binDir := GinkgoT().TempDir()
+		stub := "#!/bin/sh\ncat <<'EOF'\n" + defaultConfig + "EOF\n"
+		Expect(os.WriteFile(filepath.Join(binDir, "containerd"), []byte(stub), 0o755)).To(Succeed())
+
+		cmd := exec.Command("bash", append([]string{"-euo", "pipefail", "-c", algo.StepContainerdConfigFuncs + function + ` "$0" "$@"`, configFile}, args...)...)
+		cmd.Env = append(os.Environ(), "PATH="+binDir+":"+os.Getenv("PATH"))
+		out, err := cmd.CombinedOutput()
+		GinkgoWriter.Println(string(out))
+		Expect(err).NotTo(HaveOccurred())
+
+		config, err := os.ReadFile(configFile)
+		Expect(err).NotTo(HaveOccurred())
+		return string(config)
+	}
+
+	configureContainerd := func() string {
+		return runContainerdFunc("configure_containerd")
+	}
+
+	BeforeEach(func() {
+		configDir = GinkgoT().TempDir()
+		configFile = filepath.Join(configDir, "containerd", "config.toml")
+	})
+
+	It("should write the default config when there is none", func() {
+		config := configureContainerd()
+		Expect(config).To(ContainSubstring("SystemdCgroup = true"))
+		Expect(config).To(ContainSubstring(`sandbox_image = "registry.k8s.io/pause:3.8"`))
+		backups, err := filepath.Glob(configFile + ".bak.*")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backups).To(BeEmpty())
+	})
+
+	It("should keep the custom settings of an existing config and back it up", func() {
+		custom := `version = 2
+[plugins."io.containerd.grpc.v1.cri".registry.mirrors."docker.io"]
+  endpoint = ["https://mirror.example.com"]
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+  BinaryName = "/usr/local/bin/runc"
+  SystemdCgroup = false
+`
+		Expect(os.MkdirAll(filepath.Dir(configFile), 0o755)).To(Succeed())
+		Expect(os.WriteFile(configFile, []byte(custom), 0o600)).To(Succeed())
+
+		config := configureContainerd()
+		Expect(config).To(ContainSubstring(`endpoint = ["https://mirror.example.com"]`))
+		Expect(config).To(ContainSubstring(`BinaryName = "/usr/local/bin/runc"`))
+		Expect(config).To(ContainSubstring("SystemdCgroup = true"))
+		Expect(config).NotTo(ContainSubstring("SystemdCgroup = false"))
+		Expect(config).To(ContainSubstring(`sandbox_image = "registry.k8s.io/pause:3.8"`))
+
+		backups, err := filepath.Glob(configFile + ".bak.*")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backups).To(HaveLen(1))
+		backup, err := os.ReadFile(backups[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(backup)).To(Equal(custom))
+	})
+
+	It("should add the missing settings to the existing tables", func() {
+		custom := `version = 2
+[plugins."io.containerd.grpc.v1.cri"]
+  sandbox_image = "my.registry/pause:3.9"
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+  BinaryName = "/usr/local/bin/runc"
+`
+		Expect(os.MkdirAll(filepath.Dir(configFile), 0o755)).To(Succeed())
+		Expect(os.WriteFile(configFile, []byte(custom), 0o600)).To(Succeed())
+
+		config := configureContainerd()
+		Expect(config).To(ContainSubstring(`sandbox_image = "my.registry/pause:3.9"`))
+		Expect(config).NotTo(ContainSubstring("registry.k8s.io/pause"))
+		Expect(config).To(ContainSubstring("[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.runc.options]\n  SystemdCgroup = true\n"))
+		Expect(strings.Count(config, "[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.runc.options]")).To(Equal(1))
+	})
+
+	It("should add the runtimes of the runtime handlers", func() {
+		configureContainerd()
+		config := runContainerdFunc("configure_runtime_handlers", "kata=io.containerd.kata.v2", "runsc=io.containerd.runsc.v1")
+		Expect(config).To(ContainSubstring("SystemdCgroup = true"))
+		Expect(config).To(ContainSubstring("[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.kata]\n  runtime_type = \"io.containerd.kata.v2\"\n"))
+		Expect(config).To(ContainSubstring("[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.runsc]\n  runtime_type = \"io.containerd.runsc.v1\"\n"))
+	})
+
+	It("should keep a runtime already in the config", func() {
+		custom := `version = 2
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runsc]
+  runtime_type = "io.containerd.runsc.v1"
+  pod_annotations = ["dev.gvisor.*"]
+`
+		Expect(os.MkdirAll(filepath.Dir(configFile), 0o755)).To(Succeed())
+		Expect(os.WriteFile(configFile, []byte(custom), 0o600)).To(Succeed())
+
+		config := runContainerdFunc("configure_runtime_handlers", "runsc=io.containerd.runsc.v1")
+		Expect(config).To(Equal(custom))
+	})
+
+	It("should start the runtime handlers from the default config when there is none", func() {
+		config := runContainerdFunc("configure_runtime_handlers", "runsc=io.containerd.runsc.v1")
+		Expect(config).To(HavePrefix(defaultConfig))
+		Expect(config).To(ContainSubstring("containerd.runtimes.runsc]"))
+	})
+})
+
+var _ = Describe("Firewall", func() {
+	var calls, state string
+
+	// runFirewallFunc runs the firewall function with an active ufw stub recording its arguments, which
+	// reports the given rules as already added
+	runFirewallFunc := func(function, mode string, added ...string) {
+		binDir := GinkgoT().TempDir()
+		calls = filepath.Join(binDir, "calls")
+		stub := "#!/bin/sh\ncase \"$1\" in\n  status) echo 'Status: active'; exit 0;;\n  show) printf '%s\\n' '' '" +
+			strings.Join(added, "' '") + "'; exit 0;;\nesac\necho \"$@\" >> " + calls + "\n"
+		Expect(os.WriteFile(filepath.Join(binDir, "ufw"), []byte(stub), 0o755)).To(Succeed())
+
+		cmd := exec.Command("bash", "-euo", "pipefail", "-c", algo.StepFirewallFuncs+function+` "$0" 10250/tcp 30000:32767/tcp`, mode)
+		cmd.Env = append(os.Environ(), "PATH="+binDir+":"+os.Getenv("PATH"), "FIREWALL_STATE_FILE="+state)
+		out, err := cmd.CombinedOutput()
+		GinkgoWriter.Println(string(out))
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	ufwCalls := func() string {
+		content, err := os.ReadFile(calls)
+		if os.IsNotExist(err) {
+			return ""
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return string(content)
+	}
+
+	BeforeEach(func() {
+		state = filepath.Join(GinkgoT().TempDir(), "firewall-rules")
+	})
+
+	It("should only open the given ports and allow routed traffic", func() {
+		runFirewallFunc("configure_firewall", algo.FirewallModeOpenPorts)
+		Expect(ufwCalls()).To(Equal("allow 10250/tcp\nallow 30000:32767/tcp\ndefault allow routed\n"))
+		Expect(os.ReadFile(state)).To(BeEquivalentTo("port 10250/tcp\nport 30000:32767/tcp\nrouted deny\n"))
+	})
+
+	It("should only close the ports it opened on uninstall", func() {
+		runFirewallFunc("configure_firewall", algo.FirewallModeOpenPorts, "ufw allow 10250/tcp")
+		Expect(ufwCalls()).To(Equal("allow 30000:32767/tcp\ndefault allow routed\n"))
+
+		runFirewallFunc("restore_firewall", algo.FirewallModeOpenPorts)
+		Expect(ufwCalls()).To(Equal("delete allow 30000:32767/tcp\ndefault deny routed\n"))
+		Expect(state).NotTo(BeAnExistingFile())
+	})
+
+	It("should leave the firewall alone on uninstall without recorded rules", func() {
+		runFirewallFunc("restore_firewall", algo.FirewallModeOpenPorts)
+		Expect(ufwCalls()).To(BeEmpty())
+	})
+
+	It("should disable and enable the firewall when configured", func() {
+		runFirewallFunc("configure_firewall", algo.FirewallModeDisable)
+		Expect(ufwCalls()).To(Equal("disable\n"))
+
+		runFirewallFunc("restore_firewall", algo.FirewallModeDisable)
+		Expect(ufwCalls()).To(Equal("--force enable\n"))
+	})
 })
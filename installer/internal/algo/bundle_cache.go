@@ -0,0 +1,21 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package algo
+
+// StepBundleCacheFuncs are the shell functions the offline install and upgrade scripts use to fetch a bundle.
+// When the agent is started with a bundle cache, e.g. a read-only share populated once for many hosts,
+// the bundle is copied from $BUNDLE_CACHE_PATH/<bundle address> instead of being pulled again with imgpkg.
+// It relies on the retry function of StepRetryFuncs.
+const StepBundleCacheFuncs = `
+pull_bundle() {
+    local cached="${BUNDLE_CACHE_PATH:-}/$1"
+    if [ -n "${BUNDLE_CACHE_PATH:-}" ] && [ -d "$cached" ] && [ -n "$(ls -A "$cached")" ]; then
+        echo "Copying bundle $1 from cache $BUNDLE_CACHE_PATH"
+        mkdir -p "$2"
+        cp -a "$cached/." "$2/"
+        return 0
+    fi
+    retry imgpkg pull -i "$1" -o "$2"
+}
+`
@@ -0,0 +1,108 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package algo
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// runtimeHandlerNameRegexp matches the names of runtime handlers, as accepted by the handler of a RuntimeClass
+	runtimeHandlerNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	// runtimeTypeRegexp matches the containerd runtime types, e.g. io.containerd.runsc.v1
+	runtimeTypeRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// StepContainerdConfigFuncs are the shell functions the install scripts use to configure containerd.
+// configure_containerd <config> writes the default config when none exists. An existing config, e.g. on a
+// host that already ran containerd with registry mirrors, is backed up and kept, and only the settings
+// kubelet requires are merged in: the systemd cgroup driver and a sandbox image.
+// Missing tables are added with the names of the version 2 config of containerd 1.x.
+// configure_runtime_handlers adds the runtimes of additional runtime handlers, e.g. gVisor or Kata Containers.
+const StepContainerdConfigFuncs = `
+configure_containerd() {
+    local config="$1"
+    local cri_table='[plugins."io.containerd.grpc.v1.cri"]'
+    local runc_options_table='[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]'
+    mkdir -p "$(dirname "$config")"
+    if [ ! -s "$config" ]; then
+        containerd config default > "$config"
+    else
+        echo "Keeping the existing containerd config $config, merging the required settings"
+        cp -a "$config" "$config.bak.$(date +%Y%m%d%H%M%S)"
+    fi
+
+    if grep -Eq '^[[:space:]]*SystemdCgroup[[:space:]]*=' "$config"; then
+        sed -i -E 's/^([[:space:]]*SystemdCgroup[[:space:]]*=[[:space:]]*)false/\1true/' "$config"
+    elif grep -q "$(toml_table_regex "$runc_options_table")" "$config"; then
+        sed -i "/$(toml_table_regex "$runc_options_table")/a\\  SystemdCgroup = true" "$config"
+    else
+        printf '\n%s\n  SystemdCgroup = true\n' "$runc_options_table" >> "$config"
+    fi
+
+    if ! grep -Eq '^[[:space:]]*sandbox_image[[:space:]]*=' "$config"; then
+        local sandbox_image
+        sandbox_image=$(containerd config default | grep -E '^[[:space:]]*sandbox_image[[:space:]]*=' | head -n1 | sed -E 's/^[[:space:]]*//')
+        if [ -n "$sandbox_image" ]; then
+            if grep -q "$(toml_table_regex "$cri_table")" "$config"; then
+                sed -i "/$(toml_table_regex "$cri_table")/a\\  $sandbox_image" "$config"
+            else
+                printf '\n%s\n  %s\n' "$cri_table" "$sandbox_image" >> "$config"
+            fi
+        fi
+    fi
+}
+
+# configure_runtime_handlers <config> <name>=<runtime type>... adds a runtime of the CRI plugin for each handler,
+# e.g. runsc=io.containerd.runsc.v1 for gVisor. A runtime already in the config is kept.
+configure_runtime_handlers() {
+    local config="$1"
+    shift
+    if [ ! -s "$config" ]; then
+        mkdir -p "$(dirname "$config")"
+        containerd config default > "$config"
+    fi
+    local handler name runtime_type table
+    for handler in "$@"; do
+        name="${handler%%=*}"
+        runtime_type="${handler#*=}"
+        table="[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.${name}]"
+        if grep -q "$(toml_table_regex "$table")" "$config"; then
+            echo "Keeping the existing runtime handler $name of the containerd config"
+            continue
+        fi
+        printf '\n%s\n  runtime_type = "%s"\n' "$table" "$runtime_type" >> "$config"
+    done
+}
+
+# toml_table_regex matches a line holding only the given TOML table header, it is usable by grep and as a sed address
+toml_table_regex() {
+    printf '^[[:space:]]*%s[[:space:]]*$' "$(printf '%s' "$1" | sed -e 's/[][\.*^$/]/\\&/g')"
+}
+`
+
+// runtimeHandlersArg validates the additional containerd runtime handlers, by name their runtime type,
+// and joins them sorted by name as name=runtime type for the install script
+func runtimeHandlersArg(handlers map[string]string) (string, error) {
+	names := make([]string, 0, len(handlers))
+	for name, runtimeType := range handlers {
+		if !runtimeHandlerNameRegexp.MatchString(name) {
+			return "", fmt.Errorf("invalid runtime handler name %q", name)
+		}
+		if !runtimeTypeRegexp.MatchString(runtimeType) {
+			return "", fmt.Errorf("invalid runtime type %q of runtime handler %q", runtimeType, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := make([]string, 0, len(names))
+	for _, name := range names {
+		args = append(args, name+"="+handlers[name])
+	}
+	return strings.Join(args, " "), nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package algo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// FirewallModeOpenPorts opens the ports of the Kubernetes components in the firewall of the host
+	FirewallModeOpenPorts = "OpenPorts"
+	// FirewallModeDisable disables the firewall of the host
+	FirewallModeDisable = "Disable"
+)
+
+// FirewallPorts are the default ports, as accepted by ufw allow, of the Kubernetes components of a node:
+// the API server, etcd, kubelet, kube-proxy health, controller-manager, scheduler and the NodePort range, and
+// of the CNI overlays: flannel VXLAN, Geneve and Calico BGP
+var FirewallPorts = []string{
+	"6443/tcp",
+	"2379:2380/tcp",
+	"10250/tcp",
+	"10256/tcp",
+	"10257/tcp",
+	"10259/tcp",
+	"30000:32767/tcp",
+	"30000:32767/udp",
+	"8472/udp",
+	"6081/udp",
+	"179/tcp",
+}
+
+// firewallPortPattern matches a port or a port range with its protocol, e.g. 6443/tcp or 30000:32767/udp
+var firewallPortPattern = regexp.MustCompile(`^[0-9]+(:[0-9]+)?/(tcp|udp)$`)
+
+// FirewallStateFile is where the install script records the firewall rules it added, so the uninstall
+// script only removes those and leaves the rules of the host alone
+const FirewallStateFile = "/etc/byoh-firewall-rules"
+
+// StepFirewallFuncs are the shell functions the install and uninstall scripts use to configure the
+// firewall of the host. Hosts without ufw are left untouched.
+const StepFirewallFuncs = `
+ufw_routed_policy() {
+    case $(sed -n 's/^DEFAULT_FORWARD_POLICY="\(.*\)"/\1/p' /etc/default/ufw 2>/dev/null) in
+        ACCEPT) echo allow ;;
+        REJECT) echo reject ;;
+        *) echo deny ;;
+    esac
+}
+
+configure_firewall() {
+    local mode=$1
+    shift
+    local state=${FIREWALL_STATE_FILE:-` + FirewallStateFile + `}
+    if ! command -v ufw >>/dev/null; then
+        return 0
+    fi
+    touch "$state"
+    if [ "$mode" == "Disable" ]; then
+        if ufw status | grep -q "Status: active"; then
+            ufw disable
+            echo "disabled" >> "$state"
+        fi
+        return 0
+    fi
+    local port
+    for port in "$@"; do
+        if ! ufw show added | grep -qxF "ufw allow $port"; then
+            ufw allow "$port"
+            echo "port $port" >> "$state"
+        fi
+    done
+    local routed
+    routed=$(ufw_routed_policy)
+    if [ "$routed" != "allow" ]; then
+        ufw default allow routed
+        echo "routed $routed" >> "$state"
+    fi
+}
+
+restore_firewall() {
+    local state=${FIREWALL_STATE_FILE:-` + FirewallStateFile + `}
+    if ! command -v ufw >>/dev/null || [ ! -f "$state" ]; then
+        return 0
+    fi
+    local rule value
+    while read -r rule value; do
+        case "$rule" in
+            disabled) ufw --force enable ;;
+            port) ufw delete allow "$value" || true ;;
+            routed) ufw default "$value" routed ;;
+        esac
+    done < "$state"
+    rm -f "$state"
+}
+`
+
+// StepFirewalldFuncs are the firewalld counterparts of the StepFirewallFuncs, for the distributions
+// shipping firewalld instead of ufw. Hosts without a running firewalld are left untouched.
+const StepFirewalldFuncs = `
+configure_firewall() {
+    local mode=$1
+    shift
+    local state=${FIREWALL_STATE_FILE:-` + FirewallStateFile + `}
+    if ! command -v firewall-cmd >>/dev/null || ! firewall-cmd --state >>/dev/null 2>&1; then
+        return 0
+    fi
+    touch "$state"
+    if [ "$mode" == "Disable" ]; then
+        systemctl disable --now firewalld
+        echo "disabled" >> "$state"
+        return 0
+    fi
+    local port
+    for port in "$@"; do
+        if ! firewall-cmd --permanent --query-port="${port/:/-}" >>/dev/null 2>&1; then
+            firewall-cmd --permanent --add-port="${port/:/-}"
+            echo "port $port" >> "$state"
+        fi
+    done
+    if ! firewall-cmd --permanent --query-forward >>/dev/null 2>&1; then
+        firewall-cmd --permanent --add-forward
+        echo "forward" >> "$state"
+    fi
+    firewall-cmd --reload
+}
+
+restore_firewall() {
+    local state=${FIREWALL_STATE_FILE:-` + FirewallStateFile + `}
+    if ! command -v firewall-cmd >>/dev/null || [ ! -f "$state" ]; then
+        return 0
+    fi
+    if grep -qx "disabled" "$state"; then
+        systemctl enable --now firewalld
+    elif firewall-cmd --state >>/dev/null 2>&1; then
+        local rule value
+        while read -r rule value; do
+            case "$rule" in
+                port) firewall-cmd --permanent --remove-port="${value/:/-}" || true ;;
+                forward) firewall-cmd --permanent --remove-forward || true ;;
+            esac
+        done < "$state"
+        firewall-cmd --reload
+    fi
+    rm -f "$state"
+}
+`
+
+// firewallModeArg validates the firewall mode, FirewallModeOpenPorts when empty
+func firewallModeArg(mode string) (string, error) {
+	switch mode {
+	case "":
+		return FirewallModeOpenPorts, nil
+	case FirewallModeOpenPorts, FirewallModeDisable:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid firewall mode %q, expected %s or %s", mode, FirewallModeOpenPorts, FirewallModeDisable)
+	}
+}
+
+// firewallPortsArg validates the firewall ports and joins them for the install script, the FirewallPorts
+// when empty
+func firewallPortsArg(ports []string) (string, error) {
+	if len(ports) == 0 {
+		ports = FirewallPorts
+	}
+	for _, port := range ports {
+		if !firewallPortPattern.MatchString(port) {
+			return "", fmt.Errorf("invalid firewall port %q, expected PORT/PROTOCOL or FIRST:LAST/PROTOCOL with tcp or udp", port)
+		}
+	}
+	return strings.Join(ports, " "), nil
+}
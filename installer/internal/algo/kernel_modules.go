@@ -0,0 +1,38 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package algo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// kernelModuleRegexp matches the names of the kernel modules modprobe accepts
+var kernelModuleRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// StepKernelModulesFuncs are the shell functions the install scripts use to load the kernel modules of the node.
+// Each module is verified to be loaded, or built into the kernel, so a host missing a module, e.g. of IPVS or a
+// GPU driver, fails the install with a clear message instead of joining as a node that never becomes ready.
+const StepKernelModulesFuncs = `
+load_kernel_modules() {
+    local module
+    for module in "$@"; do
+        if ! modprobe "$module" || [ ! -d "/sys/module/${module//-/_}" ]; then
+            echo "required kernel module $module is not available on this host, install the package providing it or remove it from the required kernel modules"
+            return 1
+        fi
+    done
+}
+`
+
+// kernelModulesArg validates the required kernel modules and joins them for the install script
+func kernelModulesArg(modules []string) (string, error) {
+	for _, module := range modules {
+		if !kernelModuleRegexp.MatchString(module) {
+			return "", fmt.Errorf("invalid kernel module name %q", module)
+		}
+	}
+	return strings.Join(modules, " "), nil
+}
@@ -4,10 +4,7 @@
 package algo
 
 import (
-	"bytes"
 	"context"
-	"fmt"
-	"html/template"
 )
 
 // KubexmInstaller represents the installer for kubexm (TLS Bootstrap) mode
@@ -19,42 +16,11 @@ type KubexmInstaller struct {
 }
 
 // NewKubexmInstaller creates a new KubexmInstaller for kubexm (TLS Bootstrap) mode
-func NewKubexmInstaller(ctx context.Context, arch, bundleAddrs, k8sVersion string, downloadMode string, proxyConfig map[string]string) (*KubexmInstaller, error) {
-	parseFn := func(script string) (string, error) {
-		parser, err := template.New("parser").Parse(script)
-		if err != nil {
-			return "", fmt.Errorf("unable to parse kubexm install script")
-		}
-		var tpl bytes.Buffer
-		if err = parser.Execute(&tpl, map[string]string{
-			"Arch":               arch,
-			"K8sVersion":         k8sVersion,
-			"DownloadMode":       downloadMode,
-			"BundleAddrs":        bundleAddrs,
-			"BundleDownloadPath": "{{.BundleDownloadPath}}",
-			"ImgpkgVersion":      ImgpkgVersion,
-			"HttpProxy":          proxyConfig["http-proxy"],
-			"HttpsProxy":         proxyConfig["https-proxy"],
-			"NoProxy":            proxyConfig["no-proxy"],
-		}); err != nil {
-			return "", fmt.Errorf("unable to apply parsed template to kubexm installer")
-		}
-		return tpl.String(), nil
-	}
-
-	install, err := parseFn(DoKubexm)
-	if err != nil {
-		return nil, err
-	}
-	uninstall, err := parseFn(UndoKubexm)
+func NewKubexmInstaller(ctx context.Context, opts Options) (*KubexmInstaller, error) {
+	install, uninstall, upgrade, err := renderScripts(opts, DoKubexm, UndoKubexm, UpgradeKubexm)
 	if err != nil {
 		return nil, err
 	}
-	upgrade, err := parseFn(UpgradeKubexm)
-	if err != nil {
-		return nil, err
-	}
-
 	return &KubexmInstaller{
 		install:   install,
 		uninstall: uninstall,
@@ -82,17 +48,24 @@ func (s *KubexmInstaller) Upgrade() string {
 var (
 	DoKubexm = `
 set -euox pipefail
-
+` + StepRetryFuncs + StepBundleCacheFuncs + StepContainerdConfigFuncs + StepKernelModulesFuncs + StepFirewallFuncs + `
 # Debug mode: capture logs on failure
 trap 'echo "Kubexm Installation failed. Collecting logs..."; journalctl -u kubelet --no-pager | tail -n 100; cat /var/log/byoh-agent.log || true' ERR
 
 ARCH={{.Arch}}
 K8S_VERSION={{.K8sVersion}}
+CNI_PLUGINS_VERSION={{.CNIPluginsVersion}}
+REQUIRED_KERNEL_MODULES="{{.KernelModules}}"
+FIREWALL_MODE={{.FirewallMode}}
+FIREWALL_PORTS="{{.FirewallPorts}}"
+RUNTIME_HANDLERS="{{.RuntimeHandlers}}"
 DOWNLOAD_MODE={{.DownloadMode}}
 
 BUNDLE_DOWNLOAD_PATH={{.BundleDownloadPath}}
+BUNDLE_CACHE_PATH="{{.BundleCachePath}}"
 BUNDLE_ADDR={{.BundleAddrs}}
 IMGPKG_VERSION={{.ImgpkgVersion}}
+IMGPKG_BASE_URL={{.ImgpkgBaseURL}}
 BUNDLE_PATH=$BUNDLE_DOWNLOAD_PATH/$BUNDLE_ADDR
 
 # Production: Ensure NTP time sync is active
@@ -143,7 +116,7 @@ if ! command -v imgpkg >>/dev/null; then
 		dl_bin="curl -s -L"
 	fi
 	
-	$dl_bin github.com/vmware-tanzu/carvel-imgpkg/releases/download/$IMGPKG_VERSION/imgpkg-linux-$ARCH > /tmp/imgpkg
+	$dl_bin $IMGPKG_BASE_URL/$IMGPKG_VERSION/imgpkg-linux-$ARCH > /tmp/imgpkg
 	mv /tmp/imgpkg /usr/local/bin/imgpkg
 	chmod +x /usr/local/bin/imgpkg
 fi
@@ -158,22 +131,22 @@ if [ "$DOWNLOAD_MODE" == "online" ]; then
     
     # Download kubelet
     echo "Downloading kubelet..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubelet" -o /usr/local/bin/kubelet
+    download_file "${K8S_DOWNLOAD_URL}/kubelet" /usr/local/bin/kubelet
     chmod +x /usr/local/bin/kubelet
     
     # Download kube-proxy
     echo "Downloading kube-proxy..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kube-proxy" -o /usr/local/bin/kube-proxy
+    download_file "${K8S_DOWNLOAD_URL}/kube-proxy" /usr/local/bin/kube-proxy
     chmod +x /usr/local/bin/kube-proxy
     
     # Download kubectl (for troubleshooting)
     echo "Downloading kubectl..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubectl" -o /usr/local/bin/kubectl
+    download_file "${K8S_DOWNLOAD_URL}/kubectl" /usr/local/bin/kubectl
     chmod +x /usr/local/bin/kubectl
     
     # Download cri-tools (crictl)
     echo "Downloading cri-tools..."
-    curl -fsSL "https://github.com/kubernetes-sigs/cri-tools/releases/download/${CRI_TOOLS_VERSION}/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}.tar.gz" -o /tmp/crictl.tar.gz
+    download_file "https://github.com/kubernetes-sigs/cri-tools/releases/download/${CRI_TOOLS_VERSION}/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}.tar.gz" /tmp/crictl.tar.gz
     tar -xzf /tmp/crictl.tar.gz -C /tmp
     mv /tmp/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}/crictl /usr/local/bin/
     rm -rf /tmp/crictl.tar.gz /tmp/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}
@@ -181,21 +154,21 @@ if [ "$DOWNLOAD_MODE" == "online" ]; then
     # Download CNI plugins
     echo "Downloading CNI plugins..."
     mkdir -p /opt/cni/bin
-    curl -fsSL "https://github.com/containernetworking/plugins/releases/download/v1.4.0/cni-plugins-linux-${ARCH}-v1.4.0.tgz" -o /tmp/cni-plugins.tgz
+    download_file "https://github.com/containernetworking/plugins/releases/download/${CNI_PLUGINS_VERSION}/cni-plugins-linux-${ARCH}-${CNI_PLUGINS_VERSION}.tgz" /tmp/cni-plugins.tgz
     tar -xzf /tmp/cni-plugins.tgz -C /opt/cni/bin/
     rm /tmp/cni-plugins.tgz
     
     # Download containerd and runc binaries
     echo "Downloading containerd..."
-    CONTAINERD_VERSION="v1.7.0"
+    CONTAINERD_VERSION="{{.ContainerdVersion}}"
     CONTAINERD_URL="https://github.com/containerd/containerd/releases/download/${CONTAINERD_VERSION}/containerd-${CONTAINERD_VERSION}-linux-${ARCH}.tar.gz"
-    curl -fsSL "$CONTAINERD_URL" -o /tmp/containerd.tar.gz
+    download_file "$CONTAINERD_URL" /tmp/containerd.tar.gz
     tar -xzf /tmp/containerd.tar.gz -C /usr/local/
     rm /tmp/containerd.tar.gz
     
     echo "Downloading runc..."
-    RUNC_VERSION="v1.1.10"
-    curl -fsSL "https://github.com/opencontainers/runc/releases/download/${RUNC_VERSION}/runc.${ARCH}" -o /usr/local/bin/runc
+    RUNC_VERSION="{{.RuncVersion}}"
+    download_file "https://github.com/opencontainers/runc/releases/download/${RUNC_VERSION}/runc.${ARCH}" /usr/local/bin/runc
     chmod +x /usr/local/bin/runc
     
 else
@@ -209,7 +182,7 @@ else
         echo "Local binary bundle found. Skipping download."
     else
         echo "Local bundle not found or incomplete. Downloading..."
-        imgpkg pull -i $BUNDLE_ADDR -o $BUNDLE_PATH
+        pull_bundle $BUNDLE_ADDR $BUNDLE_PATH
     fi
     
     # Extract and install Kubernetes binaries
@@ -247,10 +220,8 @@ fi
 ## disable swap
 swapoff -a && sed -ri '/\sswap\s/s/^#?/#/' /etc/fstab
 
-## disable firewall
-if command -v ufw >>/dev/null; then
-	ufw disable
-fi
+## configure firewall
+configure_firewall "$FIREWALL_MODE" $FIREWALL_PORTS
 
 ## ensure iptables is installed (required for kube-proxy)
 if ! command -v iptables >>/dev/null; then
@@ -259,12 +230,18 @@ if ! command -v iptables >>/dev/null; then
 fi
 
 ## load kernel modules
-modprobe overlay && modprobe br_netfilter
+load_kernel_modules overlay br_netfilter $REQUIRED_KERNEL_MODULES
+if [ -n "$REQUIRED_KERNEL_MODULES" ]; then
+    printf '%s\n' $REQUIRED_KERNEL_MODULES > /etc/modules-load.d/byoh-required-modules.conf
+fi
+
+## configuring containerd with SystemdCgroup = true (required for cgroup v2), keeping an existing config
+configure_containerd /etc/containerd/config.toml
 
-## configuring containerd with SystemdCgroup = true (required for cgroup v2)
-mkdir -p /etc/containerd
-containerd config default > /etc/containerd/config.toml
-sed -i 's/SystemdCgroup = false/SystemdCgroup = true/' /etc/containerd/config.toml
+## adding the additional containerd runtime handlers, e.g. gVisor or Kata Containers
+if [ -n "$RUNTIME_HANDLERS" ]; then
+    configure_runtime_handlers /etc/containerd/config.toml $RUNTIME_HANDLERS
+fi
 
 ## Create directories for kubelet and kube-proxy
 mkdir -p /var/lib/kubelet
@@ -310,7 +287,7 @@ systemctl daemon-reload && systemctl enable containerd && systemctl start contai
 
 	UndoKubexm = `
 set -euox pipefail
-
+` + StepFirewallFuncs + `
 # Proxy configuration
 HTTP_PROXY_VAL="{{.HttpProxy}}"
 HTTPS_PROXY_VAL="{{.HttpsProxy}}"
@@ -379,11 +356,10 @@ rm -rf /etc/containerd
 
 ## remove kernel modules
 modprobe -rq overlay && modprobe -r br_netfilter || true
+rm -f /etc/modules-load.d/byoh-required-modules.conf
 
-## enable firewall
-if command -v ufw >>/dev/null; then
-	ufw enable
-fi
+## restore firewall
+restore_firewall
 
 ## enable swap
 swapon -a && sed -ri '/\sswap\s/s/^#?//' /etc/fstab
@@ -394,7 +370,7 @@ echo "Kubexm cleanup complete."
 
 	UpgradeKubexm = `
 set -euox pipefail
-
+` + StepRetryFuncs + StepBundleCacheFuncs + `
 # Proxy configuration
 HTTP_PROXY_VAL="{{.HttpProxy}}"
 HTTPS_PROXY_VAL="{{.HttpsProxy}}"
@@ -414,6 +390,7 @@ fi
 
 
 BUNDLE_DOWNLOAD_PATH={{.BundleDownloadPath}}
+BUNDLE_CACHE_PATH="{{.BundleCachePath}}"
 BUNDLE_ADDR={{.BundleAddrs}}
 ARCH={{.Arch}}
 K8S_VERSION={{.K8sVersion}}
@@ -428,15 +405,15 @@ if [ "$DOWNLOAD_MODE" == "online" ]; then
     K8S_DOWNLOAD_URL="https://dl.k8s.io/${K8S_VERSION}/bin/linux/${ARCH}"
     
     echo "Upgrading kubelet..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubelet" -o /usr/local/bin/kubelet
+    download_file "${K8S_DOWNLOAD_URL}/kubelet" /usr/local/bin/kubelet
     chmod +x /usr/local/bin/kubelet
     
     echo "Upgrading kube-proxy..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kube-proxy" -o /usr/local/bin/kube-proxy
+    download_file "${K8S_DOWNLOAD_URL}/kube-proxy" /usr/local/bin/kube-proxy
     chmod +x /usr/local/bin/kube-proxy
     
     echo "Upgrading kubectl..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubectl" -o /usr/local/bin/kubectl
+    download_file "${K8S_DOWNLOAD_URL}/kubectl" /usr/local/bin/kubectl
     chmod +x /usr/local/bin/kubectl
     
 else
@@ -451,7 +428,7 @@ else
         chmod +x /usr/local/bin/*
     else
         echo "Bundle not found. Downloading..."
-        imgpkg pull -i $BUNDLE_ADDR -o $BUNDLE_PATH
+        pull_bundle $BUNDLE_ADDR $BUNDLE_PATH
         cp -f $BUNDLE_PATH/bin/* /usr/local/bin/
         chmod +x /usr/local/bin/*
     fi
@@ -0,0 +1,127 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package algo
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+)
+
+// Options are the settings the install, uninstall and upgrade scripts of the installers are rendered with.
+// The defaults are used for the empty versions and URLs.
+type Options struct {
+	// Arch is the architecture of the host, e.g. amd64
+	Arch string
+	// BundleAddrs is the address of the BYOH bundle of the host
+	BundleAddrs string
+	// K8sVersion is the Kubernetes version installed
+	K8sVersion string
+	// DownloadMode is online or offline, only used by the kubexm installer
+	DownloadMode string
+	// CNIPluginsVersion pins the CNI plugins downloaded in online mode
+	CNIPluginsVersion string
+	// ContainerdVersion and RuncVersion pin containerd and runc downloaded in online mode
+	ContainerdVersion string
+	RuncVersion       string
+	// ImgpkgVersion and ImgpkgBaseURL pin the imgpkg release fetched when the host lacks imgpkg
+	ImgpkgVersion string
+	ImgpkgBaseURL string
+	// KernelModules are loaded and verified in addition to the ones every installer requires
+	KernelModules []string
+	// FirewallMode is FirewallModeOpenPorts or FirewallModeDisable, FirewallModeOpenPorts when empty
+	FirewallMode string
+	// FirewallPorts are the ports opened in FirewallModeOpenPorts, e.g. 6443/tcp or 30000:32767/udp,
+	// the default FirewallPorts when empty
+	FirewallPorts []string
+	// RuntimeHandlers are additional containerd runtime handlers, by name their runtime type
+	RuntimeHandlers map[string]string
+	// ProxyConfig are the http-proxy, https-proxy and no-proxy settings of the downloads
+	ProxyConfig map[string]string
+}
+
+// templateData validates the options and returns the data the scripts are rendered with
+func (o Options) templateData() (map[string]string, error) {
+	if o.CNIPluginsVersion == "" {
+		o.CNIPluginsVersion = DefaultCNIPluginsVersion
+	}
+	if o.ContainerdVersion == "" {
+		o.ContainerdVersion = DefaultContainerdVersion
+	}
+	if o.RuncVersion == "" {
+		o.RuncVersion = DefaultRuncVersion
+	}
+	if o.ImgpkgVersion == "" {
+		o.ImgpkgVersion = ImgpkgVersion
+	}
+	if o.ImgpkgBaseURL == "" {
+		o.ImgpkgBaseURL = DefaultImgpkgBaseURL
+	}
+	requiredKernelModules, err := kernelModulesArg(o.KernelModules)
+	if err != nil {
+		return nil, err
+	}
+	firewallMode, err := firewallModeArg(o.FirewallMode)
+	if err != nil {
+		return nil, err
+	}
+	firewallPorts, err := firewallPortsArg(o.FirewallPorts)
+	if err != nil {
+		return nil, err
+	}
+	containerdRuntimeHandlers, err := runtimeHandlersArg(o.RuntimeHandlers)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"BundleAddrs":        o.BundleAddrs,
+		"Arch":               o.Arch,
+		"DownloadMode":       o.DownloadMode,
+		"ImgpkgVersion":      o.ImgpkgVersion,
+		"ImgpkgBaseURL":      o.ImgpkgBaseURL,
+		"KernelModules":      requiredKernelModules,
+		"FirewallMode":       firewallMode,
+		"FirewallPorts":      firewallPorts,
+		"RuntimeHandlers":    containerdRuntimeHandlers,
+		"BundleDownloadPath": "{{.BundleDownloadPath}}",
+		"BundleCachePath":    "{{.BundleCachePath}}",
+		"K8sVersion":         o.K8sVersion,
+		"CNIPluginsVersion":  o.CNIPluginsVersion,
+		"ContainerdVersion":  o.ContainerdVersion,
+		"RuncVersion":        o.RuncVersion,
+		"HttpProxy":          o.ProxyConfig["http-proxy"],
+		"HttpsProxy":         o.ProxyConfig["https-proxy"],
+		"NoProxy":            o.ProxyConfig["no-proxy"],
+	}, nil
+}
+
+// renderScripts validates the options and renders the install, uninstall and upgrade scripts with them
+func renderScripts(opts Options, installScript, uninstallScript, upgradeScript string) (install, uninstall, upgrade string, err error) {
+	data, err := opts.templateData()
+	if err != nil {
+		return "", "", "", err
+	}
+	parseFn := func(script string) (string, error) {
+		parser, err := template.New("parser").Parse(script)
+		if err != nil {
+			return "", fmt.Errorf("unable to parse install script")
+		}
+		var tpl bytes.Buffer
+		if err = parser.Execute(&tpl, data); err != nil {
+			return "", fmt.Errorf("unable to apply install parsed template to the data object")
+		}
+		return tpl.String(), nil
+	}
+
+	if install, err = parseFn(installScript); err != nil {
+		return "", "", "", err
+	}
+	if uninstall, err = parseFn(uninstallScript); err != nil {
+		return "", "", "", err
+	}
+	if upgrade, err = parseFn(upgradeScript); err != nil {
+		return "", "", "", err
+	}
+	return install, uninstall, upgrade, nil
+}
@@ -0,0 +1,29 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package algo
+
+// StepRetryFuncs are the shell functions the install and upgrade scripts use to retry a single step.
+// A transient failure of one download is retried on its own, instead of failing the whole script
+// whose retry would download all the binaries again.
+// download_file only replaces the destination once the download completed.
+const StepRetryFuncs = `
+STEP_RETRIES=5
+retry() {
+    local attempt=1
+    until "$@"; do
+        if [ "$attempt" -ge "$STEP_RETRIES" ]; then
+            echo "$* failed after $attempt attempts"
+            return 1
+        fi
+        echo "$* failed (attempt $attempt/$STEP_RETRIES), retrying..."
+        sleep $((attempt * 5))
+        attempt=$((attempt + 1))
+    done
+}
+
+download_file() {
+    retry curl -fsSL --connect-timeout 30 "$1" -o "$2.part"
+    mv -f "$2.part" "$2"
+}
+`
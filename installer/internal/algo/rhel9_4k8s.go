@@ -0,0 +1,431 @@
+// Copyright 2022 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package algo
+
+import (
+	"context"
+)
+
+// StepPackageFuncs are the shell functions the RHEL install scripts use to install packages, with dnf or
+// with yum on hosts without dnf
+const StepPackageFuncs = `
+pkg_install() {
+    if command -v dnf >>/dev/null; then
+        dnf install -y "$@"
+    else
+        yum install -y "$@"
+    fi
+}
+`
+
+// RHEL9Installer represent the installer implementation for the Red Hat Enterprise Linux 9.*, Rocky Linux 9.* and CentOS Stream 9
+// os distributions. It installs packages with dnf, or yum when dnf is missing, configures firewalld instead of ufw
+// and sets SELinux to permissive.
+type RHEL9Installer struct {
+	install   string
+	uninstall string
+	upgrade   string
+}
+
+// NewRHEL9Installer will return new RHEL9Installer instance
+func NewRHEL9Installer(ctx context.Context, opts Options) (*RHEL9Installer, error) {
+	install, uninstall, upgrade, err := renderScripts(opts, DoRHEL9_4K8s, UndoRHEL9_4K8s, UpgradeRHEL9_4K8s)
+	if err != nil {
+		return nil, err
+	}
+	return &RHEL9Installer{
+		install:   install,
+		uninstall: uninstall,
+		upgrade:   upgrade,
+	}, nil
+}
+
+// Install will return k8s install script
+func (s *RHEL9Installer) Install() string {
+	return s.install
+}
+
+// Uninstall will return k8s uninstall script
+func (s *RHEL9Installer) Uninstall() string {
+	return s.uninstall
+}
+
+// Upgrade will return k8s upgrade script
+func (s *RHEL9Installer) Upgrade() string {
+	return s.upgrade
+}
+
+// contains the installation and uninstallation steps for the supported os and k8s
+var (
+	DoRHEL9_4K8s = `
+set -euox pipefail
+` + StepRetryFuncs + StepBundleCacheFuncs + StepContainerdConfigFuncs + StepKernelModulesFuncs + StepFirewalldFuncs + StepPackageFuncs + `
+# Debug mode: capture logs on failure
+trap 'echo "Installation failed. Collecting logs..."; journalctl -u kubelet --no-pager | tail -n 100; cat /var/log/byoh-agent.log || true' ERR
+
+BUNDLE_DOWNLOAD_PATH={{.BundleDownloadPath}}
+BUNDLE_CACHE_PATH="{{.BundleCachePath}}"
+BUNDLE_ADDR={{.BundleAddrs}}
+IMGPKG_VERSION={{.ImgpkgVersion}}
+IMGPKG_BASE_URL={{.ImgpkgBaseURL}}
+ARCH={{.Arch}}
+K8S_VERSION={{.K8sVersion}}
+CNI_PLUGINS_VERSION={{.CNIPluginsVersion}}
+REQUIRED_KERNEL_MODULES="{{.KernelModules}}"
+FIREWALL_MODE={{.FirewallMode}}
+FIREWALL_PORTS="{{.FirewallPorts}}"
+RUNTIME_HANDLERS="{{.RuntimeHandlers}}"
+BUNDLE_PATH=$BUNDLE_DOWNLOAD_PATH/$BUNDLE_ADDR
+
+# Production: Ensure NTP time sync is active
+echo "Ensuring time synchronization..."
+systemctl enable --now chronyd || true
+timedatectl set-ntp true || true
+
+# Production: Configure Proxy if set
+HTTP_PROXY_VAL="{{.HttpProxy}}"
+HTTPS_PROXY_VAL="{{.HttpsProxy}}"
+NO_PROXY_VAL="{{.NoProxy}}"
+if [ -n "$HTTP_PROXY_VAL" ]; then
+    export HTTP_PROXY="$HTTP_PROXY_VAL"
+    export http_proxy="$HTTP_PROXY_VAL"
+fi
+if [ -n "$HTTPS_PROXY_VAL" ]; then
+    export HTTPS_PROXY="$HTTPS_PROXY_VAL"
+    export https_proxy="$HTTPS_PROXY_VAL"
+fi
+if [ -n "$NO_PROXY_VAL" ]; then
+    export NO_PROXY="$NO_PROXY_VAL"
+    export no_proxy="$NO_PROXY_VAL"
+fi
+
+# Resilience: Proactively clean up any previous state to ensure a fresh install
+echo "Ensuring clean state..."
+if command -v kubeadm >/dev/null; then
+    kubeadm reset -f || true
+fi
+rm -rf /etc/cni/net.d
+rm -rf /var/lib/kubelet
+rm -rf /etc/kubernetes
+rm -rf /var/lib/etcd
+
+
+if ! command -v imgpkg >>/dev/null; then
+	echo "installing imgpkg"	
+	
+	if command -v wget >>/dev/null; then
+		dl_bin="wget -nv -O-"
+	elif command -v curl >>/dev/null; then
+		dl_bin="curl -s -L"
+	else
+		echo "installing curl"
+		pkg_install curl
+		dl_bin="curl -s -L"
+	fi
+	
+	$dl_bin $IMGPKG_BASE_URL/$IMGPKG_VERSION/imgpkg-linux-$ARCH > /tmp/imgpkg
+	mv /tmp/imgpkg /usr/local/bin/imgpkg
+	chmod +x /usr/local/bin/imgpkg
+fi
+
+echo "Checking installation mode..."
+
+if [ "$BUNDLE_ADDR" == "online" ]; then
+    echo "Running in ONLINE mode, using binary download..."
+
+    # Download Kubernetes binaries directly from official releases
+    K8S_MAJOR_MINOR=$(echo $K8S_VERSION | cut -d. -f1,2)
+    K8S_PATCH=$(echo $K8S_VERSION | cut -d. -f3)
+    K8S_DOWNLOAD_URL="https://dl.k8s.io/${K8S_VERSION}/bin/linux/${ARCH}"
+    CRI_TOOLS_VERSION="${K8S_VERSION}"
+    
+    echo "Downloading Kubernetes ${K8S_VERSION} binaries for ${ARCH}..."
+    
+    # Download kubeadm
+    echo "Downloading kubeadm..."
+    download_file "${K8S_DOWNLOAD_URL}/kubeadm" /usr/local/bin/kubeadm
+    chmod +x /usr/local/bin/kubeadm
+    
+    # Download kubectl
+    echo "Downloading kubectl..."
+    download_file "${K8S_DOWNLOAD_URL}/kubectl" /usr/local/bin/kubectl
+    chmod +x /usr/local/bin/kubectl
+    
+    # Download kubelet
+    echo "Downloading kubelet..."
+    download_file "${K8S_DOWNLOAD_URL}/kubelet" /usr/local/bin/kubelet
+    chmod +x /usr/local/bin/kubelet
+    
+    # Download cri-tools (crictl)
+    echo "Downloading cri-tools..."
+    download_file "https://github.com/kubernetes-sigs/cri-tools/releases/download/${CRI_TOOLS_VERSION}/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}.tar.gz" /tmp/crictl.tar.gz
+    tar -xzf /tmp/crictl.tar.gz -C /tmp
+    mv /tmp/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}/crictl /usr/local/bin/
+    rm -rf /tmp/crictl.tar.gz /tmp/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}
+    
+    # Download CNI plugins
+    echo "Downloading CNI plugins..."
+    mkdir -p /opt/cni/bin
+    download_file "https://github.com/containernetworking/plugins/releases/download/${CNI_PLUGINS_VERSION}/cni-plugins-linux-${ARCH}-${CNI_PLUGINS_VERSION}.tgz" /tmp/cni-plugins.tgz
+    tar -xzf /tmp/cni-plugins.tgz -C /opt/cni/bin/
+    rm /tmp/cni-plugins.tgz
+    
+    # Download containerd and runc binaries
+    echo "Downloading containerd..."
+    CONTAINERD_VERSION="{{.ContainerdVersion}}"
+    CONTAINERD_URL="https://github.com/containerd/containerd/releases/download/${CONTAINERD_VERSION}/containerd-${CONTAINERD_VERSION}-linux-${ARCH}.tar.gz"
+    download_file "$CONTAINERD_URL" /tmp/containerd.tar.gz
+    tar -xzf /tmp/containerd.tar.gz -C /usr/local/
+    rm /tmp/containerd.tar.gz
+    
+    echo "Downloading runc..."
+    RUNC_VERSION="{{.RuncVersion}}"
+    download_file "https://github.com/opencontainers/runc/releases/download/${RUNC_VERSION}/runc.${ARCH}" /usr/local/bin/runc
+    chmod +x /usr/local/bin/runc
+    
+    # Create dummy bundle path for subsequent logic compatibility
+    mkdir -p $BUNDLE_PATH
+    
+else
+    echo "Running in OFFLINE mode, using binary bundle..."
+    
+    echo "Checking for local bundle..."
+    mkdir -p $BUNDLE_PATH
+
+    # Check if critical binary files exist
+    if [ -f "$BUNDLE_PATH/kubeadm" ] && [ -f "$BUNDLE_PATH/containerd/bin/containerd" ]; then
+        echo "Local binary bundle found. Skipping download."
+    else
+        echo "Local bundle not found or incomplete. Downloading..."
+        pull_bundle $BUNDLE_ADDR $BUNDLE_PATH
+    fi
+    
+    # Extract and install Kubernetes binaries
+    if [ -d "$BUNDLE_PATH/bin" ]; then
+        echo "Installing Kubernetes binaries from bundle..."
+        cp -f $BUNDLE_PATH/bin/* /usr/local/bin/
+        chmod +x /usr/local/bin/*
+    fi
+    
+    # Install CNI plugins
+    if [ -d "$BUNDLE_PATH/cni/bin" ]; then
+        echo "Installing CNI plugins from bundle..."
+        mkdir -p /opt/cni/bin
+        cp -f $BUNDLE_PATH/cni/bin/* /opt/cni/bin/
+    fi
+    
+    # Install containerd
+    if [ -d "$BUNDLE_PATH/containerd" ]; then
+        echo "Installing containerd from bundle..."
+        cp -rf $BUNDLE_PATH/containerd/* /usr/local/
+    fi
+fi
+
+## Pre-flight Check: Swap
+if swapon --show | grep -q .; then
+    echo "Error: Swap is enabled. Please disable swap before proceeding."
+    exit 1
+fi
+
+
+## disable swap
+swapoff -a && sed -ri '/\sswap\s/s/^#?/#/' /etc/fstab
+
+## set SELinux to permissive, an enforcing host is restored on uninstall
+if command -v getenforce >>/dev/null && [ "$(getenforce)" == "Enforcing" ]; then
+    touch /etc/selinux/byoh-was-enforcing
+fi
+setenforce 0 || true
+if [ -f /etc/selinux/config ]; then
+    sed -i 's/^SELINUX=enforcing$/SELINUX=permissive/' /etc/selinux/config
+fi
+
+## configure firewall
+configure_firewall "$FIREWALL_MODE" $FIREWALL_PORTS
+
+## ensure iptables is installed (required for kube-proxy)
+if ! command -v iptables >>/dev/null; then
+	echo "installing iptables"
+	pkg_install iptables
+fi
+
+## load kernal modules
+load_kernel_modules overlay br_netfilter $REQUIRED_KERNEL_MODULES
+if [ -n "$REQUIRED_KERNEL_MODULES" ]; then
+    printf '%s\n' $REQUIRED_KERNEL_MODULES > /etc/modules-load.d/byoh-required-modules.conf
+fi
+
+## GPU Detection and Container Toolkit Installation
+if command -v lspci >>/dev/null && lspci -n | grep -q "10de:"; then
+    # The NVIDIA drivers are not packaged by the distribution, they are expected on the host
+    echo "NVIDIA GPU detected. Installing NVIDIA Container Toolkit..."
+    curl -s -L https://nvidia.github.io/libnvidia-container/stable/rpm/nvidia-container-toolkit.repo | \
+      tee /etc/yum.repos.d/nvidia-container-toolkit.repo
+    pkg_install nvidia-container-toolkit
+
+    echo "Configuring containerd for NVIDIA..."
+    # We will configure it after containerd is installed below
+    # Just setting a flag file to remember to configure it later
+    touch /tmp/install-nvidia-ctk
+fi
+
+
+## configuring containerd with SystemdCgroup = true (required for cgroup v2), keeping an existing config
+configure_containerd /etc/containerd/config.toml
+
+## adding the additional containerd runtime handlers, e.g. gVisor or Kata Containers
+if [ -n "$RUNTIME_HANDLERS" ]; then
+    configure_runtime_handlers /etc/containerd/config.toml $RUNTIME_HANDLERS
+fi
+
+if [ -f /tmp/install-nvidia-ctk ]; then
+    echo "Applying NVIDIA Container Toolkit configuration..."
+    nvidia-ctk runtime configure --runtime=containerd
+    rm /tmp/install-nvidia-ctk
+fi
+
+## starting containerd service
+systemctl daemon-reload && systemctl enable containerd && systemctl start containerd`
+
+	UndoRHEL9_4K8s = `
+set -euox pipefail
+` + StepFirewalldFuncs + `
+BUNDLE_DOWNLOAD_PATH={{.BundleDownloadPath}}
+BUNDLE_ADDR={{.BundleAddrs}}
+BUNDLE_PATH=$BUNDLE_DOWNLOAD_PATH/$BUNDLE_ADDR
+
+## Reset Kubernetes state (Best Effort)
+echo "Resetting Kubernetes state..."
+if command -v kubeadm >/dev/null; then
+    kubeadm reset -f || true
+fi
+
+## disabling containerd service
+systemctl stop containerd && systemctl disable containerd && systemctl daemon-reload
+
+## Deep Clean: Remove Data Directories
+echo "Cleaning up data directories..."
+rm -rf /var/lib/etcd
+rm -rf /var/lib/kubelet
+rm -rf /etc/kubernetes
+rm -rf /var/lib/cni
+rm -rf /etc/cni
+rm -rf /opt/cni
+rm -rf /opt/containerd
+rm -rf /etc/containerd
+
+## Removing Kubernetes binaries
+echo "Removing Kubernetes binaries..."
+rm -f /usr/local/bin/kubeadm
+rm -f /usr/local/bin/kubectl
+rm -f /usr/local/bin/kubelet
+rm -f /usr/local/bin/crictl
+rm -f /usr/local/bin/containerd
+rm -f /usr/local/bin/containerd-shim-runc-v2
+rm -f /usr/local/bin/runc
+
+## Removing CNI plugins
+echo "Removing CNI plugins..."
+rm -rf /opt/cni/bin/*
+
+## removing os configuration
+if [ -f "$BUNDLE_PATH/conf.tar" ]; then
+    tar tf "$BUNDLE_PATH/conf.tar" | xargs -n 1 echo '/' | sed 's/ //g' | grep -e "[^/]$" | xargs rm -f || true
+fi
+
+## remove kernal modules
+modprobe -rq overlay && modprobe -r br_netfilter || true
+rm -f /etc/modules-load.d/byoh-required-modules.conf
+
+## restore firewall
+restore_firewall
+
+## enable swap
+swapon -a && sed -ri '/\sswap\s/s/^#?//' /etc/fstab
+
+## restore SELinux enforcing mode
+if [ -f /etc/selinux/byoh-was-enforcing ]; then
+    sed -i 's/^SELINUX=permissive$/SELINUX=enforcing/' /etc/selinux/config
+    setenforce 1 || true
+    rm -f /etc/selinux/byoh-was-enforcing
+fi
+
+rm -rf $BUNDLE_PATH`
+
+	UpgradeRHEL9_4K8s = `
+set -euox pipefail
+` + StepRetryFuncs + StepBundleCacheFuncs + `
+BUNDLE_DOWNLOAD_PATH={{.BundleDownloadPath}}
+BUNDLE_CACHE_PATH="{{.BundleCachePath}}"
+BUNDLE_ADDR={{.BundleAddrs}}
+ARCH={{.Arch}}
+K8S_VERSION={{.K8sVersion}}
+BUNDLE_PATH=$BUNDLE_DOWNLOAD_PATH/$BUNDLE_ADDR
+
+echo "Checking upgrade mode..."
+
+if [ "$BUNDLE_ADDR" == "online" ]; then
+    echo "Running in ONLINE mode, upgrading via binary download..."
+    
+    K8S_DOWNLOAD_URL="https://dl.k8s.io/${K8S_VERSION}/bin/linux/${ARCH}"
+    
+    echo "Upgrading kubeadm..."
+    download_file "${K8S_DOWNLOAD_URL}/kubeadm" /usr/local/bin/kubeadm
+    chmod +x /usr/local/bin/kubeadm
+    
+    # Determine version from new kubeadm
+    NEW_K8S_VERSION=$(kubeadm version -o short)
+    
+    echo "Applying kubeadm upgrade to $NEW_K8S_VERSION..."
+    
+    # Check if this is a control plane node (simple check for kube-apiserver manifest)
+    if [ -f /etc/kubernetes/manifests/kube-apiserver.yaml ]; then
+        kubeadm upgrade apply -y $NEW_K8S_VERSION
+    else
+        kubeadm upgrade node
+    fi
+    
+    echo "Upgrading kubelet and kubectl..."
+    download_file "${K8S_DOWNLOAD_URL}/kubelet" /usr/local/bin/kubelet
+    chmod +x /usr/local/bin/kubelet
+    
+    download_file "${K8S_DOWNLOAD_URL}/kubectl" /usr/local/bin/kubectl
+    chmod +x /usr/local/bin/kubectl
+
+else
+    echo "Running in OFFLINE mode, upgrading via binary bundle..."
+    
+    echo "Checking for local bundle..."
+    mkdir -p $BUNDLE_PATH
+
+    if [ -f "$BUNDLE_PATH/bin/kubeadm" ]; then
+        echo "Upgrading Kubernetes binaries from bundle..."
+        cp -f $BUNDLE_PATH/bin/* /usr/local/bin/
+        chmod +x /usr/local/bin/*
+    else
+        echo "Bundle not found. Downloading..."
+        pull_bundle $BUNDLE_ADDR $BUNDLE_PATH
+        cp -f $BUNDLE_PATH/bin/* /usr/local/bin/
+        chmod +x /usr/local/bin/*
+    fi
+    
+    # Determine version from new kubeadm
+    NEW_K8S_VERSION=$(kubeadm version -o short)
+    
+    echo "Applying kubeadm upgrade to $NEW_K8S_VERSION..."
+    
+    if [ -f /etc/kubernetes/manifests/kube-apiserver.yaml ]; then
+        kubeadm upgrade apply -y $NEW_K8S_VERSION
+    else
+        kubeadm upgrade node
+    fi
+fi
+
+echo "Restarting kubelet..."
+systemctl daemon-reload
+systemctl restart kubelet
+
+echo "Upgrade complete!"
+`
+)
@@ -4,15 +4,20 @@
 package algo
 
 import (
-	"bytes"
 	"context"
-	"fmt"
-	"html/template"
 )
 
 const (
 	// ImgpkgVersion defines the imgpkg version that will be installed on host if imgpkg is not already installed
 	ImgpkgVersion = "v0.36.4"
+	// DefaultImgpkgBaseURL defines where imgpkg releases are downloaded from unless the cluster points to a mirror
+	DefaultImgpkgBaseURL = "github.com/vmware-tanzu/carvel-imgpkg/releases/download"
+	// DefaultCNIPluginsVersion defines the CNI plugins version downloaded in online mode unless the cluster pins another one
+	DefaultCNIPluginsVersion = "v1.4.0"
+	// DefaultContainerdVersion defines the containerd version downloaded in online mode unless the installer config pins another one
+	DefaultContainerdVersion = "v1.7.0"
+	// DefaultRuncVersion defines the runc version downloaded in online mode unless the installer config pins another one
+	DefaultRuncVersion = "v1.1.10"
 )
 
 // Ubuntu20_04Installer represent the installer implementation for ubunto20.04.* os distribution
@@ -23,37 +28,8 @@ type Ubuntu20_04Installer struct {
 }
 
 // NewUbuntu20_04Installer will return new Ubuntu20_04Installer instance
-func NewUbuntu20_04Installer(ctx context.Context, arch, bundleAddrs, k8sVersion string, proxyConfig map[string]string) (*Ubuntu20_04Installer, error) {
-	parseFn := func(script string) (string, error) {
-		parser, err := template.New("parser").Parse(script)
-		if err != nil {
-			return "", fmt.Errorf("unable to parse install script")
-		}
-		var tpl bytes.Buffer
-		if err = parser.Execute(&tpl, map[string]string{
-			"BundleAddrs":        bundleAddrs,
-			"Arch":               arch,
-			"ImgpkgVersion":      ImgpkgVersion,
-			"BundleDownloadPath": "{{.BundleDownloadPath}}",
-			"K8sVersion":         k8sVersion,
-			"HttpProxy":          proxyConfig["http-proxy"],
-			"HttpsProxy":         proxyConfig["https-proxy"],
-			"NoProxy":            proxyConfig["no-proxy"],
-		}); err != nil {
-			return "", fmt.Errorf("unable to apply install parsed template to the data object")
-		}
-		return tpl.String(), nil
-	}
-
-	install, err := parseFn(DoUbuntu20_4K8s1_22)
-	if err != nil {
-		return nil, err
-	}
-	uninstall, err := parseFn(UndoUbuntu20_4K8s1_22)
-	if err != nil {
-		return nil, err
-	}
-	upgrade, err := parseFn(UpgradeUbuntu20_4K8s)
+func NewUbuntu20_04Installer(ctx context.Context, opts Options) (*Ubuntu20_04Installer, error) {
+	install, uninstall, upgrade, err := renderScripts(opts, DoUbuntu20_4K8s1_22, UndoUbuntu20_4K8s1_22, UpgradeUbuntu20_4K8s)
 	if err != nil {
 		return nil, err
 	}
@@ -83,7 +59,7 @@ func (s *Ubuntu20_04Installer) Upgrade() string {
 var (
 	DoUbuntu20_4K8s1_22 = `
 set -euox pipefail
-
+` + StepRetryFuncs + StepBundleCacheFuncs + StepContainerdConfigFuncs + StepKernelModulesFuncs + StepFirewallFuncs + `
 # Proxy configuration
 HTTP_PROXY_VAL="{{.HttpProxy}}"
 HTTPS_PROXY_VAL="{{.HttpsProxy}}"
@@ -103,10 +79,17 @@ fi
 
 
 BUNDLE_DOWNLOAD_PATH={{.BundleDownloadPath}}
+BUNDLE_CACHE_PATH="{{.BundleCachePath}}"
 BUNDLE_ADDR={{.BundleAddrs}}
 IMGPKG_VERSION={{.ImgpkgVersion}}
+IMGPKG_BASE_URL={{.ImgpkgBaseURL}}
 ARCH={{.Arch}}
 K8S_VERSION={{.K8sVersion}}
+CNI_PLUGINS_VERSION={{.CNIPluginsVersion}}
+REQUIRED_KERNEL_MODULES="{{.KernelModules}}"
+FIREWALL_MODE={{.FirewallMode}}
+FIREWALL_PORTS="{{.FirewallPorts}}"
+RUNTIME_HANDLERS="{{.RuntimeHandlers}}"
 BUNDLE_PATH=$BUNDLE_DOWNLOAD_PATH/$BUNDLE_ADDR
 
 
@@ -123,7 +106,7 @@ if ! command -v imgpkg >>/dev/null; then
 		dl_bin="curl -s -L"
 	fi
 	
-	$dl_bin github.com/vmware-tanzu/carvel-imgpkg/releases/download/$IMGPKG_VERSION/imgpkg-linux-$ARCH > /tmp/imgpkg
+	$dl_bin $IMGPKG_BASE_URL/$IMGPKG_VERSION/imgpkg-linux-$ARCH > /tmp/imgpkg
 	mv /tmp/imgpkg /usr/local/bin/imgpkg
 	chmod +x /usr/local/bin/imgpkg
 fi
@@ -141,22 +124,22 @@ if [ "$BUNDLE_ADDR" == "online" ]; then
     
     # Download kubeadm
     echo "Downloading kubeadm..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubeadm" -o /usr/local/bin/kubeadm
+    download_file "${K8S_DOWNLOAD_URL}/kubeadm" /usr/local/bin/kubeadm
     chmod +x /usr/local/bin/kubeadm
     
     # Download kubectl
     echo "Downloading kubectl..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubectl" -o /usr/local/bin/kubectl
+    download_file "${K8S_DOWNLOAD_URL}/kubectl" /usr/local/bin/kubectl
     chmod +x /usr/local/bin/kubectl
     
     # Download kubelet
     echo "Downloading kubelet..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubelet" -o /usr/local/bin/kubelet
+    download_file "${K8S_DOWNLOAD_URL}/kubelet" /usr/local/bin/kubelet
     chmod +x /usr/local/bin/kubelet
     
     # Download cri-tools (crictl)
     echo "Downloading cri-tools..."
-    curl -fsSL "https://github.com/kubernetes-sigs/cri-tools/releases/download/${CRI_TOOLS_VERSION}/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}.tar.gz" -o /tmp/crictl.tar.gz
+    download_file "https://github.com/kubernetes-sigs/cri-tools/releases/download/${CRI_TOOLS_VERSION}/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}.tar.gz" /tmp/crictl.tar.gz
     tar -xzf /tmp/crictl.tar.gz -C /tmp
     mv /tmp/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}/crictl /usr/local/bin/
     rm -rf /tmp/crictl.tar.gz /tmp/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}
@@ -164,21 +147,21 @@ if [ "$BUNDLE_ADDR" == "online" ]; then
     # Download CNI plugins
     echo "Downloading CNI plugins..."
     mkdir -p /opt/cni/bin
-    curl -fsSL "https://github.com/containernetworking/plugins/releases/download/v1.4.0/cni-plugins-linux-${ARCH}-v1.4.0.tgz" -o /tmp/cni-plugins.tgz
+    download_file "https://github.com/containernetworking/plugins/releases/download/${CNI_PLUGINS_VERSION}/cni-plugins-linux-${ARCH}-${CNI_PLUGINS_VERSION}.tgz" /tmp/cni-plugins.tgz
     tar -xzf /tmp/cni-plugins.tgz -C /opt/cni/bin/
     rm /tmp/cni-plugins.tgz
     
     # Download containerd and runc binaries
     echo "Downloading containerd..."
-    CONTAINERD_VERSION="v1.7.0"
+    CONTAINERD_VERSION="{{.ContainerdVersion}}"
     CONTAINERD_URL="https://github.com/containerd/containerd/releases/download/${CONTAINERD_VERSION}/containerd-${CONTAINERD_VERSION}-linux-${ARCH}.tar.gz"
-    curl -fsSL "$CONTAINERD_URL" -o /tmp/containerd.tar.gz
+    download_file "$CONTAINERD_URL" /tmp/containerd.tar.gz
     tar -xzf /tmp/containerd.tar.gz -C /usr/local/
     rm /tmp/containerd.tar.gz
     
     echo "Downloading runc..."
-    RUNC_VERSION="v1.1.10"
-    curl -fsSL "https://github.com/opencontainers/runc/releases/download/${RUNC_VERSION}/runc.${ARCH}" -o /usr/local/bin/runc
+    RUNC_VERSION="{{.RuncVersion}}"
+    download_file "https://github.com/opencontainers/runc/releases/download/${RUNC_VERSION}/runc.${ARCH}" /usr/local/bin/runc
     chmod +x /usr/local/bin/runc
     
     # Create dummy bundle path for subsequent logic compatibility
@@ -195,7 +178,7 @@ else
         echo "Local binary bundle found. Skipping download."
     else
         echo "Local bundle not found or incomplete. Downloading..."
-        imgpkg pull -i $BUNDLE_ADDR -o $BUNDLE_PATH
+        pull_bundle $BUNDLE_ADDR $BUNDLE_PATH
     fi
     
     # Extract and install Kubernetes binaries
@@ -222,25 +205,31 @@ fi
 ## disable swap
 swapoff -a && sed -ri '/\sswap\s/s/^#?/#/' /etc/fstab
 
-## disable firewall
-if command -v ufw >>/dev/null; then
-	ufw disable
-fi
+## configure firewall
+configure_firewall "$FIREWALL_MODE" $FIREWALL_PORTS
 
 ## load kernal modules
-modprobe overlay && modprobe br_netfilter
+load_kernel_modules overlay br_netfilter $REQUIRED_KERNEL_MODULES
+if [ -n "$REQUIRED_KERNEL_MODULES" ]; then
+    printf '%s\n' $REQUIRED_KERNEL_MODULES > /etc/modules-load.d/byoh-required-modules.conf
+fi
 
 ## adding os configuration
 if [ -f "$BUNDLE_PATH/conf.tar" ]; then
     tar -C / -xvf "$BUNDLE_PATH/conf.tar" && sysctl --system 
 fi
 
+## adding the additional containerd runtime handlers, e.g. gVisor or Kata Containers
+if [ -n "$RUNTIME_HANDLERS" ]; then
+    configure_runtime_handlers /etc/containerd/config.toml $RUNTIME_HANDLERS
+fi
+
 ## starting containerd service
 systemctl daemon-reload && systemctl enable containerd && systemctl start containerd`
 
 	UndoUbuntu20_4K8s1_22 = `
 set -euox pipefail
-
+` + StepFirewallFuncs + `
 # Proxy configuration
 HTTP_PROXY_VAL="{{.HttpProxy}}"
 HTTPS_PROXY_VAL="{{.HttpsProxy}}"
@@ -304,11 +293,10 @@ fi
 
 ## remove kernal modules
 modprobe -rq overlay && modprobe -r br_netfilter || true
+rm -f /etc/modules-load.d/byoh-required-modules.conf
 
-## enable firewall
-if command -v ufw >>/dev/null; then
-	ufw enable
-fi
+## restore firewall
+restore_firewall
 
 ## enable swap
 swapon -a && sed -ri '/\sswap\s/s/^#?//' /etc/fstab
@@ -317,7 +305,7 @@ rm -rf $BUNDLE_PATH`
 
 	UpgradeUbuntu20_4K8s = `
 set -euox pipefail
-
+` + StepRetryFuncs + StepBundleCacheFuncs + `
 # Proxy configuration
 HTTP_PROXY_VAL="{{.HttpProxy}}"
 HTTPS_PROXY_VAL="{{.HttpsProxy}}"
@@ -337,6 +325,7 @@ fi
 
 
 BUNDLE_DOWNLOAD_PATH={{.BundleDownloadPath}}
+BUNDLE_CACHE_PATH="{{.BundleCachePath}}"
 BUNDLE_ADDR={{.BundleAddrs}}
 ARCH={{.Arch}}
 K8S_VERSION={{.K8sVersion}}
@@ -350,7 +339,7 @@ if [ "$BUNDLE_ADDR" == "online" ]; then
     K8S_DOWNLOAD_URL="https://dl.k8s.io/${K8S_VERSION}/bin/linux/${ARCH}"
     
     echo "Upgrading kubeadm..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubeadm" -o /usr/local/bin/kubeadm
+    download_file "${K8S_DOWNLOAD_URL}/kubeadm" /usr/local/bin/kubeadm
     chmod +x /usr/local/bin/kubeadm
     
     # Determine version from new kubeadm
@@ -365,10 +354,10 @@ if [ "$BUNDLE_ADDR" == "online" ]; then
     fi
     
     echo "Upgrading kubelet and kubectl..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubelet" -o /usr/local/bin/kubelet
+    download_file "${K8S_DOWNLOAD_URL}/kubelet" /usr/local/bin/kubelet
     chmod +x /usr/local/bin/kubelet
     
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubectl" -o /usr/local/bin/kubectl
+    download_file "${K8S_DOWNLOAD_URL}/kubectl" /usr/local/bin/kubectl
     chmod +x /usr/local/bin/kubectl
 
 else
@@ -383,7 +372,7 @@ else
         chmod +x /usr/local/bin/*
     else
         echo "Bundle not found. Downloading..."
-        imgpkg pull -i $BUNDLE_ADDR -o $BUNDLE_PATH
+        pull_bundle $BUNDLE_ADDR $BUNDLE_PATH
         cp -f $BUNDLE_PATH/bin/* /usr/local/bin/
         chmod +x /usr/local/bin/*
     fi
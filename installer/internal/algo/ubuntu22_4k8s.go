@@ -4,10 +4,7 @@
 package algo
 
 import (
-	"bytes"
 	"context"
-	"fmt"
-	"html/template"
 )
 
 // Ubuntu22_04Installer represent the installer implementation for ubunto22.04.* os distribution
@@ -18,37 +15,8 @@ type Ubuntu22_04Installer struct {
 }
 
 // NewUbuntu22_04Installer will return new Ubuntu22_04Installer instance
-func NewUbuntu22_04Installer(ctx context.Context, arch, bundleAddrs, k8sVersion string, proxyConfig map[string]string) (*Ubuntu22_04Installer, error) {
-	parseFn := func(script string) (string, error) {
-		parser, err := template.New("parser").Parse(script)
-		if err != nil {
-			return "", fmt.Errorf("unable to parse install script")
-		}
-		var tpl bytes.Buffer
-		if err = parser.Execute(&tpl, map[string]string{
-			"BundleAddrs":        bundleAddrs,
-			"Arch":               arch,
-			"ImgpkgVersion":      ImgpkgVersion,
-			"BundleDownloadPath": "{{.BundleDownloadPath}}",
-			"K8sVersion":         k8sVersion,
-			"HttpProxy":          proxyConfig["http-proxy"],
-			"HttpsProxy":         proxyConfig["https-proxy"],
-			"NoProxy":            proxyConfig["no-proxy"],
-		}); err != nil {
-			return "", fmt.Errorf("unable to apply install parsed template to the data object")
-		}
-		return tpl.String(), nil
-	}
-
-	install, err := parseFn(DoUbuntu22_4K8s)
-	if err != nil {
-		return nil, err
-	}
-	uninstall, err := parseFn(UndoUbuntu22_4K8s)
-	if err != nil {
-		return nil, err
-	}
-	upgrade, err := parseFn(UpgradeUbuntu22_4K8s)
+func NewUbuntu22_04Installer(ctx context.Context, opts Options) (*Ubuntu22_04Installer, error) {
+	install, uninstall, upgrade, err := renderScripts(opts, DoUbuntu22_4K8s, UndoUbuntu22_4K8s, UpgradeUbuntu22_4K8s)
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +46,7 @@ func (s *Ubuntu22_04Installer) Upgrade() string {
 var (
 	DoUbuntu22_4K8s = `
 set -euox pipefail
-
+` + StepRetryFuncs + StepBundleCacheFuncs + StepContainerdConfigFuncs + StepKernelModulesFuncs + StepFirewallFuncs + `
 # Proxy configuration
 HTTP_PROXY_VAL="{{.HttpProxy}}"
 HTTPS_PROXY_VAL="{{.HttpsProxy}}"
@@ -100,10 +68,17 @@ fi
 trap 'echo "Installation failed. Collecting logs..."; journalctl -u kubelet --no-pager | tail -n 100; cat /var/log/byoh-agent.log || true' ERR
 
 BUNDLE_DOWNLOAD_PATH={{.BundleDownloadPath}}
+BUNDLE_CACHE_PATH="{{.BundleCachePath}}"
 BUNDLE_ADDR={{.BundleAddrs}}
 IMGPKG_VERSION={{.ImgpkgVersion}}
+IMGPKG_BASE_URL={{.ImgpkgBaseURL}}
 ARCH={{.Arch}}
 K8S_VERSION={{.K8sVersion}}
+CNI_PLUGINS_VERSION={{.CNIPluginsVersion}}
+REQUIRED_KERNEL_MODULES="{{.KernelModules}}"
+FIREWALL_MODE={{.FirewallMode}}
+FIREWALL_PORTS="{{.FirewallPorts}}"
+RUNTIME_HANDLERS="{{.RuntimeHandlers}}"
 BUNDLE_PATH=$BUNDLE_DOWNLOAD_PATH/$BUNDLE_ADDR
 
 
@@ -120,7 +95,7 @@ if ! command -v imgpkg >>/dev/null; then
 		dl_bin="curl -s -L"
 	fi
 	
-	$dl_bin github.com/vmware-tanzu/carvel-imgpkg/releases/download/$IMGPKG_VERSION/imgpkg-linux-$ARCH > /tmp/imgpkg
+	$dl_bin $IMGPKG_BASE_URL/$IMGPKG_VERSION/imgpkg-linux-$ARCH > /tmp/imgpkg
 	mv /tmp/imgpkg /usr/local/bin/imgpkg
 	chmod +x /usr/local/bin/imgpkg
 fi
@@ -138,22 +113,22 @@ if [ "$BUNDLE_ADDR" == "online" ]; then
     
     # Download kubeadm
     echo "Downloading kubeadm..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubeadm" -o /usr/local/bin/kubeadm
+    download_file "${K8S_DOWNLOAD_URL}/kubeadm" /usr/local/bin/kubeadm
     chmod +x /usr/local/bin/kubeadm
     
     # Download kubectl
     echo "Downloading kubectl..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubectl" -o /usr/local/bin/kubectl
+    download_file "${K8S_DOWNLOAD_URL}/kubectl" /usr/local/bin/kubectl
     chmod +x /usr/local/bin/kubectl
     
     # Download kubelet
     echo "Downloading kubelet..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubelet" -o /usr/local/bin/kubelet
+    download_file "${K8S_DOWNLOAD_URL}/kubelet" /usr/local/bin/kubelet
     chmod +x /usr/local/bin/kubelet
     
     # Download cri-tools (crictl)
     echo "Downloading cri-tools..."
-    curl -fsSL "https://github.com/kubernetes-sigs/cri-tools/releases/download/${CRI_TOOLS_VERSION}/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}.tar.gz" -o /tmp/crictl.tar.gz
+    download_file "https://github.com/kubernetes-sigs/cri-tools/releases/download/${CRI_TOOLS_VERSION}/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}.tar.gz" /tmp/crictl.tar.gz
     tar -xzf /tmp/crictl.tar.gz -C /tmp
     mv /tmp/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}/crictl /usr/local/bin/
     rm -rf /tmp/crictl.tar.gz /tmp/crictl-${CRI_TOOLS_VERSION}-linux-${ARCH}
@@ -161,21 +136,21 @@ if [ "$BUNDLE_ADDR" == "online" ]; then
     # Download CNI plugins
     echo "Downloading CNI plugins..."
     mkdir -p /opt/cni/bin
-    curl -fsSL "https://github.com/containernetworking/plugins/releases/download/v1.4.0/cni-plugins-linux-${ARCH}-v1.4.0.tgz" -o /tmp/cni-plugins.tgz
+    download_file "https://github.com/containernetworking/plugins/releases/download/${CNI_PLUGINS_VERSION}/cni-plugins-linux-${ARCH}-${CNI_PLUGINS_VERSION}.tgz" /tmp/cni-plugins.tgz
     tar -xzf /tmp/cni-plugins.tgz -C /opt/cni/bin/
     rm /tmp/cni-plugins.tgz
     
     # Download containerd and runc binaries
     echo "Downloading containerd..."
-    CONTAINERD_VERSION="v1.7.0"
+    CONTAINERD_VERSION="{{.ContainerdVersion}}"
     CONTAINERD_URL="https://github.com/containerd/containerd/releases/download/${CONTAINERD_VERSION}/containerd-${CONTAINERD_VERSION}-linux-${ARCH}.tar.gz"
-    curl -fsSL "$CONTAINERD_URL" -o /tmp/containerd.tar.gz
+    download_file "$CONTAINERD_URL" /tmp/containerd.tar.gz
     tar -xzf /tmp/containerd.tar.gz -C /usr/local/
     rm /tmp/containerd.tar.gz
     
     echo "Downloading runc..."
-    RUNC_VERSION="v1.1.10"
-    curl -fsSL "https://github.com/opencontainers/runc/releases/download/${RUNC_VERSION}/runc.${ARCH}" -o /usr/local/bin/runc
+    RUNC_VERSION="{{.RuncVersion}}"
+    download_file "https://github.com/opencontainers/runc/releases/download/${RUNC_VERSION}/runc.${ARCH}" /usr/local/bin/runc
     chmod +x /usr/local/bin/runc
     
     # Create dummy bundle path for subsequent logic compatibility
@@ -192,7 +167,7 @@ else
         echo "Local binary bundle found. Skipping download."
     else
         echo "Local bundle not found or incomplete. Downloading..."
-        imgpkg pull -i $BUNDLE_ADDR -o $BUNDLE_PATH
+        pull_bundle $BUNDLE_ADDR $BUNDLE_PATH
     fi
     
     # Extract and install Kubernetes binaries
@@ -226,10 +201,8 @@ fi
 ## disable swap
 swapoff -a && sed -ri '/\sswap\s/s/^#?/#/' /etc/fstab
 
-## disable firewall
-if command -v ufw >>/dev/null; then
-	ufw disable
-fi
+## configure firewall
+configure_firewall "$FIREWALL_MODE" $FIREWALL_PORTS
 
 ## ensure iptables is installed (required for kube-proxy)
 if ! command -v iptables >>/dev/null; then
@@ -238,24 +211,30 @@ if ! command -v iptables >>/dev/null; then
 fi
 
 ## load kernal modules
-modprobe overlay && modprobe br_netfilter
+load_kernel_modules overlay br_netfilter $REQUIRED_KERNEL_MODULES
+if [ -n "$REQUIRED_KERNEL_MODULES" ]; then
+    printf '%s\n' $REQUIRED_KERNEL_MODULES > /etc/modules-load.d/byoh-required-modules.conf
+fi
 
 ## adding os configuration
 if [ -f "$BUNDLE_PATH/conf.tar" ]; then
     tar -C / -xvf "$BUNDLE_PATH/conf.tar" && sysctl --system 
 fi
 
-## configuring containerd with SystemdCgroup = true (required for cgroup v2)
-mkdir -p /etc/containerd
-containerd config default > /etc/containerd/config.toml
-sed -i 's/SystemdCgroup = false/SystemdCgroup = true/' /etc/containerd/config.toml
+## configuring containerd with SystemdCgroup = true (required for cgroup v2), keeping an existing config
+configure_containerd /etc/containerd/config.toml
+
+## adding the additional containerd runtime handlers, e.g. gVisor or Kata Containers
+if [ -n "$RUNTIME_HANDLERS" ]; then
+    configure_runtime_handlers /etc/containerd/config.toml $RUNTIME_HANDLERS
+fi
 
 ## starting containerd service
 systemctl daemon-reload && systemctl enable containerd && systemctl start containerd`
 
 	UndoUbuntu22_4K8s = `
 set -euox pipefail
-
+` + StepFirewallFuncs + `
 # Proxy configuration
 HTTP_PROXY_VAL="{{.HttpProxy}}"
 HTTPS_PROXY_VAL="{{.HttpsProxy}}"
@@ -316,11 +295,10 @@ tar tf "$BUNDLE_PATH/conf.tar" | xargs -n 1 echo '/' | sed 's/ //g' | grep -e "[
 
 ## remove kernal modules
 modprobe -rq overlay && modprobe -r br_netfilter || true
+rm -f /etc/modules-load.d/byoh-required-modules.conf
 
-## enable firewall
-if command -v ufw >>/dev/null; then
-	ufw enable
-fi
+## restore firewall
+restore_firewall
 
 ## enable swap
 swapon -a && sed -ri '/\sswap\s/s/^#?//' /etc/fstab
@@ -329,7 +307,7 @@ rm -rf $BUNDLE_PATH`
 
 	UpgradeUbuntu22_4K8s = `
 set -euox pipefail
-
+` + StepRetryFuncs + StepBundleCacheFuncs + `
 # Proxy configuration
 HTTP_PROXY_VAL="{{.HttpProxy}}"
 HTTPS_PROXY_VAL="{{.HttpsProxy}}"
@@ -348,6 +326,7 @@ if [ -n "$NO_PROXY_VAL" ]; then
 fi
 
 BUNDLE_DOWNLOAD_PATH={{.BundleDownloadPath}}
+BUNDLE_CACHE_PATH="{{.BundleCachePath}}"
 BUNDLE_ADDR={{.BundleAddrs}}
 ARCH={{.Arch}}
 K8S_VERSION={{.K8sVersion}}
@@ -361,7 +340,7 @@ if [ "$BUNDLE_ADDR" == "online" ]; then
     K8S_DOWNLOAD_URL="https://dl.k8s.io/${K8S_VERSION}/bin/linux/${ARCH}"
     
     echo "Upgrading kubeadm..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubeadm" -o /usr/local/bin/kubeadm
+    download_file "${K8S_DOWNLOAD_URL}/kubeadm" /usr/local/bin/kubeadm
     chmod +x /usr/local/bin/kubeadm
     
     # Determine version from new kubeadm
@@ -376,10 +355,10 @@ if [ "$BUNDLE_ADDR" == "online" ]; then
     fi
     
     echo "Upgrading kubelet and kubectl..."
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubelet" -o /usr/local/bin/kubelet
+    download_file "${K8S_DOWNLOAD_URL}/kubelet" /usr/local/bin/kubelet
     chmod +x /usr/local/bin/kubelet
     
-    curl -fsSL "${K8S_DOWNLOAD_URL}/kubectl" -o /usr/local/bin/kubectl
+    download_file "${K8S_DOWNLOAD_URL}/kubectl" /usr/local/bin/kubectl
     chmod +x /usr/local/bin/kubectl
 
 else
@@ -394,7 +373,7 @@ else
         chmod +x /usr/local/bin/*
     else
         echo "Bundle not found. Downloading..."
-        imgpkg pull -i $BUNDLE_ADDR -o $BUNDLE_PATH
+        pull_bundle $BUNDLE_ADDR $BUNDLE_PATH
         cp -f $BUNDLE_PATH/bin/* /usr/local/bin/
         chmod +x /usr/local/bin/*
     fi
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 )
 
 // ErrBundleInstallerAlreadyExists is returned when a bundle installer already exists
@@ -111,6 +112,21 @@ func (r *registry) ResolveOsToOsBundle(os string) string {
 	return ""
 }
 
+// ResolveK8sFilter returns the k8s version filter of the OS bundle matching the k8s version, e.g. v1.29.*
+// for v1.29.3, or an empty string when none matches
+func (r *registry) ResolveK8sFilter(osBundle, k8sVersion string) string {
+	k8sFilters := r.ListK8s(osBundle)
+	sort.Strings(k8sFilters)
+	for _, k8sFilter := range k8sFilters {
+		matched, _ := regexp.MatchString("^"+k8sFilter+"$", k8sVersion)
+		if matched {
+			return k8sFilter
+		}
+	}
+
+	return ""
+}
+
 // GetSupportedRegistry returns a registry with installers for the supported OS and K8s
 func GetSupportedRegistry() registry {
 	reg := newRegistry()
@@ -178,6 +194,21 @@ func GetSupportedRegistry() registry {
 		reg.AddOsFilter("Ubuntu_22.04.*_aarch64", linuxDistro22Arm)
 	}
 
+	{
+		// RHEL
+
+		// Red Hat Enterprise Linux 9, its rebuild Rocky Linux 9 and its upstream CentOS Stream 9 share a bundle
+		linuxDistroRHEL9 := "RHEL_9_x86-64"
+		for i := 27; i <= 35; i++ {
+			version := fmt.Sprintf("v1.%d.*", i)
+			addBundle(linuxDistroRHEL9, version)
+			reg.AddK8sFilter(version)
+		}
+		reg.AddOsFilter("Red_Hat_Enterprise_Linux_9.*_x86-64", linuxDistroRHEL9)
+		reg.AddOsFilter("Rocky_Linux_9.*_x86-64", linuxDistroRHEL9)
+		reg.AddOsFilter("CentOS_Stream_9.*_x86-64", linuxDistroRHEL9)
+	}
+
 	/*
 	 * PLACEHOLDER - ADD MORE OS HERE
 	 */
@@ -126,5 +126,21 @@ var _ = Describe("Byohost Installer Tests", func() {
 			Expect(osBundleResult24).To(ContainElements("v1.27.*", "v1.28.*", "v1.29.*", "v1.30.*", "v1.31.*", "v1.32.*", "v1.33.*", "v1.34.*", "v1.35.*"))
 			Expect(osBundleResult24).To(HaveLen(9))
 		})
+
+		It("Should resolve RHEL 9, Rocky Linux 9 and CentOS Stream 9 to the RHEL 9 bundle", func() {
+			for _, osDist := range []string{
+				"Red_Hat_Enterprise_Linux_9.3_(Plow)_x86-64",
+				"Rocky_Linux_9.4_(Blue_Onyx)_x86-64",
+				"CentOS_Stream_9_x86-64",
+			} {
+				Expect(r.ResolveOsToOsBundle(osDist)).To(Equal("RHEL_9_x86-64"), osDist)
+				Expect(r.ListK8s(osDist)).To(HaveLen(9), osDist)
+			}
+			Expect(r.ResolveOsToOsBundle("Red_Hat_Enterprise_Linux_8.9_(Ootpa)_x86-64")).To(Equal(""))
+
+			osBundleResult := r.ListK8s("Rocky_Linux_9.4_(Blue_Onyx)_x86-64")
+			Expect(osBundleResult).To(ContainElements("v1.27.*", "v1.30.*", "v1.35.*"))
+			Expect(osBundleResult).To(HaveLen(9))
+		})
 	})
 })
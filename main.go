@@ -6,7 +6,10 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -26,6 +29,9 @@ import (
 	byohcontrollers "github.com/mensylisir/cluster-api-provider-bringyourownhost/controllers/infrastructure"
 
 	infrastructurev1beta1 "github.com/mensylisir/cluster-api-provider-bringyourownhost/apis/infrastructure/v1beta1"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common/bootstrapsecret"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common/bootstraptoken"
+	"github.com/mensylisir/cluster-api-provider-bringyourownhost/common/kubeletconfig"
 
 	//+kubebuilder:scaffold:imports
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
@@ -39,6 +45,31 @@ var (
 	metricsAddr          string
 	enableLeaderElection bool
 	probeAddr            string
+
+	kubeletHealthzBindAddress string
+	kubeletHealthzPort        int
+	kubeletEvictionHard       string
+
+	bootstrapTokenUsages     string
+	hostBootstrapTokenGroups string
+	nodeBootstrapTokenGroups string
+	bootstrapSecretKeys      string
+
+	enableHostInventory bool
+
+	csrApprovalWarningThreshold time.Duration
+	csrByoHostNamespace         string
+
+	remoteClientRetries int
+	remoteClientTimeout time.Duration
+
+	byoMachineDeletionTimeout time.Duration
+	cordonTimeout             time.Duration
+
+	hostLeaseTimeout     time.Duration
+	hostAttachMaxRetries int
+
+	forceCleanupConfirmationWindow time.Duration
 )
 
 func init() {
@@ -59,6 +90,42 @@ func setFlags() {
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&kubeletHealthzBindAddress, "kubelet-healthz-bind-address", kubeletconfig.DefaultHealthzBindAddress,
+		"The address the kubelet healthz endpoint binds to in the generated default kubelet configuration.")
+	flag.IntVar(&kubeletHealthzPort, "kubelet-healthz-port", kubeletconfig.DefaultHealthzPort,
+		"The port of the kubelet healthz endpoint in the generated default kubelet configuration.")
+	flag.StringVar(&kubeletEvictionHard, "kubelet-eviction-hard", "",
+		"Comma separated hard eviction thresholds, e.g. memory.available=200Mi,nodefs.available=5%, overriding the ones of the generated default kubelet configuration.")
+	flag.StringVar(&bootstrapTokenUsages, "bootstrap-token-usages", "",
+		"Comma separated usages of the generated bootstrap tokens, e.g. authentication. Defaults to signing,authentication.")
+	flag.StringVar(&hostBootstrapTokenGroups, "host-bootstrap-token-groups", "",
+		"Comma separated groups, prefixed with system:bootstrappers:, of the bootstrap tokens hosts register with. Defaults to "+infrastructurev1beta1.BootstrapTokenExtraGroups+".")
+	flag.StringVar(&nodeBootstrapTokenGroups, "node-bootstrap-token-groups", "",
+		"Comma separated groups, prefixed with system:bootstrappers:, of the bootstrap tokens kubelet joins the workload cluster with in TLS Bootstrap mode. Defaults to "+infrastructurev1beta1.BootstrapTokenExtraGroups+".")
+	flag.StringVar(&bootstrapSecretKeys, "bootstrap-secret-keys", "",
+		"Comma separated artifact=key mappings of the keys the bootstrap data secret of a Machine stores the artifacts of TLS Bootstrap mode under, "+
+			"e.g. ca.crt=ca,bootstrap-kubeconfig=kubeconfig, for bootstrap providers with another layout. "+
+			"The artifacts are value, ca.crt, bootstrap-kubeconfig, kubelet-config.yaml and kube-proxy.kubeconfig, read from their own key when not mapped.")
+	flag.BoolVar(&enableHostInventory, "enable-host-inventory", false,
+		"Serve a read-only JSON inventory of the ByoHosts on the metrics endpoint at "+byohcontrollers.HostInventoryPath+".")
+	flag.IntVar(&remoteClientRetries, "remote-client-retries", byohcontrollers.DefaultRemoteClientRetries,
+		"The number of times a ByoMachine is requeued with backoff when acquiring a workload cluster client fails, before the cluster is reported as not reachable.")
+	flag.DurationVar(&remoteClientTimeout, "remote-client-timeout", 30*time.Second,
+		"The maximum time a reconcile spends acquiring a workload cluster client. Set to 0 for no limit.")
+	flag.DurationVar(&byoMachineDeletionTimeout, "byomachine-deletion-timeout", byohcontrollers.DefaultDeletionTimeout,
+		"The maximum time the deletion of a ByoMachine waits for the cleanup of its host before its finalizer is removed regardless. Set to 0 for no limit.")
+	flag.DurationVar(&cordonTimeout, "cordon-timeout", byohcontrollers.DefaultCordonTimeout,
+		"The maximum time the cleanup of a host spends acquiring a workload cluster client to cordon its node before it is requeued.")
+	flag.DurationVar(&hostLeaseTimeout, "host-lease-timeout", byohcontrollers.DefaultHostLeaseTimeout,
+		"The time a ByoMachine holds the lease on the ByoHost it attaches before another ByoMachine may claim the host.")
+	flag.IntVar(&hostAttachMaxRetries, "host-attach-max-retries", byohcontrollers.DefaultHostAttachMaxRetries,
+		"The number of ByoHosts a ByoMachine tries to claim in a reconcile before it requeues.")
+	flag.DurationVar(&forceCleanupConfirmationWindow, "force-cleanup-confirmation-window", byohcontrollers.DefaultForceCleanupConfirmationWindow,
+		"The time the agent still gets to show activity, e.g. a heartbeat, once the cleanup timeout of a ByoHost is exceeded, before its Node is force deleted. Keep it above the --heartbeat-period of the agents. Set to 0 to force the cleanup right away.")
+	flag.DurationVar(&csrApprovalWarningThreshold, "csr-approval-warning-threshold", time.Minute,
+		"Emit a warning event on CSRs approved later than this after their creation. Set to 0 to disable.")
+	flag.StringVar(&csrByoHostNamespace, "csr-byohost-namespace", "",
+		"Namespace the ByoHosts backing the nodes requesting kubelet certificates are looked up in. All namespaces are searched when empty.")
 	flag.Parse()
 }
 
@@ -71,6 +138,33 @@ func main() {
 	setFlags()
 	ctrl.SetLogger(klogr.New())
 
+	evictionHard, err := kubeletconfig.ParseEvictionHard(kubeletEvictionHard)
+	if err != nil {
+		setupLog.Error(err, "invalid kubelet eviction thresholds")
+		os.Exit(1)
+	}
+	secretKeys, err := bootstrapsecret.ParseKeyMap(bootstrapSecretKeys)
+	if err != nil {
+		setupLog.Error(err, "invalid bootstrap secret keys")
+		os.Exit(1)
+	}
+	if hostLeaseTimeout <= 0 {
+		setupLog.Error(fmt.Errorf("%s is not positive", hostLeaseTimeout), "invalid host lease timeout")
+		os.Exit(1)
+	}
+	if hostAttachMaxRetries < 1 {
+		setupLog.Error(fmt.Errorf("%d is less than 1", hostAttachMaxRetries), "invalid host attach max retries")
+		os.Exit(1)
+	}
+	hostTokenOptions := bootstraptoken.Options{Usages: splitList(bootstrapTokenUsages), ExtraGroups: splitList(hostBootstrapTokenGroups)}
+	nodeTokenOptions := bootstraptoken.Options{Usages: splitList(bootstrapTokenUsages), ExtraGroups: splitList(nodeBootstrapTokenGroups)}
+	for _, opts := range []bootstraptoken.Options{hostTokenOptions, nodeTokenOptions} {
+		if err := opts.Validate(); err != nil {
+			setupLog.Error(err, "invalid bootstrap token options")
+			os.Exit(1)
+		}
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -100,18 +194,41 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err = byohcontrollers.IndexByoHostByName(context.TODO(), mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "unable to index the ByoHosts by name")
+		os.Exit(1)
+	}
+	if err = byohcontrollers.IndexByoHostByMachineUID(context.TODO(), mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "unable to index the ByoHosts by the UID of their ByoMachine")
+		os.Exit(1)
+	}
+
 	if err = (&byohcontrollers.ByoMachineReconciler{
 		Client:   mgr.GetClient(),
 		Scheme:   mgr.GetScheme(),
 		Tracker:  tracker,
 		Recorder: mgr.GetEventRecorderFor("byomachine-controller"),
+
+		RemoteClientRetries:  remoteClientRetries,
+		RemoteClientTimeout:  remoteClientTimeout,
+		DeletionTimeout:      byoMachineDeletionTimeout,
+		CordonTimeout:        cordonTimeout,
+		HostLeaseTimeout:     hostLeaseTimeout,
+		HostAttachMaxRetries: hostAttachMaxRetries,
+
+		KubeletHealthzBindAddress: kubeletHealthzBindAddress,
+		KubeletHealthzPort:        int32(kubeletHealthzPort),
+		KubeletEvictionHard:       evictionHard,
+		BootstrapTokenOptions:     nodeTokenOptions,
+		BootstrapSecretKeys:       secretKeys,
 	}).SetupWithManager(context.TODO(), mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ByoMachine")
 		os.Exit(1)
 	}
 	if err = (&byohcontrollers.ByoHostReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                         mgr.GetClient(),
+		Scheme:                         mgr.GetScheme(),
+		ForceCleanupConfirmationWindow: forceCleanupConfirmationWindow,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ByoHost")
 		os.Exit(1)
@@ -134,7 +251,11 @@ func main() {
 	// Set 'MANUAL_CSR_APPROVAL=enable' to disable ByoAdmission controller. Now CSRs should be approved manually.
 	if os.Getenv("MANUAL_CSR_APPROVAL") != "enable" {
 		if err = (&byohcontrollers.ByoAdmissionReconciler{
-			ClientSet: clientset.NewForConfigOrDie(ctrl.GetConfigOrDie()),
+			ClientSet:             clientset.NewForConfigOrDie(ctrl.GetConfigOrDie()),
+			Client:                mgr.GetClient(),
+			Recorder:              mgr.GetEventRecorderFor("byoadmission-controller"),
+			SlowApprovalThreshold: csrApprovalWarningThreshold,
+			Namespace:             csrByoHostNamespace,
 		}).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "ByoAdmission")
 			os.Exit(1)
@@ -145,17 +266,29 @@ func main() {
 		os.Exit(1)
 	}
 
-	mgr.GetWebhookServer().Register("/validate-infrastructure-cluster-x-k8s-io-v1beta1-byohost", &webhook.Admission{Handler: &infrastructurev1beta1.ByoHostValidator{}})
+	mgr.GetWebhookServer().Register("/validate-infrastructure-cluster-x-k8s-io-v1beta1-byohost", &webhook.Admission{Handler: &infrastructurev1beta1.ByoHostValidator{Client: mgr.GetClient()}})
+	mgr.GetWebhookServer().Register("/validate-infrastructure-cluster-x-k8s-io-v1beta1-byohost-status", &webhook.Admission{Handler: &infrastructurev1beta1.ByoHostValidator{Client: mgr.GetClient()}})
+	mgr.GetWebhookServer().Register("/validate-v1-configmap-host-facts", &webhook.Admission{Handler: &infrastructurev1beta1.HostFactsValidator{}})
+	mgr.GetWebhookServer().Register("/validate-infrastructure-cluster-x-k8s-io-v1beta1-byomachine", &webhook.Admission{Handler: &infrastructurev1beta1.ByoMachineValidator{Client: mgr.GetClient()}})
+	mgr.GetWebhookServer().Register("/mutate-infrastructure-cluster-x-k8s-io-v1beta1-byomachine", &webhook.Admission{Handler: &infrastructurev1beta1.ByoMachineMutator{}})
 
 	if err = (&byohcontrollers.BootstrapKubeconfigReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		TokenOptions: hostTokenOptions,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "BootstrapKubeconfig")
 		os.Exit(1)
 	}
 	//+kubebuilder:scaffold:builder
 
+	if enableHostInventory {
+		if err := mgr.AddMetricsExtraHandler(byohcontrollers.HostInventoryPath, byohcontrollers.NewHostInventoryHandler(mgr.GetClient())); err != nil {
+			setupLog.Error(err, "unable to set up host inventory endpoint")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -175,3 +308,14 @@ func main() {
 func concurrency(c int) controller.Options {
 	return controller.Options{MaxConcurrentReconciles: c}
 }
+
+// splitList splits a comma separated flag value, ignoring empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}